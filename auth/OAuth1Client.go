@@ -5,7 +5,6 @@ import (
 	"crypto/sha1"
 	"encoding/base64"
 	"encoding/json"
-	"io/ioutil"
 	"net/http"
 	"net/url"
 	"sort"
@@ -62,14 +61,7 @@ func (o *OAuth) Post(path string, params map[string]string, body map[string]stri
 
 // Send ...
 func (o *OAuth) Send(req *http.Request) (types.M, error) {
-	client := http.DefaultClient
-	response, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer response.Body.Close()
-
-	body, err := ioutil.ReadAll(response.Body)
+	body, err := doRequest(req)
 	if err != nil {
 		return nil, err
 	}
@@ -82,7 +74,9 @@ func (o *OAuth) Send(req *http.Request) (types.M, error) {
 	return result, nil
 }
 
+// buildRequest 组装请求并签名，签名使用不含查询参数的完整地址
 func (o *OAuth) buildRequest(method, path string, params, body map[string]string) (*http.Request, error) {
+	baseURL := o.Host + path
 	if len(params) > 0 {
 		path = path + "?" + buildParameterString(params)
 	}
@@ -107,7 +101,7 @@ func (o *OAuth) buildRequest(method, path string, params, body map[string]string
 		oauthParams["oauth_token"] = o.AuthToken
 	}
 
-	request = signRequest(request, oauthParams, o.ConsumerSecret, o.AuthTokenSecret, request.URL.RequestURI(), params, body)
+	request = signRequest(request, oauthParams, o.ConsumerSecret, o.AuthTokenSecret, baseURL, params, body)
 
 	return request, nil
 }
@@ -15,7 +15,7 @@ func (a baidu) ValidateAuthData(authData types.M, options types.M) error {
 	path := "isAppUser?access_token=" + utils.S(authData["access_token"]) + "&uid=" + utils.S(authData["id"])
 	data, err := request(host+path, nil)
 	if err != nil {
-		return errs.E(errs.ObjectNotFound, "Failed to validate this access token with Baidu.")
+		return requestFailed(err, "Baidu")
 	}
 	if result, ok := data["result"].(float64); ok && result == 1 {
 		return nil
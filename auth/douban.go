@@ -17,7 +17,7 @@ func (a douban) ValidateAuthData(authData types.M, options types.M) error {
 	}
 	data, err := request(host+path, headers)
 	if err != nil {
-		return errs.E(errs.ObjectNotFound, "Failed to validate this access token with Douban.")
+		return requestFailed(err, "Douban")
 	}
 	if data["id"] != nil && utils.S(data["id"]) == utils.S(authData["id"]) {
 		return nil
@@ -1,20 +1,32 @@
 package auth
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+
 	"github.com/lfq7413/tomato/errs"
 	"github.com/lfq7413/tomato/types"
 	"github.com/lfq7413/tomato/utils"
 )
 
+// facebookGraphHost Graph API 地址
+var facebookGraphHost = "https://graph.facebook.com/v2.5/"
+
 type facebook struct{}
 
+// ValidateAuthData 校验 access_token 属于 authData 中的用户，并且由 appIds 中的应用签发
 func (a facebook) ValidateAuthData(authData types.M, options types.M) error {
-	accessToken := utils.S(authData["access_token"])
-	host := "https://graph.facebook.com/v2.5/"
+	accessToken := url.QueryEscape(utils.S(authData["access_token"]))
+	// 设置了 appSecret 时附带 appsecret_proof ，Graph API 会拒绝其他应用签发的 access_token
+	if options != nil && utils.S(options["appSecret"]) != "" {
+		accessToken += "&appsecret_proof=" + appSecretProof(utils.S(authData["access_token"]), utils.S(options["appSecret"]))
+	}
 	path := "me?fields=id&access_token=" + accessToken
-	data, err := request(host+path, nil)
+	data, err := request(facebookGraphHost+path, nil)
 	if err != nil {
-		return errs.E(errs.ObjectNotFound, "Failed to validate this access token with Facebook.")
+		return requestFailed(err, "Facebook")
 	}
 	if data["id"] == nil || utils.S(data["id"]) != utils.S(authData["id"]) {
 		return errs.E(errs.ObjectNotFound, "Facebook auth is invalid for this user.")
@@ -24,16 +36,14 @@ func (a facebook) ValidateAuthData(authData types.M, options types.M) error {
 	if options == nil {
 		return errs.E(errs.ObjectNotFound, "Facebook auth is not configured.")
 	}
-	var appIDs []string
-	if v, ok := options["appIds"].([]string); ok == true && len(appIDs) > 0 {
-		appIDs = v
-	} else {
+	appIDs, ok := options["appIds"].([]string)
+	if ok == false || len(appIDs) == 0 {
 		return errs.E(errs.ObjectNotFound, "Facebook auth is not configured.")
 	}
 	path = "app?access_token=" + accessToken
-	data, err = request(host+path, nil)
+	data, err = request(facebookGraphHost+path, nil)
 	if err != nil {
-		return errs.E(errs.ObjectNotFound, "Failed to validate this access token with Facebook.")
+		return requestFailed(err, "Facebook")
 	}
 	if data["id"] != nil {
 		id := utils.S(data["id"])
@@ -46,3 +56,10 @@ func (a facebook) ValidateAuthData(authData types.M, options types.M) error {
 
 	return errs.E(errs.ObjectNotFound, "Facebook auth is invalid for this user.")
 }
+
+// appSecretProof 使用 appSecret 对 access_token 做 HMAC-SHA256 签名
+func appSecretProof(accessToken, appSecret string) string {
+	mac := hmac.New(sha256.New, []byte(appSecret))
+	mac.Write([]byte(accessToken))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/lfq7413/tomato/errs"
+	"github.com/lfq7413/tomato/types"
+)
+
+func Test_facebook_ValidateAuthData(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("access_token") != "token" {
+			w.Write([]byte(`{"error":{"message":"Invalid OAuth access token."}}`))
+			return
+		}
+		if proof := r.URL.Query().Get("appsecret_proof"); proof != "" && proof != appSecretProof("token", "secret") {
+			w.Write([]byte(`{"error":{"message":"Invalid appsecret_proof provided in the API argument"}}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/me":
+			w.Write([]byte(`{"id":"1001"}`))
+		case "/app":
+			w.Write([]byte(`{"id":"2001"}`))
+		}
+	}))
+	defer server.Close()
+	host := facebookGraphHost
+	facebookGraphHost = server.URL + "/"
+	defer func() { facebookGraphHost = host }()
+
+	a := facebook{}
+	var authData types.M
+	var options types.M
+	var err error
+	var expect error
+	/*************************************************/
+	authData = types.M{"id": "1001", "access_token": "token"}
+	options = types.M{"appIds": []string{"2001"}}
+	err = a.ValidateAuthData(authData, options)
+	if err != nil {
+		t.Error("expect:", nil, "result:", err)
+	}
+	/*************************************************/
+	authData = types.M{"id": "1002", "access_token": "token"}
+	options = types.M{"appIds": []string{"2001"}}
+	err = a.ValidateAuthData(authData, options)
+	expect = errs.E(errs.ObjectNotFound, "Facebook auth is invalid for this user.")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/*************************************************/
+	authData = types.M{"id": "1001", "access_token": "other"}
+	options = types.M{"appIds": []string{"2001"}}
+	err = a.ValidateAuthData(authData, options)
+	expect = errs.E(errs.ObjectNotFound, "Facebook auth is invalid for this user.")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/*************************************************/
+	authData = types.M{"id": "1001", "access_token": "token"}
+	options = types.M{"appIds": []string{"2002"}}
+	err = a.ValidateAuthData(authData, options)
+	expect = errs.E(errs.ObjectNotFound, "Facebook auth is invalid for this user.")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/*************************************************/
+	authData = types.M{"id": "1001", "access_token": "token"}
+	options = types.M{"appIds": []string{}}
+	err = a.ValidateAuthData(authData, options)
+	expect = errs.E(errs.ObjectNotFound, "Facebook auth is not configured.")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/*************************************************/
+	authData = types.M{"id": "1001", "access_token": "token"}
+	options = types.M{"appIds": []string{"2001"}, "appSecret": "secret"}
+	err = a.ValidateAuthData(authData, options)
+	if err != nil {
+		t.Error("expect:", nil, "result:", err)
+	}
+	/*************************************************/
+	authData = types.M{"id": "1001", "access_token": "token"}
+	options = types.M{"appIds": []string{"2001"}, "appSecret": "other"}
+	err = a.ValidateAuthData(authData, options)
+	expect = errs.E(errs.ObjectNotFound, "Facebook auth is invalid for this user.")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+}
+
+func Test_appSecretProof(t *testing.T) {
+	// echo -n token | openssl dgst -sha256 -hmac secret
+	expect := "e941110e3d2bfe82621f0e3e1434730d7305d106c5f68c87165d0b27a4611a4a"
+	if result := appSecretProof("token", "secret"); result != expect {
+		t.Error("expect:", expect, "result:", result)
+	}
+}
@@ -1,26 +1,54 @@
 package auth
 
 import (
+	"strconv"
+	"strings"
+
 	"github.com/lfq7413/tomato/errs"
 	"github.com/lfq7413/tomato/types"
 	"github.com/lfq7413/tomato/utils"
 )
 
+// githubAPIHost GitHub API 地址
+var githubAPIHost = "https://api.github.com/"
+
 type github struct{}
 
+// ValidateAuthData 使用 access_token 请求 /user 接口，校验返回的 id 与 authData 中的 id 一致
 func (a github) ValidateAuthData(authData types.M, options types.M) error {
-	host := "https://api.github.com/"
 	path := "user"
+	// GitHub 会拒绝没有 User-Agent 的请求
 	headers := map[string]string{
-		"Authorization": "bearer " + utils.S(authData["access_token"]),
-		"User-Agent":    "parse-server",
+		"Authorization": "token " + utils.S(authData["access_token"]),
+		"User-Agent":    "tomato",
+		"Accept":        "application/vnd.github.v3+json",
 	}
-	data, err := request(host+path, headers)
+	data, err := request(githubAPIHost+path, headers)
 	if err != nil {
-		return errs.E(errs.ObjectNotFound, "Failed to validate this access token with Github.")
+		return requestFailed(err, "Github")
+	}
+	// 超出频率限制时返回 403 或 429 ，message 中包含 rate limit ，此时应由客户端稍后重试，而不是视为校验失败
+	if message := strings.ToLower(utils.S(data["message"])); strings.Contains(message, "rate limit") {
+		return errs.E(errs.RequestLimitExceeded, "Github API rate limit exceeded. Please try again later.")
 	}
-	if data["id"] != nil && utils.S(data["id"]) == utils.S(authData["id"]) {
+	id := githubID(data["id"])
+	if id != "" && id == githubID(authData["id"]) {
 		return nil
 	}
 	return errs.E(errs.ObjectNotFound, "Github auth is invalid for this user.")
 }
+
+// githubID GitHub 返回的 id 为数字，客户端传入的 id 可能是字符串或者数字，统一转换为字符串后比较
+func githubID(v interface{}) string {
+	switch id := v.(type) {
+	case string:
+		return id
+	case float64:
+		return strconv.FormatFloat(id, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(id)
+	case int64:
+		return strconv.FormatInt(id, 10)
+	}
+	return ""
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/lfq7413/tomato/errs"
+	"github.com/lfq7413/tomato/types"
+)
+
+func Test_github_ValidateAuthData(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/user" || r.Header.Get("User-Agent") == "" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"message":"Request forbidden by administrative rules. Please make sure your request has a User-Agent header."}`))
+			return
+		}
+		switch r.Header.Get("Authorization") {
+		case "token token":
+			w.Write([]byte(`{"login":"joe","id":1001}`))
+		case "token limited":
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"message":"API rate limit exceeded for user ID 1001."}`))
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"message":"Bad credentials"}`))
+		}
+	}))
+	defer server.Close()
+	host := githubAPIHost
+	githubAPIHost = server.URL + "/"
+	defer func() { githubAPIHost = host }()
+
+	a := github{}
+	var authData types.M
+	var err error
+	var expect error
+	/*************************************************/
+	authData = types.M{"id": "1001", "access_token": "token"}
+	err = a.ValidateAuthData(authData, nil)
+	if err != nil {
+		t.Error("expect:", nil, "result:", err)
+	}
+	/*************************************************/
+	authData = types.M{"id": 1001.0, "access_token": "token"}
+	err = a.ValidateAuthData(authData, nil)
+	if err != nil {
+		t.Error("expect:", nil, "result:", err)
+	}
+	/*************************************************/
+	authData = types.M{"id": "1002", "access_token": "token"}
+	err = a.ValidateAuthData(authData, nil)
+	expect = errs.E(errs.ObjectNotFound, "Github auth is invalid for this user.")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/*************************************************/
+	authData = types.M{"id": "1001", "access_token": "bad"}
+	err = a.ValidateAuthData(authData, nil)
+	expect = errs.E(errs.ObjectNotFound, "Github auth is invalid for this user.")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/*************************************************/
+	authData = types.M{"id": "1001", "access_token": "limited"}
+	err = a.ValidateAuthData(authData, nil)
+	expect = errs.E(errs.RequestLimitExceeded, "Github API rate limit exceeded. Please try again later.")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+}
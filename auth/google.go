@@ -1,48 +1,235 @@
 package auth
 
 import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
 	"github.com/lfq7413/tomato/errs"
 	"github.com/lfq7413/tomato/types"
 	"github.com/lfq7413/tomato/utils"
 )
 
+// googleTokenInfoHost tokeninfo 接口地址
+var googleTokenInfoHost = "https://www.googleapis.com/oauth2/v3/"
+
+// googleJWKSURL Google 签发 id_token 使用的公钥地址
+var googleJWKSURL = "https://www.googleapis.com/oauth2/v3/certs"
+
+// googleIssuers id_token 中合法的 iss
+var googleIssuers = []string{"accounts.google.com", "https://accounts.google.com"}
+
+// googleKeysRefreshInterval 遇到未知 kid 时，两次拉取公钥的最小间隔，避免伪造的 kid 导致频繁请求
+const googleKeysRefreshInterval = time.Minute
+
+// googleKeys 缓存的 Google 公钥，按 kid 索引
+var googleKeys = struct {
+	sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}{}
+
 type google struct{}
 
+// ValidateAuthData 校验 id_token 或者 access_token
+// 必须配置 clientIds ，token 的 aud 必须为其中之一
 func (a google) ValidateAuthData(authData types.M, options types.M) error {
-	var err error
-	if utils.S(authData["id_token"]) != "" {
-		err = a.validateIDToken(utils.S(authData["id"]), utils.S(authData["id_token"]))
-	} else {
-		err = a.validateAuthToken(utils.S(authData["id"]), utils.S(authData["access_token"]))
-		if err != nil {
-			err = a.validateIDToken(utils.S(authData["id"]), utils.S(authData["access_token"]))
+	var clientIDs []string
+	if options != nil {
+		if v, ok := options["clientIds"].([]string); ok {
+			clientIDs = v
+		}
+	}
+	id := utils.S(authData["id"])
+	if id == "" {
+		return errs.E(errs.ObjectNotFound, "Google auth is invalid for this user.")
+	}
+	// 任何 Google 应用都能签发合法的 token ，不限制 aud 时其他应用的 token 也能登录
+	if len(clientIDs) == 0 {
+		return errs.E(errs.ObjectNotFound, "Google auth is not configured.")
+	}
+	if idToken := utils.S(authData["id_token"]); idToken != "" {
+		return a.verifyIDToken(id, idToken, clientIDs)
+	}
+	accessToken := utils.S(authData["access_token"])
+	// 旧版 SDK 会把 id_token 放在 access_token 中
+	if strings.Count(accessToken, ".") == 2 {
+		return a.verifyIDToken(id, accessToken, clientIDs)
+	}
+	return a.validateToken(id, "access_token", accessToken, clientIDs)
+}
+
+// validateToken 使用 tokeninfo 接口校验 token ，tokenType 为 id_token 或者 access_token
+func (a google) validateToken(id, tokenType, token string, clientIDs []string) error {
+	path := "tokeninfo?" + tokenType + "=" + url.QueryEscape(token)
+	data, err := request(googleTokenInfoHost+path, nil)
+	if err != nil || data == nil {
+		return requestFailed(err, "Google")
+	}
+	if data["error_description"] != nil || data["error"] != nil {
+		return errs.E(errs.ObjectNotFound, "Google auth token is invalid or expired.")
+	}
+	if exp, err := strconv.ParseInt(utils.S(data["exp"]), 10, 64); err == nil && exp < time.Now().Unix() {
+		return errs.E(errs.ObjectNotFound, "Google auth token is expired.")
+	}
+	if utils.S(data["sub"]) != id && utils.S(data["user_id"]) != id {
+		return errs.E(errs.ObjectNotFound, "Google auth is invalid for this user.")
+	}
+	return checkGoogleAudience([]string{utils.S(data["aud"])}, clientIDs)
+}
+
+// verifyIDToken 使用 Google 公钥校验 id_token 的签名，并检查 iss 、 exp 、 sub 与 aud
+func (a google) verifyIDToken(id, token string, clientIDs []string) error {
+	invalidErr := errs.E(errs.ObjectNotFound, "Google auth token is invalid or expired.")
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return invalidErr
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if decodeJWTPart(parts[0], &header) != nil || header.Alg != "RS256" {
+		return invalidErr
+	}
+	var claims struct {
+		Iss string      `json:"iss"`
+		Sub string      `json:"sub"`
+		Aud interface{} `json:"aud"`
+		Exp json.Number `json:"exp"`
+	}
+	if decodeJWTPart(parts[1], &claims) != nil {
+		return invalidErr
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return invalidErr
+	}
+
+	key, err := googlePublicKey(header.Kid)
+	if err != nil {
+		return requestFailed(err, "Google")
+	}
+	if key == nil {
+		return invalidErr
+	}
+	hashed := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if rsa.VerifyPKCS1v15(key, crypto.SHA256, hashed[:], signature) != nil {
+		return invalidErr
+	}
+
+	validIssuer := false
+	for _, iss := range googleIssuers {
+		if claims.Iss == iss {
+			validIssuer = true
+		}
+	}
+	if validIssuer == false {
+		return errs.E(errs.ObjectNotFound, "Google auth token has an invalid issuer.")
+	}
+	if exp, err := claims.Exp.Int64(); err != nil || exp < time.Now().Unix() {
+		return errs.E(errs.ObjectNotFound, "Google auth token is expired.")
+	}
+	if claims.Sub != id {
+		return errs.E(errs.ObjectNotFound, "Google auth is invalid for this user.")
+	}
+	return checkGoogleAudience(googleAudience(claims.Aud), clientIDs)
+}
+
+// googleAudience JWT 中的 aud 可以是字符串或者字符串数组
+func googleAudience(v interface{}) []string {
+	switch aud := v.(type) {
+	case string:
+		return []string{aud}
+	case []interface{}:
+		auds := []string{}
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				auds = append(auds, s)
+			}
+		}
+		return auds
+	}
+	return nil
+}
+
+// checkGoogleAudience auds 中必须有一个为 clientIDs 之一，未配置 clientIDs 时总是失败
+func checkGoogleAudience(auds []string, clientIDs []string) error {
+	if len(clientIDs) == 0 {
+		return errs.E(errs.ObjectNotFound, "Google auth is not configured.")
+	}
+	for _, clientID := range clientIDs {
+		for _, aud := range auds {
+			if aud == clientID {
+				return nil
+			}
 		}
 	}
-	return err
+	return errs.E(errs.ObjectNotFound, "Google auth token has an invalid audience.")
 }
 
-func (a google) validateIDToken(id, token string) error {
-	host := "https://www.googleapis.com/oauth2/v3/"
-	path := "tokeninfo?id_token=" + token
-	data, err := request(host+path, nil)
+// decodeJWTPart 解码 JWT 中 base64url 编码的 JSON 段
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
 	if err != nil {
-		return errs.E(errs.ObjectNotFound, "Failed to validate this access token with Google.")
+		return err
+	}
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// googlePublicKey 从缓存中获取 kid 对应的公钥，不存在时重新拉取，仍不存在时返回 nil
+func googlePublicKey(kid string) (*rsa.PublicKey, error) {
+	googleKeys.Lock()
+	defer googleKeys.Unlock()
+	if key := googleKeys.keys[kid]; key != nil {
+		return key, nil
 	}
-	if data != nil && (utils.S(data["sub"]) == id || utils.S(data["user_id"]) == id) {
-		return nil
+	if googleKeys.keys != nil && time.Since(googleKeys.fetchedAt) < googleKeysRefreshInterval {
+		return nil, nil
 	}
-	return errs.E(errs.ObjectNotFound, "Google auth is invalid for this user.")
+	keys, err := fetchGooglePublicKeys()
+	if err != nil {
+		return nil, err
+	}
+	googleKeys.keys = keys
+	googleKeys.fetchedAt = time.Now()
+	return keys[kid], nil
 }
 
-func (a google) validateAuthToken(id, token string) error {
-	host := "https://www.googleapis.com/oauth2/v3/"
-	path := "tokeninfo?access_token=" + token
-	data, err := request(host+path, nil)
+// fetchGooglePublicKeys 拉取 JWKS 格式的公钥
+func fetchGooglePublicKeys() (map[string]*rsa.PublicKey, error) {
+	data, err := request(googleJWKSURL, nil)
 	if err != nil {
-		return errs.E(errs.ObjectNotFound, "Failed to validate this access token with Google.")
+		return nil, err
 	}
-	if data != nil && (utils.S(data["sub"]) == id || utils.S(data["user_id"]) == id) {
-		return nil
+	keys := map[string]*rsa.PublicKey{}
+	for _, v := range utils.A(data["keys"]) {
+		jwk := utils.M(v)
+		if jwk == nil || utils.S(jwk["kty"]) != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(utils.S(jwk["n"]))
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(utils.S(jwk["e"]))
+		if err != nil || len(e) == 0 {
+			continue
+		}
+		keys[utils.S(jwk["kid"])] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
 	}
-	return errs.E(errs.ObjectNotFound, "Google auth is invalid for this user.")
+	return keys, nil
 }
@@ -0,0 +1,237 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/lfq7413/tomato/errs"
+	"github.com/lfq7413/tomato/types"
+)
+
+func Test_google_ValidateAuthData(t *testing.T) {
+	exp := strconv.FormatInt(time.Now().Unix()+3600, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("access_token") {
+		case "token":
+			w.Write([]byte(`{"sub":"1001","aud":"client","exp":"` + exp + `"}`))
+		case "expired":
+			w.Write([]byte(`{"sub":"1001","aud":"client","exp":"1000"}`))
+		default:
+			w.Write([]byte(`{"error_description":"Invalid Value"}`))
+		}
+	}))
+	defer server.Close()
+	host := googleTokenInfoHost
+	googleTokenInfoHost = server.URL + "/"
+	defer func() { googleTokenInfoHost = host }()
+
+	a := google{}
+	var authData types.M
+	var options types.M
+	var err error
+	var expect error
+	/*************************************************/
+	authData = types.M{"id": "1001", "access_token": "token"}
+	options = types.M{"clientIds": []string{"client"}}
+	err = a.ValidateAuthData(authData, options)
+	if err != nil {
+		t.Error("expect:", nil, "result:", err)
+	}
+	/*************************************************/
+	// 未配置 clientIds 时同样不允许使用 access_token 登录
+	authData = types.M{"id": "1001", "access_token": "token"}
+	options = nil
+	err = a.ValidateAuthData(authData, options)
+	expect = errs.E(errs.ObjectNotFound, "Google auth is not configured.")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	err = a.validateToken("1001", "access_token", "token", []string{})
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/*************************************************/
+	authData = types.M{"id": "1002", "access_token": "token"}
+	options = types.M{"clientIds": []string{"client"}}
+	err = a.ValidateAuthData(authData, options)
+	expect = errs.E(errs.ObjectNotFound, "Google auth is invalid for this user.")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/*************************************************/
+	authData = types.M{"id": "1001", "access_token": "token"}
+	options = types.M{"clientIds": []string{"other"}}
+	err = a.ValidateAuthData(authData, options)
+	expect = errs.E(errs.ObjectNotFound, "Google auth token has an invalid audience.")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/*************************************************/
+	authData = types.M{"id": "1001", "access_token": "expired"}
+	options = types.M{"clientIds": []string{"client"}}
+	err = a.ValidateAuthData(authData, options)
+	expect = errs.E(errs.ObjectNotFound, "Google auth token is expired.")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/*************************************************/
+	authData = types.M{"id": "1001", "access_token": "bad"}
+	options = types.M{"clientIds": []string{"client"}}
+	err = a.ValidateAuthData(authData, options)
+	expect = errs.E(errs.ObjectNotFound, "Google auth token is invalid or expired.")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+}
+
+func Test_google_verifyIDToken(t *testing.T) {
+	key1, _ := rsa.GenerateKey(rand.Reader, 2048)
+	key2, _ := rsa.GenerateKey(rand.Reader, 2048)
+	jwks := []types.M{googleTestJWK("kid1", &key1.PublicKey)}
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		body, _ := json.Marshal(types.M{"keys": jwks})
+		w.Write(body)
+	}))
+	defer server.Close()
+	jwksURL := googleJWKSURL
+	googleJWKSURL = server.URL
+	defer func() {
+		googleJWKSURL = jwksURL
+		googleKeys.keys = nil
+	}()
+	googleKeys.keys = nil
+
+	a := google{}
+	now := time.Now().Unix()
+	claims := func(sub string, aud interface{}, iss string, exp int64) types.M {
+		return types.M{"sub": sub, "aud": aud, "iss": iss, "exp": exp}
+	}
+	var token string
+	var err error
+	var expect error
+	/*************************************************/
+	token = googleTestToken(key1, "kid1", claims("1001", "client", "https://accounts.google.com", now+3600))
+	err = a.ValidateAuthData(types.M{"id": "1001", "id_token": token}, types.M{"clientIds": []string{"client"}})
+	if err != nil {
+		t.Error("expect:", nil, "result:", err)
+	}
+	// 旧版 SDK 把 id_token 放在 access_token 中
+	err = a.ValidateAuthData(types.M{"id": "1001", "access_token": token}, types.M{"clientIds": []string{"client"}})
+	if err != nil {
+		t.Error("expect:", nil, "result:", err)
+	}
+	if requests != 1 {
+		t.Error("expect:", 1, "result:", requests)
+	}
+	/*************************************************/
+	// 未配置 clientIds 时不允许使用 id_token 登录
+	err = a.ValidateAuthData(types.M{"id": "1001", "id_token": token}, nil)
+	expect = errs.E(errs.ObjectNotFound, "Google auth is not configured.")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	err = a.verifyIDToken("1001", token, []string{})
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/*************************************************/
+	// aud 为数组
+	token = googleTestToken(key1, "kid1", claims("1001", []string{"other", "client"}, "accounts.google.com", now+3600))
+	err = a.verifyIDToken("1001", token, []string{"client"})
+	if err != nil {
+		t.Error("expect:", nil, "result:", err)
+	}
+	token = googleTestToken(key1, "kid1", claims("1001", []string{"other"}, "accounts.google.com", now+3600))
+	err = a.verifyIDToken("1001", token, []string{"client"})
+	expect = errs.E(errs.ObjectNotFound, "Google auth token has an invalid audience.")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/*************************************************/
+	token = googleTestToken(key1, "kid1", claims("1001", "client", "accounts.google.com", now-10))
+	err = a.verifyIDToken("1001", token, []string{"client"})
+	expect = errs.E(errs.ObjectNotFound, "Google auth token is expired.")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/*************************************************/
+	token = googleTestToken(key1, "kid1", claims("1001", "other", "accounts.google.com", now+3600))
+	err = a.verifyIDToken("1001", token, []string{"client"})
+	expect = errs.E(errs.ObjectNotFound, "Google auth token has an invalid audience.")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/*************************************************/
+	token = googleTestToken(key1, "kid1", claims("1002", "client", "accounts.google.com", now+3600))
+	err = a.verifyIDToken("1001", token, []string{"client"})
+	expect = errs.E(errs.ObjectNotFound, "Google auth is invalid for this user.")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/*************************************************/
+	token = googleTestToken(key1, "kid1", claims("1001", "client", "evil.com", now+3600))
+	err = a.verifyIDToken("1001", token, []string{"client"})
+	expect = errs.E(errs.ObjectNotFound, "Google auth token has an invalid issuer.")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/*************************************************/
+	// 签名与 kid 对应的公钥不匹配
+	token = googleTestToken(key2, "kid1", claims("1001", "client", "accounts.google.com", now+3600))
+	err = a.verifyIDToken("1001", token, []string{"client"})
+	expect = errs.E(errs.ObjectNotFound, "Google auth token is invalid or expired.")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	err = a.verifyIDToken("1001", "a.b.c", []string{"client"})
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/*************************************************/
+	// 公钥轮换后，遇到未知 kid 时重新拉取
+	jwks = append(jwks, googleTestJWK("kid2", &key2.PublicKey))
+	googleKeys.fetchedAt = time.Now().Add(-2 * googleKeysRefreshInterval)
+	token = googleTestToken(key2, "kid2", claims("1001", "client", "accounts.google.com", now+3600))
+	err = a.verifyIDToken("1001", token, []string{"client"})
+	if err != nil || requests != 2 {
+		t.Error("expect:", nil, 2, "result:", err, requests)
+	}
+	// 刚拉取过公钥时，未知 kid 不会再次请求
+	token = googleTestToken(key2, "kid3", claims("1001", "client", "accounts.google.com", now+3600))
+	err = a.verifyIDToken("1001", token, []string{"client"})
+	if reflect.DeepEqual(expect, err) == false || requests != 2 {
+		t.Error("expect:", expect, 2, "result:", err, requests)
+	}
+}
+
+func googleTestJWK(kid string, key *rsa.PublicKey) types.M {
+	return types.M{
+		"kty": "RSA",
+		"alg": "RS256",
+		"kid": kid,
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func googleTestToken(key *rsa.PrivateKey, kid string, claims types.M) string {
+	header, _ := json.Marshal(types.M{"alg": "RS256", "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	hashed := sha256.Sum256([]byte(signingInput))
+	signature, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
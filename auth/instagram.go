@@ -13,7 +13,7 @@ func (a instagram) ValidateAuthData(authData types.M, options types.M) error {
 	path := "users/self/?access_token=" + utils.S(authData["access_token"])
 	data, err := request(host+path, nil)
 	if err != nil {
-		return errs.E(errs.ObjectNotFound, "Failed to validate this access token with Instagram.")
+		return requestFailed(err, "Instagram")
 	}
 	if d := utils.M(data["data"]); d != nil {
 		if d["id"] != nil && utils.S(d["id"]) == utils.S(authData["id"]) {
@@ -17,7 +17,7 @@ func (a janraincapture) ValidateAuthData(authData types.M, options types.M) erro
 	path := "/entity?attribute_name=uuid&access_token=" + utils.S(authData["access_token"])
 	data, err := request(host+path, nil)
 	if err != nil {
-		return errs.E(errs.ObjectNotFound, "Failed to validate this access token with Janrain.")
+		return requestFailed(err, "Janrain")
 	}
 	if utils.S(data["stat"]) == "ok" && utils.S(data["result"]) == utils.S(authData["id"]) {
 		return nil
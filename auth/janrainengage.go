@@ -19,7 +19,7 @@ func (a janrainengage) ValidateAuthData(authData types.M, options types.M) error
 	}
 	data, err := post(host+path, nil, requestData)
 	if err != nil {
-		return errs.E(errs.ObjectNotFound, "Failed to validate this access token with Janrain.")
+		return requestFailed(err, "Janrain")
 	}
 	if utils.S(data["stat"]) == "ok" {
 		if profile := utils.M(data["profile"]); profile != nil {
@@ -20,7 +20,7 @@ func (a linkedin) ValidateAuthData(authData types.M, options types.M) error {
 	}
 	data, err := request(host+path, headers)
 	if err != nil {
-		return errs.E(errs.ObjectNotFound, "Failed to validate this access token with Linkedin.")
+		return requestFailed(err, "Linkedin")
 	}
 	if data["id"] != nil && utils.S(data["id"]) == utils.S(authData["id"]) {
 		return nil
@@ -1,6 +1,8 @@
 package auth
 
 import (
+	"regexp"
+
 	"github.com/lfq7413/tomato/config"
 	"github.com/lfq7413/tomato/errs"
 	"github.com/lfq7413/tomato/types"
@@ -35,7 +37,11 @@ func init() {
 	}
 	options = map[string]types.M{
 		"facebook": types.M{
-			"appIds": []string{},
+			"appIds":    config.TConfig.FacebookAppIDs,
+			"appSecret": config.TConfig.FacebookAppSecret,
+		},
+		"google": types.M{
+			"clientIds": config.TConfig.GoogleClientIDs,
 		},
 		"janraincapture": types.M{
 			"janrain_capture_host": "https://my-app.janraincapture.com",
@@ -46,6 +52,14 @@ func init() {
 		"spotify": types.M{
 			"appIds": []string{},
 		},
+		"twitter": types.M{
+			"consumer_key":    config.TConfig.TwitterConsumerKey,
+			"consumer_secret": config.TConfig.TwitterConsumerSecret,
+		},
+		"digits": types.M{
+			"consumer_key":    config.TConfig.TwitterConsumerKey,
+			"consumer_secret": config.TConfig.TwitterConsumerSecret,
+		},
 	}
 }
 
@@ -66,8 +80,14 @@ func ValidateAuthData(provider string, authData types.M) error {
 
 type anonymous struct{}
 
+// anonymousIDPattern 匿名用户 id 为小写的 UUID
+var anonymousIDPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
 func (a anonymous) ValidateAuthData(authData types.M, option types.M) error {
-	return nil
+	if id, ok := authData["id"].(string); ok && anonymousIDPattern.MatchString(id) {
+		return nil
+	}
+	return errs.E(errs.ObjectNotFound, "Anonymous auth is invalid for this user.")
 }
 
 // Provider ...
@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lfq7413/tomato/config"
+	"github.com/lfq7413/tomato/errs"
+	"github.com/lfq7413/tomato/types"
+)
+
+func Test_anonymous(t *testing.T) {
+	var authData types.M
+	var err error
+	var expect error
+	enableAnonymousUsers := config.TConfig.EnableAnonymousUsers
+	defer func() { config.TConfig.EnableAnonymousUsers = enableAnonymousUsers }()
+	/*********************************************************/
+	config.TConfig.EnableAnonymousUsers = true
+	authData = types.M{"id": "0f8fad5b-d9cb-469f-a165-70867728950e"}
+	err = ValidateAuthData("anonymous", authData)
+	if err != nil {
+		t.Error("expect:", nil, "result:", err)
+	}
+	/*********************************************************/
+	expect = errs.E(errs.ObjectNotFound, "Anonymous auth is invalid for this user.")
+	for _, id := range []interface{}{"0F8FAD5B-D9CB-469F-A165-70867728950E", "1001", "", 1001, nil} {
+		authData = types.M{"id": id}
+		err = ValidateAuthData("anonymous", authData)
+		if reflect.DeepEqual(expect, err) == false {
+			t.Error("expect:", expect, "result:", err, id)
+		}
+	}
+	/*********************************************************/
+	config.TConfig.EnableAnonymousUsers = false
+	authData = types.M{"id": "0f8fad5b-d9cb-469f-a165-70867728950e"}
+	err = ValidateAuthData("anonymous", authData)
+	expect = errs.E(errs.UnsupportedService, "This authentication method is unsupported.")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+}
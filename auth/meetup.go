@@ -16,7 +16,7 @@ func (a meetup) ValidateAuthData(authData types.M, options types.M) error {
 	}
 	data, err := request(host+path, headers)
 	if err != nil {
-		return errs.E(errs.ObjectNotFound, "Failed to validate this access token with Meetup.")
+		return requestFailed(err, "Meetup")
 	}
 	if data["id"] != nil && utils.S(data["id"]) == utils.S(authData["id"]) {
 		return nil
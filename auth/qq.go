@@ -14,7 +14,7 @@ func (a qq) ValidateAuthData(authData types.M, options types.M) error {
 	path := "me?access_token=" + utils.S(authData["access_token"])
 	data, err := requestQQ(host+path, nil)
 	if err != nil {
-		return errs.E(errs.ObjectNotFound, "Failed to validate this access token with QQ.")
+		return requestFailed(err, "QQ")
 	}
 	if data["openid"] != nil && utils.S(data["openid"]) == utils.S(authData["id"]) {
 		return nil
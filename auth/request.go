@@ -2,14 +2,81 @@ package auth
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
+	"github.com/lfq7413/tomato/config"
+	"github.com/lfq7413/tomato/errs"
 	"github.com/lfq7413/tomato/types"
 )
 
+// TimeoutError 请求第三方接口超时
+type TimeoutError struct {
+	URL string
+}
+
+func (e *TimeoutError) Error() string {
+	return "request to " + e.URL + " timed out"
+}
+
+// requestFailed 转换请求第三方接口时的错误，超时返回 errs.Timeout ，其他错误视为校验失败
+func requestFailed(err error, provider string) error {
+	if _, ok := err.(*TimeoutError); ok {
+		return errs.E(errs.Timeout, "Request to "+provider+" timed out.")
+	}
+	return errs.E(errs.ObjectNotFound, "Failed to validate this access token with "+provider+".")
+}
+
+// retryBackoff 第一次重试前的等待时间，之后每次重试等待时间加倍
+var retryBackoff = 200 * time.Millisecond
+
+// doRequest 发送请求，GET 请求遇到网络错误与 5xx 响应时最多重试 AuthRequestRetries 次，超时不重试
+// 其他方法的请求不是幂等的，不进行重试
+func doRequest(req *http.Request) ([]byte, error) {
+	client := &http.Client{
+		Timeout: time.Duration(config.TConfig.AuthRequestTimeout) * time.Second,
+	}
+	retries := config.TConfig.AuthRequestRetries
+	if retries < 0 || req.Method != "GET" {
+		retries = 0
+	}
+
+	var lastErr error
+	for i := 0; i <= retries; i++ {
+		if i > 0 {
+			time.Sleep(retryBackoff << uint(i-1))
+		}
+		response, err := client.Do(req)
+		if err != nil {
+			if e, ok := err.(net.Error); ok && e.Timeout() {
+				return nil, &TimeoutError{URL: req.URL.Host}
+			}
+			lastErr = err
+			continue
+		}
+		body, err := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		if err != nil {
+			if e, ok := err.(net.Error); ok && e.Timeout() {
+				return nil, &TimeoutError{URL: req.URL.Host}
+			}
+			lastErr = err
+			continue
+		}
+		if response.StatusCode >= 500 {
+			lastErr = fmt.Errorf("request to %s failed with status %d", req.URL.Host, response.StatusCode)
+			continue
+		}
+		return body, nil
+	}
+	return nil, lastErr
+}
+
 func request(path string, headers map[string]string) (types.M, error) {
 	request, err := http.NewRequest("GET", path, nil)
 	if err != nil {
@@ -20,14 +87,7 @@ func request(path string, headers map[string]string) (types.M, error) {
 		request.Header.Set(k, v)
 	}
 
-	client := http.DefaultClient
-	response, err := client.Do(request)
-	if err != nil {
-		return nil, err
-	}
-	defer response.Body.Close()
-
-	body, err := ioutil.ReadAll(response.Body)
+	body, err := doRequest(request)
 	if err != nil {
 		return nil, err
 	}
@@ -55,14 +115,7 @@ func post(path string, headers map[string]string, data map[string]string) (types
 		request.Header.Set(k, v)
 	}
 
-	client := http.DefaultClient
-	response, err := client.Do(request)
-	if err != nil {
-		return nil, err
-	}
-	defer response.Body.Close()
-
-	body, err := ioutil.ReadAll(response.Body)
+	body, err := doRequest(request)
 	if err != nil {
 		return nil, err
 	}
@@ -85,14 +138,7 @@ func requestQQ(path string, headers map[string]string) (types.M, error) {
 		request.Header.Set(k, v)
 	}
 
-	client := http.DefaultClient
-	response, err := client.Do(request)
-	if err != nil {
-		return nil, err
-	}
-	defer response.Body.Close()
-
-	body, err := ioutil.ReadAll(response.Body)
+	body, err := doRequest(request)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lfq7413/tomato/config"
+	"github.com/lfq7413/tomato/errs"
+	"github.com/lfq7413/tomato/types"
+)
+
+func Test_request(t *testing.T) {
+	var count int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count++
+		switch r.URL.Path {
+		case "/retry":
+			if count < 3 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			w.Write([]byte(`{"id":"1001"}`))
+		case "/fail":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/slow":
+			time.Sleep(1500 * time.Millisecond)
+			w.Write([]byte(`{"id":"1001"}`))
+		}
+	}))
+	defer server.Close()
+	timeout, retries, backoff := config.TConfig.AuthRequestTimeout, config.TConfig.AuthRequestRetries, retryBackoff
+	config.TConfig.AuthRequestTimeout = 1
+	config.TConfig.AuthRequestRetries = 2
+	retryBackoff = 50 * time.Millisecond
+	defer func() {
+		config.TConfig.AuthRequestTimeout, config.TConfig.AuthRequestRetries, retryBackoff = timeout, retries, backoff
+	}()
+
+	var result types.M
+	var err error
+	/*************************************************/
+	count = 0
+	result, err = request(server.URL+"/retry", nil)
+	if err != nil || reflect.DeepEqual(result, types.M{"id": "1001"}) == false {
+		t.Error("expect:", types.M{"id": "1001"}, "result:", result, err)
+	}
+	if count != 3 {
+		t.Error("expect:", 3, "result:", count)
+	}
+	/*************************************************/
+	count = 0
+	_, err = request(server.URL+"/fail", nil)
+	if err == nil {
+		t.Error("expect:", "error", "result:", err)
+	}
+	if count != 3 {
+		t.Error("expect:", 3, "result:", count)
+	}
+	if reflect.DeepEqual(requestFailed(err, "Facebook"), errs.E(errs.ObjectNotFound, "Failed to validate this access token with Facebook.")) == false {
+		t.Error("expect:", "ObjectNotFound", "result:", requestFailed(err, "Facebook"))
+	}
+	/*************************************************/
+	// 重试之间等待 50ms 、 100ms
+	count = 0
+	start := time.Now()
+	_, err = request(server.URL+"/fail", nil)
+	if err == nil || time.Since(start) < 150*time.Millisecond {
+		t.Error("expect:", ">= 150ms", "result:", time.Since(start), err)
+	}
+	/*************************************************/
+	// POST 请求不重试
+	count = 0
+	_, err = post(server.URL+"/fail", nil, map[string]string{"code": "1001"})
+	if err == nil {
+		t.Error("expect:", "error", "result:", err)
+	}
+	if count != 1 {
+		t.Error("expect:", 1, "result:", count)
+	}
+	/*************************************************/
+	count = 0
+	_, err = request(server.URL+"/slow", nil)
+	if _, ok := err.(*TimeoutError); ok == false {
+		t.Error("expect:", "*TimeoutError", "result:", err)
+	}
+	if count != 1 {
+		t.Error("expect:", 1, "result:", count)
+	}
+	if reflect.DeepEqual(requestFailed(err, "Facebook"), errs.E(errs.Timeout, "Request to Facebook timed out.")) == false {
+		t.Error("expect:", "Timeout", "result:", requestFailed(err, "Facebook"))
+	}
+}
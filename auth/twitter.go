@@ -6,21 +6,40 @@ import (
 	"github.com/lfq7413/tomato/utils"
 )
 
+// twitterHost Twitter API 地址
+var twitterHost = "https://api.twitter.com"
+
 type twitter struct{}
 
+// ValidateAuthData 使用 OAuth1 签名请求 verify_credentials ，校验返回的用户 ID
+// authData 中的 token 可以使用 oauth_token oauth_token_secret ，或者 auth_token auth_token_secret
 func (a twitter) ValidateAuthData(authData types.M, options types.M) error {
 	// 具体接口参考：https://dev.twitter.com/rest/reference/get/account/verify_credentials
 	// https://dev.twitter.com/rest/tools/console
-	if len(options) == 0 {
+	if len(options) == 0 || utils.S(options["consumer_key"]) == "" {
 		return errs.E(errs.InternalServerError, "No options passed to OAuth")
 	}
 	client := NewOAuth(options)
-	client.Host = "https://api.twitter.com"
-	client.AuthToken = utils.S(authData["access_token"])
-	client.AuthTokenSecret = utils.S(authData["auth_token_secret"])
+	client.Host = twitterHost
+	client.AuthToken = utils.S(authData["oauth_token"])
+	if client.AuthToken == "" {
+		client.AuthToken = utils.S(authData["auth_token"])
+	}
+	client.AuthTokenSecret = utils.S(authData["oauth_token_secret"])
+	if client.AuthTokenSecret == "" {
+		client.AuthTokenSecret = utils.S(authData["auth_token_secret"])
+	}
 	data, err := client.Get("/1.1/account/verify_credentials.json", nil)
 	if err != nil {
-		return errs.E(errs.ObjectNotFound, "Failed to validate this access token with Twitter.")
+		return requestFailed(err, "Twitter")
+	}
+	// 签名或者 token 无效时，返回 {"errors":[{"code":32,"message":"Could not authenticate you."}]}
+	if errors := utils.A(data["errors"]); len(errors) > 0 {
+		message := ""
+		if e := utils.M(errors[0]); e != nil {
+			message = utils.S(e["message"])
+		}
+		return errs.E(errs.ObjectNotFound, "Twitter rejected the OAuth request: "+message)
 	}
 	if data["id_str"] != nil && utils.S(data["id_str"]) == utils.S(authData["id"]) {
 		return nil
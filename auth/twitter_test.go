@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lfq7413/tomato/errs"
+	"github.com/lfq7413/tomato/types"
+)
+
+func Test_twitter_ValidateAuthData(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if strings.Contains(header, `oauth_consumer_key="key"`) == false || strings.Contains(header, `oauth_token="token"`) == false {
+			w.WriteHeader(401)
+			w.Write([]byte(`{"errors":[{"code":32,"message":"Could not authenticate you."}]}`))
+			return
+		}
+		w.Write([]byte(`{"id_str":"1001"}`))
+	}))
+	defer server.Close()
+	host := twitterHost
+	twitterHost = server.URL
+	defer func() { twitterHost = host }()
+
+	a := twitter{}
+	var authData types.M
+	var options types.M
+	var err error
+	var expect error
+	/*************************************************/
+	authData = types.M{"id": "1001", "oauth_token": "token", "oauth_token_secret": "secret"}
+	options = nil
+	err = a.ValidateAuthData(authData, options)
+	expect = errs.E(errs.InternalServerError, "No options passed to OAuth")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/*************************************************/
+	authData = types.M{"id": "1001", "oauth_token": "token", "oauth_token_secret": "secret"}
+	options = types.M{"consumer_key": "key", "consumer_secret": "secret"}
+	err = a.ValidateAuthData(authData, options)
+	if err != nil {
+		t.Error("expect:", nil, "result:", err)
+	}
+	/*************************************************/
+	authData = types.M{"id": "1001", "auth_token": "token", "auth_token_secret": "secret"}
+	options = types.M{"consumer_key": "key", "consumer_secret": "secret"}
+	err = a.ValidateAuthData(authData, options)
+	if err != nil {
+		t.Error("expect:", nil, "result:", err)
+	}
+	/*************************************************/
+	authData = types.M{"id": "1002", "oauth_token": "token", "oauth_token_secret": "secret"}
+	options = types.M{"consumer_key": "key", "consumer_secret": "secret"}
+	err = a.ValidateAuthData(authData, options)
+	expect = errs.E(errs.ObjectNotFound, "Twitter auth is invalid for this user.")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/*************************************************/
+	authData = types.M{"id": "1001", "oauth_token": "other", "oauth_token_secret": "secret"}
+	options = types.M{"consumer_key": "key", "consumer_secret": "secret"}
+	err = a.ValidateAuthData(authData, options)
+	expect = errs.E(errs.ObjectNotFound, "Twitter rejected the OAuth request: Could not authenticate you.")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+}
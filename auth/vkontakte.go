@@ -11,7 +11,7 @@ type vkontakte struct{}
 func (a vkontakte) ValidateAuthData(authData types.M, params types.M) error {
 	response, err := a.vkOAuth2Request(params)
 	if err != nil {
-		return errs.E(errs.ObjectNotFound, "Failed to validate this access token with Vk.")
+		return requestFailed(err, "Vk")
 	}
 	if response != nil && utils.S(response["access_token"]) != "" {
 		host := "https://api.vk.com/"
@@ -20,7 +20,7 @@ func (a vkontakte) ValidateAuthData(authData types.M, params types.M) error {
 			"&access_token=" + utils.S(response["access_token"])
 		data, err := request(host+path, nil)
 		if err != nil {
-			return errs.E(errs.ObjectNotFound, "Failed to validate this access token with Vk.")
+			return requestFailed(err, "Vk")
 		}
 		if res := utils.M(data["response"]); res != nil {
 			if utils.S(res["user_id"]) == utils.S(authData["id"]) {
@@ -17,7 +17,7 @@ func (a weibo) ValidateAuthData(authData types.M, options types.M) error {
 	}
 	data, err := post(host+path, nil, requestData)
 	if err != nil {
-		return errs.E(errs.ObjectNotFound, "Failed to validate this access token with Weibo.")
+		return requestFailed(err, "Weibo")
 	}
 	if data["uid"] != nil && utils.S(data["uid"]) == utils.S(authData["id"]) {
 		return nil
@@ -14,7 +14,7 @@ func (a weixin) ValidateAuthData(authData types.M, options types.M) error {
 	path := "auth?access_token=" + utils.S(authData["access_token"]) + "&openid=" + utils.S(authData["id"])
 	data, err := request(host+path, nil)
 	if err != nil {
-		return errs.E(errs.ObjectNotFound, "Failed to validate this access token with Weixin.")
+		return requestFailed(err, "Weixin")
 	}
 	if code, ok := data["errcode"].(float64); ok && code == 0 {
 		if data["errmsg"] != nil && utils.S(data["errmsg"]) == "ok" {
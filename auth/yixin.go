@@ -14,7 +14,7 @@ func (a yixin) ValidateAuthData(authData types.M, options types.M) error {
 	path := "userinfo?access_token=" + utils.S(authData["access_token"])
 	data, err := request(host+path, nil)
 	if err != nil {
-		return errs.E(errs.ObjectNotFound, "Failed to validate this access token with Yixin.")
+		return requestFailed(err, "Yixin")
 	}
 	if code, ok := data["code"].(float64); ok && code == 1 {
 		if userinfo := utils.M(data["userinfo"]); userinfo != nil {
@@ -16,7 +16,7 @@ func (a youdao) ValidateAuthData(authData types.M, options types.M) error {
 	client.AuthTokenSecret = utils.S(authData["auth_token_secret"])
 	data, err := client.Get("/yws/open/user/get.json", nil)
 	if err != nil {
-		return errs.E(errs.ObjectNotFound, "Failed to validate this access token with Youdao.")
+		return requestFailed(err, "Youdao")
 	}
 	if data["user"] != nil && utils.S(data["user"]) == utils.S(authData["id"]) {
 		return nil
@@ -22,7 +22,7 @@ type SchemaCache struct {
 // singleCache 默认为 false
 func NewSchemaCache(ttl int, singleCache bool) *SchemaCache {
 	if adapter == nil {
-		adapter = newInMemoryCacheAdapter(5)
+		adapter = newInMemoryCacheAdapter(5, 0)
 	}
 	prefix := schemaCachePrefix
 	if singleCache == false {
@@ -2,6 +2,7 @@ package cache
 
 import (
 	"strings"
+	"sync/atomic"
 
 	"github.com/lfq7413/tomato/config"
 )
@@ -14,22 +15,28 @@ var User *SubCache
 
 var adapter Adapter
 
+// userAdapter 用户缓存使用的适配器， InMemory 时单独使用一个 LRU ，避免大量 session 把 schema 与角色缓存淘汰
+var userAdapter Adapter
+
 func init() {
 	a := config.TConfig.CacheAdapter
-	if a == "InMemory" {
-		adapter = newInMemoryCacheAdapter(5)
-	} else if a == "Redis" {
+	if a == "Redis" {
 		adapter = newRedisCacheAdapter(config.TConfig.RedisAddress, config.TConfig.RedisPassword, 0)
+		userAdapter = adapter
 	} else if a == "Null" {
 		adapter = newNullMemoryCacheAdapter()
+		userAdapter = adapter
 	} else {
-		adapter = newInMemoryCacheAdapter(5)
+		adapter = newInMemoryCacheAdapter(5, config.TConfig.CacheMaxSize)
+		userAdapter = newInMemoryCacheAdapter(5, config.TConfig.UserCacheMaxSize)
 	}
 	Role = &SubCache{
-		prefix: "role",
+		prefix:  "role",
+		adapter: adapter,
 	}
 	User = &SubCache{
-		prefix: "user",
+		prefix:  "user",
+		adapter: userAdapter,
 	}
 }
 
@@ -54,36 +61,51 @@ func del(key string) {
 	adapter.del(cacheKey)
 }
 
-func clear() {
-	adapter.clear()
+// DefaultTTL 返回缓存适配器的默认有效期，单位为秒， put 时 ttl 为 0 即使用该有效期
+func DefaultTTL() int64 {
+	return adapter.defaultTTL()
 }
 
 // SubCache ...
 type SubCache struct {
-	prefix string
+	prefix  string
+	adapter Adapter
+	hits    uint64
+	misses  uint64
 }
 
 // Get ...
 func (c *SubCache) Get(key string) interface{} {
-	cacheKey := joinKeys(c.prefix, key)
-	return get(cacheKey)
+	cacheKey := joinKeys(config.TConfig.AppID, c.prefix, key)
+	value := c.adapter.get(cacheKey)
+	if value == nil {
+		atomic.AddUint64(&c.misses, 1)
+	} else {
+		atomic.AddUint64(&c.hits, 1)
+	}
+	return value
+}
+
+// Stats 返回缓存的命中与未命中次数，通过 /health/cache 接口查看
+func (c *SubCache) Stats() (hits, misses uint64) {
+	return atomic.LoadUint64(&c.hits), atomic.LoadUint64(&c.misses)
 }
 
 // Put ...
 func (c *SubCache) Put(key string, value interface{}, ttl int64) {
-	cacheKey := joinKeys(c.prefix, key)
-	put(cacheKey, value, ttl)
+	cacheKey := joinKeys(config.TConfig.AppID, c.prefix, key)
+	c.adapter.put(cacheKey, value, ttl)
 }
 
 // Del ...
 func (c *SubCache) Del(key string) {
-	cacheKey := joinKeys(c.prefix, key)
-	del(cacheKey)
+	cacheKey := joinKeys(config.TConfig.AppID, c.prefix, key)
+	c.adapter.del(cacheKey)
 }
 
 // Clear ...
 func (c *SubCache) Clear() {
-	clear()
+	c.adapter.clear()
 }
 
 // Adapter ...
@@ -92,15 +114,19 @@ type Adapter interface {
 	put(key string, value interface{}, ttl int64)
 	del(key string)
 	clear()
+	defaultTTL() int64
 }
 
 // InitCache 仅用于测试
 func InitCache() {
-	adapter = newInMemoryCacheAdapter(5)
+	adapter = newInMemoryCacheAdapter(5, 0)
+	userAdapter = newInMemoryCacheAdapter(5, 0)
 	Role = &SubCache{
-		prefix: "role",
+		prefix:  "role",
+		adapter: adapter,
 	}
 	User = &SubCache{
-		prefix: "user",
+		prefix:  "user",
+		adapter: userAdapter,
 	}
 }
@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"container/list"
 	"sync"
 	"time"
 
@@ -10,20 +11,25 @@ import (
 // TODO 增加定时清理过期缓存的操作
 
 type inMemoryCacheAdapter struct {
-	mu    sync.Mutex
-	ttl   int64
-	cache map[string]*recordCache
+	mu      sync.Mutex
+	ttl     int64
+	maxSize int
+	cache   map[string]*list.Element
+	lru     *list.List // 最近使用的记录在队首，超过 maxSize 时从队尾淘汰
 }
 
 const defaultCacheTTL = 5
 
-func newInMemoryCacheAdapter(ttl int64) *inMemoryCacheAdapter {
+// newInMemoryCacheAdapter ttl 为默认有效期，单位为秒， maxSize 为最多缓存的记录数，为 0 时不限制
+func newInMemoryCacheAdapter(ttl int64, maxSize int) *inMemoryCacheAdapter {
 	if ttl == 0 {
 		ttl = defaultCacheTTL
 	}
 	m := &inMemoryCacheAdapter{
-		ttl:   ttl,
-		cache: map[string]*recordCache{},
+		ttl:     ttl,
+		maxSize: maxSize,
+		cache:   map[string]*list.Element{},
+		lru:     list.New(),
 	}
 	return m
 }
@@ -31,11 +37,13 @@ func newInMemoryCacheAdapter(ttl int64) *inMemoryCacheAdapter {
 func (m *inMemoryCacheAdapter) get(key string) interface{} {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	if record, ok := m.cache[key]; ok {
+	if e, ok := m.cache[key]; ok {
+		record := e.Value.(*recordCache)
 		if record.expire == -1 || record.expire >= time.Now().UnixNano() {
+			m.lru.MoveToFront(e)
 			return utils.DeepCopy(record.value)
 		}
-		delete(m.cache, key)
+		m.remove(e)
 		return nil
 	}
 	return nil
@@ -47,34 +55,62 @@ func (m *inMemoryCacheAdapter) put(key string, value interface{}, ttl int64) {
 	defer m.mu.Unlock()
 	var expire int64
 	if ttl == 0 {
-		expire = m.ttl*10e9 + time.Now().UnixNano()
+		expire = m.ttl*int64(time.Second) + time.Now().UnixNano()
 	} else if ttl == -1 {
 		expire = -1
 	} else {
-		expire = ttl*10e9 + time.Now().UnixNano()
+		expire = ttl*int64(time.Second) + time.Now().UnixNano()
+	}
+
+	if e, ok := m.cache[key]; ok {
+		record := e.Value.(*recordCache)
+		record.value = value
+		record.expire = expire
+		m.lru.MoveToFront(e)
+		return
 	}
 
 	record := &recordCache{
+		key:    key,
 		value:  value,
 		expire: expire,
 	}
+	m.cache[key] = m.lru.PushFront(record)
 
-	m.cache[key] = record
+	if m.maxSize > 0 {
+		for m.lru.Len() > m.maxSize {
+			m.remove(m.lru.Back())
+		}
+	}
 }
 
 func (m *inMemoryCacheAdapter) del(key string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	delete(m.cache, key)
+	if e, ok := m.cache[key]; ok {
+		m.remove(e)
+	}
 }
 
 func (m *inMemoryCacheAdapter) clear() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	m.cache = map[string]*recordCache{}
+	m.cache = map[string]*list.Element{}
+	m.lru.Init()
+}
+
+func (m *inMemoryCacheAdapter) defaultTTL() int64 {
+	return m.ttl
+}
+
+// remove 删除记录，调用方需持有锁
+func (m *inMemoryCacheAdapter) remove(e *list.Element) {
+	m.lru.Remove(e)
+	delete(m.cache, e.Value.(*recordCache).key)
 }
 
 type recordCache struct {
+	key    string
 	expire int64
 	value  interface{}
 }
@@ -0,0 +1,111 @@
+package cache
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lfq7413/tomato/types"
+)
+
+func Test_inMemoryCacheAdapter(t *testing.T) {
+	var m *inMemoryCacheAdapter
+	var result interface{}
+	var expect interface{}
+	/*********************************************************/
+	m = newInMemoryCacheAdapter(5, 0)
+	m.put("a", types.M{"key": "value"}, 0)
+	result = m.get("a")
+	expect = types.M{"key": "value"}
+	if reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "result:", result)
+	}
+	m.del("a")
+	result = m.get("a")
+	if result != nil {
+		t.Error("expect:", nil, "result:", result)
+	}
+	/*********************************************************/
+	m = newInMemoryCacheAdapter(5, 0)
+	m.put("a", "1", 1)
+	m.put("b", "2", -1)
+	m.cache["a"].Value.(*recordCache).expire = time.Now().UnixNano() - 1
+	result = m.get("a")
+	if result != nil {
+		t.Error("expect:", nil, "result:", result)
+	}
+	if _, ok := m.cache["a"]; ok || m.lru.Len() != 1 {
+		t.Error("expect:", "expired record removed", "result:", m.lru.Len())
+	}
+	result = m.get("b")
+	if result != "2" {
+		t.Error("expect:", "2", "result:", result)
+	}
+	/*********************************************************/
+	m = newInMemoryCacheAdapter(5, 2)
+	m.put("a", "1", 0)
+	m.put("b", "2", 0)
+	m.get("a")
+	m.put("c", "3", 0)
+	if m.get("b") != nil {
+		t.Error("expect:", nil, "result:", m.get("b"))
+	}
+	if m.get("a") != "1" || m.get("c") != "3" {
+		t.Error("expect:", "1", "3", "result:", m.get("a"), m.get("c"))
+	}
+	m.put("a", "4", 0)
+	m.put("d", "5", 0)
+	if m.get("c") != nil || m.get("a") != "4" || m.get("d") != "5" {
+		t.Error("expect:", nil, "4", "5", "result:", m.get("c"), m.get("a"), m.get("d"))
+	}
+	/*********************************************************/
+	m.clear()
+	if m.get("a") != nil || m.lru.Len() != 0 {
+		t.Error("expect:", 0, "result:", m.lru.Len())
+	}
+}
+
+func Test_SubCache_Stats(t *testing.T) {
+	InitCache()
+	User.Put("abc", types.M{"objectId": "1001"}, 0)
+	User.Get("abc")
+	User.Get("abc")
+	User.Get("def")
+	hits, misses := User.Stats()
+	if hits != 2 || misses != 1 {
+		t.Error("expect:", 2, 1, "result:", hits, misses)
+	}
+	hits, misses = Role.Stats()
+	if hits != 0 || misses != 0 {
+		t.Error("expect:", 0, 0, "result:", hits, misses)
+	}
+}
+
+func Test_SubCache_userAdapter(t *testing.T) {
+	defer InitCache()
+	adapter = newInMemoryCacheAdapter(5, 2)
+	userAdapter = newInMemoryCacheAdapter(5, 2)
+	Role = &SubCache{prefix: "role", adapter: adapter}
+	User = &SubCache{prefix: "user", adapter: userAdapter}
+	/*********************************************************/
+	// 大量用户缓存不会淘汰角色缓存
+	Role.Put("1001", []string{"role:admin"}, 0)
+	User.Put("a", types.M{"objectId": "1001"}, 0)
+	User.Put("b", types.M{"objectId": "1002"}, 0)
+	User.Put("c", types.M{"objectId": "1003"}, 0)
+	if reflect.DeepEqual([]string{"role:admin"}, Role.Get("1001")) == false {
+		t.Error("expect:", []string{"role:admin"}, "result:", Role.Get("1001"))
+	}
+	if User.Get("a") != nil {
+		t.Error("expect:", nil, "result:", User.Get("a"))
+	}
+	/*********************************************************/
+	// 清除用户缓存不影响角色缓存
+	User.Clear()
+	if User.Get("c") != nil {
+		t.Error("expect:", nil, "result:", User.Get("c"))
+	}
+	if Role.Get("1001") == nil {
+		t.Error("expect:", []string{"role:admin"}, "result:", nil)
+	}
+}
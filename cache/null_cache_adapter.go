@@ -20,3 +20,7 @@ func (m *nullCacheAdapter) del(key string) {
 
 func (m *nullCacheAdapter) clear() {
 }
+
+func (m *nullCacheAdapter) defaultTTL() int64 {
+	return 0
+}
@@ -97,3 +97,7 @@ func (m *redisCacheAdapter) del(key string) {
 func (m *redisCacheAdapter) clear() {
 	m.do("FLUSHDB")
 }
+
+func (m *redisCacheAdapter) defaultTTL() int64 {
+	return int64(m.ttl)
+}
@@ -83,6 +83,16 @@ func AfterFind(className string, handler TriggerHandler) error {
 	return nil
 }
 
+// BeforeLogin 校验密码之后、创建 session 之前执行，返回错误时拒绝登录
+func BeforeLogin(handler TriggerHandler) {
+	AddTrigger(TypeBeforeLogin, "_User", handler)
+}
+
+// AfterLogout 通过 /logout 删除 session 之后执行
+func AfterLogout(handler TriggerHandler) {
+	AddTrigger(TypeAfterLogout, "_Session", handler)
+}
+
 // RemoveHook ...
 func RemoveHook(category, name, triggerType string) {
 	Unregister(category, name, triggerType)
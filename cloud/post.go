@@ -2,57 +2,129 @@ package cloud
 
 import (
 	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"time"
 
 	"github.com/lfq7413/tomato/config"
+	"github.com/lfq7413/tomato/errs"
 	"github.com/lfq7413/tomato/types"
 	"github.com/lfq7413/tomato/utils"
 )
 
-// post 请求网络接口
+// webhookClient 所有 webhook 请求共用的 http.Client ，单次请求的超时时间由 context 控制
+var webhookClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   5 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	},
+}
+
+// retryBackoff 第一次重试前的等待时间，之后每次翻倍
+var retryBackoff = 100 * time.Millisecond
+
+// post 请求网络接口，请求超时或者网络错误时最多重试 retries 次
 // 接口返回格式如下：
 // {
 // 	"success":{},
 // 	"error":{},
 // }
-func post(params types.M, URL string) (r types.M, e types.M) {
+func post(params types.M, URL string, retries int) (r types.M, e types.M) {
 	jsonParams, err := json.Marshal(params)
 	if err != nil {
 		return types.M{}, types.M{"code": -1, "message": "Malformed response"}
 	}
-	request, err := http.NewRequest("POST", URL, bytes.NewBuffer(jsonParams))
+
+	var body []byte
+	for i := 0; ; i++ {
+		body, err = doPost(jsonParams, URL)
+		if err == nil || i >= retries {
+			break
+		}
+		time.Sleep(retryBackoff << uint(i))
+	}
+	if err != nil {
+		if e, ok := err.(net.Error); ok && e.Timeout() {
+			return types.M{}, types.M{"code": errs.ScriptFailed, "message": "Webhook request timed out."}
+		}
+		return types.M{}, types.M{"code": -1, "message": "Malformed response"}
+	}
+
+	var result types.M
+	err = json.Unmarshal(body, &result)
 	if err != nil {
 		return types.M{}, types.M{"code": -1, "message": "Malformed response"}
 	}
 
+	if result["error"] != nil {
+		return types.M{}, types.M{"code": 0, "message": utils.S(result["error"])}
+	}
+	if _, ok := result["success"]; ok == false {
+		return result, nil
+	}
+
+	return utils.M(result["success"]), nil
+}
+
+// doPost 发送一次请求，超时时间为 WebhookTimeout 秒
+func doPost(jsonParams []byte, URL string) ([]byte, error) {
+	request, err := http.NewRequest("POST", URL, bytes.NewBuffer(jsonParams))
+	if err != nil {
+		return nil, err
+	}
+
 	request.Header.Set("Content-Type", "application/json")
 	if config.TConfig.WebhookKey != "" {
 		request.Header.Add("X-Parse-Webhook-Key", config.TConfig.WebhookKey)
+		request.Header.Add("X-Tomato-Signature", signPayload(config.TConfig.WebhookKey, jsonParams))
 	}
 
-	client := http.DefaultClient
-	response, err := client.Do(request)
-	if err != nil {
-		return types.M{}, types.M{"code": -1, "message": "Malformed response"}
+	if config.TConfig.WebhookTimeout > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.TConfig.WebhookTimeout)*time.Second)
+		defer cancel()
+		request = request.WithContext(ctx)
 	}
-	defer response.Body.Close()
 
-	body, err := ioutil.ReadAll(response.Body)
+	response, err := webhookClient.Do(request)
 	if err != nil {
-		return types.M{}, types.M{"code": -1, "message": "Malformed response"}
+		return nil, err
 	}
+	defer response.Body.Close()
 
-	var result types.M
-	err = json.Unmarshal(body, &result)
+	body, err := ioutil.ReadAll(response.Body)
 	if err != nil {
-		return types.M{}, types.M{"code": -1, "message": "Malformed response"}
+		return nil, err
 	}
-
-	if result["error"] != nil {
-		return types.M{}, types.M{"code": 0, "message": utils.S(result["error"])}
+	// 设置了 WebhookKey 时，webhook 必须返回签名，校验返回数据是否被篡改
+	if config.TConfig.WebhookKey != "" {
+		signature := response.Header.Get("X-Tomato-Signature")
+		if signature == "" {
+			return nil, errors.New("missing webhook response signature")
+		}
+		if hmac.Equal([]byte(signature), []byte(signPayload(config.TConfig.WebhookKey, body))) == false {
+			return nil, errors.New("invalid webhook response signature")
+		}
 	}
+	return body, nil
+}
 
-	return utils.M(result["success"]), nil
+// signPayload 使用 WebhookKey 计算数据的 HMAC-SHA256 签名，返回十六进制字符串
+func signPayload(key string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
 }
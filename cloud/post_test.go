@@ -0,0 +1,221 @@
+package cloud
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lfq7413/tomato/config"
+	"github.com/lfq7413/tomato/errs"
+	"github.com/lfq7413/tomato/types"
+)
+
+func Test_post(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow":
+			time.Sleep(1500 * time.Millisecond)
+		case "/error":
+			w.Write([]byte(`{"error":"bad request"}`))
+			return
+		}
+		w.Write([]byte(`{"success":{"key":"hello"}}`))
+	}))
+	defer server.Close()
+	config.TConfig = &config.Config{WebhookTimeout: 1}
+
+	var result types.M
+	var err types.M
+	var expect types.M
+	/*************************************************/
+	result, err = post(types.M{}, server.URL+"/ok", 0)
+	expect = types.M{"key": "hello"}
+	if err != nil || reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "result:", result, err)
+	}
+	/*************************************************/
+	_, err = post(types.M{}, server.URL+"/error", 0)
+	expect = types.M{"code": 0, "message": "bad request"}
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/*************************************************/
+	_, err = post(types.M{}, server.URL+"/slow", 0)
+	expect = types.M{"code": errs.ScriptFailed, "message": "Webhook request timed out."}
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+}
+
+func Test_post_signature(t *testing.T) {
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		body := []byte(`{"success":{"key":"hello"}}`)
+		switch r.URL.Path {
+		case "/signed":
+			w.Header().Set("X-Tomato-Signature", signPayload("webhookkey", body))
+		case "/forged":
+			w.Header().Set("X-Tomato-Signature", signPayload("otherkey", body))
+		}
+		w.Write(body)
+	}))
+	defer server.Close()
+	config.TConfig = &config.Config{WebhookKey: "webhookkey"}
+
+	var result types.M
+	var err types.M
+	var expect types.M
+	/*************************************************/
+	signature := signPayload("webhookkey", []byte(`{"params":{}}`))
+	if signature != "ca1b5642f832deac654ca2562fb99d354bb70c321e47deca051d4ac1a954e8a8" {
+		t.Error("expect:", "ca1b5642f832deac654ca2562fb99d354bb70c321e47deca051d4ac1a954e8a8", "result:", signature)
+	}
+	/*************************************************/
+	result, err = post(types.M{"params": types.M{}}, server.URL+"/signed", 0)
+	expect = types.M{"key": "hello"}
+	if err != nil || reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "result:", result, err)
+	}
+	if header.Get("X-Parse-Webhook-Key") != "webhookkey" {
+		t.Error("expect:", "webhookkey", "result:", header.Get("X-Parse-Webhook-Key"))
+	}
+	if header.Get("X-Tomato-Signature") != signature {
+		t.Error("expect:", signature, "result:", header.Get("X-Tomato-Signature"))
+	}
+	/*************************************************/
+	_, err = post(types.M{"params": types.M{}}, server.URL+"/forged", 0)
+	expect = types.M{"code": -1, "message": "Malformed response"}
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/*************************************************/
+	_, err = post(types.M{"params": types.M{}}, server.URL+"/unsigned", 0)
+	expect = types.M{"code": -1, "message": "Malformed response"}
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+}
+
+func Test_GetTriggerHandler(t *testing.T) {
+	var count int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count++
+		if count < 3 {
+			// 前两次请求直接断开连接
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		w.Write([]byte(`{"success":{}}`))
+	}))
+	defer server.Close()
+	config.TConfig = &config.Config{WebhookTimeout: 1, WebhookRetries: 2}
+	backoff := retryBackoff
+	retryBackoff = time.Millisecond
+	defer func() { retryBackoff = backoff }()
+
+	var request TriggerRequest
+	var response *TriggerResponse
+	/*************************************************/
+	count = 0
+	request = TriggerRequest{TriggerName: TypeAfterSave, Object: types.M{}}
+	response = &TriggerResponse{Request: request}
+	GetTriggerHandler(server.URL)(request, response)
+	if response.Err != nil {
+		t.Error("expect:", nil, "result:", response.Err)
+	}
+	if count != 3 {
+		t.Error("expect:", 3, "result:", count)
+	}
+	/*************************************************/
+	count = 0
+	request = TriggerRequest{TriggerName: TypeBeforeSave, Object: types.M{}}
+	response = &TriggerResponse{Request: request}
+	GetTriggerHandler(server.URL)(request, response)
+	if response.Err == nil {
+		t.Error("expect:", "error", "result:", nil)
+	}
+	if count != 1 {
+		t.Error("expect:", 1, "result:", count)
+	}
+}
+
+func Test_GetTriggerHandler_beforeSave(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"object":{"status":"approved","createdAt":"2017-01-01T00:00:00.000Z"}}`))
+	}))
+	defer server.Close()
+	config.TConfig = &config.Config{WebhookTimeout: 1}
+
+	request := TriggerRequest{TriggerName: TypeBeforeSave, Object: types.M{"status": "pending"}}
+	response := &TriggerResponse{Request: request}
+	GetTriggerHandler(server.URL)(request, response)
+	expect := types.M{"object": types.M{"status": "approved", "createdAt": "2017-01-01T00:00:00.000Z"}}
+	if response.Err != nil || reflect.DeepEqual(expect, response.Response) == false {
+		t.Error("expect:", expect, "result:", response.Response, response.Err)
+	}
+}
+
+type testJobStatus struct {
+	status  string
+	message string
+}
+
+func (j *testJobStatus) SetSucceeded(message string) {
+	j.status = "succeeded"
+	j.message = message
+}
+
+func (j *testJobStatus) SetFailed(message string) {
+	j.status = "failed"
+	j.message = message
+}
+
+func (j *testJobStatus) SetMessage(message string) {
+	j.message = message
+}
+
+func Test_GetJobHandler(t *testing.T) {
+	var body types.M
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body = types.M{}
+		json.NewDecoder(r.Body).Decode(&body)
+		if r.URL.Path == "/error" {
+			w.Write([]byte(`{"error":"job failed"}`))
+			return
+		}
+		w.Write([]byte(`{"success":{"message":"done"}}`))
+	}))
+	defer server.Close()
+	config.TConfig = &config.Config{WebhookTimeout: 1}
+
+	var request JobRequest
+	var status *testJobStatus
+	var expect types.M
+	/*************************************************/
+	request = JobRequest{Params: types.M{"key": "hello"}, JobName: "job", JobID: "1001"}
+	status = &testJobStatus{}
+	GetJobHandler(server.URL+"/ok")(request, JobResponse{JobStatus: status})
+	if status.status != "succeeded" || status.message != "done" {
+		t.Error("expect:", "succeeded", "done", "result:", status.status, status.message)
+	}
+	expect = types.M{
+		"params":  map[string]interface{}{"key": "hello"},
+		"headers": nil,
+		"jobName": "job",
+		"jobId":   "1001",
+	}
+	if reflect.DeepEqual(expect, body) == false {
+		t.Error("expect:", expect, "result:", body)
+	}
+	/*************************************************/
+	status = &testJobStatus{}
+	GetJobHandler(server.URL+"/error")(request, JobResponse{JobStatus: status})
+	if status.status != "failed" || status.message != "job failed" {
+		t.Error("expect:", "failed", "job failed", "result:", status.status, status.message)
+	}
+}
@@ -1,6 +1,10 @@
 package cloud
 
-import "github.com/lfq7413/tomato/types"
+import (
+	"github.com/lfq7413/tomato/config"
+	"github.com/lfq7413/tomato/types"
+	"github.com/lfq7413/tomato/utils"
+)
 
 // RemoteDefine ...
 func RemoteDefine(functionName string, functionHandlerURL, validatorHandlerURL string) {
@@ -27,6 +31,28 @@ func RemoteAfterDelete(className string, triggerHandlerURL string) error {
 	return AfterDelete(className, GetTriggerHandler(triggerHandlerURL))
 }
 
+// RemoteBeforeLogin ...
+func RemoteBeforeLogin(triggerHandlerURL string) {
+	BeforeLogin(GetTriggerHandler(triggerHandlerURL))
+}
+
+// RemoteAfterLogout ...
+func RemoteAfterLogout(triggerHandlerURL string) {
+	AfterLogout(GetTriggerHandler(triggerHandlerURL))
+}
+
+// RemoteJob ...
+func RemoteJob(jobName string, jobHandlerURL string) {
+	Job(jobName, GetJobHandler(jobHandlerURL))
+}
+
+// idempotentTriggers 可以安全重试的回调类型
+var idempotentTriggers = map[string]bool{
+	TypeBeforeFind: true,
+	TypeAfterFind:  true,
+	TypeAfterSave:  true,
+}
+
 // GetFunctionHandler ...
 func GetFunctionHandler(url string) FunctionHandler {
 	return func(request FunctionRequest, response Response) {
@@ -37,7 +63,7 @@ func GetFunctionHandler(url string) FunctionHandler {
 			"installationID": request.InstallationID,
 			"headers":        request.Headers,
 		}
-		result, err := post(params, url)
+		result, err := post(params, url, 0)
 		if err != nil {
 			response.Error(err["code"].(int), err["message"].(string))
 			return
@@ -56,7 +82,7 @@ func GetValidatorHandler(url string) ValidatorHandler {
 			"installationID": request.InstallationID,
 			"headers":        request.Headers,
 		}
-		result, _ := post(params, url)
+		result, _ := post(params, url, 0)
 		if v, ok := result["result"].(bool); ok {
 			return v
 		}
@@ -71,20 +97,49 @@ func GetTriggerHandler(url string) TriggerHandler {
 			"triggerName":    request.TriggerName,
 			"object":         request.Object,
 			"original":       request.Original,
+			"context":        request.Context,
 			"master":         request.Master,
 			"user":           request.User,
 			"installationID": request.InstallationID,
 		}
-		result, err := post(params, url)
+		retries := 0
+		if idempotentTriggers[request.TriggerName] {
+			retries = config.TConfig.WebhookRetries
+		}
+		result, err := post(params, url, retries)
 		if err != nil {
 			response.Error(err["code"].(int), err["message"].(string))
 			return
 		}
 		if request.TriggerName == TypeBeforeSave {
-			delete(result, "createdAt")
-			delete(result, "updatedAt")
-			request.Object = result
+			// 返回数据可以是修改后的对象，也可以是 {"object":{...}}
+			object := result
+			if o := utils.M(result["object"]); o != nil {
+				object = o
+			}
+			if len(object) > 0 {
+				response.Success(object)
+				return
+			}
 		}
 		response.Success(nil)
 	}
 }
+
+// GetJobHandler 远程任务返回 {"success":{"message":"..."}} 时标记为成功
+func GetJobHandler(url string) JobHandler {
+	return func(request JobRequest, response JobResponse) {
+		params := types.M{
+			"params":  request.Params,
+			"headers": request.Headers,
+			"jobName": request.JobName,
+			"jobId":   request.JobID,
+		}
+		result, err := post(params, url, 0)
+		if err != nil {
+			response.Error(utils.S(err["message"]))
+			return
+		}
+		response.Success(utils.S(result["message"]))
+	}
+}
@@ -17,6 +17,10 @@ const (
 	TypeBeforeDelete = "beforeDelete"
 	// TypeAfterDelete 删除后回调
 	TypeAfterDelete = "afterDelete"
+	// TypeBeforeLogin 登录前回调，仅用于 _User
+	TypeBeforeLogin = "beforeLogin"
+	// TypeAfterLogout 退出登录后回调，仅用于 _Session
+	TypeAfterLogout = "afterLogout"
 	// TypeBeforeFind 查询前回调
 	TypeBeforeFind = "beforeFind"
 	// TypeAfterFind 查询后回调
@@ -31,6 +35,7 @@ type TriggerRequest struct {
 	Query          types.M // beforeFind 时使用
 	Count          bool    // beforeFind 时使用
 	Objects        types.S // afterFind 时使用
+	Context        types.M // beforeSave afterSave 时使用，由客户端通过 _context 传入
 	Master         bool
 	User           types.M
 	InstallationID string
@@ -77,18 +82,32 @@ var functions map[string]FunctionHandler
 var validators map[string]ValidatorHandler
 var jobs map[string]JobHandler
 
+// webhookTriggers webhookFunctions webhookJobs 通过 hooks 注册的远程回调，优先级低于本地注册的函数
+var webhookTriggers map[string]map[string]TriggerHandler
+var webhookFunctions map[string]FunctionHandler
+var webhookJobs map[string]JobHandler
+
 func init() {
-	triggers = map[string]map[string]TriggerHandler{
+	triggers = newTriggers()
+	functions = map[string]FunctionHandler{}
+	validators = map[string]ValidatorHandler{}
+	jobs = map[string]JobHandler{}
+	webhookTriggers = newTriggers()
+	webhookFunctions = map[string]FunctionHandler{}
+	webhookJobs = map[string]JobHandler{}
+}
+
+func newTriggers() map[string]map[string]TriggerHandler {
+	return map[string]map[string]TriggerHandler{
 		TypeBeforeSave:   map[string]TriggerHandler{},
 		TypeAfterSave:    map[string]TriggerHandler{},
 		TypeBeforeDelete: map[string]TriggerHandler{},
 		TypeAfterDelete:  map[string]TriggerHandler{},
 		TypeBeforeFind:   map[string]TriggerHandler{},
 		TypeAfterFind:    map[string]TriggerHandler{},
+		TypeBeforeLogin:  map[string]TriggerHandler{},
+		TypeAfterLogout:  map[string]TriggerHandler{},
 	}
-	functions = map[string]FunctionHandler{}
-	validators = map[string]ValidatorHandler{}
-	jobs = map[string]JobHandler{}
 }
 
 // AddFunction 添加函数到列表
@@ -107,6 +126,39 @@ func AddTrigger(triggerType string, className string, handler TriggerHandler) {
 	triggers[triggerType][className] = handler
 }
 
+// AddWebhookFunction 添加远程函数，同名的本地函数存在时优先执行本地函数
+func AddWebhookFunction(name string, handler FunctionHandler) {
+	webhookFunctions[name] = handler
+}
+
+// AddWebhookJob 添加远程任务，同名的本地任务存在时优先执行本地任务
+func AddWebhookJob(name string, handler JobHandler) {
+	webhookJobs[name] = handler
+}
+
+// AddWebhookTrigger 添加远程回调函数，同名的本地回调存在时优先执行本地回调
+func AddWebhookTrigger(triggerType string, className string, handler TriggerHandler) {
+	if _, ok := webhookTriggers[triggerType]; ok == false {
+		return
+	}
+	webhookTriggers[triggerType][className] = handler
+}
+
+// RemoveWebhookFunction 删除远程函数
+func RemoveWebhookFunction(name string) {
+	delete(webhookFunctions, name)
+}
+
+// RemoveWebhookJob 删除远程任务
+func RemoveWebhookJob(name string) {
+	delete(webhookJobs, name)
+}
+
+// RemoveWebhookTrigger 删除远程回调函数
+func RemoveWebhookTrigger(triggerType string, className string) {
+	delete(webhookTriggers[triggerType], className)
+}
+
 // RemoveFunction 从列表删除函数
 func RemoveFunction(name string) {
 	delete(functions, name)
@@ -142,26 +194,21 @@ func Unregister(category, name, triggerType string) {
 
 // UnregisterAll 删除所有注册的云代码
 func UnregisterAll() {
-	triggers = map[string]map[string]TriggerHandler{
-		TypeBeforeSave:   map[string]TriggerHandler{},
-		TypeAfterSave:    map[string]TriggerHandler{},
-		TypeBeforeDelete: map[string]TriggerHandler{},
-		TypeAfterDelete:  map[string]TriggerHandler{},
-	}
+	triggers = newTriggers()
 	functions = map[string]FunctionHandler{}
 	validators = map[string]ValidatorHandler{}
 	jobs = map[string]JobHandler{}
+	webhookTriggers = newTriggers()
+	webhookFunctions = map[string]FunctionHandler{}
+	webhookJobs = map[string]JobHandler{}
 }
 
-// GetTrigger 获取回调函数
+// GetTrigger 获取回调函数，先查找本地注册的回调，不存在时再查找远程回调
 func GetTrigger(triggerType string, className string) TriggerHandler {
-	if triggers == nil {
-		return nil
-	}
-	if _, ok := triggers[triggerType]; ok == false {
-		return nil
+	if v := triggers[triggerType][className]; v != nil {
+		return v
 	}
-	if v, ok := triggers[triggerType][className]; ok {
+	if v := webhookTriggers[triggerType][className]; v != nil {
 		return v
 	}
 	return nil
@@ -172,12 +219,12 @@ func TriggerExists(triggerType string, className string) bool {
 	return GetTrigger(triggerType, className) != nil
 }
 
-// GetFunction 获取函数
+// GetFunction 获取函数，先查找本地注册的函数，不存在时再查找远程函数
 func GetFunction(name string) FunctionHandler {
-	if functions == nil {
-		return nil
+	if v := functions[name]; v != nil {
+		return v
 	}
-	if v, ok := functions[name]; ok {
+	if v := webhookFunctions[name]; v != nil {
 		return v
 	}
 	return nil
@@ -194,23 +241,27 @@ func GetValidator(name string) ValidatorHandler {
 	return nil
 }
 
-// GetJob 获取定时任务
+// GetJob 获取定时任务，先查找本地注册的任务，不存在时再查找远程任务
 func GetJob(name string) JobHandler {
-	if jobs == nil {
-		return nil
+	if v := jobs[name]; v != nil {
+		return v
 	}
-	if v, ok := jobs[name]; ok {
+	if v := webhookJobs[name]; v != nil {
 		return v
 	}
 	return nil
 }
 
-// GetJobs 获取定时任务
+// GetJobs 获取所有定时任务，包括远程任务
 func GetJobs() map[string]JobHandler {
-	if jobs == nil {
-		return nil
+	result := map[string]JobHandler{}
+	for name, handler := range webhookJobs {
+		result[name] = handler
+	}
+	for name, handler := range jobs {
+		result[name] = handler
 	}
-	return jobs
+	return result
 }
 
 // TriggerResponse ...
@@ -234,6 +285,8 @@ func (t *TriggerResponse) Success(response interface{}) {
 	if t.Response != nil &&
 		reflect.DeepEqual(t.Response, t.Request.Object) == false &&
 		t.Request.TriggerName == TypeBeforeSave {
+		// 回调返回了修改后的对象
+		t.Response = types.M{"object": t.Response}
 		return
 	}
 	if t.Response != nil && t.Request.TriggerName == TypeBeforeFind {
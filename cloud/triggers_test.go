@@ -0,0 +1,51 @@
+package cloud
+
+import (
+	"testing"
+)
+
+func Test_Job(t *testing.T) {
+	UnregisterAll()
+	defer UnregisterAll()
+	var local, remote JobHandler
+	var ran string
+	local = func(request JobRequest, response JobResponse) { ran = "local" }
+	remote = func(request JobRequest, response JobResponse) { ran = "remote" }
+	/*************************************************/
+	Job("job", local)
+	if handler := GetJob("job"); handler == nil {
+		t.Error("expect:", "job", "result:", nil)
+	} else {
+		handler(JobRequest{JobName: "job"}, JobResponse{})
+		if ran != "local" {
+			t.Error("expect:", "local", "result:", ran)
+		}
+	}
+	/*************************************************/
+	// 同名的本地任务优先
+	AddWebhookJob("job", remote)
+	GetJob("job")(JobRequest{JobName: "job"}, JobResponse{})
+	if ran != "local" {
+		t.Error("expect:", "local", "result:", ran)
+	}
+	RemoveJob("job")
+	GetJob("job")(JobRequest{JobName: "job"}, JobResponse{})
+	if ran != "remote" {
+		t.Error("expect:", "remote", "result:", ran)
+	}
+	/*************************************************/
+	Job("job2", local)
+	jobs := GetJobs()
+	if len(jobs) != 2 || jobs["job"] == nil || jobs["job2"] == nil {
+		t.Error("expect:", "job job2", "result:", jobs)
+	}
+	/*************************************************/
+	RemoveWebhookJob("job")
+	if GetJob("job") != nil {
+		t.Error("expect:", nil, "result:", "job")
+	}
+	Unregister("jobs", "job2", "")
+	if GetJob("job2") != nil || len(GetJobs()) != 0 {
+		t.Error("expect:", 0, "result:", len(GetJobs()))
+	}
+}
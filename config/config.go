@@ -4,6 +4,8 @@ import (
 	"time"
 
 	"log"
+	"net"
+	"path/filepath"
 
 	"regexp"
 
@@ -28,10 +30,23 @@ type Config struct {
 	EnableAnonymousUsers             bool     // 是否支持匿名用户，默认为 true 支持匿名用户
 	VerifyUserEmails                 bool     // 是否需要验证用户的 Email ，默认为 false 不需要验证
 	EmailVerifyTokenValidityDuration int      // 邮箱验证 Token 有效期，单位为秒，取值大于等于 0 ，默认为 0 表示不设置 Token 有效期
-	MailAdapter                      string   // 邮件发送模块，仅在 VerifyUserEmails=true 时需要配置，可选： smtp ，默认为 smtp
+	VerificationEmailRequestInterval int      // 同一用户两次请求发送验证邮件的最小间隔，单位为秒，默认为 300 秒，为 0 时不限制
+	MailAdapter                      string   // 邮件发送模块，VerifyUserEmails=true 时必须可用，可选： smtp、mailgun ，默认为 smtp ，未配置 SMTPServer 时不发送邮件
 	SMTPServer                       string   // SMTP 邮箱服务器地址，仅在 MailAdapter=smtp 时需要配置
-	MailUsername                     string   // SMTP 用户名，仅在 MailAdapter=smtp 时需要配置
-	MailPassword                     string   // SMTP 密码，仅在 MailAdapter=smtp 时需要配置
+	SMTPPort                         int      // SMTP 端口，默认为 25
+	SMTPUseTLS                       bool     // 是否使用 TLS 连接 SMTP 服务器，默认为 false ，此时如服务器支持则使用 STARTTLS
+	MailUsername                     string   // SMTP 用户名，为空时不进行认证
+	MailPassword                     string   // SMTP 密码，选填
+	MailFrom                         string   // 发件人地址，默认为 MailUsername
+	VerificationEmailSubject         string   // 验证邮件主题模板，支持 %username% %email% %appname% %link% 占位符，为空时使用默认模板
+	VerificationEmailBody            string   // 验证邮件内容模板，占位符同上，为空时使用默认模板
+	VerificationEmailHTML            string   // 验证邮件 HTML 内容模板，占位符同上，选填
+	PasswordResetEmailSubject        string   // 密码重置邮件主题模板，占位符同上，为空时使用默认模板
+	PasswordResetEmailBody           string   // 密码重置邮件内容模板，占位符同上，为空时使用默认模板
+	PasswordResetEmailHTML           string   // 密码重置邮件 HTML 内容模板，占位符同上，选填
+	MailgunAPIKey                    string   // Mailgun API Key ，仅在 MailAdapter=mailgun 时需要配置
+	MailgunDomain                    string   // Mailgun 发信域名，仅在 MailAdapter=mailgun 时需要配置
+	MailgunAPIURL                    string   // Mailgun API 地址，默认为 https://api.mailgun.net/v3 ，欧洲区域可使用 https://api.eu.mailgun.net/v3
 	FileAdapter                      string   // 文件存储模块，可选： Disk、GridFS、Qiniu、Sina、Tencent， 默认为 Disk 本地磁盘存储
 	FileDirectAccess                 bool     // 是否允许直接访问文件地址，默认为 true 允许直接访问而不是通过 tomato 中转
 	QiniuBucket                      string   // 七牛云存储 Bucket ，仅在 FileAdapter=Qiniu 时需要配置
@@ -47,30 +62,53 @@ type Config struct {
 	TencentAppID                     string   // 腾讯云存储 AppID ，仅在 FileAdapter=Tencent 时需要配置
 	TencentSecretID                  string   // 腾讯云存储 SecretID ，仅在 FileAdapter=Tencent 时需要配置
 	TencentSecretKey                 string   // 腾讯云存储 SecretKey ，仅在 FileAdapter=Tencent 时需要配置
-	PushAdapter                      string   // 推送模块，可选：FCM，默认为 tomato
+	PushAdapter                      string   // 推送模块，可选：FCM、APNS，默认为 tomato
 	PushChannel                      string   // 推送通道
 	PushBatchSize                    int      // 批量推送的大小
-	ScheduledPush                    bool     // 是否有推送调度器
+	ScheduledPush                    bool     // 是否启用定时推送，启用后设置了 push_time 的推送会在指定时间发送
 	LiveQueryClasses                 string   // LiveQuery 支持的 classe ，多个 class 使用 | 隔开，如： classeA|classeB|classeC
 	PublisherType                    string   // 发布者类型，可选：Redis ，默认使用自带的 EventEmitter
 	PublisherURL                     string   // 发布者地址， PublisherType=Redis 时必填
 	PublisherConfig                  string   // 发布者配置信息， PublisherType=Redis 时为 Redis 密码，选填
 	SessionLength                    int      // Session 有效期，单位为秒，取值大于 0 ，默认为 31536000 秒，即 1 年
 	RevokeSessionOnPasswordReset     bool     // 密码重置后是否清除 Session ，默认为 true 清除 Session
+	ExpireInactiveSessions           bool     // 是否在使用 Session 时刷新其过期时间，使活跃用户不会过期，默认为 false
+	SessionCleanupInterval           int      // 定期删除已过期 Session 的时间间隔，单位为秒， 0 表示不清理，默认为 3600 秒
 	PreventLoginWithUnverifiedEmail  bool     // 是否阻止未验证邮箱的用户登录，默认为 false 不阻止
 	CacheAdapter                     string   // 缓存模块，可选： InMemory、Redis、Null， 默认为 InMemory 使用内存做缓存模块
 	RedisAddress                     string   // Redis 地址， CacheAdapter=Redis 时必填
 	RedisPassword                    string   // Redis 密码，选填
 	SchemaCacheTTL                   int      // Schema 缓存有效期，单位为秒。取值： -1 表示永不过期，0 表示使用 CacheAdapter 自身的有效期，或者大于 0 ，默认为 5 秒
 	EnableSingleSchemaCache          bool     // 是否允许缓存唯一一份 SchemaCache ，默认为 false 不允许
-	WebhookKey                       string   // 用于云代码鉴权
+	EnableRoleCache                  bool     // 是否缓存用户所属的角色列表，默认为 true
+	RoleCacheTTL                     int      // 角色缓存有效期，单位为秒。取值： -1 表示永不过期，0 表示使用 CacheAdapter 自身的有效期，或者大于 0 ，默认为 0
+	EnableUserCache                  bool     // 是否缓存 sessionToken 对应的用户信息，默认为 true
+	UserCacheTTL                     int      // 用户缓存有效期，单位为秒。取值： -1 表示直到 session 过期，0 表示使用 CacheAdapter 自身的有效期，或者大于 0 ，默认为 0 。实际有效期不会超过 session 的剩余有效期
+	CacheMaxSize                     int      // InMemory 缓存最多保存的记录数（不含用户缓存），超出时淘汰最久未使用的记录， 0 表示不限制，默认为 10000
+	UserCacheMaxSize                 int      // InMemory 缓存中用户缓存单独保存的最多记录数，避免大量 session 挤占 schema 与角色缓存， 0 表示不限制，默认为 10000
+	WebhookKey                       string   // 用于云代码鉴权，同时用于计算 webhook 请求与响应的 X-Tomato-Signature 签名
+	AllowInsecureWebhooks            bool     // 是否允许使用 http 地址注册 webhook ，默认为 false 仅允许 https
+	WebhookTimeout                   int      // 请求 webhook 的超时时间，单位为秒，默认为 15 秒
+	WebhookRetries                   int      // beforeFind afterFind afterSave 类型的 webhook 请求失败时的重试次数，默认为 0 不重试
 	EnableAccountLockout             bool     // 是否启用账户锁定规则，默认为 false 不启用
 	AccountLockoutThreshold          int      // 锁定账户需要的登录失败次数，取值范围： 1-999 ，默认为 3 次
 	AccountLockoutDuration           int      // 锁定账户时长，单位为分钟，取值范围： 1-99999 ，默认为 10 分钟
+	UnlockOnPasswordReset            bool     // 重置密码成功后是否解除账户锁定，默认为 false 需等待锁定时长结束
+	EnableIPLockout                  bool     // 是否按客户端 IP 统计登录失败次数并锁定该 IP ，与账户锁定相互独立，默认为 false 不启用
+	IPLockoutThreshold               int      // 锁定 IP 需要的登录失败次数，取值范围： 1-9999 ，默认为 20 次
+	IPLockoutDuration                int      // 锁定 IP 时长，同时也是统计失败次数的时间窗口，单位为分钟，取值范围： 1-99999 ，默认为 10 分钟
+	TrustedProxies                   []string // 可信的反向代理地址， IP 或者 CIDR ，多个使用 | 分隔，只有请求来自可信代理时才使用 X-Forwarded-For 中的客户端 IP
 	PasswordPolicy                   bool     // 是否启用密码规则，默认为 false 不启用
 	ResetTokenValidityDuration       int      // 密码重置验证 Token 有效期，单位为秒，取值大于等于 0 ，默认为 0 表示不设置 Token 有效期
+	ResetTokenReuseIfValid           bool     // 重复请求重置密码时，如果已有的 Token 未过期则继续使用，仅在设置了 Token 有效期时生效，默认为 false
 	ValidatorPattern                 string   // 校验密码规则的正则表达式
+	ValidationError                  string   // 密码不符合规则时返回的错误信息，默认为 Password does not meet the Password Policy requirements.
 	DoNotAllowUsername               bool     // 是否启用密码中不允许包含用户名，默认为 false 不启用，密码中可包含用户名
+	PasswordMinLength                int      // 密码最小长度，取值大于等于 0 ，默认为 0 表示不限制
+	PasswordRequireMixedCase         bool     // 密码是否必须同时包含大写与小写字母，默认为 false
+	PasswordRequireNumber            bool     // 密码是否必须包含数字，默认为 false
+	PasswordRequireSymbol            bool     // 密码是否必须包含字母与数字以外的符号，默认为 false
+	PasswordPolicyExemptMaster       bool     // 使用 Master Key 修改密码时是否跳过密码规则校验，重置密码流程不受影响，默认为 false
 	MaxPasswordAge                   int      // 密码的最长使用时间，单位为天，取值大于等于 0 ，默认为 0 表示不设置最长使用时间
 	MaxPasswordHistory               int      // 最大密码历史个数，修改的密码不能与密码历史重复，取值范围： 0-20 ，默认为 0 表示不设置密码历史
 	UserSensitiveFields              []string // 用户敏感字段，按需删除，多个字段使用 | 删除，如： email|password
@@ -79,15 +117,34 @@ type Config struct {
 	InfluxDBUsername                 string   // InfluxDB 用户名，仅在 AnalyticsAdapter=InfluxDB 时需要配置
 	InfluxDBPassword                 string   // InfluxDB 密码，仅在 AnalyticsAdapter=InfluxDB 时需要配置
 	InfluxDBDatabaseName             string   // InfluxDB 数据库，仅在 AnalyticsAdapter=InfluxDB 时需要配置
-	InvalidLink                      string   // 自定义页面地址，无效链接页面
-	InvalidVerificationLink          string   // 自定义页面地址，无效验证链接页面
-	LinkSendSuccess                  string   // 自定义页面地址，发送成功页面
-	LinkSendFail                     string   // 自定义页面地址，发送失败页面
-	VerifyEmailSuccess               string   // 自定义页面地址，验证邮箱成功页面
-	ChoosePassword                   string   // 自定义页面地址，修改密码页面
-	PasswordResetSuccess             string   // 自定义页面地址，密码重置成功页面
+	InvalidLink                      string   // 自定义页面，无效链接页面。以 .html 结尾时视为本地页面文件，否则为重定向地址，下同
+	InvalidVerificationLink          string   // 自定义页面，无效验证链接页面
+	LinkSendSuccess                  string   // 自定义页面，发送成功页面
+	LinkSendFail                     string   // 自定义页面，发送失败页面
+	VerifyEmailSuccess               string   // 自定义页面，验证邮箱成功页面
+	ChoosePassword                   string   // 自定义页面，修改密码页面
+	PasswordResetSuccess             string   // 自定义页面，密码重置成功页面
 	ParseFrameURL                    string   // 自定义页面地址，用于呈现验证 Email 页面和密码重置页面
+	PagesPath                        string   // 自定义页面模板所在目录，如 invalid_link.html ，文件不存在时使用内置页面
 	FCMServerKey                     string   // FCM Server Key
+	APNSKeyFile                      string   // APNS 推送使用的 .p8 私钥文件路径
+	APNSKeyID                        string   // APNS 私钥对应的 Key ID
+	APNSTeamID                       string   // Apple 开发者账号的 Team ID
+	APNSTopic                        string   // 默认推送的 Bundle ID ，设备存在 appIdentifier 时优先使用 appIdentifier
+	APNSProduction                   bool     // 是否使用 APNS 正式环境，默认为 false 使用 sandbox 环境
+	FacebookAppIDs                   []string // 允许登录的 Facebook 应用 ID ，多个 ID 使用 | 分隔
+	FacebookAppSecret                string   // Facebook 应用的 App Secret ，设置后请求 Graph API 时附带 appsecret_proof ，选填
+	TwitterConsumerKey               string   // Twitter 应用的 Consumer Key
+	TwitterConsumerSecret            string   // Twitter 应用的 Consumer Secret
+	GoogleClientIDs                  []string // 允许登录的 Google Client ID ，多个 ID 使用 | 分隔，未配置时不能使用 id_token 登录
+	AuthRequestTimeout               int      // 请求第三方登录接口的超时时间，单位为秒，默认为 10 秒
+	AuthRequestRetries               int      // 第三方登录接口的 GET 请求遇到网络错误或者 5xx 响应时的重试次数，默认为 2 次
+	BatchRequestLimit                int      // 批量请求中允许的最大子请求数，取值大于 0 ，默认为 50
+	SubqueryLimit                    int      // $select $dontSelect 子查询允许返回的最大结果数，为 0 时不限制，默认为 10000
+	MaxIncludeDepth                  int      // include 中以 . 分隔的路径允许的最大层数，为 0 时不限制，默认为 10
+
+	// ValidatorCallback 校验密码规则的回调函数，仅在代码中设置，返回 false 表示密码不符合规则
+	ValidatorCallback func(string) bool
 }
 
 var (
@@ -130,24 +187,58 @@ func parseConfig() {
 
 	TConfig.SessionLength = beego.AppConfig.DefaultInt("SessionLength", 31536000)
 	TConfig.RevokeSessionOnPasswordReset = beego.AppConfig.DefaultBool("RevokeSessionOnPasswordReset", true)
+	TConfig.ExpireInactiveSessions = beego.AppConfig.DefaultBool("ExpireInactiveSessions", false)
+	TConfig.SessionCleanupInterval = beego.AppConfig.DefaultInt("SessionCleanupInterval", 3600)
 	TConfig.PreventLoginWithUnverifiedEmail = beego.AppConfig.DefaultBool("PreventLoginWithUnverifiedEmail", false)
 	TConfig.EmailVerifyTokenValidityDuration = beego.AppConfig.DefaultInt("EmailVerifyTokenValidityDuration", 0)
+	TConfig.VerificationEmailRequestInterval = beego.AppConfig.DefaultInt("VerificationEmailRequestInterval", 300)
 	TConfig.SchemaCacheTTL = beego.AppConfig.DefaultInt("SchemaCacheTTL", 5)
 
 	TConfig.SMTPServer = beego.AppConfig.String("SMTPServer")
+	TConfig.SMTPPort = beego.AppConfig.DefaultInt("SMTPPort", 25)
+	TConfig.SMTPUseTLS = beego.AppConfig.DefaultBool("SMTPUseTLS", false)
 	TConfig.MailUsername = beego.AppConfig.String("MailUsername")
 	TConfig.MailPassword = beego.AppConfig.String("MailPassword")
+	TConfig.MailFrom = beego.AppConfig.DefaultString("MailFrom", TConfig.MailUsername)
+	TConfig.VerificationEmailSubject = beego.AppConfig.String("VerificationEmailSubject")
+	TConfig.VerificationEmailBody = beego.AppConfig.String("VerificationEmailBody")
+	TConfig.VerificationEmailHTML = beego.AppConfig.String("VerificationEmailHTML")
+	TConfig.PasswordResetEmailSubject = beego.AppConfig.String("PasswordResetEmailSubject")
+	TConfig.PasswordResetEmailBody = beego.AppConfig.String("PasswordResetEmailBody")
+	TConfig.PasswordResetEmailHTML = beego.AppConfig.String("PasswordResetEmailHTML")
+	TConfig.MailgunAPIKey = beego.AppConfig.String("MailgunAPIKey")
+	TConfig.MailgunDomain = beego.AppConfig.String("MailgunDomain")
+	TConfig.MailgunAPIURL = beego.AppConfig.DefaultString("MailgunAPIURL", "https://api.mailgun.net/v3")
 	TConfig.WebhookKey = beego.AppConfig.String("WebhookKey")
+	TConfig.AllowInsecureWebhooks = beego.AppConfig.DefaultBool("AllowInsecureWebhooks", false)
+	TConfig.WebhookTimeout = beego.AppConfig.DefaultInt("WebhookTimeout", 15)
+	TConfig.WebhookRetries = beego.AppConfig.DefaultInt("WebhookRetries", 0)
 
 	TConfig.EnableAccountLockout = beego.AppConfig.DefaultBool("EnableAccountLockout", false)
 	TConfig.AccountLockoutThreshold = beego.AppConfig.DefaultInt("AccountLockoutThreshold", 3)
 	TConfig.AccountLockoutDuration = beego.AppConfig.DefaultInt("AccountLockoutDuration", 10)
+	TConfig.UnlockOnPasswordReset = beego.AppConfig.DefaultBool("UnlockOnPasswordReset", false)
+	TConfig.EnableIPLockout = beego.AppConfig.DefaultBool("EnableIPLockout", false)
+	TConfig.IPLockoutThreshold = beego.AppConfig.DefaultInt("IPLockoutThreshold", 20)
+	TConfig.IPLockoutDuration = beego.AppConfig.DefaultInt("IPLockoutDuration", 10)
+	TConfig.TrustedProxies = []string{}
+	for _, proxy := range strings.Split(beego.AppConfig.String("TrustedProxies"), "|") {
+		if proxy != "" {
+			TConfig.TrustedProxies = append(TConfig.TrustedProxies, proxy)
+		}
+	}
 
 	TConfig.CacheAdapter = beego.AppConfig.DefaultString("CacheAdapter", "InMemory")
 	TConfig.RedisAddress = beego.AppConfig.String("RedisAddress")
 	TConfig.RedisPassword = beego.AppConfig.String("RedisPassword")
 
 	TConfig.EnableSingleSchemaCache = beego.AppConfig.DefaultBool("EnableSingleSchemaCache", false)
+	TConfig.EnableRoleCache = beego.AppConfig.DefaultBool("EnableRoleCache", true)
+	TConfig.RoleCacheTTL = beego.AppConfig.DefaultInt("RoleCacheTTL", 0)
+	TConfig.EnableUserCache = beego.AppConfig.DefaultBool("EnableUserCache", true)
+	TConfig.UserCacheTTL = beego.AppConfig.DefaultInt("UserCacheTTL", 0)
+	TConfig.CacheMaxSize = beego.AppConfig.DefaultInt("CacheMaxSize", 10000)
+	TConfig.UserCacheMaxSize = beego.AppConfig.DefaultInt("UserCacheMaxSize", 10000)
 
 	TConfig.QiniuBucket = beego.AppConfig.String("QiniuBucket")
 	TConfig.QiniuDomain = beego.AppConfig.String("QiniuDomain")
@@ -168,8 +259,15 @@ func parseConfig() {
 
 	TConfig.PasswordPolicy = beego.AppConfig.DefaultBool("PasswordPolicy", false)
 	TConfig.ResetTokenValidityDuration = beego.AppConfig.DefaultInt("ResetTokenValidityDuration", 0)
+	TConfig.ResetTokenReuseIfValid = beego.AppConfig.DefaultBool("ResetTokenReuseIfValid", false)
 	TConfig.ValidatorPattern = beego.AppConfig.String("ValidatorPattern")
+	TConfig.ValidationError = beego.AppConfig.String("ValidationError")
 	TConfig.DoNotAllowUsername = beego.AppConfig.DefaultBool("DoNotAllowUsername", false)
+	TConfig.PasswordMinLength = beego.AppConfig.DefaultInt("PasswordMinLength", 0)
+	TConfig.PasswordRequireMixedCase = beego.AppConfig.DefaultBool("PasswordRequireMixedCase", false)
+	TConfig.PasswordRequireNumber = beego.AppConfig.DefaultBool("PasswordRequireNumber", false)
+	TConfig.PasswordRequireSymbol = beego.AppConfig.DefaultBool("PasswordRequireSymbol", false)
+	TConfig.PasswordPolicyExemptMaster = beego.AppConfig.DefaultBool("PasswordPolicyExemptMaster", false)
 	TConfig.MaxPasswordAge = beego.AppConfig.DefaultInt("MaxPasswordAge", 0)
 	TConfig.MaxPasswordHistory = beego.AppConfig.DefaultInt("MaxPasswordHistory", 0)
 
@@ -184,16 +282,47 @@ func parseConfig() {
 	TConfig.InfluxDBDatabaseName = beego.AppConfig.String("InfluxDBDatabaseName")
 
 	TConfig.InvalidLink = beego.AppConfig.String("InvalidLink")
+	TConfig.InvalidVerificationLink = beego.AppConfig.String("InvalidVerificationLink")
+	TConfig.LinkSendSuccess = beego.AppConfig.String("LinkSendSuccess")
+	TConfig.LinkSendFail = beego.AppConfig.String("LinkSendFail")
 	TConfig.VerifyEmailSuccess = beego.AppConfig.String("VerifyEmailSuccess")
 	TConfig.ChoosePassword = beego.AppConfig.String("ChoosePassword")
 	TConfig.PasswordResetSuccess = beego.AppConfig.String("PasswordResetSuccess")
 	TConfig.ParseFrameURL = beego.AppConfig.String("ParseFrameURL")
+	TConfig.PagesPath = beego.AppConfig.String("PagesPath")
 
 	TConfig.PushChannel = beego.AppConfig.String("PushChannel")
 	TConfig.PushBatchSize = beego.AppConfig.DefaultInt("PushBatchSize", 0)
 	TConfig.ScheduledPush = beego.AppConfig.DefaultBool("ScheduledPush", false)
 
 	TConfig.FCMServerKey = beego.AppConfig.String("FCMServerKey")
+	TConfig.APNSKeyFile = beego.AppConfig.String("APNSKeyFile")
+	TConfig.APNSKeyID = beego.AppConfig.String("APNSKeyID")
+	TConfig.APNSTeamID = beego.AppConfig.String("APNSTeamID")
+	TConfig.APNSTopic = beego.AppConfig.String("APNSTopic")
+	TConfig.APNSProduction = beego.AppConfig.DefaultBool("APNSProduction", false)
+
+	TConfig.FacebookAppIDs = []string{}
+	for _, id := range strings.Split(beego.AppConfig.String("FacebookAppIds"), "|") {
+		if id != "" {
+			TConfig.FacebookAppIDs = append(TConfig.FacebookAppIDs, id)
+		}
+	}
+	TConfig.FacebookAppSecret = beego.AppConfig.String("FacebookAppSecret")
+	TConfig.TwitterConsumerKey = beego.AppConfig.String("TwitterConsumerKey")
+	TConfig.TwitterConsumerSecret = beego.AppConfig.String("TwitterConsumerSecret")
+	TConfig.AuthRequestTimeout = beego.AppConfig.DefaultInt("AuthRequestTimeout", 10)
+	TConfig.AuthRequestRetries = beego.AppConfig.DefaultInt("AuthRequestRetries", 2)
+	TConfig.GoogleClientIDs = []string{}
+	for _, id := range strings.Split(beego.AppConfig.String("GoogleClientIds"), "|") {
+		if id != "" {
+			TConfig.GoogleClientIDs = append(TConfig.GoogleClientIDs, id)
+		}
+	}
+
+	TConfig.BatchRequestLimit = beego.AppConfig.DefaultInt("BatchRequestLimit", 50)
+	TConfig.SubqueryLimit = beego.AppConfig.DefaultInt("SubqueryLimit", 10000)
+	TConfig.MaxIncludeDepth = beego.AppConfig.DefaultInt("MaxIncludeDepth", 10)
 }
 
 // Validate 校验用户参数合法性
@@ -205,9 +334,12 @@ func Validate() {
 	validateLiveQueryConfiguration()
 	validateSessionConfiguration()
 	validateAccountLockoutPolicy()
+	validateIPLockoutPolicy()
 	validatePasswordPolicy()
 	validateCacheConfiguration()
 	validateAnalyticsConfiguration()
+	validateBatchConfiguration()
+	validateSubqueryConfiguration()
 }
 
 // validateApplicationConfiguration 校验应用相关参数
@@ -271,11 +403,21 @@ func validateMailConfiguration() {
 		if TConfig.SMTPServer == "" {
 			log.Fatalln("SMTPServer is required")
 		}
-		if TConfig.MailUsername == "" {
-			log.Fatalln("MailUsername is required")
+		if TConfig.SMTPPort <= 0 || TConfig.SMTPPort > 65535 {
+			log.Fatalln("SMTPPort must be a valid port number")
+		}
+		if TConfig.MailFrom == "" {
+			log.Fatalln("MailFrom is required")
+		}
+	case "mailgun":
+		if TConfig.MailgunAPIKey == "" {
+			log.Fatalln("MailgunAPIKey is required")
 		}
-		if TConfig.MailPassword == "" {
-			log.Fatalln("MailPassword is required")
+		if TConfig.MailgunDomain == "" {
+			log.Fatalln("MailgunDomain is required")
+		}
+		if TConfig.MailFrom == "" {
+			log.Fatalln("MailFrom is required")
 		}
 	default:
 		log.Fatalln("Unsupported MailAdapter")
@@ -283,6 +425,9 @@ func validateMailConfiguration() {
 	if TConfig.EmailVerifyTokenValidityDuration < 0 {
 		log.Fatalln("Email verify token validity duration must be a value greater than 0")
 	}
+	if TConfig.VerificationEmailRequestInterval < 0 {
+		log.Fatalln("VerificationEmailRequestInterval must be a value greater than or equal to 0")
+	}
 }
 
 // validateLiveQueryConfiguration 校验 LiveQuery 相关参数
@@ -304,6 +449,9 @@ func validateSessionConfiguration() {
 	if TConfig.SessionLength <= 0 {
 		log.Fatalln("Session length must be a value greater than 0")
 	}
+	if TConfig.SessionCleanupInterval < 0 {
+		log.Fatalln("SessionCleanupInterval should be 0 or an integer greater than 0")
+	}
 }
 
 // validateAccountLockoutPolicy 校验账户锁定规则
@@ -319,20 +467,41 @@ func validateAccountLockoutPolicy() {
 	}
 }
 
-// validatePasswordPolicy 校验密码规则
-func validatePasswordPolicy() {
-	if TConfig.PasswordPolicy == false {
+// validateIPLockoutPolicy 校验 IP 锁定规则
+func validateIPLockoutPolicy() {
+	if TConfig.EnableIPLockout == false {
 		return
 	}
+	if TConfig.IPLockoutDuration < 1 || TConfig.IPLockoutDuration > 99999 {
+		log.Fatalln("IP lockout duration should be greater than 0 and less than 100000")
+	}
+	if TConfig.IPLockoutThreshold < 1 || TConfig.IPLockoutThreshold > 9999 {
+		log.Fatalln("IP lockout threshold should be an integer greater than 0 and less than 10000")
+	}
+	for _, proxy := range TConfig.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			log.Fatalln("TrustedProxies should be IP addresses or CIDR ranges:", proxy)
+		}
+	}
+}
+
+// validatePasswordPolicy 校验密码规则
+func validatePasswordPolicy() {
 	if TConfig.ResetTokenValidityDuration < 0 {
 		log.Fatalln("ResetTokenValidityDuration must be a positive number")
 	}
+	if TConfig.PasswordPolicy == false {
+		return
+	}
 	if TConfig.ValidatorPattern != "" {
 		_, err := regexp.Compile(TConfig.ValidatorPattern)
 		if err != nil {
 			log.Fatalln("ValidatorPattern must be a RegExp")
 		}
 	}
+	if TConfig.PasswordMinLength < 0 {
+		log.Fatalln("PasswordMinLength must be a positive number")
+	}
 	if TConfig.MaxPasswordAge < 0 {
 		log.Fatalln("MaxPasswordAge must be a positive number")
 	}
@@ -356,6 +525,18 @@ func validateCacheConfiguration() {
 	if TConfig.SchemaCacheTTL < -1 {
 		log.Fatalln("SchemaCacheTTL should be -1 or 0 or an integer greater than 0")
 	}
+	if TConfig.RoleCacheTTL < -1 {
+		log.Fatalln("RoleCacheTTL should be -1 or 0 or an integer greater than 0")
+	}
+	if TConfig.UserCacheTTL < -1 {
+		log.Fatalln("UserCacheTTL should be -1 or 0 or an integer greater than 0")
+	}
+	if TConfig.CacheMaxSize < 0 {
+		log.Fatalln("CacheMaxSize should be 0 or an integer greater than 0")
+	}
+	if TConfig.UserCacheMaxSize < 0 {
+		log.Fatalln("UserCacheMaxSize should be 0 or an integer greater than 0")
+	}
 }
 
 // validateAnalyticsConfiguration 校验分析模块相关参数
@@ -382,6 +563,23 @@ func validateAnalyticsConfiguration() {
 	}
 }
 
+// validateBatchConfiguration 校验批量请求相关参数
+func validateBatchConfiguration() {
+	if TConfig.BatchRequestLimit <= 0 {
+		log.Fatalln("BatchRequestLimit must be a value greater than 0")
+	}
+}
+
+// validateSubqueryConfiguration 校验子查询相关参数
+func validateSubqueryConfiguration() {
+	if TConfig.SubqueryLimit < 0 {
+		log.Fatalln("SubqueryLimit must be a value greater than or equal to 0")
+	}
+	if TConfig.MaxIncludeDepth < 0 {
+		log.Fatalln("MaxIncludeDepth must be a value greater than or equal to 0")
+	}
+}
+
 // GenerateSessionExpiresAt 获取 Session 过期时间
 func GenerateSessionExpiresAt() time.Time {
 	expiresAt := time.Now().UTC()
@@ -401,7 +599,7 @@ func GenerateEmailVerifyTokenExpiresAt() time.Time {
 
 // GeneratePasswordResetTokenExpiresAt 获取 重置密码 验证 Token 过期时间
 func GeneratePasswordResetTokenExpiresAt() time.Time {
-	if TConfig.PasswordPolicy == false || TConfig.ResetTokenValidityDuration == 0 {
+	if TConfig.ResetTokenValidityDuration <= 0 {
 		return time.Time{}
 	}
 	expiresAt := time.Now().UTC()
@@ -409,9 +607,31 @@ func GeneratePasswordResetTokenExpiresAt() time.Time {
 	return expiresAt
 }
 
+// isCustomPageURL 自定义页面是否为重定向地址
+func isCustomPageURL(page string) bool {
+	return page != "" && isCustomPageFile(page) == false
+}
+
+// isCustomPageFile 自定义页面是否为本地页面文件
+func isCustomPageFile(page string) bool {
+	ext := strings.ToLower(filepath.Ext(page))
+	if ext != ".html" && ext != ".htm" {
+		return false
+	}
+	return strings.HasPrefix(page, "http://") == false && strings.HasPrefix(page, "https://") == false
+}
+
+// CustomPageFile 返回自定义页面对应的本地文件路径，未配置为本地文件时返回空
+func CustomPageFile(page string) string {
+	if isCustomPageFile(page) {
+		return page
+	}
+	return ""
+}
+
 // InvalidLinkURL ...
 func InvalidLinkURL() string {
-	if TConfig.InvalidLink != "" {
+	if isCustomPageURL(TConfig.InvalidLink) {
 		return TConfig.InvalidLink
 	}
 	return TConfig.ServerURL + `/apps/invalid_link`
@@ -419,7 +639,7 @@ func InvalidLinkURL() string {
 
 // InvalidVerificationLinkURL ...
 func InvalidVerificationLinkURL() string {
-	if TConfig.InvalidVerificationLink != "" {
+	if isCustomPageURL(TConfig.InvalidVerificationLink) {
 		return TConfig.InvalidVerificationLink
 	}
 	return TConfig.ServerURL + `/apps/invalid_verification_link`
@@ -427,7 +647,7 @@ func InvalidVerificationLinkURL() string {
 
 // LinkSendSuccessURL ...
 func LinkSendSuccessURL() string {
-	if TConfig.LinkSendSuccess != "" {
+	if isCustomPageURL(TConfig.LinkSendSuccess) {
 		return TConfig.LinkSendSuccess
 	}
 	return TConfig.ServerURL + `/apps/link_send_success`
@@ -435,7 +655,7 @@ func LinkSendSuccessURL() string {
 
 // LinkSendFailURL ...
 func LinkSendFailURL() string {
-	if TConfig.LinkSendFail != "" {
+	if isCustomPageURL(TConfig.LinkSendFail) {
 		return TConfig.LinkSendFail
 	}
 	return TConfig.ServerURL + `/apps/link_send_fail`
@@ -443,7 +663,7 @@ func LinkSendFailURL() string {
 
 // VerifyEmailSuccessURL ...
 func VerifyEmailSuccessURL() string {
-	if TConfig.VerifyEmailSuccess != "" {
+	if isCustomPageURL(TConfig.VerifyEmailSuccess) {
 		return TConfig.VerifyEmailSuccess
 	}
 	return TConfig.ServerURL + `/apps/verify_email_success`
@@ -451,7 +671,7 @@ func VerifyEmailSuccessURL() string {
 
 // ChoosePasswordURL ...
 func ChoosePasswordURL() string {
-	if TConfig.ChoosePassword != "" {
+	if isCustomPageURL(TConfig.ChoosePassword) {
 		return TConfig.ChoosePassword
 	}
 	return TConfig.ServerURL + `/apps/choose_password`
@@ -459,12 +679,12 @@ func ChoosePasswordURL() string {
 
 // RequestResetPasswordURL ...
 func RequestResetPasswordURL() string {
-	return TConfig.ServerURL + `/apps/request_password_reset`
+	return TConfig.ServerURL + `/apps/` + TConfig.AppID + `/request_password_reset`
 }
 
 // PasswordResetSuccessURL ...
 func PasswordResetSuccessURL() string {
-	if TConfig.PasswordResetSuccess != "" {
+	if isCustomPageURL(TConfig.PasswordResetSuccess) {
 		return TConfig.PasswordResetSuccess
 	}
 	return TConfig.ServerURL + `/apps/password_reset_success`
@@ -477,5 +697,5 @@ func ParseFrameURL() string {
 
 // VerifyEmailURL ...
 func VerifyEmailURL() string {
-	return TConfig.ServerURL + `/apps/verify_email`
+	return TConfig.ServerURL + `/apps/` + TConfig.AppID + `/verify_email`
 }
@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"encoding/json"
+
+	"github.com/lfq7413/tomato/errs"
+	"github.com/lfq7413/tomato/rest"
+	"github.com/lfq7413/tomato/types"
+	"github.com/lfq7413/tomato/utils"
+)
+
+// AggregateController 处理 /aggregate 接口的请求，仅允许 Master 权限访问
+// 支持的阶段有：group match project sort limit skip unwind count sample sortByCount
+// $out $merge 等会写入数据的阶段禁止使用，其他阶段返回 CommandUnavailable
+type AggregateController struct {
+	ClassesController
+}
+
+// aggregateStages 可直接作为参数传入的阶段，按此顺序组装管道
+var aggregateStages = []string{"match", "unwind", "group", "project", "sortByCount", "sort", "skip", "limit", "sample", "count"}
+
+// Prepare ...
+func (a *AggregateController) Prepare() {
+	a.ClassesController.Prepare()
+	if a.Ctx.ResponseWriter.Started == false {
+		a.EnforceMasterKeyAccess()
+	}
+}
+
+// HandleAggregate 处理聚合请求
+// 可在 pipeline 参数中传入完整的管道，也可以按阶段传入参数，如：
+// group={"objectId":"$city","total":{"$sum":1}}&sort={"total":-1}
+// @router /:className [get]
+func (a *AggregateController) HandleAggregate() {
+	if a.ClassName == "" {
+		a.ClassName = a.Ctx.Input.Param(":className")
+	}
+
+	pipeline, err := a.getPipeline()
+	if err != nil {
+		a.HandleError(err, 0)
+		return
+	}
+
+	options := types.M{"pipeline": pipeline}
+	response, err := rest.Find(a.Auth, a.ClassName, types.M{}, options, a.Info.ClientSDK)
+	if err != nil {
+		a.HandleError(err, 0)
+		return
+	}
+
+	a.Data["json"] = types.M{"results": response["results"]}
+	a.ServeJSON()
+}
+
+// getPipeline 从请求参数中组装聚合管道
+func (a *AggregateController) getPipeline() (types.S, error) {
+	var rawPipeline interface{}
+	if a.Query["pipeline"] != "" {
+		err := json.Unmarshal([]byte(a.Query["pipeline"]), &rawPipeline)
+		if err != nil {
+			return nil, errs.E(errs.InvalidJSON, "pipeline should be valid json")
+		}
+	} else if a.JSONBody != nil && a.JSONBody["pipeline"] != nil {
+		rawPipeline = a.JSONBody["pipeline"]
+	}
+	if rawPipeline != nil {
+		stages := utils.A(rawPipeline)
+		if stages == nil {
+			return nil, errs.E(errs.InvalidQuery, "pipeline must be an array")
+		}
+		for _, s := range stages {
+			if stage := utils.M(s); stage != nil {
+				transformGroupStage(stage)
+			}
+		}
+		return stages, nil
+	}
+
+	allowed := map[string]bool{}
+	for _, name := range aggregateStages {
+		allowed[name] = true
+	}
+	for k := range a.Query {
+		if allowed[k] == false {
+			return nil, errs.E(errs.InvalidQuery, "Invalid parameter for query: "+k)
+		}
+	}
+	for k := range a.JSONBody {
+		if allowed[k] == false {
+			return nil, errs.E(errs.InvalidQuery, "Invalid parameter for query: "+k)
+		}
+	}
+
+	pipeline := types.S{}
+	for _, name := range aggregateStages {
+		var value interface{}
+		if a.Query[name] != "" {
+			err := json.Unmarshal([]byte(a.Query[name]), &value)
+			if err != nil {
+				// 非 JSON 格式的值按字符串处理，如 count=total
+				value = a.Query[name]
+			}
+		} else if a.JSONBody != nil && a.JSONBody[name] != nil {
+			value = a.JSONBody[name]
+		} else {
+			continue
+		}
+		stage := types.M{"$" + name: value}
+		transformGroupStage(stage)
+		pipeline = append(pipeline, stage)
+	}
+
+	return pipeline, nil
+}
+
+// transformGroupStage 转换 $group 中的简写，使用 objectId 代替 _id
+func transformGroupStage(stage types.M) {
+	group := utils.M(stage["$group"])
+	if group == nil {
+		return
+	}
+	if id, ok := group["objectId"]; ok {
+		group["_id"] = id
+		delete(group, "objectId")
+	}
+}
@@ -40,6 +40,7 @@ type RequestInfo struct {
 	InstallationID string
 	ClientVersion  string
 	ClientSDK      map[string]string
+	ClientIP       string
 }
 
 // Prepare 对请求权限进行处理
@@ -58,6 +59,7 @@ func (b *BaseController) Prepare() {
 	info.RestAPIKey = b.Ctx.Input.Header("X-Parse-REST-API-Key")
 	info.SessionToken = b.Ctx.Input.Header("X-Parse-Session-Token")
 	info.InstallationID = b.Ctx.Input.Header("X-Parse-Installation-Id")
+	info.ClientIP = utils.ClientIP(b.Ctx.Request.RemoteAddr, b.Ctx.Input.Header("X-Forwarded-For"), config.TConfig.TrustedProxies)
 	info.ClientVersion = b.Ctx.Input.Header("X-Parse-Client-Version")
 
 	basicAuth := httpAuth(b.Ctx.Input.Header("Authorization"))
@@ -105,12 +107,16 @@ func (b *BaseController) Prepare() {
 		// Unclear at this point if action needs to be taken.
 		delete(b.JSONBody, "_noBody")
 		delete(b.JSONBody, "_method")
+		// 登录与注册总是创建带 r: 前缀、有过期时间的 _Session ，无需区分 _RevocableSession
+		delete(b.JSONBody, "_RevocableSession")
+	}
+
+	if err := b.setCloudContext(); err != nil {
+		b.HandleError(err, 0)
+		return
 	}
 
 	if info.AppID == "" {
-		if b.JSONBody != nil {
-			delete(b.JSONBody, "_RevocableSession")
-		}
 		// 从请求数据中获取各种 key
 		if b.JSONBody != nil && b.JSONBody["_ApplicationId"] != nil {
 			info.AppID = utils.S(b.JSONBody["_ApplicationId"])
@@ -251,6 +257,30 @@ func decodeBase64(str string) string {
 	return string(data)
 }
 
+// setCloudContext 从请求头中获取云代码 context ，请求数据中的 _context 优先
+// 仅创建与更新对象时使用，查询请求的 JSONBody 会作为查询参数，不能加入 _context
+func (b *BaseController) setCloudContext() error {
+	cloudContext := b.Ctx.Input.Header("X-Parse-Cloud-Context")
+	if cloudContext == "" {
+		return nil
+	}
+	if method := b.Ctx.Input.Method(); method != "POST" && method != "PUT" {
+		return nil
+	}
+	var object types.M
+	err := json.Unmarshal([]byte(cloudContext), &object)
+	if err != nil || object == nil {
+		return errs.E(errs.InvalidJSON, "X-Parse-Cloud-Context must be a JSON object")
+	}
+	if b.JSONBody == nil {
+		b.JSONBody = types.M{}
+	}
+	if b.JSONBody["_context"] == nil {
+		b.JSONBody["_context"] = object
+	}
+	return nil
+}
+
 // HandleError 返回错误信息，不指定 status 参数时，默认为 0
 func (b *BaseController) HandleError(err error, status int) {
 	code := errs.GetErrorCode(err)
@@ -0,0 +1,62 @@
+package controllers
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/astaxie/beego/context"
+	"github.com/lfq7413/tomato/errs"
+	"github.com/lfq7413/tomato/types"
+)
+
+func Test_setCloudContext(t *testing.T) {
+	newController := func(method, cloudContext string, body types.M) *BaseController {
+		r := httptest.NewRequest(method, "/classes/post", nil)
+		if cloudContext != "" {
+			r.Header.Set("X-Parse-Cloud-Context", cloudContext)
+		}
+		ctx := context.NewContext()
+		ctx.Reset(httptest.NewRecorder(), r)
+		b := &BaseController{JSONBody: body}
+		b.Ctx = ctx
+		return b
+	}
+	var b *BaseController
+	var err error
+	var expect types.M
+	/*****************************************************************/
+	// 查询请求的 JSONBody 会作为查询参数，不加入 _context
+	b = newController("GET", `{"source":"app"}`, nil)
+	err = b.setCloudContext()
+	if err != nil || b.JSONBody != nil {
+		t.Error("expect:", nil, "result:", b.JSONBody, err)
+	}
+	b = newController("GET", `{"source":"app"}`, types.M{"where": types.M{}})
+	err = b.setCloudContext()
+	expect = types.M{"where": types.M{}}
+	if err != nil || reflect.DeepEqual(expect, b.JSONBody) == false {
+		t.Error("expect:", expect, "result:", b.JSONBody, err)
+	}
+	/*****************************************************************/
+	b = newController("POST", `{"source":"app"}`, nil)
+	err = b.setCloudContext()
+	expect = types.M{"_context": types.M{"source": "app"}}
+	if err != nil || reflect.DeepEqual(expect, b.JSONBody) == false {
+		t.Error("expect:", expect, "result:", b.JSONBody, err)
+	}
+	/*****************************************************************/
+	b = newController("PUT", `{"source":"app"}`, types.M{"key": "hello", "_context": types.M{"source": "body"}})
+	err = b.setCloudContext()
+	expect = types.M{"key": "hello", "_context": types.M{"source": "body"}}
+	if err != nil || reflect.DeepEqual(expect, b.JSONBody) == false {
+		t.Error("expect:", expect, "result:", b.JSONBody, err)
+	}
+	/*****************************************************************/
+	b = newController("POST", `[1]`, nil)
+	err = b.setCloudContext()
+	expectErr := errs.E(errs.InvalidJSON, "X-Parse-Cloud-Context must be a JSON object")
+	if reflect.DeepEqual(expectErr, err) == false {
+		t.Error("expect:", expectErr, "result:", err)
+	}
+}
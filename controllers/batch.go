@@ -7,9 +7,11 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/astaxie/beego"
+	"github.com/lfq7413/tomato/config"
 	"github.com/lfq7413/tomato/errs"
 	"github.com/lfq7413/tomato/types"
 	"github.com/lfq7413/tomato/utils"
@@ -74,6 +76,12 @@ func (b *BatchController) HandleRequest(requests types.S, headers map[string]str
 	bodys := []interface{}{}
 	results := types.S{}
 
+	// 限制单次批量请求中的子请求数量
+	if len(requests) > config.TConfig.BatchRequestLimit {
+		b.HandleError(errs.E(errs.InvalidJSON, "Too many requests in a batch, the limit is "+strconv.Itoa(config.TConfig.BatchRequestLimit)), 0)
+		return
+	}
+
 	for _, v := range requests {
 		request := utils.M(v)
 		if request == nil {
@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/astaxie/beego/context"
+	"github.com/lfq7413/tomato/config"
+	"github.com/lfq7413/tomato/errs"
+	"github.com/lfq7413/tomato/types"
+)
+
+func Test_HandleRequest(t *testing.T) {
+	limit := config.TConfig.BatchRequestLimit
+	defer func() {
+		config.TConfig.BatchRequestLimit = limit
+	}()
+	newController := func() (*BatchController, *httptest.ResponseRecorder) {
+		w := httptest.NewRecorder()
+		ctx := context.NewContext()
+		ctx.Reset(w, httptest.NewRequest("POST", "/batch", nil))
+		b := &BatchController{}
+		b.Ctx = ctx
+		b.Data = map[interface{}]interface{}{}
+		return b, w
+	}
+	var b *BatchController
+	var w *httptest.ResponseRecorder
+	var requests types.S
+	var expect types.M
+	/*****************************************************************/
+	// 子请求数量超过限制时，不执行任何子请求
+	config.TConfig.BatchRequestLimit = 2
+	b, w = newController()
+	requests = types.S{
+		types.M{"method": "POST", "path": "/classes/post", "body": types.M{"key": "1"}},
+		types.M{"method": "POST", "path": "/classes/post", "body": types.M{"key": "2"}},
+		types.M{"method": "POST", "path": "/classes/post", "body": types.M{"key": "3"}},
+	}
+	b.HandleRequest(requests, map[string]string{}, "http")
+	expect = errs.ErrorToMap(errs.E(errs.InvalidJSON, "Too many requests in a batch, the limit is 2"))
+	if w.Code != 400 || reflect.DeepEqual(expect, b.Data["json"]) == false {
+		t.Error("expect:", 400, expect, "result:", w.Code, b.Data["json"])
+	}
+	/*****************************************************************/
+	// 数量未超过限制时，继续校验子请求
+	b, w = newController()
+	requests = types.S{
+		types.M{"method": "POST", "path": "/classes/post"},
+		types.M{"path": "/classes/post"},
+	}
+	b.HandleRequest(requests, map[string]string{}, "http")
+	expect = errs.ErrorToMap(errs.E(errs.InvalidJSON, "Invalid method"))
+	if w.Code != 400 || reflect.DeepEqual(expect, b.Data["json"]) == false {
+		t.Error("expect:", 400, expect, "result:", w.Code, b.Data["json"])
+	}
+}
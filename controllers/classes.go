@@ -62,8 +62,9 @@ func (c *ClassesController) HandleGet() {
 	}
 
 	allowedGetQueryKeys := map[string]bool{
-		"keys":    true,
-		"include": true,
+		"keys":        true,
+		"excludeKeys": true,
+		"include":     true,
 	}
 	for k := range c.Query {
 		if allowedGetQueryKeys[k] == false {
@@ -85,6 +86,12 @@ func (c *ClassesController) HandleGet() {
 		options["keys"] = c.JSONBody["keys"]
 	}
 
+	if c.Query["excludeKeys"] != "" {
+		options["excludeKeys"] = c.Query["excludeKeys"]
+	} else if c.JSONBody["excludeKeys"] != nil {
+		options["excludeKeys"] = c.JSONBody["excludeKeys"]
+	}
+
 	if c.Query["include"] != "" {
 		options["include"] = c.Query["include"]
 	} else if c.JSONBody["include"] != "" {
@@ -154,9 +161,15 @@ func (c *ClassesController) HandleFind() {
 		"order":                   true,
 		"count":                   true,
 		"keys":                    true,
+		"excludeKeys":             true,
 		"include":                 true,
 		"redirectClassNameForKey": true,
 		"where":                   true,
+		"distinct":                true,
+		"readPreference":          true,
+		"includeReadPreference":   true,
+		"subqueryReadPreference":  true,
+		"explain":                 true,
 	}
 	for k := range c.Query {
 		if allowConstraints[k] == false {
@@ -217,6 +230,12 @@ func (c *ClassesController) HandleFind() {
 		options["keys"] = c.JSONBody["keys"]
 	}
 
+	if c.Query["excludeKeys"] != "" {
+		options["excludeKeys"] = c.Query["excludeKeys"]
+	} else if c.JSONBody != nil && c.JSONBody["excludeKeys"] != nil {
+		options["excludeKeys"] = c.JSONBody["excludeKeys"]
+	}
+
 	if c.Query["include"] != "" {
 		options["include"] = c.Query["include"]
 	} else if c.JSONBody != nil && c.JSONBody["include"] != nil {
@@ -229,6 +248,38 @@ func (c *ClassesController) HandleFind() {
 		options["redirectClassNameForKey"] = c.JSONBody["redirectClassNameForKey"]
 	}
 
+	// distinct 仅允许 Master 权限使用
+	if c.Query["distinct"] != "" {
+		options["distinct"] = c.Query["distinct"]
+	} else if c.JSONBody != nil && c.JSONBody["distinct"] != nil {
+		options["distinct"] = c.JSONBody["distinct"]
+	}
+	if options["distinct"] != nil && c.EnforceMasterKeyAccess() == false {
+		return
+	}
+
+	// 读偏好仅允许 Master 权限使用
+	for _, k := range []string{"readPreference", "includeReadPreference", "subqueryReadPreference"} {
+		if c.Query[k] != "" {
+			options[k] = c.Query[k]
+		} else if c.JSONBody != nil && c.JSONBody[k] != nil {
+			options[k] = c.JSONBody[k]
+		}
+		if options[k] != nil && c.EnforceMasterKeyAccess() == false {
+			return
+		}
+	}
+
+	// explain 仅允许 Master 权限使用，返回查询计划而不是对象
+	if c.Query["explain"] == "true" {
+		options["explain"] = true
+	} else if c.JSONBody != nil && c.JSONBody["explain"] == true {
+		options["explain"] = true
+	}
+	if options["explain"] != nil && c.EnforceMasterKeyAccess() == false {
+		return
+	}
+
 	where := types.M{}
 	if c.Query["where"] != "" {
 		err := json.Unmarshal([]byte(c.Query["where"]), &where)
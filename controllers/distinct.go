@@ -0,0 +1,77 @@
+package controllers
+
+import (
+	"encoding/json"
+
+	"github.com/lfq7413/tomato/errs"
+	"github.com/lfq7413/tomato/rest"
+	"github.com/lfq7413/tomato/types"
+	"github.com/lfq7413/tomato/utils"
+)
+
+// DistinctController 处理 /distinct 接口的请求
+// 与 /classes 中的 distinct 参数不同，非 Master 权限也可以访问，返回结果受 ACL 与 CLP 限制
+type DistinctController struct {
+	ClassesController
+}
+
+// HandleDistinct 获取指定字段的不重复值，可通过 where 参数过滤
+// @router /:className [get]
+func (d *DistinctController) HandleDistinct() {
+	if d.ClassName == "" {
+		d.ClassName = d.Ctx.Input.Param(":className")
+	}
+
+	allowConstraints := map[string]bool{
+		"distinct": true,
+		"where":    true,
+	}
+	for k := range d.Query {
+		if allowConstraints[k] == false {
+			d.HandleError(errs.E(errs.InvalidQuery, "Invalid parameter for query: "+k), 0)
+			return
+		}
+	}
+	for k := range d.JSONBody {
+		if allowConstraints[k] == false {
+			d.HandleError(errs.E(errs.InvalidQuery, "Invalid parameter for query: "+k), 0)
+			return
+		}
+	}
+
+	var field string
+	if d.Query["distinct"] != "" {
+		field = d.Query["distinct"]
+	} else if d.JSONBody != nil {
+		field = utils.S(d.JSONBody["distinct"])
+	}
+	if field == "" {
+		d.HandleError(errs.E(errs.InvalidQuery, "distinct field is required"), 0)
+		return
+	}
+
+	where := types.M{}
+	if d.Query["where"] != "" {
+		err := json.Unmarshal([]byte(d.Query["where"]), &where)
+		if err != nil {
+			d.HandleError(errs.E(errs.InvalidJSON, "where should be valid json"), 0)
+			return
+		}
+	} else if d.JSONBody != nil && d.JSONBody["where"] != nil {
+		where = utils.M(d.JSONBody["where"])
+	}
+
+	options := types.M{"distinct": field}
+	response, err := rest.Find(d.Auth, d.ClassName, where, options, d.Info.ClientSDK)
+	if err != nil {
+		d.HandleError(err, 0)
+		return
+	}
+	results := utils.A(response["results"])
+	if results == nil {
+		results = types.S{}
+	}
+
+	d.Data["json"] = types.M{"results": results}
+	d.ServeJSON()
+}
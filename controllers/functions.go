@@ -1,6 +1,8 @@
 package controllers
 
 import (
+	"fmt"
+
 	"github.com/lfq7413/tomato/cloud"
 	"github.com/lfq7413/tomato/errs"
 	"github.com/lfq7413/tomato/types"
@@ -63,17 +65,37 @@ func (f *FunctionsController) HandleCloudFunction() {
 		}
 	}
 
-	response := &cloud.FunctionResponse{}
-	theFunction(request, response)
-	if response.Err != nil {
-		f.HandleError(response.Err, 0)
+	response, err := runFunction(theFunction, request)
+	if err != nil {
+		f.HandleError(err, 0)
 		return
 	}
 
-	f.Data["json"] = response.Response
+	f.Data["json"] = response
 	f.ServeJSON()
 }
 
+// runFunction 执行云函数，云函数中出现的 panic 按 ScriptFailed 错误返回
+// 云函数未设置返回值时，返回 {"result":null}
+func runFunction(theFunction cloud.FunctionHandler, request cloud.FunctionRequest) (result types.M, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = nil
+			err = errs.E(errs.ScriptFailed, fmt.Sprint(r))
+		}
+	}()
+
+	response := &cloud.FunctionResponse{}
+	theFunction(request, response)
+	if response.Err != nil {
+		return nil, response.Err
+	}
+	if response.Response == nil {
+		return types.M{"result": nil}, nil
+	}
+	return response.Response, nil
+}
+
 // Get ...
 // @router / [get]
 func (f *FunctionsController) Get() {
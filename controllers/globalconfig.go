@@ -1,8 +1,7 @@
 package controllers
 
 import (
-	"strings"
-
+	"github.com/lfq7413/tomato/errs"
 	"github.com/lfq7413/tomato/orm"
 	"github.com/lfq7413/tomato/types"
 	"github.com/lfq7413/tomato/utils"
@@ -13,15 +12,7 @@ type GlobalConfigController struct {
 	ClassesController
 }
 
-// Prepare ...
-func (g *GlobalConfigController) Prepare() {
-	if g.Ctx.Input.Method() == "GET" && strings.HasPrefix(g.Ctx.Input.URL(), "/v1/config") {
-		return
-	}
-	g.ClassesController.Prepare()
-}
-
-// HandleGet 获取配置信息
+// HandleGet 获取配置信息，masterKeyOnly 中标记的参数仅对 Master Key 可见
 // @router / [get]
 func (g *GlobalConfigController) HandleGet() {
 	results, _ := orm.TomatoDBController.Find("_GlobalConfig", types.M{"objectId": "1"}, types.M{"limit": 1})
@@ -36,11 +27,30 @@ func (g *GlobalConfigController) HandleGet() {
 		g.ServeJSON()
 		return
 	}
-	g.Data["json"] = types.M{"params": globalConfig["params"]}
+	params := utils.M(globalConfig["params"])
+	if params == nil {
+		params = types.M{}
+	}
+	masterKeyOnly := utils.M(globalConfig["masterKeyOnly"])
+	if masterKeyOnly == nil {
+		masterKeyOnly = types.M{}
+	}
+	if g.Auth.IsMaster {
+		g.Data["json"] = types.M{"params": params, "masterKeyOnly": masterKeyOnly}
+		g.ServeJSON()
+		return
+	}
+	for k := range params {
+		if v, ok := masterKeyOnly[k].(bool); ok && v {
+			delete(params, k)
+		}
+	}
+	g.Data["json"] = types.M{"params": params}
 	g.ServeJSON()
 }
 
 // HandlePut 修改配置信息
+// 参数值为 null 时删除该参数，masterKeyOnly 用于标记仅 Master Key 可见的参数
 // @router / [put]
 func (g *GlobalConfigController) HandlePut() {
 	if g.EnforceMasterKeyAccess() == false {
@@ -55,8 +65,29 @@ func (g *GlobalConfigController) HandlePut() {
 	params := utils.M(g.JSONBody["params"])
 	update := types.M{}
 	for k, v := range params {
+		if v == nil {
+			update["params."+k] = types.M{"__op": "Delete"}
+			update["masterKeyOnly."+k] = types.M{"__op": "Delete"}
+			continue
+		}
+		if err := validateConfigValue(v); err != nil {
+			g.HandleError(errs.E(errs.InvalidJSON, "Invalid value for config key "+k+": "+errs.GetErrorMessage(err)), 0)
+			return
+		}
 		update["params."+k] = v
 	}
+	if masterKeyOnly := utils.M(g.JSONBody["masterKeyOnly"]); masterKeyOnly != nil {
+		for k, v := range masterKeyOnly {
+			if _, ok := v.(bool); ok == false {
+				g.HandleError(errs.E(errs.InvalidJSON, "masterKeyOnly."+k+" must be a boolean"), 0)
+				return
+			}
+			if params[k] == nil && update["params."+k] != nil {
+				continue
+			}
+			update["masterKeyOnly."+k] = v
+		}
+	}
 	_, err := orm.TomatoDBController.Update("_GlobalConfig", types.M{"objectId": "1"}, update, types.M{"upsert": true}, false)
 	if err != nil {
 		g.HandleError(err, 0)
@@ -66,6 +97,38 @@ func (g *GlobalConfigController) HandlePut() {
 	g.ServeJSON()
 }
 
+// validateConfigValue 校验配置参数是否为合法的 Parse 类型，数组与对象需要校验其中的每个元素
+func validateConfigValue(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+	if _, err := orm.GetType(value); err != nil {
+		return err
+	}
+	if array := utils.A(value); array != nil {
+		for _, v := range array {
+			if err := validateConfigValue(v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if object := utils.M(value); object != nil {
+		if object["__type"] != nil {
+			return nil
+		}
+		if object["__op"] != nil {
+			return errs.E(errs.InvalidJSON, "operations are not supported in config")
+		}
+		for _, v := range object {
+			if err := validateConfigValue(v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // Post ...
 // @router / [post]
 func (g *GlobalConfigController) Post() {
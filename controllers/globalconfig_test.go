@@ -0,0 +1,57 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lfq7413/tomato/errs"
+	"github.com/lfq7413/tomato/types"
+)
+
+func Test_validateConfigValue(t *testing.T) {
+	var value interface{}
+	var err error
+	var expect error
+	/*****************************************************************/
+	value = nil
+	err = validateConfigValue(value)
+	if err != nil {
+		t.Error("expect:", nil, "result:", err)
+	}
+	/*****************************************************************/
+	value = types.M{
+		"number": 1024.0,
+		"string": "hello",
+		"array":  types.S{"a", 1.0, true},
+		"date":   types.M{"__type": "Date", "iso": "2006-01-02T15:04:05.000Z"},
+		"object": types.M{"key": types.M{"key": "value"}},
+	}
+	err = validateConfigValue(value)
+	if err != nil {
+		t.Error("expect:", nil, "result:", err)
+	}
+	/*****************************************************************/
+	// 不支持 __op 操作
+	value = types.M{"__op": "Increment", "amount": 1}
+	err = validateConfigValue(value)
+	expect = errs.E(errs.InvalidJSON, "operations are not supported in config")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/*****************************************************************/
+	// 嵌套在数组与对象中的 __op 同样不支持
+	value = types.S{types.M{"key": types.M{"__op": "Delete"}}}
+	err = validateConfigValue(value)
+	expect = errs.E(errs.InvalidJSON, "operations are not supported in config")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/*****************************************************************/
+	// 不合法的 Parse 类型
+	value = types.M{"key": types.M{"__type": "Pointer"}}
+	err = validateConfigValue(value)
+	expect = errs.E(errs.IncorrectType, "This is not a valid Pointer")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+}
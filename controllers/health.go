@@ -1,14 +1,46 @@
 package controllers
 
-import "github.com/astaxie/beego"
+import (
+	"github.com/astaxie/beego"
+	"github.com/lfq7413/tomato/cache"
+	"github.com/lfq7413/tomato/types"
+)
 
 // HealthController 检测服务器健康状态
 type HealthController struct {
 	beego.Controller
 }
 
-// Get 直接返回状态 200
+// Get 返回状态 200
 // @router / [get]
 func (h *HealthController) Get() {
 	h.Ctx.Output.SetStatus(200)
+	h.Data["json"] = types.M{"status": "ok"}
+	h.ServeJSON()
+}
+
+// CacheStatsController 处理 /health/cache 接口的请求
+type CacheStatsController struct {
+	BaseController
+}
+
+// Get 返回用户缓存与角色缓存的命中与未命中次数，用于调整缓存的大小与有效期，需要 Master 权限
+// @router / [get]
+func (c *CacheStatsController) Get() {
+	if c.EnforceMasterKeyAccess() == false {
+		return
+	}
+	c.Data["json"] = types.M{
+		"user": cacheStats(cache.User),
+		"role": cacheStats(cache.Role),
+	}
+	c.ServeJSON()
+}
+
+func cacheStats(c *cache.SubCache) types.M {
+	hits, misses := c.Stats()
+	return types.M{
+		"hits":   hits,
+		"misses": misses,
+	}
 }
@@ -169,6 +169,79 @@ func (h *HooksController) HandleUpdateTrigger() {
 	h.ServeJSON()
 }
 
+// HandleGetAllJobs ...
+// @router /jobs [get]
+func (h *HooksController) HandleGetAllJobs() {
+	results, err := hooks.GetJobs()
+	if err != nil {
+		h.HandleError(err, 0)
+		return
+	}
+	if results == nil {
+		results = types.S{}
+	}
+	h.Data["json"] = results
+	h.ServeJSON()
+}
+
+// HandleGetJob ...
+// @router /jobs/:jobName [get]
+func (h *HooksController) HandleGetJob() {
+	jobName := h.Ctx.Input.Param(":jobName")
+	result, err := hooks.GetJob(jobName)
+	if err != nil {
+		h.HandleError(err, 0)
+		return
+	}
+	if result == nil {
+		h.HandleError(errs.E(errs.WebhookError, "no job named: "+jobName+" is defined"), 0)
+		return
+	}
+	h.Data["json"] = result
+	h.ServeJSON()
+}
+
+// HandleCreateJob ...
+// @router /jobs [post]
+func (h *HooksController) HandleCreateJob() {
+	result, err := hooks.CreateHook(h.JSONBody)
+	if err != nil {
+		h.HandleError(err, 0)
+		return
+	}
+	h.Data["json"] = result
+	h.ServeJSON()
+}
+
+// HandleUpdateJob ...
+// @router /jobs/:jobName [put]
+func (h *HooksController) HandleUpdateJob() {
+	jobName := h.Ctx.Input.Param(":jobName")
+	var err error
+	var result = types.M{}
+	if utils.S(h.JSONBody["__op"]) == "Delete" {
+		// delete
+		err = hooks.DeleteJob(jobName)
+	} else {
+		// update
+		if h.JSONBody["url"] == nil {
+			h.HandleError(errs.E(errs.WebhookError, "invalid hook declaration"), 0)
+			return
+		}
+		hook := types.M{
+			"jobName": jobName,
+			"url":     h.JSONBody["url"],
+		}
+		result, err = hooks.UpdateHook(hook)
+	}
+	if err != nil {
+		h.HandleError(err, 0)
+		return
+	}
+	h.Data["json"] = result
+	h.ServeJSON()
+}
+
 // Get ...
 // @router / [get]
 func (h *HooksController) Get() {
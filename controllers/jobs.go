@@ -1,9 +1,13 @@
 package controllers
 
 import (
+	"fmt"
+	"strconv"
+
 	"github.com/lfq7413/tomato/cloud"
 	"github.com/lfq7413/tomato/errs"
 	"github.com/lfq7413/tomato/job"
+	"github.com/lfq7413/tomato/rest"
 	"github.com/lfq7413/tomato/types"
 	"github.com/lfq7413/tomato/utils"
 )
@@ -36,8 +40,7 @@ func (j *JobsController) HandlePost() {
 func (j *JobsController) runJob(jobName string) {
 	jobFunction := cloud.GetJob(jobName)
 	if jobFunction == nil {
-		j.Data["json"] = errs.ErrorMessageToMap(errs.ScriptFailed, "Invalid job.")
-		j.ServeJSON()
+		j.HandleError(errs.E(errs.ScriptFailed, "Invalid job."), 0)
 		return
 	}
 	jobHandler := job.NewjobStatus()
@@ -67,20 +70,62 @@ func (j *JobsController) runJob(jobName string) {
 	response := cloud.JobResponse{
 		JobStatus: jobHandler,
 	}
-	jobStatus := jobHandler.SetRunning(jobName, j.JSONBody)
+	jobStatus := jobHandler.SetPending(jobName, j.JSONBody)
 	request.JobID = utils.S(jobStatus["objectId"])
 
-	go jobFunction(request, response)
+	go func() {
+		// 任务中出现 panic 时，标记为失败，避免状态一直为 running
+		defer func() {
+			if r := recover(); r != nil {
+				response.Error(fmt.Sprint(r))
+			}
+		}()
+		jobHandler.SetRunning()
+		jobFunction(request, response)
+	}()
 
 	j.Ctx.Output.Header("X-Parse-Job-Status-Id", utils.S(jobStatus["objectId"]))
-	j.Data["json"] = types.M{}
+	j.Data["json"] = types.M{"jobStatusId": jobStatus["objectId"]}
 	j.ServeJSON()
 }
 
-// Get ...
+// HandleFind 查询后台任务的执行状态，按创建时间倒序排列
+// 支持 skip limit 参数分页，未指定 limit 时默认返回 100 条
 // @router / [get]
-func (j *JobsController) Get() {
-	j.ClassesController.Get()
+func (j *JobsController) HandleFind() {
+	if j.EnforceMasterKeyAccess() == false {
+		return
+	}
+	where := types.M{}
+	if j.Query["jobName"] != "" {
+		where["jobName"] = j.Query["jobName"]
+	}
+	options := types.M{"order": "-createdAt", "limit": 100}
+	if j.Query["skip"] != "" {
+		if i, err := strconv.Atoi(j.Query["skip"]); err == nil {
+			options["skip"] = i
+		}
+	} else if j.JSONBody != nil && j.JSONBody["skip"] != nil {
+		if i, ok := j.JSONBody["skip"].(float64); ok {
+			options["skip"] = int(i)
+		}
+	}
+	if j.Query["limit"] != "" {
+		if i, err := strconv.Atoi(j.Query["limit"]); err == nil {
+			options["limit"] = i
+		}
+	} else if j.JSONBody != nil && j.JSONBody["limit"] != nil {
+		if i, ok := j.JSONBody["limit"].(float64); ok {
+			options["limit"] = int(i)
+		}
+	}
+	response, err := rest.Find(rest.Master(), "_JobStatus", where, options, j.Info.ClientSDK)
+	if err != nil {
+		j.HandleError(err, 0)
+		return
+	}
+	j.Data["json"] = response
+	j.ServeJSON()
 }
 
 // Delete ...
@@ -1,8 +1,6 @@
 package controllers
 
 import (
-	"time"
-
 	"github.com/lfq7413/tomato/config"
 	"github.com/lfq7413/tomato/errs"
 	"github.com/lfq7413/tomato/files"
@@ -17,23 +15,15 @@ type LoginController struct {
 	ClassesController
 }
 
-// HandleLogIn 处理登录请求
+// HandleLogIn 处理登录请求，支持使用 username 或 email 登录
 // @router / [get]
 func (l *LoginController) HandleLogIn() {
-	var username, password string
-	if l.JSONBody != nil && l.JSONBody["username"] != nil {
-		username = utils.S(l.JSONBody["username"])
-	} else {
-		username = l.Query["username"]
-	}
-	if l.JSONBody != nil && l.JSONBody["password"] != nil {
-		password = utils.S(l.JSONBody["password"])
-	} else {
-		password = l.Query["password"]
-	}
+	username := l.credential("username")
+	email := l.credential("email")
+	password := l.credential("password")
 
-	if username == "" {
-		l.HandleError(errs.E(errs.UsernameMissing, "username is required."), 0)
+	if username == "" && email == "" {
+		l.HandleError(errs.E(errs.UsernameMissing, "username/email is required."), 0)
 		return
 	}
 	if password == "" {
@@ -41,15 +31,29 @@ func (l *LoginController) HandleLogIn() {
 		return
 	}
 
-	where := types.M{
-		"username": username,
+	// 锁定的 IP 不再查询用户
+	err := rest.CheckIPLockout(l.Info.ClientIP)
+	if err != nil {
+		l.HandleError(err, 0)
+		return
+	}
+
+	// 同时提供 username 与 email 时，二者必须属于同一用户
+	where := types.M{}
+	if username != "" {
+		where["username"] = username
+	}
+	if email != "" {
+		where["email"] = email
 	}
 	results, err := orm.TomatoDBController.Find("_User", where, types.M{})
 	if err != nil {
 		l.HandleError(err, 0)
 		return
 	}
-	if results == nil || len(results) == 0 {
+	// 多个用户使用相同的 email 时同样视为登录失败，不透露具体原因
+	if len(results) != 1 {
+		rest.RecordFailedIPAttempt(l.Info.ClientIP)
 		l.HandleError(errs.E(errs.ObjectNotFound, "Invalid username/password."), 0)
 		return
 	}
@@ -70,6 +74,7 @@ func (l *LoginController) HandleLogIn() {
 	// TODO 换用高强度的加密方式
 	correct := utils.Compare(password, utils.S(user["password"]))
 	accountLockoutPolicy := rest.NewAccountLockout(utils.S(user["username"]))
+	accountLockoutPolicy.SetClientIP(l.Info.ClientIP)
 	err = accountLockoutPolicy.HandleLoginAttempt(correct)
 	if err != nil {
 		l.HandleError(err, 0)
@@ -81,20 +86,17 @@ func (l *LoginController) HandleLogIn() {
 	}
 
 	// 检测密码是否过期
-	if config.TConfig.PasswordPolicy && config.TConfig.MaxPasswordAge > 0 {
-		if changedAt, ok := user["_password_changed_at"].(time.Time); ok {
-			// 密码过期时间戳存在，判断是否过期
-			expiresAt := changedAt.Add(time.Duration(config.TConfig.MaxPasswordAge) * 24 * time.Hour)
-			if expiresAt.UnixNano() < time.Now().UnixNano() {
-				l.HandleError(errs.E(errs.ObjectNotFound, "Your password has expired. Please reset your password."), 0)
-				return
-			}
-		} else {
-			// 在启用密码过期之前的数据，需要增加该字段
-			query := types.M{"username": user["username"]}
-			update := types.M{"_password_changed_at": utils.TimetoString(time.Now().UTC())}
-			orm.TomatoDBController.Update("_User", query, update, types.M{}, false)
-		}
+	err = rest.CheckPasswordExpired(user)
+	if err != nil {
+		l.HandleError(err, 0)
+		return
+	}
+
+	// 登录前回调出错时拒绝登录，不创建 session
+	err = rest.RunBeforeLoginTrigger(l.Auth, user)
+	if err != nil {
+		l.HandleError(err, 0)
+		return
 	}
 
 	token := "r:" + utils.CreateToken()
@@ -159,7 +161,15 @@ func (l *LoginController) HandleLogIn() {
 // Post ...
 // @router / [post]
 func (l *LoginController) Post() {
-	l.ClassesController.Post()
+	l.HandleLogIn()
+}
+
+// credential 从请求数据中获取登录参数，请求数据中不存在时从 URL 参数中获取
+func (l *LoginController) credential(key string) string {
+	if l.JSONBody != nil && l.JSONBody[key] != nil {
+		return utils.S(l.JSONBody[key])
+	}
+	return l.Query[key]
 }
 
 // Delete ...
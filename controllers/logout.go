@@ -1,9 +1,9 @@
 package controllers
 
 import (
+	"github.com/lfq7413/tomato/errs"
 	"github.com/lfq7413/tomato/rest"
 	"github.com/lfq7413/tomato/types"
-	"github.com/lfq7413/tomato/utils"
 )
 
 // LogoutController 处理 /logout 接口的请求
@@ -11,29 +11,21 @@ type LogoutController struct {
 	ClassesController
 }
 
-// HandleLogOut 处理用户退出请求
+// HandleLogOut 处理用户退出请求，删除当前 session ，删除时会同时清除缓存
 // @router / [post]
 func (l *LogoutController) HandleLogOut() {
-	if l.Info != nil && l.Info.SessionToken != "" {
-		where := types.M{
-			"sessionToken": l.Info.SessionToken,
-		}
-		records, err := rest.Find(rest.Master(), "_Session", where, types.M{}, l.Info.ClientSDK)
-
-		if err != nil {
-			l.HandleError(err, 0)
-			return
-		}
-		if utils.HasResults(records) {
-			results := utils.A(records["results"])
-			obj := utils.M(results[0])
-			err := rest.Delete(rest.Master(), "_Session", utils.S(obj["objectId"]))
-			if err != nil {
-				l.HandleError(err, 0)
-				return
-			}
-		}
+	if l.Info == nil || l.Info.SessionToken == "" {
+		l.HandleError(errs.E(errs.InvalidSessionToken, "Session token required."), 0)
+		return
+	}
+	session, err := rest.DestroySession(l.Info.SessionToken, l.Info.ClientSDK)
+	if err != nil {
+		l.HandleError(err, 0)
+		return
 	}
+	// 退出登录后回调不影响本次请求的结果
+	rest.RunAfterLogoutTrigger(l.Auth, session)
+
 	l.Data["json"] = types.M{}
 	l.ServeJSON()
 }
@@ -1,10 +1,12 @@
 package controllers
 
 import (
+	"net/url"
 	"strings"
 
 	"github.com/astaxie/beego"
 	"github.com/lfq7413/tomato/config"
+	"github.com/lfq7413/tomato/errs"
 	"github.com/lfq7413/tomato/publichtml"
 	"github.com/lfq7413/tomato/rest"
 )
@@ -33,13 +35,22 @@ func (p *PublicController) VerifyEmail() {
 
 	ok := rest.VerifyEmail(username, token)
 	if ok {
-		p.Ctx.Output.SetStatus(302)
-		p.Ctx.Output.Header("location", config.VerifyEmailSuccessURL()+"?username="+username)
+		p.redirect(config.VerifyEmailSuccessURL(), url.Values{"username": {username}})
 	} else {
 		p.invalidVerification()
 	}
 }
 
+// VerifyEmailForApp 处理带有 appId 的验证邮箱请求，验证邮件中的链接使用该地址
+// @router /:appId/verify_email [get]
+func (p *PublicController) VerifyEmailForApp() {
+	if p.Ctx.Input.Param(":appId") != config.TConfig.AppID {
+		p.invalid()
+		return
+	}
+	p.VerifyEmail()
+}
+
 // ResendVerificationEmail 处理重新发送验证邮件请求
 // @router /resend_verification_email [post]
 func (p *PublicController) ResendVerificationEmail() {
@@ -54,11 +65,9 @@ func (p *PublicController) ResendVerificationEmail() {
 	}
 	err := rest.ResendVerificationEmail(username)
 	if err != nil {
-		p.Ctx.Output.SetStatus(302)
-		p.Ctx.Output.Header("location", config.LinkSendFailURL())
+		p.redirect(config.LinkSendFailURL(), url.Values{"username": {username}, "error": {err.Error()}})
 	} else {
-		p.Ctx.Output.SetStatus(302)
-		p.Ctx.Output.Header("location", config.LinkSendSuccessURL())
+		p.redirect(config.LinkSendSuccessURL(), url.Values{"username": {username}})
 	}
 }
 
@@ -70,7 +79,7 @@ func (p *PublicController) ChangePassword() {
 		return
 	}
 
-	data := strings.Replace(publichtml.ChoosePasswordPage, "PARSE_SERVER_URL", `"`+config.TConfig.ServerURL+`"`, -1)
+	data := strings.Replace(p.renderPage(config.TConfig.ChoosePassword, publichtml.ChoosePasswordFile, publichtml.ChoosePasswordPage), "PARSE_SERVER_URL", `"`+config.TConfig.ServerURL+`"`, -1)
 	p.Ctx.Output.Header("Content-Type", "text/html")
 	p.Ctx.Output.Body([]byte(data))
 }
@@ -91,20 +100,23 @@ func (p *PublicController) ResetPassword() {
 		p.invalid()
 		return
 	}
+	// token 已过期或者已被使用
+	if rest.CheckResetTokenValidity(username, token) == nil {
+		p.invalid()
+		return
+	}
 
 	err := rest.UpdatePassword(username, token, newPassword)
 	if err == nil {
-		p.Ctx.Output.SetStatus(302)
-		p.Ctx.Output.Header("location", config.PasswordResetSuccessURL()+"?username="+username)
+		p.redirect(config.PasswordResetSuccessURL(), url.Values{"username": {username}})
 	} else {
-		p.Ctx.Output.SetStatus(302)
-		location := config.ChoosePasswordURL()
-		location += "?token=" + token
-		location += "&id=" + config.TConfig.AppID
-		location += "&username=" + username
-		location += "&error=" + err.Error()
-		location += "&app=" + config.TConfig.AppName
-		p.Ctx.Output.Header("location", location)
+		p.redirect(config.ChoosePasswordURL(), url.Values{
+			"token":    {token},
+			"id":       {config.TConfig.AppID},
+			"username": {username},
+			"error":    {errs.GetErrorMessage(err)},
+			"app":      {config.TConfig.AppName},
+		})
 	}
 }
 
@@ -127,29 +139,48 @@ func (p *PublicController) RequestResetPassword() {
 
 	user := rest.CheckResetTokenValidity(username, token)
 	if user != nil {
-		p.Ctx.Output.SetStatus(302)
-		location := config.ChoosePasswordURL()
-		location += "?token=" + token
-		location += "&id=" + config.TConfig.AppID
-		location += "&username=" + username
-		location += "&app=" + config.TConfig.AppName
-		p.Ctx.Output.Header("location", location)
+		p.redirect(config.ChoosePasswordURL(), url.Values{
+			"token":    {token},
+			"id":       {config.TConfig.AppID},
+			"username": {username},
+			"app":      {config.TConfig.AppName},
+		})
 	} else {
 		p.invalid()
 	}
 }
 
+// ResetPasswordForApp 处理带有 appId 的重置密码请求，修改密码页面的表单提交到该地址
+// @router /:appId/request_password_reset [post]
+func (p *PublicController) ResetPasswordForApp() {
+	if p.Ctx.Input.Param(":appId") != config.TConfig.AppID {
+		p.invalid()
+		return
+	}
+	p.ResetPassword()
+}
+
+// RequestResetPasswordForApp 处理带有 appId 的重置密码请求，重置密码邮件中的链接使用该地址
+// @router /:appId/request_password_reset [get]
+func (p *PublicController) RequestResetPasswordForApp() {
+	if p.Ctx.Input.Param(":appId") != config.TConfig.AppID {
+		p.invalid()
+		return
+	}
+	p.RequestResetPassword()
+}
+
 // InvalidLink 无效链接页面
 // @router /invalid_link [get]
 func (p *PublicController) InvalidLink() {
 	p.Ctx.Output.Header("Content-Type", "text/html")
-	p.Ctx.Output.Body([]byte(publichtml.InvalidLinkPage))
+	p.Ctx.Output.Body([]byte(p.renderPage(config.TConfig.InvalidLink, publichtml.InvalidLinkFile, publichtml.InvalidLinkPage)))
 }
 
 // InvalidVerificationLink 无效验证链接页面
 // @router /invalid_verification_link [get]
 func (p *PublicController) InvalidVerificationLink() {
-	data := strings.Replace(publichtml.InvalidVerificationLink, "RESEND_VERIFICATION_URL", config.TConfig.ServerURL+"/apps/resend_verification_email", -1)
+	data := strings.Replace(p.renderPage(config.TConfig.InvalidVerificationLink, publichtml.InvalidVerificationLinkFile, publichtml.InvalidVerificationLink), "RESEND_VERIFICATION_URL", config.TConfig.ServerURL+"/apps/resend_verification_email", -1)
 	p.Ctx.Output.Header("Content-Type", "text/html")
 	p.Ctx.Output.Body([]byte(data))
 }
@@ -158,28 +189,57 @@ func (p *PublicController) InvalidVerificationLink() {
 // @router /link_send_success [get]
 func (p *PublicController) LinkSendSuccess() {
 	p.Ctx.Output.Header("Content-Type", "text/html")
-	p.Ctx.Output.Body([]byte(publichtml.LinkSendSuccess))
+	p.Ctx.Output.Body([]byte(p.renderPage(config.TConfig.LinkSendSuccess, publichtml.LinkSendSuccessFile, publichtml.LinkSendSuccess)))
 }
 
 // LinkSendFail 发送失败页面
 // @router /link_send_fail [get]
 func (p *PublicController) LinkSendFail() {
 	p.Ctx.Output.Header("Content-Type", "text/html")
-	p.Ctx.Output.Body([]byte(publichtml.LinkSendFail))
+	p.Ctx.Output.Body([]byte(p.renderPage(config.TConfig.LinkSendFail, publichtml.LinkSendFailFile, publichtml.LinkSendFail)))
 }
 
 // PasswordResetSuccess 密码重置成功页面
 // @router /password_reset_success [get]
 func (p *PublicController) PasswordResetSuccess() {
 	p.Ctx.Output.Header("Content-Type", "text/html")
-	p.Ctx.Output.Body([]byte(publichtml.PasswordResetSuccessPage))
+	p.Ctx.Output.Body([]byte(p.renderPage(config.TConfig.PasswordResetSuccess, publichtml.PasswordResetSuccessFile, publichtml.PasswordResetSuccessPage)))
 }
 
 // VerifyEmailSuccess 验证邮箱成功页面
 // @router /verify_email_success [get]
 func (p *PublicController) VerifyEmailSuccess() {
 	p.Ctx.Output.Header("Content-Type", "text/html")
-	p.Ctx.Output.Body([]byte(publichtml.VerifyEmailSuccessPage))
+	p.Ctx.Output.Body([]byte(p.renderPage(config.TConfig.VerifyEmailSuccess, publichtml.VerifyEmailSuccessFile, publichtml.VerifyEmailSuccessPage)))
+}
+
+// renderPage 渲染页面，优先使用 customPage 配置的本地页面文件，其次使用 PagesPath 中的自定义模板
+func (p *PublicController) renderPage(customPage, name, defaultPage string) string {
+	data := map[string]string{
+		"appName":   config.TConfig.AppName,
+		"appId":     config.TConfig.AppID,
+		"serverURL": config.TConfig.ServerURL,
+		"username":  p.GetString("username"),
+		"token":     p.GetString("token"),
+		"error":     p.GetString("error"),
+	}
+	if file := config.CustomPageFile(customPage); file != "" {
+		return publichtml.RenderFile(file, defaultPage, data)
+	}
+	return publichtml.Render(config.TConfig.PagesPath, name, defaultPage, data)
+}
+
+// redirect 重定向到 location ，并附加查询参数
+func (p *PublicController) redirect(location string, params url.Values) {
+	if len(params) > 0 {
+		if strings.Contains(location, "?") {
+			location += "&" + params.Encode()
+		} else {
+			location += "?" + params.Encode()
+		}
+	}
+	p.Ctx.Output.SetStatus(302)
+	p.Ctx.Output.Header("location", location)
 }
 
 func (p *PublicController) invalid() {
@@ -190,8 +250,7 @@ func (p *PublicController) invalid() {
 func (p *PublicController) invalidVerification() {
 	username := p.GetString("username")
 	if username != "" {
-		p.Ctx.Output.SetStatus(302)
-		p.Ctx.Output.Header("location", config.InvalidVerificationLinkURL()+"?username="+username)
+		p.redirect(config.InvalidVerificationLinkURL(), url.Values{"username": {username}})
 	} else {
 		p.invalid()
 	}
@@ -12,6 +12,7 @@ type ResetController struct {
 }
 
 // HandleResetRequest 处理通过 email 重置密码的请求
+// 未找到对应用户时，为避免泄露用户信息，仍然返回成功，仅 Master 请求返回 EmailNotFound
 // @router / [post]
 func (r *ResetController) HandleResetRequest() {
 	if r.JSONBody == nil || r.JSONBody["email"] == nil {
@@ -27,12 +28,14 @@ func (r *ResetController) HandleResetRequest() {
 	}
 	err := rest.SendPasswordResetEmail(email)
 	if err != nil {
-		if errs.GetErrorCode(err) == errs.ObjectNotFound {
-			err = errs.E(errs.EmailNotFound, "No user found with email "+email)
+		if errs.GetErrorCode(err) != errs.ObjectNotFound {
+			r.HandleError(err, 0)
+			return
+		}
+		if r.Auth != nil && r.Auth.IsMaster {
+			r.HandleError(errs.E(errs.EmailNotFound, "No user found with email "+email), 0)
+			return
 		}
-
-		r.HandleError(err, 0)
-		return
 	}
 
 	r.Data["json"] = types.M{}
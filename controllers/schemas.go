@@ -44,7 +44,7 @@ func (s *SchemasController) HandleGet() {
 	className := s.Ctx.Input.Param(":className")
 	schema := orm.TomatoDBController.LoadSchema(types.M{"clearCache": true})
 	sch, err := schema.GetOneSchema(className, false, types.M{"clearCache": true})
-	if err != nil {
+	if err != nil || len(sch) == 0 {
 		s.HandleError(errs.E(errs.InvalidClassName, "Class "+className+" does not exist."), 0)
 		return
 	}
@@ -80,6 +80,11 @@ func (s *SchemasController) HandleCreate() {
 		return
 	}
 
+	if data["classLevelPermissions"] != nil && utils.M(data["classLevelPermissions"]) == nil {
+		s.HandleError(errs.E(errs.InvalidJSON, "classLevelPermissions must be an object"), 0)
+		return
+	}
+
 	schema := orm.TomatoDBController.LoadSchema(types.M{"clearCache": true})
 	result, err := schema.AddClassIfNotExists(className, utils.M(data["fields"]), utils.M(data["classLevelPermissions"]))
 	if err != nil {
@@ -87,6 +92,20 @@ func (s *SchemasController) HandleCreate() {
 		return
 	}
 
+	if data["indexes"] != nil {
+		indexes := utils.M(data["indexes"])
+		if indexes == nil {
+			s.HandleError(errs.E(errs.InvalidJSON, "indexes should be an object"), 0)
+			return
+		}
+		err = schema.CreateIndexes(className, indexes)
+		if err != nil {
+			s.HandleError(err, 0)
+			return
+		}
+		result["indexes"] = indexes
+	}
+
 	s.Data["json"] = result
 	s.ServeJSON()
 }
@@ -115,6 +134,11 @@ func (s *SchemasController) HandleUpdate() {
 		submittedFields = utils.M(data["fields"])
 	}
 
+	if data["classLevelPermissions"] != nil && utils.M(data["classLevelPermissions"]) == nil {
+		s.HandleError(errs.E(errs.InvalidJSON, "classLevelPermissions must be an object"), 0)
+		return
+	}
+
 	schema := orm.TomatoDBController.LoadSchema(types.M{"clearCache": true})
 	result, err := schema.UpdateClass(className, submittedFields, utils.M(data["classLevelPermissions"]))
 	if err != nil {
@@ -122,6 +146,20 @@ func (s *SchemasController) HandleUpdate() {
 		return
 	}
 
+	if data["indexes"] != nil {
+		indexes := utils.M(data["indexes"])
+		if indexes == nil {
+			s.HandleError(errs.E(errs.InvalidJSON, "indexes should be an object"), 0)
+			return
+		}
+		err = schema.CreateIndexes(className, indexes)
+		if err != nil {
+			s.HandleError(err, 0)
+			return
+		}
+		result["indexes"] = indexes
+	}
+
 	s.Data["json"] = result
 	s.ServeJSON()
 }
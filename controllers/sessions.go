@@ -47,7 +47,7 @@ func (s *SessionsController) HandleUpdate() {
 func (s *SessionsController) HandleDelete() {
 	objectID := s.Ctx.Input.Param(":objectId")
 	if objectID == "me" {
-		s.ClassesController.Delete()
+		s.handleDeleteMe()
 		return
 	}
 	s.ClassName = "_Session"
@@ -79,6 +79,21 @@ func (s *SessionsController) HandleGetMe() {
 	s.ServeJSON()
 }
 
+// handleDeleteMe 注销当前请求的 session ，删除时会同时清除缓存，使 token 立即失效
+func (s *SessionsController) handleDeleteMe() {
+	if s.Info == nil || s.Info.SessionToken == "" {
+		s.HandleError(errs.E(errs.InvalidSessionToken, "Session token required."), 0)
+		return
+	}
+	_, err := rest.DestroySession(s.Info.SessionToken, s.Info.ClientSDK)
+	if err != nil {
+		s.HandleError(err, 0)
+		return
+	}
+	s.Data["json"] = types.M{}
+	s.ServeJSON()
+}
+
 // HandleUpdateMe 仅用于更新 installationId
 // @router /me [put]
 func (s *SessionsController) HandleUpdateMe() {
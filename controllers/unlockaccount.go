@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"github.com/lfq7413/tomato/errs"
+	"github.com/lfq7413/tomato/orm"
+	"github.com/lfq7413/tomato/rest"
+	"github.com/lfq7413/tomato/types"
+	"github.com/lfq7413/tomato/utils"
+)
+
+// UnlockAccountController 处理 /unlockAccount 接口的请求
+type UnlockAccountController struct {
+	ClassesController
+}
+
+// HandleUnlockAccount 解除指定用户的账户锁定，仅允许 Master Key 访问
+// @router / [post]
+func (u *UnlockAccountController) HandleUnlockAccount() {
+	if u.EnforceMasterKeyAccess() == false {
+		return
+	}
+	var username, email string
+	if u.JSONBody != nil {
+		username = utils.S(u.JSONBody["username"])
+		email = utils.S(u.JSONBody["email"])
+	}
+
+	var where types.M
+	if username != "" {
+		where = types.M{"username": username}
+	} else if email != "" {
+		where = types.M{"email": email}
+	} else {
+		u.HandleError(errs.E(errs.UsernameMissing, "username or email is required."), 0)
+		return
+	}
+
+	results, err := orm.TomatoDBController.Find("_User", where, types.M{})
+	if err != nil {
+		u.HandleError(err, 0)
+		return
+	}
+	if len(results) == 0 {
+		u.HandleError(errs.E(errs.ObjectNotFound, "Object not found."), 0)
+		return
+	}
+	user := utils.M(results[0])
+
+	err = rest.NewAccountLockout(utils.S(user["username"])).Unlock()
+	if err != nil {
+		u.HandleError(err, 0)
+		return
+	}
+
+	u.Data["json"] = types.M{}
+	u.ServeJSON()
+}
+
+// Get ...
+// @router / [get]
+func (u *UnlockAccountController) Get() {
+	u.ClassesController.Get()
+}
+
+// Delete ...
+// @router / [delete]
+func (u *UnlockAccountController) Delete() {
+	u.ClassesController.Delete()
+}
+
+// Put ...
+// @router / [put]
+func (u *UnlockAccountController) Put() {
+	u.ClassesController.Put()
+}
@@ -1,6 +1,9 @@
 package controllers
 
 import (
+	"strings"
+
+	"github.com/lfq7413/tomato/cache"
 	"github.com/lfq7413/tomato/config"
 	"github.com/lfq7413/tomato/errs"
 	"github.com/lfq7413/tomato/orm"
@@ -21,9 +24,24 @@ func (u *UpgradeSessionController) HandleUpdateToRevocableSession() {
 		u.HandleError(errs.E(errs.InvalidSessionToken, "Session token required."), 0)
 		return
 	}
+	// 已经是可撤销的 session token ，不需要升级
+	if strings.HasPrefix(u.Info.SessionToken, "r:") {
+		u.HandleError(errs.E(errs.InvalidSessionToken, "Session token is already revocable."), 0)
+		return
+	}
+	// 使用 Master Key 时 Prepare 中不会校验 legacy session token ，此处重新获取用户信息
+	auth := u.Auth
+	if auth == nil || auth.IsMaster || auth.User == nil {
+		var err error
+		auth, err = rest.GetAuthForLegacySessionToken(u.Info.SessionToken, u.Info.InstallationID)
+		if err != nil {
+			u.HandleError(err, 0)
+			return
+		}
+	}
 
 	token := "r:" + utils.CreateToken()
-	userID := utils.S(u.Auth.User["objectId"])
+	userID := utils.S(auth.User["objectId"])
 	expiresAt := config.GenerateSessionExpiresAt()
 	sessionData := types.M{
 		"sessionToken": token,
@@ -36,7 +54,7 @@ func (u *UpgradeSessionController) HandleUpdateToRevocableSession() {
 			"action": "upgrade",
 		},
 		"restricted":     false,
-		"installationId": u.Auth.InstallationID,
+		"installationId": auth.InstallationID,
 		"expiresAt": types.M{
 			"__type": "Date",
 			"iso":    utils.TimetoString(expiresAt),
@@ -66,6 +84,7 @@ func (u *UpgradeSessionController) HandleUpdateToRevocableSession() {
 		u.HandleError(err, 0)
 		return
 	}
+	cache.User.Del(u.Info.SessionToken)
 
 	u.Data["json"] = sessionData
 	u.ServeJSON()
@@ -72,30 +72,32 @@ func (u *UsersController) HandleMe() {
 		return
 	}
 	sessionToken := u.Info.SessionToken
-	where := types.M{
-		"sessionToken": sessionToken,
-	}
-	option := types.M{
-		"include": "user",
+	// 使用 Master Key 时 Prepare 中不会校验 sessionToken ，此处需要重新校验
+	auth, err := rest.GetAuthForSessionToken(sessionToken, u.Info.InstallationID)
+	if err != nil {
+		u.HandleError(err, 0)
+		return
 	}
-	response, err := rest.Find(rest.Master(), "_Session", where, option, u.Info.ClientSDK)
 
+	// 以用户自身的权限重新查询，获取最新的用户信息，包括 email authData 等字段
+	where := types.M{
+		"objectId": auth.User["objectId"],
+	}
+	response, err := rest.Find(auth, "_User", where, types.M{}, u.Info.ClientSDK)
 	if err != nil {
 		u.HandleError(err, 0)
 		return
 	}
-
 	if utils.HasResults(response) == false {
 		u.HandleError(errs.E(errs.InvalidSessionToken, "invalid session token"), 0)
 		return
 	}
 	results := utils.A(response["results"])
-	result := utils.M(results[0])
-	if result["user"] == nil {
+	user := utils.M(results[0])
+	if user == nil {
 		u.HandleError(errs.E(errs.InvalidSessionToken, "invalid session token"), 0)
 		return
 	}
-	user := utils.M(result["user"])
 	user["sessionToken"] = sessionToken
 
 	// 删除隐藏字段
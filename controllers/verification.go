@@ -2,10 +2,8 @@ package controllers
 
 import (
 	"github.com/lfq7413/tomato/errs"
-	"github.com/lfq7413/tomato/orm"
 	"github.com/lfq7413/tomato/rest"
 	"github.com/lfq7413/tomato/types"
-	"github.com/lfq7413/tomato/utils"
 )
 
 // VerificationController 处理 /verificationEmailRequest 接口的请求
@@ -28,25 +26,11 @@ func (r *VerificationController) HandleVerificationEmailRequest() {
 		return
 	}
 
-	results, err := orm.TomatoDBController.Find("_User", types.M{"email": email}, types.M{})
+	err := rest.ResendVerificationEmailByEmail(email)
 	if err != nil {
 		r.HandleError(err, 0)
 		return
 	}
-	if len(results) < 1 {
-		err = errs.E(errs.EmailNotFound, "No user found with email "+email)
-		r.HandleError(err, 0)
-	}
-
-	user := utils.M(results[0])
-	if user != nil {
-		if emailVerified, ok := user["emailVerified"].(bool); ok && emailVerified {
-			err = errs.E(errs.OtherCause, "Email "+email+" is already verified.")
-			r.HandleError(err, 0)
-		}
-	}
-
-	rest.SendVerificationEmail(user)
 	r.Data["json"] = types.M{}
 	r.ServeJSON()
 }
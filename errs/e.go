@@ -435,6 +435,11 @@ const AccountAlreadyLinked = 208
 // Error code indicating that the current session token is invalid.
 const InvalidSessionToken = 209
 
+// PasswordExpired ...
+// Error code indicating that the user's password is older than MaxPasswordAge
+// and must be reset before logging in.
+const PasswordExpired = 210
+
 // LinkedIDMissing ...
 // Error code indicating that a user cannot be linked to an account because
 // that account's id could not be found.
@@ -1,7 +1,10 @@
 package hooks
 
 import (
+	"net/url"
+
 	"github.com/lfq7413/tomato/cloud"
+	"github.com/lfq7413/tomato/config"
 	"github.com/lfq7413/tomato/errs"
 	"github.com/lfq7413/tomato/orm"
 	"github.com/lfq7413/tomato/types"
@@ -66,15 +69,42 @@ func GetTriggers() (types.S, error) {
 	return results, nil
 }
 
+// GetJob ...
+func GetJob(jobName string) (types.M, error) {
+	results, err := getHooks(types.M{"jobName": jobName}, types.M{"limit": 1})
+	if err != nil {
+		return nil, err
+	}
+	if results == nil || len(results) != 1 {
+		return nil, nil
+	}
+	return utils.M(results[0]), nil
+}
+
+// GetJobs ...
+func GetJobs() (types.S, error) {
+	results, err := getHooks(types.M{"jobName": types.M{"$exists": true}}, types.M{})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
 // DeleteFunction ...
 func DeleteFunction(functionName string) error {
-	cloud.RemoveFunction(functionName)
+	cloud.RemoveWebhookFunction(functionName)
 	return removeHooks(types.M{"functionName": functionName})
 }
 
+// DeleteJob ...
+func DeleteJob(jobName string) error {
+	cloud.RemoveWebhookJob(jobName)
+	return removeHooks(types.M{"jobName": jobName})
+}
+
 // DeleteTrigger ...
 func DeleteTrigger(className, triggerName string) error {
-	cloud.RemoveTrigger(triggerName, className)
+	cloud.RemoveWebhookTrigger(triggerName, className)
 	return removeHooks(types.M{"className": className, "triggerName": triggerName})
 }
 
@@ -101,6 +131,10 @@ func saveHook(hook types.M) (types.M, error) {
 		query = types.M{
 			"functionName": hook["functionName"],
 		}
+	} else if hook["jobName"] != nil && hook["url"] != nil {
+		query = types.M{
+			"jobName": hook["jobName"],
+		}
 	} else if hook["triggerName"] != nil && hook["className"] != nil && hook["url"] != nil {
 		query = types.M{
 			"triggerName": hook["triggerName"],
@@ -115,9 +149,12 @@ func saveHook(hook types.M) (types.M, error) {
 
 func addHookToTriggers(hook types.M) {
 	if hook["className"] != nil {
-		cloud.AddTrigger(utils.S(hook["triggerName"]), utils.S(hook["className"]), cloud.GetTriggerHandler(utils.S(hook["url"])))
+		cloud.AddWebhookTrigger(utils.S(hook["triggerName"]), utils.S(hook["className"]), cloud.GetTriggerHandler(utils.S(hook["url"])))
+	} else if hook["jobName"] != nil {
+		cloud.AddWebhookJob(utils.S(hook["jobName"]), cloud.GetJobHandler(utils.S(hook["url"])))
+	} else {
+		cloud.AddWebhookFunction(utils.S(hook["functionName"]), cloud.GetFunctionHandler(utils.S(hook["url"])))
 	}
-	cloud.AddFunction(utils.S(hook["functionName"]), cloud.GetFunctionHandler(utils.S(hook["url"])), nil)
 }
 
 func addHook(hook types.M) (types.M, error) {
@@ -132,6 +169,11 @@ func createOrUpdateHook(aHook types.M) (types.M, error) {
 			"functionName": aHook["functionName"],
 			"url":          aHook["url"],
 		}
+	} else if aHook != nil && aHook["jobName"] != nil && aHook["url"] != nil {
+		hook = types.M{
+			"jobName": aHook["jobName"],
+			"url":     aHook["url"],
+		}
 	} else if aHook != nil && aHook["className"] != nil && aHook["url"] != nil && aHook["triggerName"] != nil {
 		hook = types.M{
 			"className":   aHook["className"],
@@ -142,9 +184,48 @@ func createOrUpdateHook(aHook types.M) (types.M, error) {
 		return nil, errs.E(errs.WebhookError, "invalid hook declaration")
 	}
 
+	if hook["triggerName"] != nil && validTriggerName(utils.S(hook["triggerName"]), utils.S(hook["className"])) == false {
+		return nil, errs.E(errs.WebhookError, "invalid trigger name: "+utils.S(hook["triggerName"]))
+	}
+	err := validateHookURL(hook["url"])
+	if err != nil {
+		return nil, err
+	}
+
 	return addHook(hook)
 }
 
+// validateHookURL 校验 webhook 地址，未开启 AllowInsecureWebhooks 时仅允许 https
+func validateHookURL(hookURL interface{}) error {
+	s, ok := hookURL.(string)
+	if ok == false {
+		return errs.E(errs.WebhookError, "invalid url")
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return errs.E(errs.WebhookError, "invalid url: "+s)
+	}
+	if u.Scheme == "https" {
+		return nil
+	}
+	if u.Scheme == "http" && config.TConfig.AllowInsecureWebhooks {
+		return nil
+	}
+	return errs.E(errs.WebhookError, "webhook url must use https: "+s)
+}
+
+func validTriggerName(triggerName, className string) bool {
+	switch triggerName {
+	case cloud.TypeBeforeSave, cloud.TypeAfterSave, cloud.TypeBeforeDelete, cloud.TypeAfterDelete, cloud.TypeBeforeFind, cloud.TypeAfterFind:
+		return true
+	case cloud.TypeBeforeLogin:
+		return className == "_User"
+	case cloud.TypeAfterLogout:
+		return className == "_Session"
+	}
+	return false
+}
+
 // CreateHook ...
 func CreateHook(aHook types.M) (types.M, error) {
 	if aHook["functionName"] != nil {
@@ -153,6 +234,12 @@ func CreateHook(aHook types.M) (types.M, error) {
 			return nil, errs.E(errs.WebhookError, "function name: "+utils.S(aHook["functionName"])+" already exits")
 		}
 		return createOrUpdateHook(aHook)
+	} else if aHook["jobName"] != nil {
+		result, _ := GetJob(utils.S(aHook["jobName"]))
+		if result != nil {
+			return nil, errs.E(errs.WebhookError, "job name: "+utils.S(aHook["jobName"])+" already exits")
+		}
+		return createOrUpdateHook(aHook)
 	} else if aHook["className"] != nil && aHook["triggerName"] != nil {
 		result, _ := GetTrigger(utils.S(aHook["className"]), utils.S(aHook["triggerName"]))
 		if result != nil {
@@ -171,6 +258,12 @@ func UpdateHook(aHook types.M) (types.M, error) {
 			return nil, errs.E(errs.WebhookError, "no function named: "+utils.S(aHook["functionName"])+" is defined")
 		}
 		return createOrUpdateHook(aHook)
+	} else if aHook["jobName"] != nil {
+		result, _ := GetJob(utils.S(aHook["jobName"]))
+		if result == nil {
+			return nil, errs.E(errs.WebhookError, "no job named: "+utils.S(aHook["jobName"])+" is defined")
+		}
+		return createOrUpdateHook(aHook)
 	} else if aHook["className"] != nil && aHook["triggerName"] != nil {
 		result, _ := GetTrigger(utils.S(aHook["className"]), utils.S(aHook["triggerName"]))
 		if result == nil {
@@ -0,0 +1,61 @@
+package hooks
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lfq7413/tomato/errs"
+	"github.com/lfq7413/tomato/types"
+)
+
+func Test_validTriggerName(t *testing.T) {
+	var ok bool
+	/*************************************************/
+	ok = validTriggerName("beforeSave", "post")
+	if ok == false {
+		t.Error("expect:", true, "result:", ok)
+	}
+	/*************************************************/
+	ok = validTriggerName("beforeLogin", "_User")
+	if ok == false {
+		t.Error("expect:", true, "result:", ok)
+	}
+	ok = validTriggerName("beforeLogin", "_Session")
+	if ok == true {
+		t.Error("expect:", false, "result:", ok)
+	}
+	/*************************************************/
+	ok = validTriggerName("afterLogout", "_Session")
+	if ok == false {
+		t.Error("expect:", true, "result:", ok)
+	}
+	ok = validTriggerName("afterLogout", "_User")
+	if ok == true {
+		t.Error("expect:", false, "result:", ok)
+	}
+	/*************************************************/
+	ok = validTriggerName("beforeRun", "post")
+	if ok == true {
+		t.Error("expect:", false, "result:", ok)
+	}
+}
+
+func Test_createOrUpdateHook(t *testing.T) {
+	var hook types.M
+	var err error
+	var expect error
+	/*************************************************/
+	hook = types.M{"className": "post", "triggerName": "beforeLogin", "url": "https://example.com/hook"}
+	_, err = createOrUpdateHook(hook)
+	expect = errs.E(errs.WebhookError, "invalid trigger name: beforeLogin")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/*************************************************/
+	hook = types.M{"className": "_User", "triggerName": "afterLogout", "url": "https://example.com/hook"}
+	_, err = createOrUpdateHook(hook)
+	expect = errs.E(errs.WebhookError, "invalid trigger name: afterLogout")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+}
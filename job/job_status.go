@@ -26,14 +26,14 @@ func NewjobStatus() *JobStatus {
 	return p
 }
 
-// SetRunning ...
-func (j *JobStatus) SetRunning(jobName string, params types.M) types.M {
+// SetPending 创建任务状态，任务开始执行前为 pending
+func (j *JobStatus) SetPending(jobName string, params types.M) types.M {
 	now := time.Now().UTC()
 	j.status = types.M{
 		"objectId":  j.objectID,
 		"jobName":   jobName,
 		"params":    params,
-		"status":    "running",
+		"status":    "pending",
 		"source":    "api",
 		"createdAt": utils.TimetoString(now),
 		// lockdown!
@@ -43,6 +43,11 @@ func (j *JobStatus) SetRunning(jobName string, params types.M) types.M {
 	return j.status
 }
 
+// SetRunning 任务开始执行
+func (j *JobStatus) SetRunning() {
+	j.db.Update(jobStatusCollection, types.M{"objectId": j.objectID}, types.M{"status": "running"}, types.M{}, false)
+}
+
 // SetMessage ...
 func (j *JobStatus) SetMessage(message string) {
 	j.db.Update(jobStatusCollection, types.M{"objectId": j.objectID}, types.M{"message": message}, types.M{}, false)
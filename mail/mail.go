@@ -1,12 +1,88 @@
 package mail
 
-import "github.com/lfq7413/tomato/types"
+import (
+	"html"
+	"strings"
 
-// Adapter ...
+	"github.com/lfq7413/tomato/types"
+	"github.com/lfq7413/tomato/utils"
+)
+
+// MailMessage 邮件内容
+type MailMessage struct {
+	To      string // 接收方地址
+	Subject string // 邮件主题
+	Text    string // 邮件内容
+	HTML    string // HTML 格式的邮件内容，选填
+}
+
+// Adapter 邮件发送模块
 type Adapter interface {
-	// SendMail 包含三个参数：
-	// to 接收方地址
-	// text 邮件内容
-	// subject 邮件主题
-	SendMail(types.M) error
+	// SendVerificationEmail 发送邮箱验证邮件
+	SendVerificationEmail(to, link string, user types.M) error
+	// SendPasswordResetEmail 发送密码重置邮件
+	SendPasswordResetEmail(to, link string, user types.M) error
+	// SendMail 发送任意邮件
+	SendMail(MailMessage) error
+}
+
+// Template 邮件模板，主题与内容中的 %username% %email% %appname% %link% 会被替换
+type Template struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// DefaultVerificationTemplate 默认的邮箱验证邮件模板
+var DefaultVerificationTemplate = Template{
+	Subject: "Please verify your e-mail for %appname%",
+	Text: "Hi,\n\n" +
+		"You are being asked to confirm the e-mail address %email% with %appname%\n\n" +
+		"Click here to confirm it:\n%link%",
+}
+
+// DefaultPasswordResetTemplate 默认的密码重置邮件模板
+var DefaultPasswordResetTemplate = Template{
+	Subject: "Password Reset for %appname%",
+	Text: "Hi,\n\n" +
+		"You requested to reset your password for %appname%\n\n" +
+		"Click here to reset it:\n%link%",
+}
+
+// NewTemplate 使用自定义的主题与内容组装模板，为空的部分使用默认模板
+func NewTemplate(subject, text, html string, defaultTemplate Template) Template {
+	t := defaultTemplate
+	if subject != "" {
+		t.Subject = subject
+	}
+	if text != "" {
+		t.Text = text
+	}
+	if html != "" {
+		t.HTML = html
+	}
+	return t
+}
+
+// Render 替换模板中的占位符，生成邮件内容
+func (t Template) Render(to, appName, link string, user types.M) MailMessage {
+	replacer := strings.NewReplacer(
+		"%username%", utils.S(user["username"]),
+		"%email%", utils.S(user["email"]),
+		"%appname%", appName,
+		"%link%", link,
+	)
+	// HTML 内容中替换的值需要转义
+	htmlReplacer := strings.NewReplacer(
+		"%username%", html.EscapeString(utils.S(user["username"])),
+		"%email%", html.EscapeString(utils.S(user["email"])),
+		"%appname%", html.EscapeString(appName),
+		"%link%", html.EscapeString(link),
+	)
+	return MailMessage{
+		To:      to,
+		Subject: replacer.Replace(t.Subject),
+		Text:    replacer.Replace(t.Text),
+		HTML:    htmlReplacer.Replace(t.HTML),
+	}
 }
@@ -0,0 +1,116 @@
+package mail
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lfq7413/tomato/types"
+)
+
+func Test_NewTemplate(t *testing.T) {
+	var result Template
+	var expect Template
+	/*********************************************************/
+	result = NewTemplate("", "", "", DefaultVerificationTemplate)
+	expect = DefaultVerificationTemplate
+	if reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "result:", result)
+	}
+	/*********************************************************/
+	result = NewTemplate("subject", "", "", DefaultVerificationTemplate)
+	expect = Template{
+		Subject: "subject",
+		Text:    DefaultVerificationTemplate.Text,
+	}
+	if reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "result:", result)
+	}
+	/*********************************************************/
+	result = NewTemplate("subject", "text", "<p>html</p>", DefaultVerificationTemplate)
+	expect = Template{
+		Subject: "subject",
+		Text:    "text",
+		HTML:    "<p>html</p>",
+	}
+	if reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "result:", result)
+	}
+}
+
+func Test_Render(t *testing.T) {
+	var tmpl Template
+	var user types.M
+	var result MailMessage
+	var expect MailMessage
+	var text string
+	/*********************************************************/
+	tmpl = DefaultVerificationTemplate
+	user = types.M{"email": "123@g.com"}
+	result = tmpl.Render("123@g.com", "tomato", "http://www.g.com", user)
+	text = "Hi,\n\n"
+	text += "You are being asked to confirm the e-mail address 123@g.com"
+	text += " with tomato\n\n"
+	text += "Click here to confirm it:\nhttp://www.g.com"
+	expect = MailMessage{
+		To:      "123@g.com",
+		Subject: "Please verify your e-mail for tomato",
+		Text:    text,
+	}
+	if reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "result:", result)
+	}
+	/*********************************************************/
+	tmpl = DefaultPasswordResetTemplate
+	user = types.M{"email": "123@g.com"}
+	result = tmpl.Render("123@g.com", "tomato", "http://www.g.com", user)
+	text = "Hi,\n\n"
+	text += "You requested to reset your password for tomato\n\n"
+	text += "Click here to reset it:\nhttp://www.g.com"
+	expect = MailMessage{
+		To:      "123@g.com",
+		Subject: "Password Reset for tomato",
+		Text:    text,
+	}
+	if reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "result:", result)
+	}
+	/*********************************************************/
+	tmpl = Template{
+		Subject: "%appname%: hello %username%",
+		Text:    "%username% <%email%> %link% %unknown%",
+		HTML:    "<a href=\"%link%\">%appname%</a>",
+	}
+	user = types.M{"username": "joe", "email": "123@g.com"}
+	result = tmpl.Render("123@g.com", "tomato", "http://www.g.com", user)
+	expect = MailMessage{
+		To:      "123@g.com",
+		Subject: "tomato: hello joe",
+		Text:    "joe <123@g.com> http://www.g.com %unknown%",
+		HTML:    "<a href=\"http://www.g.com\">tomato</a>",
+	}
+	if reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "result:", result)
+	}
+	/*********************************************************/
+	tmpl = Template{
+		Subject: "hello %username%",
+		HTML:    "<p>%username%</p>",
+	}
+	user = types.M{"username": "<joe>"}
+	result = tmpl.Render("123@g.com", "tomato", "http://www.g.com", user)
+	expect = MailMessage{
+		To:      "123@g.com",
+		Subject: "hello <joe>",
+		HTML:    "<p>&lt;joe&gt;</p>",
+	}
+	if reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "result:", result)
+	}
+	/*********************************************************/
+	tmpl = DefaultPasswordResetTemplate
+	user = nil
+	result = tmpl.Render("joe", "tomato", "http://www.g.com", user)
+	if result.To != "joe" || result.Subject != "Password Reset for tomato" {
+		t.Error("expect:", "joe", "Password Reset for tomato", "result:", result)
+	}
+}
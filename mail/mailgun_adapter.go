@@ -0,0 +1,116 @@
+package mail
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lfq7413/tomato/config"
+	"github.com/lfq7413/tomato/logger"
+	"github.com/lfq7413/tomato/types"
+)
+
+// mailgunTimeout 请求 Mailgun 接口的超时时间
+const mailgunTimeout = 30 * time.Second
+
+// MailgunAdapter 通过 Mailgun 的 HTTP 接口发送邮件
+type MailgunAdapter struct {
+	apiURL                string
+	apiKey                string
+	domain                string
+	from                  string
+	appName               string
+	verificationTemplate  Template
+	passwordResetTemplate Template
+	client                *http.Client
+}
+
+// NewMailgunAdapter ...
+func NewMailgunAdapter() *MailgunAdapter {
+	apiURL := config.TConfig.MailgunAPIURL
+	if apiURL == "" {
+		apiURL = "https://api.mailgun.net/v3"
+	}
+	m := &MailgunAdapter{
+		apiURL:  strings.TrimSuffix(apiURL, "/"),
+		apiKey:  config.TConfig.MailgunAPIKey,
+		domain:  config.TConfig.MailgunDomain,
+		from:    config.TConfig.MailFrom,
+		appName: config.TConfig.AppName,
+		verificationTemplate: NewTemplate(
+			config.TConfig.VerificationEmailSubject,
+			config.TConfig.VerificationEmailBody,
+			config.TConfig.VerificationEmailHTML,
+			DefaultVerificationTemplate,
+		),
+		passwordResetTemplate: NewTemplate(
+			config.TConfig.PasswordResetEmailSubject,
+			config.TConfig.PasswordResetEmailBody,
+			config.TConfig.PasswordResetEmailHTML,
+			DefaultPasswordResetTemplate,
+		),
+		client: &http.Client{Timeout: mailgunTimeout},
+	}
+	return m
+}
+
+// SendVerificationEmail ...
+func (m *MailgunAdapter) SendVerificationEmail(to, link string, user types.M) error {
+	return m.SendMail(m.verificationTemplate.Render(to, m.appName, link, user))
+}
+
+// SendPasswordResetEmail ...
+func (m *MailgunAdapter) SendPasswordResetEmail(to, link string, user types.M) error {
+	return m.SendMail(m.passwordResetTemplate.Render(to, m.appName, link, user))
+}
+
+// SendMail 以表单格式提交到 Mailgun 的 messages 接口
+func (m *MailgunAdapter) SendMail(message MailMessage) error {
+	form := url.Values{}
+	form.Set("from", m.from)
+	form.Set("to", message.To)
+	form.Set("subject", message.Subject)
+	form.Set("text", message.Text)
+	if message.HTML != "" {
+		form.Set("html", message.HTML)
+	}
+
+	req, err := http.NewRequest("POST", m.apiURL+"/"+m.domain+"/messages", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth("api", m.apiKey)
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		logger.Error("Mailgun request failed:", err)
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var result struct {
+		ID      string `json:"id"`
+		Message string `json:"message"`
+	}
+	json.Unmarshal(body, &result)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg := result.Message
+		if msg == "" {
+			msg = strings.TrimSpace(string(body))
+		}
+		logger.Error("Mailgun error", strconv.Itoa(resp.StatusCode)+":", msg)
+		return errors.New("Mailgun error " + strconv.Itoa(resp.StatusCode) + ": " + msg)
+	}
+	logger.Info("Mailgun message sent to", message.To, "id:", result.ID)
+	return nil
+}
@@ -0,0 +1,113 @@
+package mail
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/lfq7413/tomato/config"
+	"github.com/lfq7413/tomato/types"
+)
+
+func Test_MailgunAdapter_SendMail(t *testing.T) {
+	var form url.Values
+	var path, username, password, contentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		contentType = r.Header.Get("Content-Type")
+		username, password, _ = r.BasicAuth()
+		r.ParseForm()
+		form = r.PostForm
+		if password != "key-1001" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte("Forbidden"))
+			return
+		}
+		if form.Get("to") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"message":"'to' parameter is missing"}`))
+			return
+		}
+		w.Write([]byte(`{"id":"<1001@mg.g.com>","message":"Queued. Thank you."}`))
+	}))
+	defer server.Close()
+
+	var m *MailgunAdapter
+	var err error
+	var expect url.Values
+	var expectErr error
+	/*********************************************************/
+	config.TConfig = &config.Config{
+		AppName:       "tomato",
+		MailFrom:      "tomato <noreply@mg.g.com>",
+		MailgunAPIKey: "key-1001",
+		MailgunDomain: "mg.g.com",
+		MailgunAPIURL: server.URL + "/",
+	}
+	m = NewMailgunAdapter()
+	err = m.SendMail(MailMessage{
+		To:      "123@g.com",
+		Subject: "hello",
+		Text:    "text",
+		HTML:    "<p>html</p>",
+	})
+	if err != nil {
+		t.Error("expect:", nil, "result:", err)
+	}
+	expect = url.Values{
+		"from":    {"tomato <noreply@mg.g.com>"},
+		"to":      {"123@g.com"},
+		"subject": {"hello"},
+		"text":    {"text"},
+		"html":    {"<p>html</p>"},
+	}
+	if reflect.DeepEqual(expect, form) == false {
+		t.Error("expect:", expect, "result:", form)
+	}
+	if path != "/mg.g.com/messages" {
+		t.Error("expect:", "/mg.g.com/messages", "result:", path)
+	}
+	if contentType != "application/x-www-form-urlencoded" {
+		t.Error("expect:", "application/x-www-form-urlencoded", "result:", contentType)
+	}
+	if username != "api" || password != "key-1001" {
+		t.Error("expect:", "api", "key-1001", "result:", username, password)
+	}
+	/*********************************************************/
+	err = m.SendPasswordResetEmail("123@g.com", "http://www.g.com", types.M{"username": "joe"})
+	if err != nil {
+		t.Error("expect:", nil, "result:", err)
+	}
+	expect = url.Values{
+		"from":    {"tomato <noreply@mg.g.com>"},
+		"to":      {"123@g.com"},
+		"subject": {"Password Reset for tomato"},
+		"text": {"Hi,\n\n" +
+			"You requested to reset your password for tomato\n\n" +
+			"Click here to reset it:\nhttp://www.g.com"},
+	}
+	if reflect.DeepEqual(expect, form) == false {
+		t.Error("expect:", expect, "result:", form)
+	}
+	/*********************************************************/
+	err = m.SendMail(MailMessage{Subject: "hello", Text: "text"})
+	expectErr = errors.New("Mailgun error 400: 'to' parameter is missing")
+	if reflect.DeepEqual(expectErr, err) == false {
+		t.Error("expect:", expectErr, "result:", err)
+	}
+	/*********************************************************/
+	config.TConfig = &config.Config{
+		MailgunAPIKey: "key-1002",
+		MailgunDomain: "mg.g.com",
+		MailgunAPIURL: server.URL,
+	}
+	m = NewMailgunAdapter()
+	err = m.SendMail(MailMessage{To: "123@g.com", Subject: "hello", Text: "text"})
+	expectErr = errors.New("Mailgun error 401: Forbidden")
+	if reflect.DeepEqual(expectErr, err) == false {
+		t.Error("expect:", expectErr, "result:", err)
+	}
+}
@@ -1,50 +1,167 @@
 package mail
 
 import (
+	"bytes"
+	"crypto/tls"
+	"mime"
+	"mime/multipart"
+	"net"
 	"net/smtp"
+	"net/textproto"
+	"strconv"
 
+	"github.com/lfq7413/tomato/config"
 	"github.com/lfq7413/tomato/types"
-	"github.com/lfq7413/tomato/utils"
 )
-import "github.com/lfq7413/tomato/config"
 
 // SMTPMailAdapter ...
 type SMTPMailAdapter struct {
-	server   string
-	username string
-	password string
+	server                string
+	port                  int
+	useTLS                bool
+	username              string
+	password              string
+	from                  string
+	appName               string
+	verificationTemplate  Template
+	passwordResetTemplate Template
 }
 
 // NewSMTPAdapter ...
 func NewSMTPAdapter() *SMTPMailAdapter {
+	port := config.TConfig.SMTPPort
+	if port == 0 {
+		port = 25
+	}
+	from := config.TConfig.MailFrom
+	if from == "" {
+		from = config.TConfig.MailUsername
+	}
 	s := &SMTPMailAdapter{
 		server:   config.TConfig.SMTPServer,
+		port:     port,
+		useTLS:   config.TConfig.SMTPUseTLS,
 		username: config.TConfig.MailUsername,
 		password: config.TConfig.MailPassword,
+		from:     from,
+		appName:  config.TConfig.AppName,
+		verificationTemplate: NewTemplate(
+			config.TConfig.VerificationEmailSubject,
+			config.TConfig.VerificationEmailBody,
+			config.TConfig.VerificationEmailHTML,
+			DefaultVerificationTemplate,
+		),
+		passwordResetTemplate: NewTemplate(
+			config.TConfig.PasswordResetEmailSubject,
+			config.TConfig.PasswordResetEmailBody,
+			config.TConfig.PasswordResetEmailHTML,
+			DefaultPasswordResetTemplate,
+		),
 	}
 	return s
 }
 
+// SendVerificationEmail ...
+func (s *SMTPMailAdapter) SendVerificationEmail(to, link string, user types.M) error {
+	return s.SendMail(s.verificationTemplate.Render(to, s.appName, link, user))
+}
+
+// SendPasswordResetEmail ...
+func (s *SMTPMailAdapter) SendPasswordResetEmail(to, link string, user types.M) error {
+	return s.SendMail(s.passwordResetTemplate.Render(to, s.appName, link, user))
+}
+
 // SendMail ...
-func (s *SMTPMailAdapter) SendMail(object types.M) error {
-	// TODO 打印错误日志
-	if s.server == "" || s.username == "" || s.password == "" {
-		return nil
+func (s *SMTPMailAdapter) SendMail(message MailMessage) error {
+	client, err := s.dial()
+	if err != nil {
+		return err
 	}
+	defer client.Close()
 
-	receiver := utils.S(object["to"])
-	subject := utils.S(object["subject"])
-	text := utils.S(object["text"])
+	if s.username != "" {
+		if ok, _ := client.Extension("AUTH"); ok {
+			auth := smtp.PlainAuth("", s.username, s.password, s.server)
+			if err = client.Auth(auth); err != nil {
+				return err
+			}
+		}
+	}
+	if err = client.Mail(s.from); err != nil {
+		return err
+	}
+	if err = client.Rcpt(message.To); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(buildMessage(s.from, message)); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
 
-	auth := smtp.PlainAuth("", s.username, s.password, s.server)
-	to := []string{receiver}
-	msg := []byte("To: " + receiver + "\r\n" +
-		"Subject: " + subject + "\r\n" +
-		"\r\n" +
-		text + "\r\n")
-	err := smtp.SendMail(s.server+":25", auth, s.username, to, msg)
+// dial 连接 SMTP 服务器，未使用 TLS 时，如服务器支持则升级为 STARTTLS
+func (s *SMTPMailAdapter) dial() (*smtp.Client, error) {
+	addr := net.JoinHostPort(s.server, strconv.Itoa(s.port))
+	tlsConfig := &tls.Config{ServerName: s.server}
+	if s.useTLS {
+		conn, err := tls.Dial("tcp", addr, tlsConfig)
+		if err != nil {
+			return nil, err
+		}
+		client, err := smtp.NewClient(conn, s.server)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return client, nil
+	}
+
+	client, err := smtp.Dial(addr)
 	if err != nil {
-		// 打印错误
+		return nil, err
+	}
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err = client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, err
+		}
 	}
-	return nil
+	return client, nil
+}
+
+// buildMessage 组装邮件头与邮件内容，主题使用 UTF-8 编码
+// 包含 HTML 内容时，使用 multipart/alternative 同时发送文本与 HTML
+func buildMessage(from string, message MailMessage) []byte {
+	header := "From: " + from + "\r\n" +
+		"To: " + message.To + "\r\n" +
+		"Subject: " + mime.QEncoding.Encode("utf-8", message.Subject) + "\r\n" +
+		"MIME-Version: 1.0\r\n"
+	if message.HTML == "" {
+		return []byte(header +
+			"Content-Type: text/plain; charset=UTF-8\r\n" +
+			"\r\n" +
+			message.Text + "\r\n")
+	}
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=UTF-8", message.Text},
+		{"text/html; charset=UTF-8", message.HTML},
+	} {
+		pw, _ := w.CreatePart(textproto.MIMEHeader{"Content-Type": {part.contentType}})
+		pw.Write([]byte(part.content))
+	}
+	w.Close()
+	return []byte(header +
+		"Content-Type: multipart/alternative; boundary=" + w.Boundary() + "\r\n" +
+		"\r\n" +
+		body.String())
 }
@@ -1,6 +1,8 @@
 package mail
 
 import (
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/lfq7413/tomato/config"
@@ -15,10 +17,102 @@ func Test_smtp(t *testing.T) {
 	}
 
 	s := NewSMTPAdapter()
-	object := types.M{
-		"text":    "text from tomato",
-		"to":      "user@163.com",
-		"subject": "tomato send",
+	message := MailMessage{
+		Text:    "text from tomato",
+		To:      "user@163.com",
+		Subject: "tomato send",
+	}
+	s.SendMail(message)
+}
+
+func Test_NewSMTPAdapter(t *testing.T) {
+	var s *SMTPMailAdapter
+	var result MailMessage
+	var expect MailMessage
+	/*********************************************************/
+	config.TConfig = &config.Config{
+		AppName:                  "tomato",
+		SMTPServer:               "smtp.163.com",
+		MailUsername:             "user@163.com",
+		VerificationEmailSubject: "Welcome to %appname%, %username%",
+	}
+	s = NewSMTPAdapter()
+	if s.port != 25 || s.from != "user@163.com" {
+		t.Error("expect:", 25, "user@163.com", "result:", s.port, s.from)
+	}
+	result = s.verificationTemplate.Render("123@g.com", s.appName, "http://www.g.com", types.M{"username": "joe", "email": "123@g.com"})
+	expect = MailMessage{
+		To:      "123@g.com",
+		Subject: "Welcome to tomato, joe",
+		Text: "Hi,\n\n" +
+			"You are being asked to confirm the e-mail address 123@g.com with tomato\n\n" +
+			"Click here to confirm it:\nhttp://www.g.com",
+	}
+	if reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "result:", result)
+	}
+	/*********************************************************/
+	config.TConfig = &config.Config{
+		SMTPServer: "smtp.163.com",
+		SMTPPort:   465,
+		SMTPUseTLS: true,
+		MailFrom:   "noreply@g.com",
+	}
+	s = NewSMTPAdapter()
+	if s.port != 465 || s.useTLS == false || s.from != "noreply@g.com" {
+		t.Error("expect:", 465, true, "noreply@g.com", "result:", s.port, s.useTLS, s.from)
+	}
+}
+
+func Test_buildMessage(t *testing.T) {
+	var message MailMessage
+	var result string
+	var expect string
+	/*********************************************************/
+	message = MailMessage{
+		To:      "123@g.com",
+		Subject: "hello",
+		Text:    "text",
+	}
+	result = string(buildMessage("noreply@g.com", message))
+	expect = "From: noreply@g.com\r\n" +
+		"To: 123@g.com\r\n" +
+		"Subject: hello\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" +
+		"text\r\n"
+	if reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "result:", result)
+	}
+	/*********************************************************/
+	message = MailMessage{
+		To:      "123@g.com",
+		Subject: "验证邮箱",
+		Text:    "text",
+	}
+	result = string(buildMessage("noreply@g.com", message))
+	expect = "From: noreply@g.com\r\n" +
+		"To: 123@g.com\r\n" +
+		"Subject: =?utf-8?q?=E9=AA=8C=E8=AF=81=E9=82=AE=E7=AE=B1?=\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" +
+		"text\r\n"
+	if reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "result:", result)
+	}
+	/*********************************************************/
+	message = MailMessage{
+		To:      "123@g.com",
+		Subject: "hello",
+		Text:    "text",
+		HTML:    "<p>html</p>",
+	}
+	result = string(buildMessage("noreply@g.com", message))
+	if strings.Contains(result, "Content-Type: multipart/alternative; boundary=") == false ||
+		strings.Contains(result, "Content-Type: text/plain; charset=UTF-8\r\n\r\ntext") == false ||
+		strings.Contains(result, "Content-Type: text/html; charset=UTF-8\r\n\r\n<p>html</p>") == false {
+		t.Error("expect:", "multipart/alternative", "result:", result)
 	}
-	s.SendMail(object)
 }
@@ -2,6 +2,7 @@
 package orm
 
 import (
+	"fmt"
 	"regexp"
 	"strconv"
 	"strings"
@@ -61,6 +62,7 @@ func (d *DBController) PurgeCollection(className string) error {
 // Find 从指定表中查询数据，查询到的数据放入 list 中
 // 如果查询的是 count ，结果也会放入 list，并且只有这一个元素
 // options 中的选项包括：skip、limit、sort、keys、count、acl
+// 内部选项 includePasswordHistory 为 true 时返回 _User 的 _password_history 字段，否则即使是 Master 也不返回
 func (d *DBController) Find(className string, query, options types.M) (types.S, error) {
 	if options == nil {
 		options = types.M{}
@@ -128,7 +130,8 @@ func (d *DBController) Find(className string, query, options types.M) (types.S,
 				return nil, errs.E(errs.InvalidKeyName, "Cannot sort by "+key)
 			}
 
-			if fieldNameIsValid(key) == false {
+			// $score 表示按全文搜索的相关度排序
+			if key != "$score" && fieldNameIsValid(key) == false {
 				return nil, errs.E(errs.InvalidKeyName, "Invalid field name: "+key)
 			}
 
@@ -143,9 +146,19 @@ func (d *DBController) Find(className string, query, options types.M) (types.S,
 		if err != nil {
 			return nil, err
 		}
+		// 非 Master 权限不能在查询条件与排序中使用 protectedFields 中的字段
+		sort, _ := options["sort"].([]string)
+		err = schema.ValidateProtectedQuery(className, aclGroup, query, sort)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	// 处理 $relatedTo
+	err = validateRelatedTo(schema, query)
+	if err != nil {
+		return nil, err
+	}
 	query = d.reduceRelationKeys(className, query)
 	// 处理 relation 字段上的 $in
 	query = d.reduceInRelation(className, query, schema)
@@ -174,6 +187,22 @@ func (d *DBController) Find(className string, query, options types.M) (types.S,
 		return nil, err
 	}
 
+	// 返回查询计划，由数据库适配器根据 count 等选项生成
+	if options["explain"] != nil {
+		if classExists == false {
+			return types.S{}, nil
+		}
+		plans, err := Adapter.Find(className, parseFormatSchema, query, options)
+		if err != nil {
+			return nil, err
+		}
+		results := types.S{}
+		for _, plan := range plans {
+			results = append(results, plan)
+		}
+		return results, nil
+	}
+
 	// 获取 count
 	if options["count"] != nil {
 		if classExists == false {
@@ -186,6 +215,67 @@ func (d *DBController) Find(className string, query, options types.M) (types.S,
 		return types.S{count}, nil
 	}
 
+	// 获取指定字段的不重复值
+	if distinct, ok := options["distinct"].(string); ok && distinct != "" {
+		if fieldNameIsValid(distinct) == false {
+			return nil, errs.E(errs.InvalidKeyName, "Invalid field name: "+distinct)
+		}
+		// 非 Master 权限不能获取用户的敏感字段
+		if isMaster == false && className == "_User" {
+			if distinct == "authData" || distinct == "sessionToken" || distinct == "password" {
+				return nil, errs.E(errs.OperationForbidden, "Cannot get distinct values of "+distinct)
+			}
+			for _, field := range config.TConfig.UserSensitiveFields {
+				if field == distinct {
+					return nil, errs.E(errs.OperationForbidden, "Cannot get distinct values of "+distinct)
+				}
+			}
+		}
+		// 非 Master 权限不能获取 protectedFields 中的字段
+		if isMaster == false {
+			fieldName := strings.Split(distinct, ".")[0]
+			for _, field := range schema.getProtectedFields(className, aclGroup) {
+				if field == fieldName {
+					return nil, errs.E(errs.OperationForbidden, "Cannot get distinct values of "+distinct)
+				}
+			}
+		}
+		if classExists == false {
+			return types.S{}, nil
+		}
+		return Adapter.Distinct(className, parseFormatSchema, query, distinct)
+	}
+
+	// 执行聚合管道
+	if pipeline, ok := options["pipeline"]; ok {
+		stages := utils.A(pipeline)
+		if stages == nil {
+			return nil, errs.E(errs.InvalidQuery, "pipeline must be an array")
+		}
+		err := validatePipeline(stages)
+		if err != nil {
+			return nil, err
+		}
+		if classExists == false {
+			return types.S{}, nil
+		}
+		objects, err := Adapter.Aggregate(className, parseFormatSchema, stages)
+		if err != nil {
+			return nil, err
+		}
+		// 与普通查询一样清理 _User 的内部字段
+		results := types.S{}
+		for _, object := range objects {
+			object = untransformObjectACL(object)
+			result := filterSensitiveData(isMaster, aclGroup, className, object)
+			if className == "_User" && result != nil {
+				delete(result, "_password_history")
+			}
+			results = append(results, result)
+		}
+		return results, nil
+	}
+
 	if classExists == false {
 		return types.S{}, nil
 	}
@@ -195,15 +285,43 @@ func (d *DBController) Find(className string, query, options types.M) (types.S,
 	if err != nil {
 		return nil, err
 	}
+	var protectedFields []string
+	if isMaster == false {
+		protectedFields = schema.getProtectedFields(className, aclGroup)
+	}
+	includePasswordHistory, _ := options["includePasswordHistory"].(bool)
 	results := types.S{}
 	for _, object := range objects {
 		object = untransformObjectACL(object)
 		result := filterSensitiveData(isMaster, aclGroup, className, object)
+		result = filterProtectedFields(protectedFields, aclGroup, className, result)
+		if className == "_User" && includePasswordHistory == false && result != nil {
+			delete(result, "_password_history")
+		}
 		results = append(results, result)
 	}
 	return results, nil
 }
 
+// filterProtectedFields 删除对象中受保护的字段，用户可以查看自己的全部字段
+func filterProtectedFields(protectedFields []string, aclGroup []string, className string, object types.M) types.M {
+	if len(protectedFields) == 0 || object == nil {
+		return object
+	}
+	if className == "_User" {
+		id := utils.S(object["objectId"])
+		for _, v := range aclGroup {
+			if v == id {
+				return object
+			}
+		}
+	}
+	for _, field := range protectedFields {
+		delete(object, field)
+	}
+	return object
+}
+
 // Destroy 从指定表中删除数据
 func (d *DBController) Destroy(className string, query types.M, options types.M) error {
 	if query == nil {
@@ -322,6 +440,10 @@ func (d *DBController) Update(className string, query, update, options types.M,
 		if err != nil {
 			return nil, err
 		}
+		err = schema.validateWritableFields(className, aclGroup, update)
+		if err != nil {
+			return nil, err
+		}
 	}
 	// 处理 Relation
 	relationUpdates = d.collectRelationUpdates(className, utils.S(originalQuery["objectId"]), update)
@@ -372,6 +494,11 @@ func (d *DBController) Update(className string, query, update, options types.M,
 
 	update = transformObjectACL(update)
 	transformAuthData(className, update, sch)
+	// 删除不存在的字段时不做任何操作
+	removeDeleteOpsForMissingFields(update, utils.M(sch["fields"]))
+	if len(update) == 0 {
+		return types.M{}, nil
+	}
 	var result types.M
 	if many {
 		err := Adapter.UpdateObjectsByQuery(className, sch, query, update)
@@ -413,6 +540,21 @@ func (d *DBController) Update(className string, query, update, options types.M,
 	return response, nil
 }
 
+// removeDeleteOpsForMissingFields 去掉 schema 中不存在的字段上的 Delete 操作
+func removeDeleteOpsForMissingFields(update, fields types.M) {
+	for key, v := range update {
+		if op := utils.M(v); op == nil || utils.S(op["__op"]) != "Delete" {
+			continue
+		}
+		if strings.Contains(key, ".") || strings.HasPrefix(key, "_") {
+			continue
+		}
+		if _, ok := fields[key]; ok == false {
+			delete(update, key)
+		}
+	}
+}
+
 // sanitizeDatabaseResult 处理数据库返回结果
 func sanitizeDatabaseResult(originalObject, result types.M) types.M {
 	response := types.M{}
@@ -473,8 +615,6 @@ func (d *DBController) Create(className string, object, options types.M) error {
 		isMaster = true
 	}
 
-	relationUpdates := d.collectRelationUpdates(className, "", object)
-
 	err := d.validateClassName(className)
 	if err != nil {
 		return err
@@ -486,8 +626,14 @@ func (d *DBController) Create(className string, object, options types.M) error {
 		if err != nil {
 			return err
 		}
+		err = schema.validateWritableFields(className, aclGroup, object)
+		if err != nil {
+			return err
+		}
 	}
 
+	relationUpdates := d.collectRelationUpdates(className, "", object)
+
 	err = schema.EnforceClassExists(className)
 	if err != nil {
 		return err
@@ -787,16 +933,18 @@ func (d *DBController) reduceRelationKeys(className string, query types.M) types
 	if query == nil {
 		return query
 	}
-	// 处理 $or 数组中的数据，并替换回去
-	if query["$or"] != nil {
+	// 处理 $or $and $nor 数组中的数据，并替换回去
+	for _, op := range []string{"$or", "$and", "$nor"} {
+		if query[op] == nil {
+			continue
+		}
 		var subQuerys types.S
-		subQuerys = utils.A(query["$or"])
+		subQuerys = utils.A(query[op])
 		for i, v := range subQuerys {
 			aQuery := utils.M(v)
 			subQuerys[i] = d.reduceRelationKeys(className, aQuery)
 		}
-		query["$or"] = subQuerys
-		return query
+		query[op] = subQuerys
 	}
 
 	if r, ok := query["$relatedTo"]; ok {
@@ -820,6 +968,37 @@ func (d *DBController) reduceRelationKeys(className string, query types.M) types
 	return query
 }
 
+// validateRelatedTo 校验 $relatedTo 中的 key 是否为对应类中的 Relation 字段
+func validateRelatedTo(schema *Schema, query types.M) error {
+	if query == nil {
+		return nil
+	}
+	for _, op := range []string{"$or", "$and", "$nor"} {
+		for _, v := range utils.A(query[op]) {
+			err := validateRelatedTo(schema, utils.M(v))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	relatedTo := utils.M(query["$relatedTo"])
+	if relatedTo == nil {
+		return nil
+	}
+	key := utils.S(relatedTo["key"])
+	object := utils.M(relatedTo["object"])
+	if key == "" || object == nil {
+		return errs.E(errs.InvalidQuery, "Bad $relatedTo format - key and object are required.")
+	}
+	objClassName := utils.S(object["className"])
+	expectedType := schema.getExpectedType(objClassName, key)
+	if expectedType == nil || utils.S(expectedType["type"]) != "Relation" {
+		return errs.E(errs.InvalidQuery, "Field "+key+" is not a Relation field of class "+objClassName)
+	}
+	return nil
+}
+
 // relatedIds 从 Join 表中查询 ids ，表名：_Join:key:className
 func (d *DBController) relatedIds(className, key, owningID string) types.S {
 	ids := types.S{}
@@ -1007,16 +1186,18 @@ func (d *DBController) reduceInRelation(className string, query types.M, schema
 	if query == nil {
 		return query
 	}
-	// 处理 $or 数组中的数据，并替换回去
-	if query["$or"] != nil {
-		var ors types.S
-		ors = utils.A(query["$or"])
-		for i, v := range ors {
+	// 处理 $or $and $nor 数组中的数据，并替换回去
+	for _, op := range []string{"$or", "$and", "$nor"} {
+		if query[op] == nil {
+			continue
+		}
+		var subQuerys types.S
+		subQuerys = utils.A(query[op])
+		for i, v := range subQuerys {
 			aQuery := utils.M(v)
-			ors[i] = d.reduceInRelation(className, aQuery, schema)
+			subQuerys[i] = d.reduceInRelation(className, aQuery, schema)
 		}
-		query["$or"] = ors
-		return query
+		query[op] = subQuerys
 	}
 
 	for key, v := range query {
@@ -1225,10 +1406,12 @@ func (d *DBController) addPointerPermissions(schema *Schema, className string, o
 		return query
 	}
 
+	schema.permsMutex.Lock()
 	perms := schema.perms[className]
+	schema.permsMutex.Unlock()
 	// 根据当前操作确定是读还是写
 	var field string
-	if operation == "get" || operation == "find" {
+	if operation == "get" || operation == "find" || operation == "count" {
 		field = "readUserFields"
 	} else {
 		field = "writeUserFields"
@@ -1261,12 +1444,17 @@ func (d *DBController) addPointerPermissions(schema *Schema, className string, o
 						"objectId":  userID,
 					}
 
-					// 使用 and 拼装请求
-					ors := []types.M{}
+					// 使用 and 拼装请求，数组类型的字段需要包含当前用户
+					ors := types.S{}
 					for _, key := range permFields {
 						q := types.M{
 							utils.S(key): userPointer,
 						}
+						if fieldType := schema.getExpectedType(className, utils.S(key)); fieldType != nil && utils.S(fieldType["type"]) == "Array" {
+							q = types.M{
+								utils.S(key): types.M{"$all": types.S{userPointer}},
+							}
+						}
 						and := types.M{
 							"$and": types.S{q, query},
 						}
@@ -1276,7 +1464,7 @@ func (d *DBController) addPointerPermissions(schema *Schema, className string, o
 					if len(ors) > 1 {
 						return types.M{"$or": ors}
 					}
-					return ors[0]
+					return ors[0].(types.M)
 				}
 			}
 		}
@@ -1312,6 +1500,7 @@ func (d *DBController) PerformInitialization() {
 	d.LoadSchema(nil).EnforceClassExists("_Role")
 	Adapter.EnsureUniqueness("_User", requiredUserFields, []string{"username"})
 	Adapter.EnsureUniqueness("_User", requiredUserFields, []string{"email"})
+	Adapter.EnsureUniqueness("_User", requiredUserFields, []string{"authData.anonymous.id"})
 	Adapter.EnsureUniqueness("_Role", requiredRoleFields, []string{"name"})
 	Adapter.PerformInitialization(types.M{"VolatileClassesSchemas": volatileClassesSchemas()})
 }
@@ -1348,9 +1537,99 @@ func addReadACL(query types.M, acl []string) types.M {
 	return newQuery
 }
 
+// allowedPipelineStages 聚合管道中允许使用的阶段
+var allowedPipelineStages = map[string]bool{
+	"$group":       true,
+	"$match":       true,
+	"$project":     true,
+	"$sort":        true,
+	"$limit":       true,
+	"$skip":        true,
+	"$unwind":      true,
+	"$count":       true,
+	"$sample":      true,
+	"$sortByCount": true,
+}
+
+// writePipelineStages 聚合管道中会写入数据的阶段，禁止使用
+var writePipelineStages = map[string]bool{
+	"$out":   true,
+	"$merge": true,
+}
+
+// protectedPipelineFields 聚合管道中禁止引用的内部字段
+var protectedPipelineFields = map[string]bool{
+	"_hashed_password":  true,
+	"_password_history": true,
+	"_session_token":    true,
+	"sessionToken":      true,
+}
+
+// validatePipeline 校验聚合管道，每个阶段仅能包含一个操作符
+func validatePipeline(pipeline types.S) error {
+	for _, s := range pipeline {
+		stage := utils.M(s)
+		if stage == nil || len(stage) != 1 {
+			return errs.E(errs.InvalidQuery, "Bad pipeline stage")
+		}
+		for name, value := range stage {
+			if writePipelineStages[name] {
+				return errs.E(errs.OperationForbidden, "Write stage is not allowed in pipeline: "+name)
+			}
+			if allowedPipelineStages[name] == false {
+				return errs.E(errs.CommandUnavailable, "Unsupported pipeline stage: "+name)
+			}
+			if field := findProtectedPipelineField(value); field != "" {
+				return errs.E(errs.OperationForbidden, "Cannot reference protected field in pipeline: "+field)
+			}
+		}
+	}
+	return nil
+}
+
+// findProtectedPipelineField 查找阶段中引用的内部字段，包括对象中的字段名与 $ 开头的字段引用
+// 普通的字符串值不是字段引用，例如 {"$match": {"key": "sessionToken"}} ，不做检查
+func findProtectedPipelineField(value interface{}) string {
+	if s, ok := value.(string); ok {
+		if strings.HasPrefix(s, "$") == false {
+			return ""
+		}
+		return protectedPipelineFieldName(strings.TrimPrefix(s, "$"))
+	}
+	if arr := utils.A(value); arr != nil {
+		for _, v := range arr {
+			if field := findProtectedPipelineField(v); field != "" {
+				return field
+			}
+		}
+		return ""
+	}
+	if object := utils.M(value); object != nil {
+		for k, v := range object {
+			if field := protectedPipelineFieldName(k); field != "" {
+				return field
+			}
+			if field := findProtectedPipelineField(v); field != "" {
+				return field
+			}
+		}
+	}
+	return ""
+}
+
+// protectedPipelineFieldName name 的第一级为内部字段时返回该字段
+func protectedPipelineFieldName(name string) string {
+	field := strings.Split(name, ".")[0]
+	if protectedPipelineFields[field] {
+		return field
+	}
+	return ""
+}
+
 var specialQuerykeys = map[string]bool{
 	"$and":                           true,
 	"$or":                            true,
+	"$nor":                           true,
 	"_rperm":                         true,
 	"_wperm":                         true,
 	"_perishable_token":              true,
@@ -1457,9 +1736,56 @@ func validateQuery(query types.M) error {
 		}
 	}
 
+	if nor, ok := query["$nor"]; ok {
+		if arr := utils.A(nor); arr != nil && len(arr) > 0 {
+			for _, a := range arr {
+				subQuery := utils.M(a)
+				if subQuery == nil {
+					return errs.E(errs.InvalidQuery, "Bad $nor format - invalid sub query.")
+				}
+				err := validateQuery(subQuery)
+				if err != nil {
+					return err
+				}
+			}
+		} else {
+			return errs.E(errs.InvalidQuery, "Bad $nor format - use an array of at least 1 value.")
+		}
+	}
+
 	for key := range query {
-		// 检测 $options 是否为 imxs
+		// 检测 $regex 是否为字符串， $options 是否为 imxs
+		// 数据库支持的正则语法（前瞻、反向引用等）与 Go 不同，表达式本身由数据库校验，无效时由适配器返回 InvalidQuery
 		if condition := utils.M(query[key]); condition != nil {
+			if regex, ok := condition["$regex"]; ok {
+				if _, ok := regex.(string); ok == false {
+					return errs.E(errs.InvalidQuery, "Bad $regex value for query, should be a string")
+				}
+			}
+			// $all 中的元素也可以是正则表达式
+			for _, v := range utils.A(condition["$all"]) {
+				if element := utils.M(v); element != nil {
+					if regex, ok := element["$regex"]; ok {
+						if _, ok := regex.(string); ok == false {
+							return errs.E(errs.InvalidQuery, "Bad $regex value for query, should be a string")
+						}
+					}
+				}
+			}
+			// $nearSphere 中的经纬度必须在有效范围内，最大距离不能为负数
+			if v, ok := condition["$nearSphere"]; ok {
+				err := validateGeoPoint(utils.M(v))
+				if err != nil {
+					return err
+				}
+				for _, k := range []string{"$maxDistance", "$maxDistanceInRadians", "$maxDistanceInMiles", "$maxDistanceInKilometers"} {
+					if d, ok := condition[k]; ok {
+						if distance, ok := geoNumber(d); ok == false || distance < 0 {
+							return errs.E(errs.InvalidQuery, "Bad "+k+" value for query, should be a non-negative number")
+						}
+					}
+				}
+			}
 			if condition["$regex"] != nil {
 				if op, ok := condition["$options"].(string); ok {
 					b, _ := regexp.MatchString(`^[imxs]+$`, op)
@@ -1483,6 +1809,39 @@ func validateQuery(query types.M) error {
 	return nil
 }
 
+// validateGeoPoint 校验 GeoPoint 格式，纬度范围为 [-90, 90] ，经度范围为 [-180, 180]
+func validateGeoPoint(point types.M) error {
+	if point == nil || utils.S(point["__type"]) != "GeoPoint" {
+		return errs.E(errs.InvalidQuery, "Bad $nearSphere value for query, should be a GeoPoint")
+	}
+	latitude, ok := geoNumber(point["latitude"])
+	if ok == false {
+		return errs.E(errs.InvalidQuery, "GeoPoint latitude should be a number")
+	}
+	longitude, ok := geoNumber(point["longitude"])
+	if ok == false {
+		return errs.E(errs.InvalidQuery, "GeoPoint longitude should be a number")
+	}
+	if latitude < -90 || latitude > 90 {
+		return errs.E(errs.InvalidQuery, fmt.Sprintf("GeoPoint latitude out of bounds: %v", latitude))
+	}
+	if longitude < -180 || longitude > 180 {
+		return errs.E(errs.InvalidQuery, fmt.Sprintf("GeoPoint longitude out of bounds: %v", longitude))
+	}
+	return nil
+}
+
+// geoNumber 取出经纬度及距离中的数值
+func geoNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	}
+	return 0, false
+}
+
 // transformObjectACL 转换对象中的 ACL 字段
 // {
 // 	"ACL":{
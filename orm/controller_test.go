@@ -437,6 +437,27 @@ func Test_Find(t *testing.T) {
 	TomatoDBController.DeleteEverything()
 	/*************************************************/
 	className = "user"
+	object = types.M{
+		"fields": types.M{
+			"key": types.M{"type": "String"},
+		},
+	}
+	Adapter.CreateClass(className, object)
+	object = types.M{
+		"objectId": "01",
+		"key":      "hello",
+	}
+	Adapter.CreateObject(className, types.M{}, object)
+	className = "user"
+	query = types.M{"key": types.M{"$regex": "^joe("}}
+	options = types.M{}
+	results, err = TomatoDBController.Find(className, query, options)
+	if errs.GetErrorCode(err) != errs.InvalidQuery {
+		t.Error("expect:", errs.InvalidQuery, "result:", results, err)
+	}
+	TomatoDBController.DeleteEverything()
+	/*************************************************/
+	className = "user"
 	object = types.M{
 		"fields": types.M{
 			"key": types.M{"type": "Number"},
@@ -1368,6 +1389,146 @@ func Test_Find(t *testing.T) {
 		t.Error("expect:", expects, "result:", results, err)
 	}
 	TomatoDBController.DeleteEverything()
+	/*************************************************/
+	initEnv()
+	className = "_User"
+	object = types.M{
+		"fields": types.M{
+			"key": types.M{"type": "String"},
+		},
+	}
+	Adapter.CreateClass(className, object)
+	object = types.M{
+		"objectId":          "1001",
+		"key":               "hello",
+		"_hashed_password":  "123456",
+		"_password_history": types.S{"654321"},
+	}
+	Adapter.CreateObject(className, types.M{}, object)
+	query = types.M{}
+	options = types.M{}
+	results, err = TomatoDBController.Find(className, query, options)
+	expects = types.S{
+		types.M{
+			"objectId": "1001",
+			"key":      "hello",
+			"password": "123456",
+		},
+	}
+	if err != nil || reflect.DeepEqual(expects, results) == false {
+		t.Error("expect:", expects, "result:", results, err)
+	}
+	options = types.M{"includePasswordHistory": true}
+	results, err = TomatoDBController.Find(className, query, options)
+	expects = types.S{
+		types.M{
+			"objectId":          "1001",
+			"key":               "hello",
+			"password":          "123456",
+			"_password_history": types.S{"654321"},
+		},
+	}
+	if err != nil || reflect.DeepEqual(expects, results) == false {
+		t.Error("expect:", expects, "result:", results, err)
+	}
+	TomatoDBController.DeleteEverything()
+	/*************************************************/
+	initEnv()
+	className = "post"
+	object = types.M{
+		"fields": types.M{
+			"key":    types.M{"type": "String"},
+			"secret": types.M{"type": "String"},
+		},
+		"classLevelPermissions": types.M{
+			"protectedFields": types.M{"*": types.S{"secret"}},
+		},
+	}
+	Adapter.CreateClass(className, object)
+	object = types.M{
+		"objectId": "01",
+		"key":      "hello",
+		"secret":   "abc",
+	}
+	Adapter.CreateObject(className, types.M{}, object)
+	query = types.M{}
+	options = types.M{"acl": []string{"*"}, "distinct": "secret"}
+	results, err = TomatoDBController.Find(className, query, options)
+	expectErr = errs.E(errs.OperationForbidden, "Cannot get distinct values of secret")
+	if reflect.DeepEqual(expectErr, err) == false {
+		t.Error("expect:", expectErr, "result:", err)
+	}
+	options = types.M{"acl": []string{"*"}, "distinct": "key"}
+	results, err = TomatoDBController.Find(className, query, options)
+	expects = types.S{"hello"}
+	if err != nil || reflect.DeepEqual(expects, results) == false {
+		t.Error("expect:", expects, "result:", results, err)
+	}
+	options = types.M{"distinct": "secret"}
+	results, err = TomatoDBController.Find(className, query, options)
+	expects = types.S{"abc"}
+	if err != nil || reflect.DeepEqual(expects, results) == false {
+		t.Error("expect:", expects, "result:", results, err)
+	}
+	query = types.M{"secret": types.M{"$regex": "^a"}}
+	options = types.M{"acl": []string{"*"}}
+	results, err = TomatoDBController.Find(className, query, options)
+	expectErr = errs.E(errs.OperationForbidden, "This user is not allowed to query secret on class post")
+	if reflect.DeepEqual(expectErr, err) == false {
+		t.Error("expect:", expectErr, "result:", err)
+	}
+	query = types.M{"$and": types.S{types.M{"secret": types.M{"$exists": true}}}}
+	options = types.M{"acl": []string{"*"}}
+	results, err = TomatoDBController.Find(className, query, options)
+	expectErr = errs.E(errs.OperationForbidden, "This user is not allowed to query secret on class post")
+	if reflect.DeepEqual(expectErr, err) == false {
+		t.Error("expect:", expectErr, "result:", err)
+	}
+	query = types.M{}
+	options = types.M{"acl": []string{"*"}, "sort": []string{"-secret"}}
+	results, err = TomatoDBController.Find(className, query, options)
+	expectErr = errs.E(errs.OperationForbidden, "This user is not allowed to sort by secret on class post")
+	if reflect.DeepEqual(expectErr, err) == false {
+		t.Error("expect:", expectErr, "result:", err)
+	}
+	query = types.M{"secret": "abc"}
+	options = types.M{"sort": []string{"secret"}}
+	results, err = TomatoDBController.Find(className, query, options)
+	expects = types.S{types.M{"objectId": "01", "key": "hello", "secret": "abc"}}
+	if err != nil || reflect.DeepEqual(expects, results) == false {
+		t.Error("expect:", expects, "result:", results, err)
+	}
+	TomatoDBController.DeleteEverything()
+	/*************************************************/
+	initEnv()
+	className = "_User"
+	object = types.M{
+		"fields": types.M{
+			"key": types.M{"type": "String"},
+		},
+	}
+	Adapter.CreateClass(className, object)
+	object = types.M{
+		"objectId":          "1001",
+		"key":               "hello",
+		"_hashed_password":  "123456",
+		"_password_history": types.S{"654321"},
+	}
+	Adapter.CreateObject(className, types.M{}, object)
+	query = types.M{}
+	options = types.M{"pipeline": types.S{types.M{"$match": types.M{}}}}
+	results, err = TomatoDBController.Find(className, query, options)
+	expects = types.S{
+		types.M{
+			"objectId": "1001",
+			"key":      "hello",
+			"password": "123456",
+		},
+	}
+	if err != nil || reflect.DeepEqual(expects, results) == false {
+		t.Error("expect:", expects, "result:", results, err)
+	}
+	TomatoDBController.DeleteEverything()
 }
 
 func Test_Destroy(t *testing.T) {
@@ -3443,6 +3604,59 @@ func Test_canAddField(t *testing.T) {
 	Adapter.DeleteAllClasses()
 }
 
+func Test_validateRelatedTo(t *testing.T) {
+	var schema *Schema
+	var query types.M
+	var err error
+	var expect error
+	schema = &Schema{
+		data: types.M{
+			"Post": types.M{
+				"likes": types.M{"type": "Relation", "targetClass": "_User"},
+				"title": types.M{"type": "String"},
+			},
+		},
+	}
+	/*************************************************/
+	query = types.M{
+		"$relatedTo": types.M{
+			"object": types.M{"__type": "Pointer", "className": "Post", "objectId": "1001"},
+			"key":    "likes",
+		},
+	}
+	err = validateRelatedTo(schema, query)
+	if err != nil {
+		t.Error("expect:", nil, "result:", err)
+	}
+	/*************************************************/
+	query = types.M{
+		"$or": types.S{
+			types.M{
+				"$relatedTo": types.M{
+					"object": types.M{"__type": "Pointer", "className": "Post", "objectId": "1001"},
+					"key":    "title",
+				},
+			},
+		},
+	}
+	err = validateRelatedTo(schema, query)
+	expect = errs.E(errs.InvalidQuery, "Field title is not a Relation field of class Post")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/*************************************************/
+	query = types.M{
+		"$relatedTo": types.M{
+			"object": types.M{"__type": "Pointer", "className": "Post", "objectId": "1001"},
+		},
+	}
+	err = validateRelatedTo(schema, query)
+	expect = errs.E(errs.InvalidQuery, "Bad $relatedTo format - key and object are required.")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+}
+
 func Test_reduceRelationKeys(t *testing.T) {
 	initEnv()
 	var object types.M
@@ -4819,7 +5033,7 @@ func Test_addPointerPermissions(t *testing.T) {
 	aclGroup = []string{"123456789012345678901234"}
 	result = TomatoDBController.addPointerPermissions(schema, className, operation, query, aclGroup)
 	expect = types.M{
-		"$or": []types.M{
+		"$or": types.S{
 			types.M{
 				"$and": types.S{
 					types.M{
@@ -4850,10 +5064,84 @@ func Test_addPointerPermissions(t *testing.T) {
 		t.Error("expect:", expect, "result:", result)
 	}
 	Adapter.DeleteAllClasses()
+	/*************************************************/
+	className = "user"
+	object = types.M{
+		"className": className,
+		"fields": types.M{
+			"key":    types.M{"type": "String"},
+			"owners": types.M{"type": "Array"},
+		},
+		"classLevelPermissions": types.M{
+			"find":           types.M{"role:1024": true},
+			"readUserFields": types.S{"owners"},
+		},
+	}
+	Adapter.CreateClass(className, object)
+	schema = getSchema()
+	schema.reloadData(nil)
+	className = "user"
+	operation = "find"
+	query = types.M{
+		"key": "hello",
+	}
+	aclGroup = []string{"123456789012345678901234"}
+	result = TomatoDBController.addPointerPermissions(schema, className, operation, query, aclGroup)
+	expect = types.M{
+		"$and": types.S{
+			types.M{
+				"owners": types.M{
+					"$all": types.S{
+						types.M{
+							"__type":    "Pointer",
+							"className": "_User",
+							"objectId":  "123456789012345678901234",
+						},
+					},
+				},
+			},
+			types.M{"key": "hello"},
+		},
+	}
+	if reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "result:", result)
+	}
+	Adapter.DeleteAllClasses()
 }
 
 //////////////////////////////////////////////////////
 
+func Test_removeDeleteOpsForMissingFields(t *testing.T) {
+	var update types.M
+	var fields types.M
+	var expect types.M
+	/**********************************************************/
+	update = types.M{
+		"name":    types.M{"__op": "Delete"},
+		"age":     types.M{"__op": "Delete"},
+		"key":     "hello",
+		"obj.sub": types.M{"__op": "Delete"},
+		"_auth_data_facebook": types.M{
+			"__op": "Delete",
+		},
+	}
+	fields = types.M{
+		"name": types.M{"type": "String"},
+	}
+	removeDeleteOpsForMissingFields(update, fields)
+	expect = types.M{
+		"name":    types.M{"__op": "Delete"},
+		"key":     "hello",
+		"obj.sub": types.M{"__op": "Delete"},
+		"_auth_data_facebook": types.M{
+			"__op": "Delete",
+		},
+	}
+	if reflect.DeepEqual(expect, update) == false {
+		t.Error("expect:", expect, "result:", update)
+	}
+}
+
 func Test_sanitizeDatabaseResult(t *testing.T) {
 	var originalObject types.M
 	var object types.M
@@ -5096,6 +5384,55 @@ func Test_filterSensitiveData(t *testing.T) {
 	}
 }
 
+func Test_filterProtectedFields(t *testing.T) {
+	var protectedFields []string
+	var aclGroup []string
+	var className string
+	var object types.M
+	var result types.M
+	var expect types.M
+	/*************************************************/
+	protectedFields = nil
+	aclGroup = []string{"*"}
+	className = "post"
+	object = types.M{"objectId": "1001", "key": "hello"}
+	result = filterProtectedFields(protectedFields, aclGroup, className, object)
+	expect = types.M{"objectId": "1001", "key": "hello"}
+	if reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "result:", result)
+	}
+	/*************************************************/
+	protectedFields = []string{"key"}
+	aclGroup = []string{"*"}
+	className = "post"
+	object = types.M{"objectId": "1001", "key": "hello"}
+	result = filterProtectedFields(protectedFields, aclGroup, className, object)
+	expect = types.M{"objectId": "1001"}
+	if reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "result:", result)
+	}
+	/*************************************************/
+	protectedFields = []string{"email", "authData"}
+	aclGroup = []string{"*", "1001"}
+	className = "_User"
+	object = types.M{"objectId": "1001", "email": "abc@g.cn"}
+	result = filterProtectedFields(protectedFields, aclGroup, className, object)
+	expect = types.M{"objectId": "1001", "email": "abc@g.cn"}
+	if reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "result:", result)
+	}
+	/*************************************************/
+	protectedFields = []string{"email", "authData"}
+	aclGroup = []string{"*", "1002"}
+	className = "_User"
+	object = types.M{"objectId": "1001", "email": "abc@g.cn"}
+	result = filterProtectedFields(protectedFields, aclGroup, className, object)
+	expect = types.M{"objectId": "1001"}
+	if reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "result:", result)
+	}
+}
+
 func Test_addWriteACL(t *testing.T) {
 	var query types.M
 	var acl []string
@@ -5251,6 +5588,62 @@ func Test_validateQuery(t *testing.T) {
 		t.Error("expect:", expect, "result:", err)
 	}
 	/*************************************************/
+	query = types.M{
+		"$nor": types.S{
+			types.M{"key": "hello"},
+		},
+	}
+	err = validateQuery(query)
+	expect = nil
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/*************************************************/
+	query = types.M{
+		"$nor": types.S{},
+	}
+	err = validateQuery(query)
+	expect = errs.E(errs.InvalidQuery, "Bad $nor format - use an array of at least 1 value.")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/*************************************************/
+	query = types.M{
+		"key": types.M{
+			"$regex": 1024,
+		},
+	}
+	err = validateQuery(query)
+	expect = errs.E(errs.InvalidQuery, "Bad $regex value for query, should be a string")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/*************************************************/
+	// 前瞻与反向引用不被 Go 支持，但 MongoDB 与 Postgres 可以执行
+	query = types.M{
+		"key": types.M{
+			"$regex": `^(?!joe)(\w)\1`,
+		},
+	}
+	err = validateQuery(query)
+	expect = nil
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/*************************************************/
+	query = types.M{
+		"key": types.M{
+			"$regex":   "^joe",
+			"$options": "i",
+			"$ne":      "joey",
+		},
+	}
+	err = validateQuery(query)
+	expect = nil
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/*************************************************/
 	query = types.M{
 		"_rperm":                         "hello",
 		"_wperm":                         "hello",
@@ -5403,6 +5796,132 @@ func Test_validateQuery(t *testing.T) {
 	if reflect.DeepEqual(expect, err) == false {
 		t.Error("expect:", expect, "result:", err)
 	}
+	/*************************************************/
+	query = types.M{
+		"location": types.M{
+			"$nearSphere":         types.M{"__type": "GeoPoint", "latitude": 40.0, "longitude": -30.0},
+			"$maxDistanceInMiles": 10.0,
+		},
+	}
+	err = validateQuery(query)
+	expect = nil
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/*************************************************/
+	query = types.M{
+		"location": types.M{
+			"$nearSphere": types.M{"__type": "GeoPoint", "latitude": 91.0, "longitude": -30.0},
+		},
+	}
+	err = validateQuery(query)
+	expect = errs.E(errs.InvalidQuery, "GeoPoint latitude out of bounds: 91")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/*************************************************/
+	query = types.M{
+		"location": types.M{
+			"$nearSphere": types.M{"__type": "GeoPoint", "latitude": 40.0, "longitude": -181.0},
+		},
+	}
+	err = validateQuery(query)
+	expect = errs.E(errs.InvalidQuery, "GeoPoint longitude out of bounds: -181")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/*************************************************/
+	query = types.M{
+		"location": types.M{
+			"$nearSphere":              types.M{"__type": "GeoPoint", "latitude": 40.0, "longitude": -30.0},
+			"$maxDistanceInKilometers": -1.0,
+		},
+	}
+	err = validateQuery(query)
+	expect = errs.E(errs.InvalidQuery, "Bad $maxDistanceInKilometers value for query, should be a non-negative number")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+}
+
+func Test_validatePipeline(t *testing.T) {
+	var pipeline types.S
+	var err error
+	var expect error
+	/*************************************************/
+	pipeline = types.S{
+		types.M{"$match": types.M{"key": "hello"}},
+		types.M{"$group": types.M{"_id": "$key"}},
+	}
+	err = validatePipeline(pipeline)
+	expect = nil
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/*************************************************/
+	pipeline = types.S{
+		types.M{"$match": types.M{"key": "hello"}, "$limit": 1},
+	}
+	err = validatePipeline(pipeline)
+	expect = errs.E(errs.InvalidQuery, "Bad pipeline stage")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/*************************************************/
+	pipeline = types.S{
+		types.M{"$out": "other"},
+	}
+	err = validatePipeline(pipeline)
+	expect = errs.E(errs.OperationForbidden, "Write stage is not allowed in pipeline: $out")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/*************************************************/
+	pipeline = types.S{
+		types.M{"$lookup": types.M{}},
+	}
+	err = validatePipeline(pipeline)
+	expect = errs.E(errs.CommandUnavailable, "Unsupported pipeline stage: $lookup")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/*************************************************/
+	pipeline = types.S{
+		types.M{"$group": types.M{"_id": "$_hashed_password"}},
+	}
+	err = validatePipeline(pipeline)
+	expect = errs.E(errs.OperationForbidden, "Cannot reference protected field in pipeline: _hashed_password")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/*************************************************/
+	pipeline = types.S{
+		types.M{"$project": types.M{"_session_token": 1}},
+	}
+	err = validatePipeline(pipeline)
+	expect = errs.E(errs.OperationForbidden, "Cannot reference protected field in pipeline: _session_token")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/*************************************************/
+	pipeline = types.S{
+		types.M{"$project": types.M{"history": "$_password_history.0"}},
+	}
+	err = validatePipeline(pipeline)
+	expect = errs.E(errs.OperationForbidden, "Cannot reference protected field in pipeline: _password_history")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/*************************************************/
+	// 字符串值不是字段引用
+	pipeline = types.S{
+		types.M{"$match": types.M{"key": "sessionToken"}},
+		types.M{"$match": types.M{"key": types.M{"$in": types.S{"_hashed_password"}}}},
+	}
+	err = validatePipeline(pipeline)
+	if err != nil {
+		t.Error("expect:", nil, "result:", err)
+	}
 }
 
 func Test_transformObjectACL(t *testing.T) {
@@ -1,11 +1,13 @@
 package orm
 
 import (
+	"fmt"
 	"regexp"
 	"strings"
 	"sync"
 
 	"github.com/lfq7413/tomato/cache"
+	"github.com/lfq7413/tomato/config"
 	"github.com/lfq7413/tomato/errs"
 	"github.com/lfq7413/tomato/storage"
 	"github.com/lfq7413/tomato/types"
@@ -13,7 +15,7 @@ import (
 )
 
 // clpValidKeys 类级别的权限 列表
-var clpValidKeys = []string{"find", "count", "get", "create", "update", "delete", "addField", "readUserFields", "writeUserFields"}
+var clpValidKeys = []string{"find", "count", "get", "create", "update", "delete", "addField", "readUserFields", "writeUserFields", "protectedFields", "writeProtectedFields"}
 
 // SystemClasses 系统表
 var SystemClasses = []string{"_User", "_Installation", "_Role", "_Session", "_Product", "_PushStatus", "_JobStatus"}
@@ -100,11 +102,13 @@ var DefaultColumns = map[string]types.M{
 		"functionName": types.M{"type": "String"},
 		"className":    types.M{"type": "String"},
 		"triggerName":  types.M{"type": "String"},
+		"jobName":      types.M{"type": "String"},
 		"url":          types.M{"type": "String"},
 	},
 	"_GlobalConfig": types.M{
-		"objectId": types.M{"type": "String"},
-		"params":   types.M{"type": "Object"},
+		"objectId":      types.M{"type": "String"},
+		"params":        types.M{"type": "Object"},
+		"masterKeyOnly": types.M{"type": "Object"},
 	},
 }
 
@@ -177,6 +181,11 @@ func (s *Schema) UpdateClass(className string, submittedFields types.M, classLev
 		}
 		op := utils.S(field["__op"])
 		if existingFields[name] != nil && op != "Delete" {
+			// 字段已存在，不能修改类型
+			existingType := utils.M(existingFields[name])
+			if existingType != nil && field["type"] != nil && dbTypeMatchesObjectType(existingType, field) == false {
+				return nil, errs.E(errs.ClassNotEmpty, "Field "+name+" exists with type "+typeToString(existingType)+", cannot change to type "+typeToString(field)+".")
+			}
 			// 字段已存在，不能更新
 			return nil, errs.E(errs.ClassNotEmpty, "Field "+name+" exists, cannot update.")
 		}
@@ -254,6 +263,52 @@ func (s *Schema) UpdateClass(className string, submittedFields types.M, classLev
 	}, nil
 }
 
+// CreateIndexes 为类创建索引，indexes 的格式为 {"indexName": {"field": 1}}
+// 字段的值可以是 1 、 -1 或者 "text" ，"text" 表示全文索引，仅能用于 String 类型的字段
+func (s *Schema) CreateIndexes(className string, indexes types.M) error {
+	schema, err := s.GetOneSchema(className, false, nil)
+	if err != nil {
+		return err
+	}
+	if schema == nil || len(schema) == 0 || utils.M(schema["fields"]) == nil {
+		return errs.E(errs.InvalidClassName, "Class "+className+" does not exist.")
+	}
+	fields := utils.M(schema["fields"])
+
+	for name, v := range indexes {
+		if indexNameIsValid(name) == false {
+			return errs.E(errs.InvalidQuery, "Invalid index name: "+name)
+		}
+		index := utils.M(v)
+		if index == nil || len(index) == 0 {
+			return errs.E(errs.InvalidQuery, "Index "+name+" should be an object.")
+		}
+		for fieldName, fieldValue := range index {
+			fieldType := utils.M(fields[fieldName])
+			if fieldType == nil {
+				return errs.E(errs.InvalidQuery, "Field "+fieldName+" does not exist, cannot add index.")
+			}
+			switch fieldValue {
+			case "text":
+				if utils.S(fieldType["type"]) != "String" {
+					return errs.E(errs.InvalidQuery, "Field "+fieldName+" is not a String, cannot add text index.")
+				}
+			case 1.0, -1.0:
+			default:
+				return errs.E(errs.InvalidQuery, "Invalid index value for field "+fieldName)
+			}
+		}
+	}
+
+	for name, v := range indexes {
+		err := s.dbAdapter.CreateIndex(className, convertSchemaToAdapterSchema(schema), name, utils.M(v))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // deleteField 从类定义中删除指定的字段
 func (s *Schema) deleteField(fieldName string, className string) error {
 	return s.deleteFields([]string{fieldName}, className)
@@ -326,6 +381,9 @@ func (s *Schema) validateObject(className string, object, query types.M) error {
 		if v == nil {
 			continue
 		}
+		if err := s.validateRelationOp(className, fieldName, v); err != nil {
+			return err
+		}
 		expected, err := getType(v)
 		if err != nil {
 			return err
@@ -358,6 +416,58 @@ func (s *Schema) validateObject(className string, object, query types.M) error {
 	return nil
 }
 
+// validateRelationOp 校验 AddRelation RemoveRelation 操作，已存在的字段必须为指向同一个类的 Relation 类型
+func (s *Schema) validateRelationOp(className, fieldName string, value interface{}) error {
+	op := utils.M(value)
+	if op == nil {
+		return nil
+	}
+	if name := utils.S(op["__op"]); name != "AddRelation" && name != "RemoveRelation" {
+		return nil
+	}
+	targetClass, err := relationOpTargetClass(op)
+	if err != nil {
+		return err
+	}
+	// 使用已加载的 schema ，其中没有该类时才重新加载
+	s.dataMutex.Lock()
+	loaded := s.data != nil && s.data[className] != nil
+	s.dataMutex.Unlock()
+	if loaded == false {
+		s.reloadData(nil)
+	}
+	expectedType := s.getExpectedType(className, fieldName)
+	if expectedType == nil {
+		return nil
+	}
+	if utils.S(expectedType["type"]) != "Relation" || utils.S(expectedType["targetClass"]) != targetClass {
+		return errs.E(errs.InvalidJSON, "field "+fieldName+" is not a Relation<"+targetClass+">, it is "+typeToString(expectedType))
+	}
+	return nil
+}
+
+// relationOpTargetClass 获取 Relation 操作中对象所属的类，objects 必须是同一个类的 Pointer 数组
+func relationOpTargetClass(op types.M) (string, error) {
+	name := utils.S(op["__op"])
+	objects := utils.A(op["objects"])
+	if len(objects) == 0 {
+		return "", errs.E(errs.InvalidJSON, "objects in "+name+" must be a non-empty array of pointers")
+	}
+	targetClass := ""
+	for _, v := range objects {
+		object := utils.M(v)
+		if object == nil || utils.S(object["__type"]) != "Pointer" || utils.S(object["className"]) == "" || utils.S(object["objectId"]) == "" {
+			return "", errs.E(errs.InvalidJSON, "objects in "+name+" must be a non-empty array of pointers")
+		}
+		if targetClass == "" {
+			targetClass = utils.S(object["className"])
+		} else if targetClass != utils.S(object["className"]) {
+			return "", errs.E(errs.InvalidJSON, "all objects in "+name+" must be of the same class")
+		}
+	}
+	return targetClass, nil
+}
+
 // testBaseCLP 校验用户是否有权限对表进行指定操作
 func (s *Schema) testBaseCLP(className string, aclGroup []string, operation string) bool {
 	s.permsMutex.Lock()
@@ -437,6 +547,151 @@ func (s *Schema) validatePermission(className string, aclGroup []string, operati
 	return errs.E(errs.OperationForbidden, "Permission denied for action "+operation+" on class "+className+".")
 }
 
+// getProtectedFields 获取当前用户不可见的字段
+// 多个权限项同时适用于当前用户时，取这些字段列表的交集
+// _User 类未设置 protectedFields 时，默认对所有人隐藏 UserSensitiveFields 与 authData
+func (s *Schema) getProtectedFields(className string, aclGroup []string) []string {
+	s.permsMutex.Lock()
+	defer s.permsMutex.Unlock()
+	var protectedFields types.M
+	if classPerms := utils.M(s.perms[className]); classPerms != nil {
+		protectedFields = utils.M(classPerms["protectedFields"])
+	}
+	if protectedFields == nil {
+		if className != "_User" {
+			return nil
+		}
+		defaultFields := types.S{}
+		for _, field := range config.TConfig.UserSensitiveFields {
+			defaultFields = append(defaultFields, field)
+		}
+		defaultFields = append(defaultFields, "authData")
+		protectedFields = types.M{"*": defaultFields}
+	}
+
+	return fieldsForEntities(protectedFields, aclGroup)
+}
+
+// ValidateProtectedQuery 校验查询条件与排序中是否使用了当前用户不可见的 protectedFields 字段
+func (s *Schema) ValidateProtectedQuery(className string, aclGroup []string, query types.M, sort []string) error {
+	protectedFields := s.getProtectedFields(className, aclGroup)
+	if len(protectedFields) == 0 {
+		return nil
+	}
+	protected := map[string]bool{}
+	for _, field := range protectedFields {
+		protected[field] = true
+	}
+	if key := findProtectedQueryKey(protected, query); key != "" {
+		return errs.E(errs.OperationForbidden, "This user is not allowed to query "+key+" on class "+className)
+	}
+	for _, key := range sort {
+		key = strings.TrimPrefix(key, "-")
+		if protected[strings.Split(key, ".")[0]] {
+			return errs.E(errs.OperationForbidden, "This user is not allowed to sort by "+key+" on class "+className)
+		}
+	}
+	return nil
+}
+
+// findProtectedQueryKey 查找查询条件中使用的受保护字段，包括 $or $and $nor 中的条件
+func findProtectedQueryKey(protected map[string]bool, query types.M) string {
+	for key, value := range query {
+		if key == "$or" || key == "$and" || key == "$nor" {
+			for _, v := range utils.A(value) {
+				if k := findProtectedQueryKey(protected, utils.M(v)); k != "" {
+					return k
+				}
+			}
+			continue
+		}
+		if protected[strings.Split(key, ".")[0]] {
+			return key
+		}
+	}
+	return ""
+}
+
+// getWriteProtectedFields 获取当前用户不可写入的字段，规则与 getProtectedFields 相同
+func (s *Schema) getWriteProtectedFields(className string, aclGroup []string) []string {
+	s.permsMutex.Lock()
+	defer s.permsMutex.Unlock()
+	classPerms := utils.M(s.perms[className])
+	if classPerms == nil {
+		return nil
+	}
+	writeProtectedFields := utils.M(classPerms["writeProtectedFields"])
+	if writeProtectedFields == nil {
+		return nil
+	}
+	return fieldsForEntities(writeProtectedFields, aclGroup)
+}
+
+// validateWritableFields 校验当前用户是否可以写入 object 中的字段
+func (s *Schema) validateWritableFields(className string, aclGroup []string, object types.M) error {
+	protectedFields := s.getWriteProtectedFields(className, aclGroup)
+	if len(protectedFields) == 0 {
+		return nil
+	}
+	protected := map[string]bool{}
+	for _, field := range protectedFields {
+		protected[field] = true
+	}
+	for key := range object {
+		fieldName := strings.Split(key, ".")[0]
+		if protected[fieldName] {
+			return errs.E(errs.OperationForbidden, "Permission denied for writing field "+fieldName+" on class "+className+".")
+		}
+	}
+	return nil
+}
+
+// fieldsForEntities 取出适用于当前用户的字段列表
+// fields 的格式为 {"*": ["email"], "role:Admin": []} ，多个权限项同时适用时取交集
+func fieldsForEntities(fields types.M, aclGroup []string) []string {
+	entities := []string{"*"}
+	for _, v := range aclGroup {
+		if v != "*" {
+			entities = append(entities, v)
+		}
+	}
+
+	var result []string
+	matched := false
+	for _, entity := range entities {
+		entityFields, ok := fields[entity]
+		if ok == false {
+			continue
+		}
+		list := []string{}
+		for _, f := range utils.A(entityFields) {
+			list = append(list, utils.S(f))
+		}
+		if matched == false {
+			result = list
+			matched = true
+			continue
+		}
+		result = intersectFields(result, list)
+	}
+	return result
+}
+
+// intersectFields 返回同时存在于两个列表中的字段
+func intersectFields(a, b []string) []string {
+	set := map[string]bool{}
+	for _, v := range b {
+		set[v] = true
+	}
+	result := []string{}
+	for _, v := range a {
+		if set[v] {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
 // EnforceClassExists 校验类名
 func (s *Schema) EnforceClassExists(className string) error {
 	s.dataMutex.Lock()
@@ -536,7 +791,7 @@ func (s *Schema) validateRequiredColumns(className string, object, query types.M
 			// 类必须的字段，不能进行删除操作
 			if o := utils.M(object[column]); o != nil {
 				if utils.S(o["__op"]) == "Delete" {
-					missingColumns = append(missingColumns, column)
+					return errs.E(errs.InvalidJSON, column+" is required and cannot be deleted.")
 				}
 			}
 			continue
@@ -621,6 +876,11 @@ func (s *Schema) HasClass(className string) bool {
 	return s.data[className] != nil
 }
 
+// GetExpectedType 获取期望的字段类型，类或者字段不存在时返回 nil
+func (s *Schema) GetExpectedType(className, fieldName string) types.M {
+	return s.getExpectedType(className, fieldName)
+}
+
 // getExpectedType 获取期望的字段类型
 func (s *Schema) getExpectedType(className, fieldName string) types.M {
 	s.dataMutex.Lock()
@@ -795,6 +1055,11 @@ func getType(obj interface{}) (types.M, error) {
 	}
 }
 
+// GetType 获取对象的字段类型，不是合法的字段值时返回错误
+func GetType(obj interface{}) (types.M, error) {
+	return getType(obj)
+}
+
 // getObjectType 获取对象格式 仅处理 slice 与 map
 func getObjectType(obj interface{}) (types.M, error) {
 	if utils.A(obj) != nil {
@@ -834,9 +1099,17 @@ func getObjectType(obj interface{}) (types.M, error) {
 				if object["base64"] != nil {
 					return types.M{"type": "Bytes"}, nil
 				}
+			case "Polygon":
+				if object["coordinates"] != nil {
+					err := validatePolygon(object["coordinates"])
+					if err != nil {
+						return nil, err
+					}
+					return types.M{"type": "Polygon"}, nil
+				}
 			}
-			// 当 __type 的值不在以上 6 种类型之中时，为无效类型
-			// 当 __type 的值在以上 6 种类型之中，但是不符合详细规则时，为无效的类型
+			// 当 __type 的值不在以上类型之中时，为无效类型
+			// 当 __type 的值在以上类型之中，但是不符合详细规则时，为无效的类型
 			return nil, errs.E(errs.IncorrectType, "This is not a valid "+t)
 		}
 		if object["$ne"] != nil {
@@ -907,6 +1180,14 @@ func fieldNameIsValid(fieldName string) bool {
 	return b
 }
 
+var indexNameRegex = `^[A-Za-z_][A-Za-z0-9_]*$`
+
+// indexNameIsValid 校验索引名，数字字母下划线，不以数字开头，索引名会拼接到 Postgres 的 SQL 中
+func indexNameIsValid(name string) bool {
+	b, _ := regexp.MatchString(indexNameRegex, name)
+	return b
+}
+
 // fieldNameIsValidForClass 校验能否添加指定字段到类中
 func fieldNameIsValidForClass(fieldName string, className string) bool {
 	// 字段名不合法不能添加
@@ -934,6 +1215,33 @@ var validNonRelationOrPointerTypes = map[string]bool{
 	"Array":    true,
 	"GeoPoint": true,
 	"File":     true,
+	"Polygon":  true,
+}
+
+// validatePolygon 校验 Polygon 的顶点，格式为 [[lat, lng], [lat, lng], ...]
+// 至少需要 3 个不同的顶点，首尾顶点相同时表示已闭合
+func validatePolygon(coordinates interface{}) error {
+	coords := utils.A(coordinates)
+	if coords == nil {
+		return errs.E(errs.InvalidJSON, "Polygon coordinates must be an array of [latitude, longitude] pairs")
+	}
+	vertices := map[string]bool{}
+	for _, c := range coords {
+		point := utils.A(c)
+		if point == nil || len(point) != 2 {
+			return errs.E(errs.InvalidJSON, "Polygon coordinates must be an array of [latitude, longitude] pairs")
+		}
+		latitude, ok1 := point[0].(float64)
+		longitude, ok2 := point[1].(float64)
+		if ok1 == false || ok2 == false || latitude < -90 || latitude > 90 || longitude < -180 || longitude > 180 {
+			return errs.E(errs.InvalidJSON, fmt.Sprintf("Polygon has an invalid coordinate: %v", c))
+		}
+		vertices[fmt.Sprintf("%v,%v", latitude, longitude)] = true
+	}
+	if len(vertices) < 3 {
+		return errs.E(errs.InvalidJSON, "Polygon must have at least 3 distinct vertices")
+	}
+	return nil
 }
 
 // fieldTypeIsInvalid 检测字段类型是否合法
@@ -1005,12 +1313,15 @@ func validateCLP(perms types.M, fields types.M) error {
 			if p := utils.A(perm); p != nil {
 				for _, v := range p {
 					key := utils.S(v)
-					// 字段类型必须为指向 _User 的指针类型
+					// 字段类型必须为指向 _User 的指针类型，或者保存 _User 指针的数组类型
 					if fields != nil && fields[key] != nil {
 						if t := utils.M(fields[key]); t != nil {
 							if utils.S(t["type"]) == "Pointer" && utils.S(t["targetClass"]) == "_User" {
 								continue
 							}
+							if utils.S(t["type"]) == "Array" {
+								continue
+							}
 						}
 					}
 					return errs.E(errs.InvalidJSON, key+" is not a valid column for class level pointer permissions "+operation)
@@ -1020,20 +1331,49 @@ func validateCLP(perms types.M, fields types.M) error {
 			return errs.E(errs.InvalidJSON, "this perms[operation] is not a valid value for class level permissions "+operation)
 		}
 
-		if p := utils.M(perm); p != nil {
-			for key, value := range p {
-				err := verifyPermissionKey(key)
+		// protectedFields 与 writeProtectedFields 的格式为 {"*": ["email"], "role:Admin": []}
+		if operation == "protectedFields" || operation == "writeProtectedFields" {
+			p := utils.M(perm)
+			if p == nil {
+				return errs.E(errs.InvalidJSON, "this perms[operation] is not a valid value for class level permissions "+operation)
+			}
+			for entity, v := range p {
+				if entity == "requiresAuthentication" {
+					return errs.E(errs.InvalidJSON, entity+" is not a valid key for class level permissions "+operation)
+				}
+				err := verifyPermissionKey(entity)
 				if err != nil {
 					return err
 				}
-				if v, ok := value.(bool); ok {
-					if v == false {
-						return errs.E(errs.InvalidJSON, "false is not a valid value for class level permissions "+operation+":"+key+":false")
+				protected := utils.A(v)
+				if protected == nil {
+					return errs.E(errs.InvalidJSON, "this perm is not a valid value for class level permissions "+operation+":"+entity)
+				}
+				for _, field := range protected {
+					if f, ok := field.(string); ok == false || fieldNameIsValid(f) == false {
+						return errs.E(errs.InvalidJSON, "this perm is not a valid value for class level permissions "+operation+":"+entity)
 					}
-				} else {
-					return errs.E(errs.InvalidJSON, "this perm is not a valid value for class level permissions "+operation+":"+key+":perm")
 				}
 			}
+			continue
+		}
+
+		p := utils.M(perm)
+		if p == nil {
+			return errs.E(errs.InvalidJSON, "this perms[operation] is not a valid value for class level permissions "+operation)
+		}
+		for key, value := range p {
+			err := verifyPermissionKey(key)
+			if err != nil {
+				return err
+			}
+			if v, ok := value.(bool); ok {
+				if v == false {
+					return errs.E(errs.InvalidJSON, "false is not a valid value for class level permissions "+operation+":"+key+":false")
+				}
+			} else {
+				return errs.E(errs.InvalidJSON, "this perm is not a valid value for class level permissions "+operation+":"+key+":perm")
+			}
 		}
 	}
 	return nil
@@ -1203,6 +1543,9 @@ func injectDefaultSchema(schema types.M) types.M {
 	newSchema["fields"] = newfields
 	newSchema["className"] = schema["className"]
 	newSchema["classLevelPermissions"] = schema["classLevelPermissions"]
+	if schema["indexes"] != nil {
+		newSchema["indexes"] = schema["indexes"]
+	}
 
 	return newSchema
 }
@@ -1002,7 +1002,7 @@ func TestPostgres_validateRequiredColumns(t *testing.T) {
 		"objectId": "1024",
 	}
 	err = schama.validateRequiredColumns(className, object, query)
-	expect = errs.E(errs.IncorrectType, "ACL is required.")
+	expect = errs.E(errs.InvalidJSON, "ACL is required and cannot be deleted.")
 	if reflect.DeepEqual(expect, err) == false {
 		t.Error("expect:", expect, "result:", err)
 	}
@@ -1035,7 +1035,7 @@ func TestPostgres_validateRequiredColumns(t *testing.T) {
 		"objectId": "1024",
 	}
 	err = schama.validateRequiredColumns(className, object, query)
-	expect = errs.E(errs.IncorrectType, "subtitle is required.")
+	expect = errs.E(errs.InvalidJSON, "subtitle is required and cannot be deleted.")
 	if reflect.DeepEqual(expect, err) == false {
 		t.Error("expect:", expect, "result:", err)
 	}
@@ -1444,14 +1444,16 @@ func TestPostgres_reloadData(t *testing.T) {
 			"functionName": types.M{"type": "String"},
 			"className":    types.M{"type": "String"},
 			"triggerName":  types.M{"type": "String"},
+			"jobName":      types.M{"type": "String"},
 			"url":          types.M{"type": "String"},
 		},
 		"_GlobalConfig": types.M{
-			"objectId":  types.M{"type": "String"},
-			"updatedAt": types.M{"type": "Date"},
-			"createdAt": types.M{"type": "Date"},
-			"ACL":       types.M{"type": "ACL"},
-			"params":    types.M{"type": "Object"},
+			"objectId":      types.M{"type": "String"},
+			"updatedAt":     types.M{"type": "Date"},
+			"createdAt":     types.M{"type": "Date"},
+			"ACL":           types.M{"type": "ACL"},
+			"params":        types.M{"type": "Object"},
+			"masterKeyOnly": types.M{"type": "Object"},
 		},
 	}
 	if reflect.DeepEqual(expect, schama.data) == false {
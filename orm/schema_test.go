@@ -122,6 +122,25 @@ func Test_UpdateClass(t *testing.T) {
 	}
 	adapter.CreateClass(className, class)
 	className = "user"
+	submittedFields = types.M{
+		"key": types.M{"type": "Number"},
+	}
+	classLevelPermissions = nil
+	result, err = schama.UpdateClass(className, submittedFields, classLevelPermissions)
+	expect = errs.E(errs.ClassNotEmpty, "Field key exists with type String, cannot change to type Number.")
+	if err == nil || reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", result, err)
+	}
+	schama.data = nil
+	adapter.DeleteAllClasses()
+	/************************************************************/
+	class = types.M{
+		"fields": types.M{
+			"key": types.M{"type": "String"},
+		},
+	}
+	adapter.CreateClass(className, class)
+	className = "user"
 	submittedFields = types.M{
 		"key1": types.M{"__op": "Delete"},
 	}
@@ -995,7 +1014,7 @@ func Test_validateRequiredColumns(t *testing.T) {
 		"objectId": "1024",
 	}
 	err = schama.validateRequiredColumns(className, object, query)
-	expect = errs.E(errs.IncorrectType, "ACL is required.")
+	expect = errs.E(errs.InvalidJSON, "ACL is required and cannot be deleted.")
 	if reflect.DeepEqual(expect, err) == false {
 		t.Error("expect:", expect, "result:", err)
 	}
@@ -1028,7 +1047,7 @@ func Test_validateRequiredColumns(t *testing.T) {
 		"objectId": "1024",
 	}
 	err = schama.validateRequiredColumns(className, object, query)
-	expect = errs.E(errs.IncorrectType, "subtitle is required.")
+	expect = errs.E(errs.InvalidJSON, "subtitle is required and cannot be deleted.")
 	if reflect.DeepEqual(expect, err) == false {
 		t.Error("expect:", expect, "result:", err)
 	}
@@ -1437,14 +1456,16 @@ func Test_reloadData(t *testing.T) {
 			"functionName": types.M{"type": "String"},
 			"className":    types.M{"type": "String"},
 			"triggerName":  types.M{"type": "String"},
+			"jobName":      types.M{"type": "String"},
 			"url":          types.M{"type": "String"},
 		},
 		"_GlobalConfig": types.M{
-			"objectId":  types.M{"type": "String"},
-			"updatedAt": types.M{"type": "Date"},
-			"createdAt": types.M{"type": "Date"},
-			"ACL":       types.M{"type": "ACL"},
-			"params":    types.M{"type": "Object"},
+			"objectId":      types.M{"type": "String"},
+			"updatedAt":     types.M{"type": "Date"},
+			"createdAt":     types.M{"type": "Date"},
+			"ACL":           types.M{"type": "ACL"},
+			"params":        types.M{"type": "Object"},
+			"masterKeyOnly": types.M{"type": "Object"},
 		},
 	}
 	if reflect.DeepEqual(expect, schama.data) == false {
@@ -2076,6 +2097,36 @@ func Test_getObjectType(t *testing.T) {
 	if err != nil || reflect.DeepEqual(expect, expect) == false {
 		t.Error("expect:", expect, "result:", result, err)
 	}
+	/************************************************************/
+	object = types.M{
+		"__type":      "Polygon",
+		"coordinates": types.S{types.S{40.0, -30.0}, types.S{40.0, -20.0}, types.S{50.0, -20.0}},
+	}
+	result, err = getObjectType(object)
+	expect = types.M{"type": "Polygon"}
+	if err != nil || reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "result:", result, err)
+	}
+	/************************************************************/
+	object = types.M{
+		"__type":      "Polygon",
+		"coordinates": types.S{types.S{40.0, -30.0}, types.S{40.0, -20.0}, types.S{40.0, -30.0}},
+	}
+	result, err = getObjectType(object)
+	expect = errs.E(errs.InvalidJSON, "Polygon must have at least 3 distinct vertices")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/************************************************************/
+	object = types.M{
+		"__type":      "Polygon",
+		"coordinates": types.S{types.S{91.0, -30.0}, types.S{40.0, -20.0}, types.S{50.0, -20.0}},
+	}
+	result, err = getObjectType(object)
+	expect = errs.E(errs.InvalidJSON, "Polygon has an invalid coordinate: [91 -30]")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
 }
 
 func Test_ClassNameIsValid(t *testing.T) {
@@ -2221,6 +2272,40 @@ func Test_fieldNameIsValid(t *testing.T) {
 	}
 }
 
+func Test_indexNameIsValid(t *testing.T) {
+	var name string
+	var ok bool
+	var expect bool
+	/************************************************************/
+	name = "name_1"
+	ok = indexNameIsValid(name)
+	expect = true
+	if ok != expect {
+		t.Error("expect:", expect, "result:", ok)
+	}
+	/************************************************************/
+	name = "_id_"
+	ok = indexNameIsValid(name)
+	expect = true
+	if ok != expect {
+		t.Error("expect:", expect, "result:", ok)
+	}
+	/************************************************************/
+	name = "1name"
+	ok = indexNameIsValid(name)
+	expect = false
+	if ok != expect {
+		t.Error("expect:", expect, "result:", ok)
+	}
+	/************************************************************/
+	name = `name"; DROP TABLE "_User`
+	ok = indexNameIsValid(name)
+	expect = false
+	if ok != expect {
+		t.Error("expect:", expect, "result:", ok)
+	}
+}
+
 func Test_fieldNameIsValidForClass(t *testing.T) {
 	var fieldName string
 	var className string
@@ -2598,6 +2683,41 @@ func Test_validateCLP(t *testing.T) {
 		t.Error("expect:", expect, "result:", err)
 	}
 	/************************************************************/
+	perms = types.M{
+		"protectedFields": types.M{
+			"*":          types.S{"email"},
+			"role:Admin": types.S{},
+		},
+	}
+	fields = nil
+	err = validateCLP(perms, fields)
+	expect = nil
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/************************************************************/
+	perms = types.M{
+		"protectedFields": types.M{
+			"*": "email",
+		},
+	}
+	fields = nil
+	err = validateCLP(perms, fields)
+	expect = errs.E(errs.InvalidJSON, "this perm is not a valid value for class level permissions protectedFields:*")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/************************************************************/
+	perms = types.M{
+		"find": true,
+	}
+	fields = nil
+	err = validateCLP(perms, fields)
+	expect = errs.E(errs.InvalidJSON, "this perms[operation] is not a valid value for class level permissions find")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/************************************************************/
 	perms = types.M{
 		"readUserFields": "hello",
 	}
@@ -2652,6 +2772,25 @@ func Test_validateCLP(t *testing.T) {
 		t.Error("expect:", expect, "result:", err)
 	}
 	/************************************************************/
+	perms = types.M{
+		"readUserFields":  types.S{"owners"},
+		"writeUserFields": types.S{"owner", "owners"},
+	}
+	fields = types.M{
+		"owner": types.M{
+			"type":        "Pointer",
+			"targetClass": "_User",
+		},
+		"owners": types.M{
+			"type": "Array",
+		},
+	}
+	err = validateCLP(perms, fields)
+	expect = nil
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/************************************************************/
 	perms = types.M{
 		"get": types.M{"abc": true},
 	}
@@ -2681,6 +2820,100 @@ func Test_validateCLP(t *testing.T) {
 	if reflect.DeepEqual(expect, err) == false {
 		t.Error("expect:", expect, "result:", err)
 	}
+	/************************************************************/
+	perms = types.M{
+		"writeProtectedFields": types.M{
+			"*":          types.S{"score"},
+			"role:Admin": types.S{},
+		},
+	}
+	fields = nil
+	err = validateCLP(perms, fields)
+	expect = nil
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/************************************************************/
+	perms = types.M{
+		"writeProtectedFields": types.M{
+			"*": "score",
+		},
+	}
+	fields = nil
+	err = validateCLP(perms, fields)
+	expect = errs.E(errs.InvalidJSON, "this perm is not a valid value for class level permissions writeProtectedFields:*")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+}
+
+func Test_validateWritableFields(t *testing.T) {
+	var schema *Schema
+	var aclGroup []string
+	var object types.M
+	var err error
+	var expect error
+	/************************************************************/
+	schema = &Schema{
+		perms: types.M{},
+	}
+	aclGroup = []string{"*"}
+	object = types.M{"score": 10}
+	err = schema.validateWritableFields("post", aclGroup, object)
+	expect = nil
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/************************************************************/
+	schema = &Schema{
+		perms: types.M{
+			"post": types.M{
+				"writeProtectedFields": types.M{
+					"*":          types.S{"score", "rank"},
+					"role:Admin": types.S{"rank"},
+				},
+			},
+		},
+	}
+	aclGroup = []string{"*", "1001"}
+	object = types.M{"title": "hello"}
+	err = schema.validateWritableFields("post", aclGroup, object)
+	expect = nil
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/************************************************************/
+	aclGroup = []string{"*", "1001"}
+	object = types.M{"title": "hello", "score": 10}
+	err = schema.validateWritableFields("post", aclGroup, object)
+	expect = errs.E(errs.OperationForbidden, "Permission denied for writing field score on class post.")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/************************************************************/
+	aclGroup = []string{"*", "1001"}
+	object = types.M{"score.total": types.M{"__op": "Increment", "amount": 1}}
+	err = schema.validateWritableFields("post", aclGroup, object)
+	expect = errs.E(errs.OperationForbidden, "Permission denied for writing field score on class post.")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/************************************************************/
+	aclGroup = []string{"*", "1001", "role:Admin"}
+	object = types.M{"score": 10}
+	err = schema.validateWritableFields("post", aclGroup, object)
+	expect = nil
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/************************************************************/
+	aclGroup = []string{"*", "1001", "role:Admin"}
+	object = types.M{"rank": 1}
+	err = schema.validateWritableFields("post", aclGroup, object)
+	expect = errs.E(errs.OperationForbidden, "Permission denied for writing field rank on class post.")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
 }
 
 func Test_verifyPermissionKey(t *testing.T) {
@@ -2834,6 +3067,7 @@ func Test_volatileClassesSchemas(t *testing.T) {
 				"functionName": types.M{"type": "String"},
 				"className":    types.M{"type": "String"},
 				"triggerName":  types.M{"type": "String"},
+				"jobName":      types.M{"type": "String"},
 				"url":          types.M{"type": "String"},
 			},
 			"classLevelPermissions": types.M{},
@@ -2883,8 +3117,9 @@ func Test_volatileClassesSchemas(t *testing.T) {
 		types.M{
 			"className": "_GlobalConfig",
 			"fields": types.M{
-				"objectId": types.M{"type": "String"},
-				"params":   types.M{"type": "Object"},
+				"objectId":      types.M{"type": "String"},
+				"params":        types.M{"type": "Object"},
+				"masterKeyOnly": types.M{"type": "Object"},
 			},
 			"classLevelPermissions": types.M{},
 		},
@@ -3272,14 +3507,16 @@ func Test_Load(t *testing.T) {
 			"functionName": types.M{"type": "String"},
 			"className":    types.M{"type": "String"},
 			"triggerName":  types.M{"type": "String"},
+			"jobName":      types.M{"type": "String"},
 			"url":          types.M{"type": "String"},
 		},
 		"_GlobalConfig": types.M{
-			"objectId":  types.M{"type": "String"},
-			"updatedAt": types.M{"type": "Date"},
-			"createdAt": types.M{"type": "Date"},
-			"ACL":       types.M{"type": "ACL"},
-			"params":    types.M{"type": "Object"},
+			"objectId":      types.M{"type": "String"},
+			"updatedAt":     types.M{"type": "Date"},
+			"createdAt":     types.M{"type": "Date"},
+			"ACL":           types.M{"type": "ACL"},
+			"params":        types.M{"type": "Object"},
+			"masterKeyOnly": types.M{"type": "Object"},
 		},
 	}
 	expectPerms = types.M{
@@ -3351,14 +3588,16 @@ func Test_Load(t *testing.T) {
 			"functionName": types.M{"type": "String"},
 			"className":    types.M{"type": "String"},
 			"triggerName":  types.M{"type": "String"},
+			"jobName":      types.M{"type": "String"},
 			"url":          types.M{"type": "String"},
 		},
 		"_GlobalConfig": types.M{
-			"objectId":  types.M{"type": "String"},
-			"updatedAt": types.M{"type": "Date"},
-			"createdAt": types.M{"type": "Date"},
-			"ACL":       types.M{"type": "ACL"},
-			"params":    types.M{"type": "Object"},
+			"objectId":      types.M{"type": "String"},
+			"updatedAt":     types.M{"type": "Date"},
+			"createdAt":     types.M{"type": "Date"},
+			"ACL":           types.M{"type": "ACL"},
+			"params":        types.M{"type": "Object"},
+			"masterKeyOnly": types.M{"type": "Object"},
 		},
 	}
 	expectPerms = types.M{
@@ -3398,3 +3637,60 @@ func getAdapter() storage.Adapter {
 func getSchemaCache() *cache.SchemaCache {
 	return cache.NewSchemaCache(5, false)
 }
+
+func Test_relationOpTargetClass(t *testing.T) {
+	var op types.M
+	var result string
+	var err error
+	var expect string
+	var expectErr error
+	/************************************************************/
+	op = types.M{
+		"__op":    "AddRelation",
+		"objects": types.S{},
+	}
+	_, err = relationOpTargetClass(op)
+	expectErr = errs.E(errs.InvalidJSON, "objects in AddRelation must be a non-empty array of pointers")
+	if reflect.DeepEqual(expectErr, err) == false {
+		t.Error("expect:", expectErr, "result:", err)
+	}
+	/************************************************************/
+	op = types.M{
+		"__op": "RemoveRelation",
+		"objects": types.S{
+			types.M{"__type": "Pointer", "className": "post", "objectId": "2001"},
+			"2002",
+		},
+	}
+	_, err = relationOpTargetClass(op)
+	expectErr = errs.E(errs.InvalidJSON, "objects in RemoveRelation must be a non-empty array of pointers")
+	if reflect.DeepEqual(expectErr, err) == false {
+		t.Error("expect:", expectErr, "result:", err)
+	}
+	/************************************************************/
+	op = types.M{
+		"__op": "AddRelation",
+		"objects": types.S{
+			types.M{"__type": "Pointer", "className": "post", "objectId": "2001"},
+			types.M{"__type": "Pointer", "className": "_User", "objectId": "1001"},
+		},
+	}
+	_, err = relationOpTargetClass(op)
+	expectErr = errs.E(errs.InvalidJSON, "all objects in AddRelation must be of the same class")
+	if reflect.DeepEqual(expectErr, err) == false {
+		t.Error("expect:", expectErr, "result:", err)
+	}
+	/************************************************************/
+	op = types.M{
+		"__op": "AddRelation",
+		"objects": types.S{
+			types.M{"__type": "Pointer", "className": "post", "objectId": "2001"},
+			types.M{"__type": "Pointer", "className": "post", "objectId": "2002"},
+		},
+	}
+	result, err = relationOpTargetClass(op)
+	expect = "post"
+	if err != nil || result != expect {
+		t.Error("expect:", expect, "result:", result, err)
+	}
+}
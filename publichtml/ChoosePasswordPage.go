@@ -162,7 +162,7 @@ var ChoosePasswordPage = `
 
     var id = urlParams['id'];
     var base = PARSE_SERVER_URL;
-    document.getElementById('form').setAttribute('action', base + '/apps' + '/request_password_reset');
+    document.getElementById('form').setAttribute('action', base + '/apps/' + id + '/request_password_reset');
     document.getElementById('username').value = urlParams['username'];
     document.getElementById('username_label').appendChild(document.createTextNode(urlParams['username']));
 
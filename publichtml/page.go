@@ -0,0 +1,52 @@
+package publichtml
+
+import (
+	"bytes"
+	"html/template"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// 可在自定义目录中替换的页面文件名
+const (
+	ChoosePasswordFile          = "choose_password.html"
+	InvalidLinkFile             = "invalid_link.html"
+	InvalidVerificationLinkFile = "invalid_verification_link.html"
+	LinkSendFailFile            = "link_send_fail.html"
+	LinkSendSuccessFile         = "link_send_success.html"
+	PasswordResetSuccessFile    = "password_reset_success.html"
+	VerifyEmailSuccessFile      = "verify_email_success.html"
+)
+
+// Render 渲染页面，dir 中存在 name 对应的模板文件时使用该模板，否则返回内置页面 defaultPage
+// 模板使用 html/template 语法，可使用 {{.appName}} {{.username}} 等变量，变量值会按所在上下文自动转义
+func Render(dir, name, defaultPage string, data map[string]string) string {
+	if dir == "" {
+		return defaultPage
+	}
+	return RenderFile(filepath.Join(dir, name), defaultPage, data)
+}
+
+// RenderFile 使用 file 模板文件渲染页面，文件不存在或者模板有误时返回内置页面 defaultPage
+// 除 {{.appName}} 外，也可以使用 {{appName}} 的形式引用变量
+func RenderFile(file, defaultPage string, data map[string]string) string {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return defaultPage
+	}
+	text := string(b)
+	for k := range data {
+		text = strings.Replace(text, "{{"+k+"}}", "{{."+k+"}}", -1)
+	}
+	t, err := template.New(filepath.Base(file)).Parse(text)
+	if err != nil {
+		return defaultPage
+	}
+	var buf bytes.Buffer
+	err = t.Execute(&buf, data)
+	if err != nil {
+		return defaultPage
+	}
+	return buf.String()
+}
@@ -0,0 +1,75 @@
+package publichtml
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_Render(t *testing.T) {
+	dir, err := ioutil.TempDir("", "publichtml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name, text string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var result string
+	var expect string
+	/*****************************************************************/
+	// 未设置目录时使用内置页面
+	result = Render("", InvalidLinkFile, "default", map[string]string{"appName": "tomato"})
+	expect = "default"
+	if result != expect {
+		t.Error("expect:", expect, "result:", result)
+	}
+	/*****************************************************************/
+	// 目录中不存在模板文件时使用内置页面
+	result = Render(dir, InvalidLinkFile, "default", map[string]string{"appName": "tomato"})
+	expect = "default"
+	if result != expect {
+		t.Error("expect:", expect, "result:", result)
+	}
+	/*****************************************************************/
+	write(LinkSendSuccessFile, `<p>{{.appName}} {{username}}</p>`)
+	result = Render(dir, LinkSendSuccessFile, "default", map[string]string{"appName": "tomato", "username": "joe"})
+	expect = `<p>tomato joe</p>`
+	if result != expect {
+		t.Error("expect:", expect, "result:", result)
+	}
+	/*****************************************************************/
+	// 变量值按 HTML 上下文转义
+	result = Render(dir, LinkSendSuccessFile, "default", map[string]string{"appName": "tomato", "username": `<script>alert("x")</script>`})
+	expect = `<p>tomato &lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt;</p>`
+	if result != expect {
+		t.Error("expect:", expect, "result:", result)
+	}
+	/*****************************************************************/
+	// 变量值按 URL 属性上下文转义
+	write(LinkSendFailFile, `<a href="/apps/{{.appName}}?username={{.username}}">link</a>`)
+	result = Render(dir, LinkSendFailFile, "default", map[string]string{"appName": "tomato", "username": `joe" onclick="x`})
+	expect = `<a href="/apps/tomato?username=joe%22%20onclick%3d%22x">link</a>`
+	if result != expect {
+		t.Error("expect:", expect, "result:", result)
+	}
+	/*****************************************************************/
+	// 变量值按 JS 上下文转义
+	write(ChoosePasswordFile, `<script>var username = {{.username}};</script>`)
+	result = Render(dir, ChoosePasswordFile, "default", map[string]string{"username": `</script><script>alert(1)`})
+	expect = `<script>var username = "\u003c/script\u003e\u003cscript\u003ealert(1)";</script>`
+	if result != expect {
+		t.Error("expect:", expect, "result:", result)
+	}
+	/*****************************************************************/
+	// 模板有误时使用内置页面
+	write(InvalidLinkFile, `<p>{{.appName</p>`)
+	result = Render(dir, InvalidLinkFile, "default", map[string]string{"appName": "tomato"})
+	expect = "default"
+	if result != expect {
+		t.Error("expect:", expect, "result:", result)
+	}
+}
@@ -0,0 +1,272 @@
+package push
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lfq7413/tomato/config"
+	"github.com/lfq7413/tomato/types"
+	"github.com/lfq7413/tomato/utils"
+)
+
+const (
+	apnsProductionHost = "https://api.push.apple.com"
+	apnsSandboxHost    = "https://api.sandbox.push.apple.com"
+	// apnsTokenLifetime APNS 要求 token 有效期不超过一小时，提前刷新
+	apnsTokenLifetime = 50 * time.Minute
+)
+
+// apnsInvalidTokenReasons 表示 deviceToken 已失效的错误
+var apnsInvalidTokenReasons = map[string]bool{
+	"BadDeviceToken":         true,
+	"Unregistered":           true,
+	"DeviceTokenNotForTopic": true,
+}
+
+type apnsPushAdapter struct {
+	validPushTypes []string
+	keyID          string
+	teamID         string
+	topic          string
+	host           string
+	key            *ecdsa.PrivateKey
+	keyErr         error
+	client         *http.Client
+
+	mu          sync.Mutex
+	token       string
+	tokenIssued time.Time
+}
+
+func newAPNSPush() *apnsPushAdapter {
+	a := &apnsPushAdapter{
+		validPushTypes: []string{"ios", "osx", "tvos"},
+		keyID:          config.TConfig.APNSKeyID,
+		teamID:         config.TConfig.APNSTeamID,
+		topic:          config.TConfig.APNSTopic,
+		host:           apnsSandboxHost,
+		client: &http.Client{
+			// 使用 TLS 时 net/http 会自动协商 HTTP/2
+			Transport: &http.Transport{ForceAttemptHTTP2: true},
+			Timeout:   30 * time.Second,
+		},
+	}
+	if config.TConfig.APNSProduction {
+		a.host = apnsProductionHost
+	}
+	a.key, a.keyErr = loadAPNSKey(config.TConfig.APNSKeyFile)
+	return a
+}
+
+func (a *apnsPushAdapter) send(body types.M, installations types.S, pushStatus string) []types.M {
+	deviceMap := classifyInstallations(installations, a.validPushTypes)
+	results := []types.M{}
+
+	payload, err := json.Marshal(apnsPayload(body))
+	for _, devices := range deviceMap {
+		for _, device := range devices {
+			if err != nil {
+				results = append(results, apnsFailure(device, err.Error()))
+				continue
+			}
+			results = append(results, a.sendToDevice(device, body, payload))
+		}
+	}
+
+	return results
+}
+
+func (a *apnsPushAdapter) getValidPushTypes() []string {
+	return a.validPushTypes
+}
+
+// sendToDevice 向单个设备发送消息，deviceToken 失效时结果中的 invalidToken 为 true
+func (a *apnsPushAdapter) sendToDevice(device, body types.M, payload []byte) types.M {
+	token, err := a.authToken()
+	if err != nil {
+		return apnsFailure(device, err.Error())
+	}
+
+	request, err := http.NewRequest("POST", a.host+"/3/device/"+utils.S(device["deviceToken"]), bytes.NewReader(payload))
+	if err != nil {
+		return apnsFailure(device, err.Error())
+	}
+	request.Header.Set("authorization", "bearer "+token)
+	request.Header.Set("content-type", "application/json")
+	topic := utils.S(device["appIdentifier"])
+	if topic == "" {
+		topic = a.topic
+	}
+	if topic != "" {
+		request.Header.Set("apns-topic", topic)
+	}
+	if t, ok := body["expiration_time"].(int64); ok {
+		request.Header.Set("apns-expiration", strconv.FormatInt(t/1000, 10))
+	}
+	data := utils.M(body["data"])
+	if data != nil && data["alert"] == nil && data["content-available"] != nil {
+		request.Header.Set("apns-push-type", "background")
+		request.Header.Set("apns-priority", "5")
+	} else {
+		request.Header.Set("apns-push-type", "alert")
+		request.Header.Set("apns-priority", "10")
+	}
+
+	response, err := a.client.Do(request)
+	if err != nil {
+		return apnsFailure(device, err.Error())
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusOK {
+		return types.M{
+			"device":      device,
+			"transmitted": true,
+			"response":    map[string]string{"id": response.Header.Get("apns-id")},
+		}
+	}
+
+	var reason struct {
+		Reason string `json:"reason"`
+	}
+	b, _ := ioutil.ReadAll(response.Body)
+	json.Unmarshal(b, &reason)
+	if reason.Reason == "" {
+		reason.Reason = response.Status
+	}
+	result := apnsFailure(device, reason.Reason)
+	if apnsInvalidTokenReasons[reason.Reason] {
+		result["invalidToken"] = true
+	}
+	return result
+}
+
+// authToken 获取 APNS 鉴权使用的 JWT ，过期前复用
+func (a *apnsPushAdapter) authToken() (string, error) {
+	if a.key == nil {
+		if a.keyErr != nil {
+			return "", a.keyErr
+		}
+		return "", errors.New("APNS key is not configured")
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.token != "" && time.Since(a.tokenIssued) < apnsTokenLifetime {
+		return a.token, nil
+	}
+	now := time.Now()
+	token, err := signAPNSToken(a.key, a.keyID, a.teamID, now)
+	if err != nil {
+		return "", err
+	}
+	a.token = token
+	a.tokenIssued = now
+	return token, nil
+}
+
+// loadAPNSKey 读取 .p8 格式的私钥
+func loadAPNSKey(path string) (*ecdsa.PrivateKey, error) {
+	if path == "" {
+		return nil, errors.New("APNS key file is not configured")
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("APNS key file must be a PEM encoded .p8 key")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	ecdsaKey, ok := key.(*ecdsa.PrivateKey)
+	if ok == false {
+		return nil, errors.New("APNS key must be an ECDSA private key")
+	}
+	return ecdsaKey, nil
+}
+
+// signAPNSToken 使用 ES256 生成 JWT
+func signAPNSToken(key *ecdsa.PrivateKey, keyID, teamID string, now time.Time) (string, error) {
+	header, _ := json.Marshal(map[string]string{"alg": "ES256", "kid": keyID})
+	claims, _ := json.Marshal(map[string]interface{}{"iss": teamID, "iat": now.Unix()})
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	hash := sha256.Sum256([]byte(unsigned))
+	r, s, err := ecdsa.Sign(rand.Reader, key, hash[:])
+	if err != nil {
+		return "", err
+	}
+	// JWS 要求签名为定长的 r||s
+	signature := make([]byte, 64)
+	copyPadded(signature[:32], r)
+	copyPadded(signature[32:], s)
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func copyPadded(dst []byte, n *big.Int) {
+	b := n.Bytes()
+	copy(dst[len(dst)-len(b):], b)
+}
+
+// apnsPayload 把推送数据转换为 APNS 格式，alert badge sound content-available category 放入 aps 中
+func apnsPayload(body types.M) types.M {
+	data := utils.M(body["data"])
+	if data == nil {
+		data = types.M{}
+	}
+	aps := types.M{}
+	payload := types.M{}
+	for key, v := range data {
+		switch key {
+		case "alert":
+			if title, ok := data["title"]; ok {
+				aps["alert"] = types.M{"title": title, "body": v}
+			} else {
+				aps["alert"] = v
+			}
+		case "title":
+			if _, ok := data["alert"]; ok == false {
+				aps["alert"] = types.M{"title": v}
+			}
+		case "badge":
+			aps["badge"] = v
+		case "sound":
+			aps["sound"] = v
+		case "content-available":
+			aps["content-available"] = 1
+		case "mutable-content":
+			aps["mutable-content"] = 1
+		case "category":
+			aps["category"] = v
+		default:
+			payload[key] = v
+		}
+	}
+	payload["aps"] = aps
+	return payload
+}
+
+func apnsFailure(device types.M, message string) types.M {
+	return types.M{
+		"device":      device,
+		"transmitted": false,
+		"response":    map[string]string{"error": message},
+	}
+}
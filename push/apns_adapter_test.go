@@ -0,0 +1,217 @@
+package push
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lfq7413/tomato/types"
+)
+
+func Test_apnsPayload(t *testing.T) {
+	var body, result, expect types.M
+	/*************************************************/
+	body = types.M{
+		"data": types.M{
+			"alert":             "hello",
+			"badge":             "Increment",
+			"sound":             "cheering.caf",
+			"content-available": 1,
+			"category":          "aaa",
+			"uri":               "xxxx",
+		},
+	}
+	result = apnsPayload(body)
+	expect = types.M{
+		"aps": types.M{
+			"alert":             "hello",
+			"badge":             "Increment",
+			"sound":             "cheering.caf",
+			"content-available": 1,
+			"category":          "aaa",
+		},
+		"uri": "xxxx",
+	}
+	if reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "result:", result)
+	}
+	/*************************************************/
+	body = types.M{
+		"data": types.M{
+			"alert": "hello",
+			"title": "title",
+		},
+	}
+	result = apnsPayload(body)
+	expect = types.M{
+		"aps": types.M{
+			"alert": types.M{"title": "title", "body": "hello"},
+		},
+	}
+	if reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "result:", result)
+	}
+	/*************************************************/
+	body = types.M{
+		"data": types.M{
+			"title":           "title",
+			"mutable-content": true,
+		},
+	}
+	result = apnsPayload(body)
+	expect = types.M{
+		"aps": types.M{
+			"alert":           types.M{"title": "title"},
+			"mutable-content": 1,
+		},
+	}
+	if reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "result:", result)
+	}
+	/*************************************************/
+	body = types.M{}
+	result = apnsPayload(body)
+	expect = types.M{"aps": types.M{}}
+	if reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "result:", result)
+	}
+}
+
+func Test_signAPNSToken(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	now := time.Unix(1476619200, 0)
+	token, err := signAPNSToken(key, "keyid", "teamid", now)
+	if err != nil {
+		t.Error("expect:", nil, "result:", err)
+		return
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Error("expect:", 3, "result:", len(parts))
+		return
+	}
+	var header, claims map[string]interface{}
+	b, _ := base64.RawURLEncoding.DecodeString(parts[0])
+	json.Unmarshal(b, &header)
+	expectHeader := map[string]interface{}{"alg": "ES256", "kid": "keyid"}
+	if reflect.DeepEqual(expectHeader, header) == false {
+		t.Error("expect:", expectHeader, "result:", header)
+	}
+	b, _ = base64.RawURLEncoding.DecodeString(parts[1])
+	json.Unmarshal(b, &claims)
+	expectClaims := map[string]interface{}{"iss": "teamid", "iat": 1476619200.0}
+	if reflect.DeepEqual(expectClaims, claims) == false {
+		t.Error("expect:", expectClaims, "result:", claims)
+	}
+	signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	if len(signature) != 64 {
+		t.Error("expect:", 64, "result:", len(signature))
+		return
+	}
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	r := new(big.Int).SetBytes(signature[:32])
+	s := new(big.Int).SetBytes(signature[32:])
+	if ecdsa.Verify(&key.PublicKey, hash[:], r, s) == false {
+		t.Error("expect:", "valid signature", "result:", "invalid signature")
+	}
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if ecdsa.Verify(&other.PublicKey, hash[:], r, s) == true {
+		t.Error("expect:", "invalid signature", "result:", "valid signature")
+	}
+}
+
+func Test_loadAPNSKey(t *testing.T) {
+	var err error
+	/*************************************************/
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	file, _ := ioutil.TempFile("", "apns")
+	defer os.Remove(file.Name())
+	pem.Encode(file, &pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	file.Close()
+	result, err := loadAPNSKey(file.Name())
+	if err != nil || result.D.Cmp(key.D) != 0 {
+		t.Error("expect:", key.D, "result:", result, err)
+	}
+	/*************************************************/
+	_, err = loadAPNSKey("")
+	if err == nil {
+		t.Error("expect:", "error", "result:", nil)
+	}
+}
+
+func Test_apnsPushAdapter_sendToDevice(t *testing.T) {
+	var header http.Header
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		path = r.URL.Path
+		switch path {
+		case "/3/device/token":
+			w.Header().Set("apns-id", "1001")
+		case "/3/device/bad":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"reason":"BadDeviceToken"}`))
+		}
+	}))
+	defer server.Close()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	a := &apnsPushAdapter{
+		validPushTypes: []string{"ios", "osx", "tvos"},
+		keyID:          "keyid",
+		teamID:         "teamid",
+		topic:          "com.example.app",
+		host:           server.URL,
+		key:            key,
+		client:         server.Client(),
+	}
+	var device, body, result, expect types.M
+	/*************************************************/
+	device = types.M{"deviceType": "ios", "deviceToken": "token"}
+	body = types.M{"data": types.M{"alert": "hello"}, "expiration_time": int64(1476619200000)}
+	result = a.sendToDevice(device, body, []byte(`{"aps":{"alert":"hello"}}`))
+	expect = types.M{
+		"device":      device,
+		"transmitted": true,
+		"response":    map[string]string{"id": "1001"},
+	}
+	if reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "result:", result)
+	}
+	if strings.HasPrefix(header.Get("authorization"), "bearer ") == false ||
+		header.Get("apns-topic") != "com.example.app" ||
+		header.Get("apns-expiration") != "1476619200" ||
+		header.Get("apns-push-type") != "alert" {
+		t.Error("expect:", "apns headers", "result:", header)
+	}
+	/*************************************************/
+	device = types.M{"deviceType": "ios", "deviceToken": "bad", "appIdentifier": "com.example.other"}
+	body = types.M{"data": types.M{"content-available": 1}}
+	result = a.sendToDevice(device, body, []byte(`{"aps":{"content-available":1}}`))
+	expect = types.M{
+		"device":       device,
+		"transmitted":  false,
+		"response":     map[string]string{"error": "BadDeviceToken"},
+		"invalidToken": true,
+	}
+	if reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "result:", result)
+	}
+	if header.Get("apns-topic") != "com.example.other" || header.Get("apns-push-type") != "background" {
+		t.Error("expect:", "apns headers", "result:", header)
+	}
+}
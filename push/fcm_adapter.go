@@ -1,16 +1,31 @@
 package push
 
 import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/NaySoftware/go-fcm"
 	"github.com/lfq7413/tomato/config"
 	"github.com/lfq7413/tomato/types"
 	"github.com/lfq7413/tomato/utils"
+)
 
-	"time"
+// fcmBatchSize 单次请求最多可发送的设备数
+const fcmBatchSize = 1000
 
-	"fmt"
+// fcmMaxRetries 遇到限流或者服务端错误时的最大重试次数
+const fcmMaxRetries = 3
 
-	"github.com/NaySoftware/go-fcm"
-)
+// fcmRetryBackoff 未返回 Retry-After 时，第一次重试前的等待时间，之后每次翻倍
+var fcmRetryBackoff = time.Second
+
+// fcmInvalidTokenErrors 表示 deviceToken 已失效的错误
+var fcmInvalidTokenErrors = map[string]bool{
+	"NotRegistered":       true,
+	"InvalidRegistration": true,
+}
 
 type fcmPushAdapter struct {
 	validPushTypes []string
@@ -34,68 +49,107 @@ func (f *fcmPushAdapter) send(body types.M, installations types.S, pushStatus st
 		if len(devices) == 0 {
 			return
 		}
-		deviceTokens := []string{}
-
-		for _, device := range devices {
-			deviceTokens = append(deviceTokens, utils.S(device["deviceToken"]))
+		// 按 FCM 的限制分批发送
+		for start := 0; start < len(devices); start += fcmBatchSize {
+			end := start + fcmBatchSize
+			if end > len(devices) {
+				end = len(devices)
+			}
+			results = append(results, f.sendBatch(pushType, devices[start:end], body)...)
 		}
+	}
 
-		var status *fcm.FcmResponseStatus
-		var err error
+	for pushType := range deviceMap {
+		loop(pushType)
+	}
 
-		switch pushType {
-		case "ios", "tvos", "osx":
-			status, err = f.sendToiOSDevices(deviceTokens, body)
-		case "android", "fcm":
-			status, err = f.sendToAndroidDevices(deviceTokens, body)
-		}
+	return results
+}
 
-		if err != nil {
-			for _, device := range devices {
-				result := types.M{
-					"device":      device,
-					"transmitted": false,
-					"response":    map[string]string{"error": err.Error()},
-				}
-				results = append(results, result)
+// sendBatch 发送一批设备，返回每个设备的发送结果，deviceToken 失效时结果中的 invalidToken 为 true
+func (f *fcmPushAdapter) sendBatch(pushType string, devices []types.M, body types.M) []types.M {
+	results := []types.M{}
+	deviceTokens := []string{}
+	for _, device := range devices {
+		deviceTokens = append(deviceTokens, utils.S(device["deviceToken"]))
+	}
+
+	status, err := f.sendWithRetry(pushType, deviceTokens, body)
+	if err == nil && status == nil {
+		err = errors.New("empty response from FCM")
+	}
+	if err == nil && status.Ok == false && len(status.Results) == 0 {
+		err = fmt.Errorf("FCM request failed with status %d: %s", status.StatusCode, status.Err)
+	}
+	if err != nil {
+		for _, device := range devices {
+			result := types.M{
+				"device":      device,
+				"transmitted": false,
+				"response":    map[string]string{"error": err.Error()},
 			}
-			return
+			results = append(results, result)
 		}
+		return results
+	}
 
-		multicastID := status.MulticastId
-		pushResults := status.Results
+	multicastID := status.MulticastId
+	pushResults := status.Results
 
-		for index := range deviceTokens {
-			var pushResult map[string]string
-			if pushResults != nil && index < len(pushResults) {
-				pushResult = pushResults[index]
-			} else {
-				pushResult = nil
-			}
-			device := devices[index]
+	for index := range deviceTokens {
+		var pushResult map[string]string
+		if pushResults != nil && index < len(pushResults) {
+			pushResult = pushResults[index]
+		} else {
+			pushResult = nil
+		}
+		device := devices[index]
 
-			resolution := types.M{
-				"device":       device,
-				"multicast_id": multicastID,
-				"response":     pushResult,
-			}
+		resolution := types.M{
+			"device":       device,
+			"multicast_id": multicastID,
+			"response":     pushResult,
+		}
 
-			if pushResult == nil || pushResult["error"] != "" {
-				resolution["transmitted"] = false
-			} else {
-				resolution["transmitted"] = true
+		if pushResult == nil || pushResult["error"] != "" {
+			resolution["transmitted"] = false
+			if pushResult != nil && fcmInvalidTokenErrors[pushResult["error"]] {
+				resolution["invalidToken"] = true
 			}
-
-			results = append(results, resolution)
+		} else {
+			resolution["transmitted"] = true
 		}
 
+		results = append(results, resolution)
 	}
+	return results
+}
 
-	for pushType := range deviceMap {
-		loop(pushType)
+// sendWithRetry 发送消息，FCM 返回 429 或者 5xx 时按 Retry-After 或者指数退避重试
+func (f *fcmPushAdapter) sendWithRetry(pushType string, tokens []string, body types.M) (*fcm.FcmResponseStatus, error) {
+	var status *fcm.FcmResponseStatus
+	var err error
+	backoff := fcmRetryBackoff
+	for i := 0; ; i++ {
+		switch pushType {
+		case "ios", "tvos", "osx":
+			status, err = f.sendToiOSDevices(tokens, body)
+		default:
+			status, err = f.sendToAndroidDevices(tokens, body)
+		}
+		if err != nil || status == nil || i >= fcmMaxRetries {
+			return status, err
+		}
+		if status.StatusCode != 429 && status.StatusCode < 500 {
+			return status, err
+		}
+		wait := backoff
+		if seconds, e := strconv.Atoi(status.RetryAfter); e == nil && seconds > 0 {
+			wait = time.Duration(seconds) * time.Second
+		}
+		time.Sleep(wait)
+		backoff *= 2
 	}
-
-	return results
 }
 
 func (f *fcmPushAdapter) getValidPushTypes() []string {
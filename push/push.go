@@ -1,6 +1,7 @@
 package push
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
@@ -8,6 +9,8 @@ import (
 
 	"github.com/lfq7413/tomato/config"
 	"github.com/lfq7413/tomato/errs"
+	"github.com/lfq7413/tomato/logger"
+	"github.com/lfq7413/tomato/orm"
 	"github.com/lfq7413/tomato/rest"
 	"github.com/lfq7413/tomato/types"
 	"github.com/lfq7413/tomato/utils"
@@ -26,6 +29,8 @@ func init() {
 		adapter = newTomatoPush()
 	} else if a == "FCM" {
 		adapter = newFCMPush()
+	} else if a == "APNS" {
+		adapter = newAPNSPush()
 	} else {
 		adapter = nil
 	}
@@ -60,13 +65,118 @@ func SendPush(body types.M, where types.M, auth *rest.Auth, onPushStatusSaved fu
 		}
 	}
 
+	// 提前校验 badge ，避免定时推送到达推送时间后才发现参数错误
+	_, err := getBadgeUpdate(body, where)
+	if err != nil {
+		return err
+	}
+
+	status := newPushStatus("")
+
+	err = status.setInitial(body, where, nil)
+	if err != nil {
+		return err
+	}
+
+	onPushStatusSaved(status.objectID)
+
+	if t, ok := body["push_time"].(time.Time); ok && config.TConfig.ScheduledPush {
+		// 定时推送，到达推送时间后再更新 badge 并加入推送队列
+		schedulePush(t, body, where, auth, status)
+		return nil
+	}
+
+	return sendPush(body, where, auth, status)
+}
+
+// sendPush 更新 iOS 设备的 badge ，并把推送加入推送队列
+func sendPush(body types.M, where types.M, auth *rest.Auth, status *pushStatus) error {
+	badgeUpdate, err := getBadgeUpdate(body, where)
+	if err == nil {
+		err = badgeUpdate()
+	}
+	if err == nil {
+		err = queue.enqueue(body, where, auth, status)
+	}
+	if err != nil {
+		status.fail(err)
+	}
+	return err
+}
+
+// schedulePush 到达推送时间后发送推送，推送状态为 scheduled 的推送在服务重启后由 StartScheduledPush 重新加载
+func schedulePush(pushTime time.Time, body types.M, where types.M, auth *rest.Auth, status *pushStatus) {
+	time.AfterFunc(pushTime.Sub(time.Now()), func() {
+		// 多个服务实例同时加载了该推送时，仅由成功修改状态的实例发送
+		if status.setPending() == false {
+			return
+		}
+		sendPush(body, where, auth, status)
+	})
+}
+
+// StartScheduledPush 加载所有未发送的定时推送，未启用 ScheduledPush 时不加载
+func StartScheduledPush() {
+	if config.TConfig.ScheduledPush == false || adapter == nil {
+		return
+	}
+	results, err := orm.TomatoDBController.Find(pushStatusCollection, types.M{"status": "scheduled"}, types.M{})
+	if err != nil {
+		logger.Error("load scheduled push failed:", err)
+		return
+	}
+	for _, v := range results {
+		object := utils.M(v)
+		if object == nil {
+			continue
+		}
+		status := newPushStatus(utils.S(object["objectId"]))
+		pushTime, body, where, err := scheduledPushFromStatus(object)
+		if err != nil {
+			status.fail(err)
+			continue
+		}
+		schedulePush(pushTime, body, where, rest.Master(), status)
+	}
+}
+
+// scheduledPushFromStatus 从 _PushStatus 中还原推送时间、推送内容与查询条件
+func scheduledPushFromStatus(object types.M) (time.Time, types.M, types.M, error) {
+	var iso string
+	if date := utils.M(object["pushTime"]); date != nil {
+		iso = utils.S(date["iso"])
+	} else {
+		iso = utils.S(object["pushTime"])
+	}
+	pushTime, err := utils.StringtoTime(iso)
+	if err != nil {
+		return time.Time{}, nil, nil, errs.E(errs.PushMisconfigured, fmt.Sprint(object["pushTime"], "is not valid time."))
+	}
+	var data, where types.M
+	if err := json.Unmarshal([]byte(utils.S(object["payload"])), &data); err != nil {
+		return time.Time{}, nil, nil, err
+	}
+	if err := json.Unmarshal([]byte(utils.S(object["query"])), &where); err != nil {
+		return time.Time{}, nil, nil, err
+	}
+	body := types.M{
+		"data":      data,
+		"push_time": pushTime,
+	}
+	if object["expiry"] != nil {
+		body["expiration_time"] = object["expiry"]
+	}
+	return pushTime, body, where, nil
+}
+
+// getBadgeUpdate 获取更新 iOS 设备 badge 的操作， data 中没有 badge 时不做任何操作
+func getBadgeUpdate(body types.M, where types.M) (func() error, error) {
 	badgeUpdate := func() error { return nil }
 
 	data := utils.M(body["data"])
 	if data != nil && data["badge"] != nil {
 		restUpdate := types.M{}
 		badge := data["badge"]
-		restUpdate = types.M{}
 		if strings.ToLower(utils.S(badge)) == "increment" {
 			restUpdate["badge"] = types.M{
 				"__op":   "Increment",
@@ -77,7 +187,7 @@ func SendPush(body types.M, where types.M, auth *rest.Auth, onPushStatusSaved fu
 		} else if v, ok := badge.(int); ok {
 			restUpdate["badge"] = v
 		} else {
-			return errors.New("Invalid value for badge, expected number or 'Increment'")
+			return nil, errors.New("Invalid value for badge, expected number or 'Increment'")
 		}
 		updateWhere := utils.CopyMapM(where)
 
@@ -101,31 +211,7 @@ func SendPush(body types.M, where types.M, auth *rest.Auth, onPushStatusSaved fu
 		}
 	}
 
-	status := newPushStatus("")
-
-	err := status.setInitial(body, where, nil)
-	if err != nil {
-		return err
-	}
-
-	onPushStatusSaved(status.objectID)
-	err = badgeUpdate()
-	if err != nil {
-		status.fail(err)
-		return err
-	}
-
-	if _, ok := body["push_time"]; ok && config.TConfig.ScheduledPush {
-
-	} else {
-		err = queue.enqueue(body, where, auth, status)
-	}
-
-	if err != nil {
-		status.fail(err)
-	}
-
-	return err
+	return badgeUpdate, nil
 }
 
 // getExpirationTime 把过期时间转换为以毫秒为单位的 Unix 时间
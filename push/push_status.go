@@ -82,6 +82,20 @@ func (p *pushStatus) setInitial(body, where, options types.M) error {
 	return p.db.Create(pushStatusCollection, object, types.M{})
 }
 
+// setPending 定时推送到达推送时间，等待发送，状态已不是 scheduled 时返回 false
+func (p *pushStatus) setPending() bool {
+	where := types.M{
+		"status":   "scheduled",
+		"objectId": p.objectID,
+	}
+	update := types.M{
+		"status":    "pending",
+		"updatedAt": utils.TimetoString(time.Now().UTC()),
+	}
+	_, err := p.db.Update(pushStatusCollection, where, update, types.M{}, false)
+	return err == nil
+}
+
 // setRunning 设置正在推送
 func (p *pushStatus) setRunning(count int) {
 	where := types.M{
@@ -107,6 +121,7 @@ func (p *pushStatus) trackSent(results []types.M) error {
 	update := types.M{}
 	numSent := 0
 	numFailed := 0
+	devicesToRemove := types.S{}
 
 	for _, result := range results {
 		if result == nil {
@@ -116,6 +131,9 @@ func (p *pushStatus) trackSent(results []types.M) error {
 			continue
 		}
 		device := utils.M(result["device"])
+		if invalid, ok := result["invalidToken"].(bool); ok && invalid && device["deviceToken"] != nil {
+			devicesToRemove = append(devicesToRemove, device["deviceToken"])
+		}
 		if device["deviceType"] == nil {
 			continue
 		}
@@ -149,6 +167,10 @@ func (p *pushStatus) trackSent(results []types.M) error {
 		"objectId": p.objectID,
 	}
 
+	if len(devicesToRemove) > 0 {
+		p.cleanupInstallations(devicesToRemove)
+	}
+
 	res, err := p.db.Update(pushStatusCollection, where, update, types.M{}, false)
 	if err != nil {
 		return err
@@ -163,6 +185,13 @@ func (p *pushStatus) trackSent(results []types.M) error {
 	return nil
 }
 
+// cleanupInstallations 清除已失效的 deviceToken ，避免继续向其推送
+func (p *pushStatus) cleanupInstallations(deviceTokens types.S) {
+	where := types.M{"deviceToken": types.M{"$in": deviceTokens}}
+	update := types.M{"deviceToken": types.M{"__op": "Delete"}}
+	p.db.Update("_Installation", where, update, types.M{"many": true}, false)
+}
+
 // complete 推送完成
 func (p *pushStatus) complete() {
 	where := types.M{
@@ -0,0 +1,69 @@
+package push
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lfq7413/tomato/types"
+	"github.com/lfq7413/tomato/utils"
+)
+
+func Test_scheduledPushFromStatus(t *testing.T) {
+	var object types.M
+	var pushTime time.Time
+	var body, where types.M
+	var err error
+	var expectBody, expectWhere types.M
+	/*************************************************/
+	pushTime = time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	object = types.M{
+		"objectId": "1001",
+		"pushTime": types.M{"__type": "Date", "iso": utils.TimetoString(pushTime)},
+		"query":    `{"channels":{"$in":["a"]}}`,
+		"payload":  `{"alert":"hello","badge":"Increment"}`,
+		"expiry":   1476619200000.0,
+		"status":   "scheduled",
+	}
+	pushTime, body, where, err = scheduledPushFromStatus(object)
+	expectBody = types.M{
+		"data":            types.M{"alert": "hello", "badge": "Increment"},
+		"push_time":       time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC),
+		"expiration_time": 1476619200000.0,
+	}
+	expectWhere = types.M{"channels": map[string]interface{}{"$in": []interface{}{"a"}}}
+	if err != nil || pushTime.Equal(time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)) == false {
+		t.Error("expect:", nil, "result:", pushTime, err)
+	}
+	if reflect.DeepEqual(expectBody, body) == false {
+		t.Error("expect:", expectBody, "result:", body)
+	}
+	if reflect.DeepEqual(expectWhere, where) == false {
+		t.Error("expect:", expectWhere, "result:", where)
+	}
+	/*************************************************/
+	object = types.M{
+		"objectId": "1001",
+		"pushTime": "2026-10-16T12:00:00.000Z",
+		"query":    `{}`,
+		"payload":  `{}`,
+		"status":   "scheduled",
+	}
+	pushTime, body, _, err = scheduledPushFromStatus(object)
+	if err != nil || pushTime.Equal(time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)) == false {
+		t.Error("expect:", nil, "result:", pushTime, err)
+	}
+	if _, ok := body["expiration_time"]; ok {
+		t.Error("expect:", nil, "result:", body["expiration_time"])
+	}
+	/*************************************************/
+	object = types.M{
+		"objectId": "1001",
+		"pushTime": "abc",
+		"status":   "scheduled",
+	}
+	_, _, _, err = scheduledPushFromStatus(object)
+	if err == nil {
+		t.Error("expect:", "error", "result:", nil)
+	}
+}
@@ -2,6 +2,7 @@ package rest
 
 import (
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/lfq7413/tomato/config"
@@ -14,6 +15,7 @@ import (
 // AccountLockout 密码错误达到一定次数，锁定账户
 type AccountLockout struct {
 	username string
+	clientIP string
 }
 
 // NewAccountLockout ...
@@ -23,21 +25,55 @@ func NewAccountLockout(username string) *AccountLockout {
 	}
 }
 
+// SetClientIP 设置发起登录请求的客户端 IP ，用于按 IP 锁定
+func (a *AccountLockout) SetClientIP(ip string) {
+	a.clientIP = ip
+}
+
 // HandleLoginAttempt 处理登录结果
 func (a *AccountLockout) HandleLoginAttempt(loginSuccessful bool) error {
+	err := CheckIPLockout(a.clientIP)
+	if err != nil {
+		return err
+	}
+	if loginSuccessful == false {
+		RecordFailedIPAttempt(a.clientIP)
+	}
+
 	if config.TConfig.EnableAccountLockout == false {
 		return nil
 	}
-	err := a.notLocked()
+	err = a.notLocked()
 	if err != nil {
 		return err
 	}
 	if loginSuccessful {
-		return a.setFailedLoginCount(0)
+		return a.resetFailedLoginCount()
 	}
 	return a.handleFailedLoginAttempt()
 }
 
+// UnlockAccount 重置密码后，按 UnlockOnPasswordReset 配置解除账户锁定
+func (a *AccountLockout) UnlockAccount() error {
+	if config.TConfig.EnableAccountLockout == false || config.TConfig.UnlockOnPasswordReset == false {
+		return nil
+	}
+	return a.Unlock()
+}
+
+// Unlock 清空登录失败次数与锁定时间，解除账户锁定
+func (a *AccountLockout) Unlock() error {
+	query := types.M{
+		"username": a.username,
+	}
+	updateFields := types.M{
+		"_failed_login_count":         types.M{"__op": "Delete"},
+		"_account_lockout_expires_at": types.M{"__op": "Delete"},
+	}
+	_, err := orm.TomatoDBController.Update("_User", query, updateFields, types.M{}, false)
+	return err
+}
+
 // notLocked 检测账户是否已经被锁住
 func (a *AccountLockout) notLocked() error {
 	query := types.M{
@@ -77,6 +113,19 @@ func (a *AccountLockout) setFailedLoginCount(count int) error {
 	return err
 }
 
+// resetFailedLoginCount 登录成功后将 _failed_login_count 置为 0 ，并清除已过期的 _account_lockout_expires_at
+func (a *AccountLockout) resetFailedLoginCount() error {
+	query := types.M{
+		"username": a.username,
+	}
+	updateFields := types.M{
+		"_failed_login_count":         0,
+		"_account_lockout_expires_at": types.M{"__op": "Delete"},
+	}
+	_, err := orm.TomatoDBController.Update("_User", query, updateFields, types.M{}, false)
+	return err
+}
+
 // handleFailedLoginAttempt 处理失败的登录
 func (a *AccountLockout) handleFailedLoginAttempt() error {
 	err := a.initFailedLoginCount()
@@ -160,3 +209,84 @@ func (a *AccountLockout) isFailedLoginCountSet() (bool, error) {
 	}
 	return false, nil
 }
+
+// ipAttempts 记录同一 IP 的登录失败情况
+type ipAttempts struct {
+	count         int
+	firstFailedAt time.Time
+	lockedUntil   time.Time
+}
+
+// maxTrackedIPs 最多记录的 IP 数量，达到该数量时清理已过期的记录，仍然没有空间时不再记录新的 IP
+const maxTrackedIPs = 10000
+
+// ipLockoutPruneInterval 两次清理过期记录的最小间隔，避免每次登录失败都遍历全部记录
+const ipLockoutPruneInterval = time.Minute
+
+var ipLockout = struct {
+	sync.Mutex
+	attempts map[string]*ipAttempts
+	prunedAt time.Time
+}{attempts: map[string]*ipAttempts{}}
+
+// CheckIPLockout 检测 IP 是否因登录失败次数过多被锁定
+func CheckIPLockout(ip string) error {
+	if config.TConfig.EnableIPLockout == false || ip == "" {
+		return nil
+	}
+	ipLockout.Lock()
+	defer ipLockout.Unlock()
+	if record := ipLockout.attempts[ip]; record != nil && record.lockedUntil.After(time.Now()) {
+		msg := "Too many failed login attempts from this IP address. Please try again after " +
+			strconv.Itoa(config.TConfig.IPLockoutDuration) + " minute(s)"
+		return errs.E(errs.ObjectNotFound, msg)
+	}
+	return nil
+}
+
+// RecordFailedIPAttempt 记录一次来自该 IP 的登录失败，在时间窗口内达到 IPLockoutThreshold 次时锁定该 IP
+func RecordFailedIPAttempt(ip string) {
+	if config.TConfig.EnableIPLockout == false || ip == "" {
+		return
+	}
+	now := time.Now()
+	window := time.Duration(config.TConfig.IPLockoutDuration) * time.Minute
+
+	ipLockout.Lock()
+	defer ipLockout.Unlock()
+	record := ipLockout.attempts[ip]
+	if record == nil && len(ipLockout.attempts) >= maxTrackedIPs {
+		if now.Sub(ipLockout.prunedAt) >= ipLockoutPruneInterval {
+			ipLockout.prunedAt = now
+			for k, v := range ipLockout.attempts {
+				if ipAttemptsExpired(v, now, window) {
+					delete(ipLockout.attempts, k)
+				}
+			}
+		}
+		if len(ipLockout.attempts) >= maxTrackedIPs {
+			return
+		}
+	}
+	if record == nil || ipAttemptsExpired(record, now, window) {
+		record = &ipAttempts{firstFailedAt: now}
+		ipLockout.attempts[ip] = record
+	}
+	record.count++
+	if record.count >= config.TConfig.IPLockoutThreshold {
+		record.lockedUntil = now.Add(window)
+	}
+}
+
+// ipAttemptsExpired 统计窗口与锁定时间都已过去时，记录失效
+func ipAttemptsExpired(record *ipAttempts, now time.Time, window time.Duration) bool {
+	return record.lockedUntil.After(now) == false && now.Sub(record.firstFailedAt) > window
+}
+
+// resetIPLockout 清空 IP 锁定记录，仅用于测试
+func resetIPLockout() {
+	ipLockout.Lock()
+	defer ipLockout.Unlock()
+	ipLockout.attempts = map[string]*ipAttempts{}
+	ipLockout.prunedAt = time.Time{}
+}
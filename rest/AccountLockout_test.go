@@ -14,7 +14,284 @@ import (
 )
 
 func Test_HandleLoginAttempt(t *testing.T) {
-	// TODO
+	var username string
+	var object, schema types.M
+	var accountLockout *AccountLockout
+	var err, expectErr error
+	var results []types.M
+	enableAccountLockout := config.TConfig.EnableAccountLockout
+	accountLockoutThreshold := config.TConfig.AccountLockoutThreshold
+	accountLockoutDuration := config.TConfig.AccountLockoutDuration
+	defer func() {
+		config.TConfig.EnableAccountLockout = enableAccountLockout
+		config.TConfig.AccountLockoutThreshold = accountLockoutThreshold
+		config.TConfig.AccountLockoutDuration = accountLockoutDuration
+	}()
+	/*****************************************************************/
+	config.TConfig.EnableAccountLockout = true
+	config.TConfig.AccountLockoutThreshold = 3
+	config.TConfig.AccountLockoutDuration = 5
+	initEnv()
+	username = "joe"
+	schema = types.M{
+		"fields": types.M{
+			"username": types.M{"type": "String"},
+			"password": types.M{"type": "String"},
+		},
+	}
+	orm.Adapter.CreateClass("_User", schema)
+	object = types.M{
+		"objectId": "01",
+		"username": username,
+	}
+	orm.Adapter.CreateObject("_User", schema, object)
+	accountLockout = NewAccountLockout(username)
+	accountLockout.HandleLoginAttempt(false)
+	accountLockout.HandleLoginAttempt(false)
+	err = accountLockout.HandleLoginAttempt(true)
+	if err != nil {
+		t.Error("expect:", nil, "result:", err)
+	}
+	results, err = orm.Adapter.Find("_User", schema, types.M{}, types.M{})
+	if len(results) != 1 || results[0]["_failed_login_count"] != 0 {
+		t.Error("expect:", 0, "result:", results)
+	}
+	// 登录成功后需要重新累计失败次数才会锁定
+	accountLockout.HandleLoginAttempt(false)
+	accountLockout.HandleLoginAttempt(false)
+	err = accountLockout.HandleLoginAttempt(false)
+	if err != nil {
+		t.Error("expect:", nil, "result:", err)
+	}
+	err = accountLockout.HandleLoginAttempt(true)
+	expectErr = errs.E(errs.ObjectNotFound, "Your account is locked due to multiple failed login attempts. Please try again after "+
+		strconv.Itoa(config.TConfig.AccountLockoutDuration)+" minute(s)")
+	if reflect.DeepEqual(expectErr, err) == false {
+		t.Error("expect:", expectErr, "result:", err)
+	}
+	orm.TomatoDBController.DeleteEverything()
+	/*****************************************************************/
+	config.TConfig.EnableAccountLockout = true
+	config.TConfig.AccountLockoutThreshold = 3
+	config.TConfig.AccountLockoutDuration = 5
+	initEnv()
+	username = "joe"
+	schema = types.M{
+		"fields": types.M{
+			"username": types.M{"type": "String"},
+			"password": types.M{"type": "String"},
+		},
+	}
+	orm.Adapter.CreateClass("_User", schema)
+	object = types.M{
+		"objectId": "01",
+		"username": username,
+		"_account_lockout_expires_at": types.M{
+			"__type": "Date",
+			"iso":    utils.TimetoString(time.Now().UTC().Add(-time.Minute)),
+		},
+		"_failed_login_count": 3,
+	}
+	orm.Adapter.CreateObject("_User", schema, object)
+	accountLockout = NewAccountLockout(username)
+	err = accountLockout.HandleLoginAttempt(true)
+	if err != nil {
+		t.Error("expect:", nil, "result:", err)
+	}
+	results, err = orm.Adapter.Find("_User", schema, types.M{}, types.M{})
+	expect := []types.M{
+		types.M{
+			"objectId":            "01",
+			"username":            username,
+			"_failed_login_count": 0,
+		},
+	}
+	if reflect.DeepEqual(expect, results) == false {
+		t.Error("expect:", expect, "result:", results)
+	}
+	orm.TomatoDBController.DeleteEverything()
+	/*****************************************************************/
+	config.TConfig.EnableAccountLockout = true
+	config.TConfig.AccountLockoutThreshold = 3
+	config.TConfig.AccountLockoutDuration = 5
+	initEnv()
+	username = "joe"
+	schema = types.M{
+		"fields": types.M{
+			"username": types.M{"type": "String"},
+			"password": types.M{"type": "String"},
+		},
+	}
+	orm.Adapter.CreateClass("_User", schema)
+	object = types.M{
+		"objectId": "01",
+		"username": username,
+	}
+	orm.Adapter.CreateObject("_User", schema, object)
+	accountLockout = NewAccountLockout(username)
+	for i := 0; i < config.TConfig.AccountLockoutThreshold; i++ {
+		err = accountLockout.HandleLoginAttempt(false)
+		if err != nil {
+			t.Error("expect:", nil, "result:", err)
+		}
+	}
+	// 达到失败次数后，即使密码正确也无法登录
+	err = accountLockout.HandleLoginAttempt(true)
+	expectErr = errs.E(errs.ObjectNotFound, "Your account is locked due to multiple failed login attempts. Please try again after "+
+		strconv.Itoa(config.TConfig.AccountLockoutDuration)+" minute(s)")
+	if reflect.DeepEqual(expectErr, err) == false {
+		t.Error("expect:", expectErr, "result:", err)
+	}
+	results, err = orm.Adapter.Find("_User", schema, types.M{}, types.M{})
+	if len(results) != 1 || results[0]["_failed_login_count"] != 3 {
+		t.Error("expect:", 3, "result:", results)
+	} else if expiresAt, ok := results[0]["_account_lockout_expires_at"].(time.Time); ok == false ||
+		expiresAt.Sub(time.Now()) > 5*time.Minute || expiresAt.Sub(time.Now()) < 4*time.Minute {
+		t.Error("expect:", "locked for 5 minutes", "result:", results[0]["_account_lockout_expires_at"])
+	}
+	orm.TomatoDBController.DeleteEverything()
+}
+
+func Test_UnlockAccount(t *testing.T) {
+	var username string
+	var object, schema types.M
+	var accountLockout *AccountLockout
+	var err, expectErr error
+	var results, expect []types.M
+	var expiresAtStr string
+	enableAccountLockout := config.TConfig.EnableAccountLockout
+	unlockOnPasswordReset := config.TConfig.UnlockOnPasswordReset
+	defer func() {
+		config.TConfig.EnableAccountLockout = enableAccountLockout
+		config.TConfig.UnlockOnPasswordReset = unlockOnPasswordReset
+	}()
+	/*****************************************************************/
+	config.TConfig.EnableAccountLockout = true
+	config.TConfig.UnlockOnPasswordReset = false
+	config.TConfig.AccountLockoutThreshold = 3
+	config.TConfig.AccountLockoutDuration = 5
+	expiresAtStr = utils.TimetoString(time.Now().UTC().Add(time.Duration(config.TConfig.AccountLockoutDuration) * time.Minute))
+	initEnv()
+	username = "joe"
+	schema = types.M{
+		"fields": types.M{
+			"username": types.M{"type": "String"},
+			"password": types.M{"type": "String"},
+		},
+	}
+	orm.Adapter.CreateClass("_User", schema)
+	object = types.M{
+		"objectId": "01",
+		"username": username,
+		"_account_lockout_expires_at": types.M{
+			"__type": "Date",
+			"iso":    expiresAtStr,
+		},
+		"_failed_login_count": 3,
+	}
+	orm.Adapter.CreateObject("_User", schema, object)
+	accountLockout = NewAccountLockout(username)
+	err = accountLockout.UnlockAccount()
+	if err != nil {
+		t.Error("expect:", nil, "result:", err)
+	}
+	err = accountLockout.HandleLoginAttempt(true)
+	expectErr = errs.E(errs.ObjectNotFound, "Your account is locked due to multiple failed login attempts. Please try again after "+
+		strconv.Itoa(config.TConfig.AccountLockoutDuration)+" minute(s)")
+	if reflect.DeepEqual(expectErr, err) == false {
+		t.Error("expect:", expectErr, "result:", err)
+	}
+	orm.TomatoDBController.DeleteEverything()
+	/*****************************************************************/
+	config.TConfig.EnableAccountLockout = true
+	config.TConfig.UnlockOnPasswordReset = true
+	config.TConfig.AccountLockoutThreshold = 3
+	config.TConfig.AccountLockoutDuration = 5
+	expiresAtStr = utils.TimetoString(time.Now().UTC().Add(time.Duration(config.TConfig.AccountLockoutDuration) * time.Minute))
+	initEnv()
+	username = "joe"
+	schema = types.M{
+		"fields": types.M{
+			"username": types.M{"type": "String"},
+			"password": types.M{"type": "String"},
+		},
+	}
+	orm.Adapter.CreateClass("_User", schema)
+	object = types.M{
+		"objectId": "01",
+		"username": username,
+		"_account_lockout_expires_at": types.M{
+			"__type": "Date",
+			"iso":    expiresAtStr,
+		},
+		"_failed_login_count": 3,
+	}
+	orm.Adapter.CreateObject("_User", schema, object)
+	accountLockout = NewAccountLockout(username)
+	err = accountLockout.UnlockAccount()
+	if err != nil {
+		t.Error("expect:", nil, "result:", err)
+	}
+	err = accountLockout.HandleLoginAttempt(true)
+	if err != nil {
+		t.Error("expect:", nil, "result:", err)
+	}
+	results, err = orm.Adapter.Find("_User", schema, types.M{}, types.M{})
+	expect = []types.M{
+		types.M{
+			"objectId":            "01",
+			"username":            username,
+			"_failed_login_count": 0,
+		},
+	}
+	if reflect.DeepEqual(expect, results) == false {
+		t.Error("expect:", expect, "result:", results)
+	}
+	orm.TomatoDBController.DeleteEverything()
+}
+
+func Test_Unlock(t *testing.T) {
+	var username string
+	var object, schema types.M
+	var accountLockout *AccountLockout
+	var err error
+	var results, expect []types.M
+	/*****************************************************************/
+	initEnv()
+	username = "joe"
+	schema = types.M{
+		"fields": types.M{
+			"username": types.M{"type": "String"},
+			"password": types.M{"type": "String"},
+		},
+	}
+	orm.Adapter.CreateClass("_User", schema)
+	object = types.M{
+		"objectId": "01",
+		"username": username,
+		"_account_lockout_expires_at": types.M{
+			"__type": "Date",
+			"iso":    utils.TimetoString(time.Now().UTC().Add(5 * time.Minute)),
+		},
+		"_failed_login_count": 3,
+	}
+	orm.Adapter.CreateObject("_User", schema, object)
+	accountLockout = NewAccountLockout(username)
+	err = accountLockout.Unlock()
+	if err != nil {
+		t.Error("expect:", nil, "result:", err)
+	}
+	results, err = orm.Adapter.Find("_User", schema, types.M{}, types.M{})
+	expect = []types.M{
+		types.M{
+			"objectId": "01",
+			"username": username,
+		},
+	}
+	if reflect.DeepEqual(expect, results) == false {
+		t.Error("expect:", expect, "result:", results)
+	}
+	orm.TomatoDBController.DeleteEverything()
 }
 
 func Test_notLocked(t *testing.T) {
@@ -447,3 +724,104 @@ func Test_isFailedLoginCountSet(t *testing.T) {
 	}
 	orm.TomatoDBController.DeleteEverything()
 }
+
+func Test_IPLockout(t *testing.T) {
+	var accountLockout *AccountLockout
+	var err, expectErr error
+	enableIPLockout := config.TConfig.EnableIPLockout
+	enableAccountLockout := config.TConfig.EnableAccountLockout
+	ipLockoutThreshold := config.TConfig.IPLockoutThreshold
+	ipLockoutDuration := config.TConfig.IPLockoutDuration
+	defer func() {
+		config.TConfig.EnableIPLockout = enableIPLockout
+		config.TConfig.EnableAccountLockout = enableAccountLockout
+		config.TConfig.IPLockoutThreshold = ipLockoutThreshold
+		config.TConfig.IPLockoutDuration = ipLockoutDuration
+		resetIPLockout()
+	}()
+	config.TConfig.EnableAccountLockout = false
+	config.TConfig.IPLockoutThreshold = 3
+	config.TConfig.IPLockoutDuration = 5
+	expectErr = errs.E(errs.ObjectNotFound, "Too many failed login attempts from this IP address. Please try again after 5 minute(s)")
+	/*****************************************************************/
+	resetIPLockout()
+	config.TConfig.EnableIPLockout = false
+	for i := 0; i < 5; i++ {
+		RecordFailedIPAttempt("10.0.0.1")
+	}
+	err = CheckIPLockout("10.0.0.1")
+	if err != nil {
+		t.Error("expect:", nil, "result:", err)
+	}
+	/*****************************************************************/
+	resetIPLockout()
+	config.TConfig.EnableIPLockout = true
+	// 使用不同的用户名尝试，同样计入该 IP 的失败次数
+	for _, username := range []string{"joe", "jack", "tom"} {
+		accountLockout = NewAccountLockout(username)
+		accountLockout.SetClientIP("10.0.0.1")
+		err = accountLockout.HandleLoginAttempt(false)
+		if err != nil {
+			t.Error("expect:", nil, "result:", err)
+		}
+	}
+	accountLockout = NewAccountLockout("lily")
+	accountLockout.SetClientIP("10.0.0.1")
+	err = accountLockout.HandleLoginAttempt(true)
+	if reflect.DeepEqual(expectErr, err) == false {
+		t.Error("expect:", expectErr, "result:", err)
+	}
+	err = CheckIPLockout("10.0.0.2")
+	if err != nil {
+		t.Error("expect:", nil, "result:", err)
+	}
+	/*****************************************************************/
+	resetIPLockout()
+	RecordFailedIPAttempt("10.0.0.1")
+	RecordFailedIPAttempt("10.0.0.1")
+	ipLockout.attempts["10.0.0.1"].firstFailedAt = time.Now().Add(-6 * time.Minute)
+	RecordFailedIPAttempt("10.0.0.1")
+	err = CheckIPLockout("10.0.0.1")
+	if err != nil || ipLockout.attempts["10.0.0.1"].count != 1 {
+		t.Error("expect:", nil, 1, "result:", err, ipLockout.attempts["10.0.0.1"].count)
+	}
+	/*****************************************************************/
+	resetIPLockout()
+	RecordFailedIPAttempt("10.0.0.1")
+	RecordFailedIPAttempt("10.0.0.1")
+	RecordFailedIPAttempt("10.0.0.1")
+	err = CheckIPLockout("10.0.0.1")
+	if reflect.DeepEqual(expectErr, err) == false {
+		t.Error("expect:", expectErr, "result:", err)
+	}
+	ipLockout.attempts["10.0.0.1"].lockedUntil = time.Now().Add(-time.Second)
+	err = CheckIPLockout("10.0.0.1")
+	if err != nil {
+		t.Error("expect:", nil, "result:", err)
+	}
+	err = CheckIPLockout("")
+	if err != nil {
+		t.Error("expect:", nil, "result:", err)
+	}
+	/*****************************************************************/
+	// 记录已满且没有过期记录时，不再记录新的 IP ，已记录的 IP 继续统计
+	resetIPLockout()
+	for i := 0; i < maxTrackedIPs; i++ {
+		RecordFailedIPAttempt("10.1." + strconv.Itoa(i/256) + "." + strconv.Itoa(i%256))
+	}
+	RecordFailedIPAttempt("10.0.0.1")
+	if len(ipLockout.attempts) != maxTrackedIPs || ipLockout.attempts["10.0.0.1"] != nil {
+		t.Error("expect:", maxTrackedIPs, "result:", len(ipLockout.attempts))
+	}
+	RecordFailedIPAttempt("10.1.0.0")
+	if ipLockout.attempts["10.1.0.0"].count != 2 {
+		t.Error("expect:", 2, "result:", ipLockout.attempts["10.1.0.0"].count)
+	}
+	// 有过期记录时清理后记录新的 IP
+	ipLockout.attempts["10.1.0.1"].firstFailedAt = time.Now().Add(-6 * time.Minute)
+	ipLockout.prunedAt = time.Time{}
+	RecordFailedIPAttempt("10.0.0.1")
+	if ipLockout.attempts["10.1.0.1"] != nil || ipLockout.attempts["10.0.0.1"] == nil {
+		t.Error("expect:", "10.0.0.1 tracked", "result:", ipLockout.attempts["10.0.0.1"])
+	}
+}
@@ -1,10 +1,14 @@
 package rest
 
 import (
+	"strings"
 	"time"
 
 	"github.com/lfq7413/tomato/cache"
+	"github.com/lfq7413/tomato/config"
 	"github.com/lfq7413/tomato/errs"
+	"github.com/lfq7413/tomato/logger"
+	"github.com/lfq7413/tomato/orm"
 	"github.com/lfq7413/tomato/types"
 	"github.com/lfq7413/tomato/utils"
 )
@@ -17,6 +21,8 @@ type Auth struct {
 	UserRoles      []string
 	FetchedRoles   bool
 	RolePromise    []string
+
+	isPasswordReset bool // 重置密码流程中使用的 Master 权限，仍需校验密码规则
 }
 
 // Master 生成 Master 级别用户
@@ -32,13 +38,15 @@ func Nobody() *Auth {
 // GetAuthForSessionToken 返回 sessionToken 对应的用户权限信息
 func GetAuthForSessionToken(sessionToken string, installationID string) (*Auth, error) {
 	// 从缓存获取用户信息
-	cachedUser := cache.User.Get(sessionToken)
-	if u := utils.M(cachedUser); u != nil {
-		return &Auth{
-			IsMaster:       false,
-			InstallationID: installationID,
-			User:           u,
-		}, nil
+	if config.TConfig.EnableUserCache {
+		cachedUser := cache.User.Get(sessionToken)
+		if u := utils.M(cachedUser); u != nil {
+			return &Auth{
+				IsMaster:       false,
+				InstallationID: installationID,
+				User:           u,
+			}, nil
+		}
 	}
 	// 缓存中不存在时，从数据库中查询
 	restOptions := types.M{
@@ -54,6 +62,7 @@ func GetAuthForSessionToken(sessionToken string, installationID string) (*Auth,
 	if err != nil {
 		return nil, sessionErr
 	}
+	query.skipAfterFind = true
 	response, err := query.Execute()
 	if err != nil {
 		return nil, sessionErr
@@ -64,6 +73,12 @@ func GetAuthForSessionToken(sessionToken string, installationID string) (*Auth,
 	}
 	results := utils.A(response["results"])
 	if results == nil || len(results) != 1 {
+		// 不带 r: 前缀的旧版 token 保存在 _User 中，为兼容旧客户端继续支持
+		if strings.HasPrefix(sessionToken, "r:") == false {
+			if auth, err := GetAuthForLegacySessionToken(sessionToken, installationID); err == nil {
+				return auth, nil
+			}
+		}
 		return nil, sessionErr
 	}
 	result := utils.M(results[0])
@@ -72,17 +87,16 @@ func GetAuthForSessionToken(sessionToken string, installationID string) (*Auth,
 	}
 
 	now := time.Now().UTC()
-	if result["expiresAt"] == nil {
-		return nil, errs.E(errs.InvalidSessionToken, "Session token is expired.")
-	}
-	expiresAtDate := utils.M(result["expiresAt"])
-	expiresAtString := utils.S(expiresAtDate["iso"])
-	expiresAt, err := utils.StringtoTime(expiresAtString)
-	if err != nil {
+	expiresAt, ok := sessionExpiresAt(result)
+	if ok == false || isSessionExpired(expiresAt, now) {
+		// 删除已过期的 session
+		if objectID := utils.S(result["objectId"]); objectID != "" {
+			orm.TomatoDBController.Destroy("_Session", types.M{"objectId": objectID}, types.M{})
+		}
 		return nil, errs.E(errs.InvalidSessionToken, "Session token is expired.")
 	}
-	if expiresAt.UnixNano() < now.UnixNano() {
-		return nil, errs.E(errs.InvalidSessionToken, "Session token is expired.")
+	if config.TConfig.ExpireInactiveSessions && shouldRefreshSession(expiresAt, now) {
+		refreshSession(utils.S(result["objectId"]))
 	}
 
 	user := utils.M(result["user"])
@@ -90,7 +104,11 @@ func GetAuthForSessionToken(sessionToken string, installationID string) (*Auth,
 	user["className"] = "_User"
 	user["sessionToken"] = sessionToken
 	// 写入缓存
-	cache.User.Put(sessionToken, user, 0)
+	if config.TConfig.EnableUserCache {
+		if ttl, ok := userCacheTTL(expiresAt, now); ok {
+			cache.User.Put(sessionToken, user, ttl)
+		}
+	}
 
 	return &Auth{
 		IsMaster:       false,
@@ -99,6 +117,125 @@ func GetAuthForSessionToken(sessionToken string, installationID string) (*Auth,
 	}, nil
 }
 
+// sessionExpiresAt 获取 session 的过期时间
+func sessionExpiresAt(session types.M) (time.Time, bool) {
+	expiresAtDate := utils.M(session["expiresAt"])
+	if expiresAtDate == nil {
+		return time.Time{}, false
+	}
+	expiresAt, err := utils.StringtoTime(utils.S(expiresAtDate["iso"]))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return expiresAt, true
+}
+
+// isSessionExpired 判断 session 是否已过期
+func isSessionExpired(expiresAt, now time.Time) bool {
+	return expiresAt.UnixNano() < now.UnixNano()
+}
+
+// shouldRefreshSession 剩余有效期不足 SessionLength 的一半时需要刷新，避免每次请求都写数据库
+func shouldRefreshSession(expiresAt, now time.Time) bool {
+	half := time.Duration(config.TConfig.SessionLength) * time.Second / 2
+	return expiresAt.Sub(now) < half
+}
+
+// userCacheTTL 计算用户缓存的有效期，不超过 session 的剩余有效期，
+// 启用 ExpireInactiveSessions 时不超过需要刷新 session 的时间，避免缓存命中时跳过刷新
+func userCacheTTL(expiresAt, now time.Time) (int64, bool) {
+	limit := expiresAt.Sub(now)
+	if config.TConfig.ExpireInactiveSessions {
+		limit -= time.Duration(config.TConfig.SessionLength) * time.Second / 2
+	}
+	seconds := int64(limit / time.Second)
+	if seconds <= 0 {
+		return 0, false
+	}
+	ttl := int64(config.TConfig.UserCacheTTL)
+	if ttl == 0 {
+		// 为 0 时使用缓存适配器的默认有效期，同样不能超过 session 的剩余有效期
+		ttl = cache.DefaultTTL()
+	}
+	if ttl == -1 || ttl > seconds {
+		return seconds, true
+	}
+	if ttl < 1 {
+		return 0, false
+	}
+	return ttl, true
+}
+
+// refreshSession 重新设置 session 的过期时间
+func refreshSession(objectID string) {
+	if objectID == "" {
+		return
+	}
+	update := types.M{
+		"expiresAt": types.M{
+			"__type": "Date",
+			"iso":    utils.TimetoString(config.GenerateSessionExpiresAt()),
+		},
+	}
+	orm.TomatoDBController.Update("_Session", types.M{"objectId": objectID}, update, types.M{}, false)
+}
+
+// DestroyExpiredSessions 删除所有已过期的 session
+func DestroyExpiredSessions() error {
+	where := types.M{
+		"expiresAt": types.M{
+			"$lt": types.M{
+				"__type": "Date",
+				"iso":    utils.TimetoString(time.Now().UTC()),
+			},
+		},
+	}
+	err := orm.TomatoDBController.Destroy("_Session", where, types.M{})
+	// 没有过期的 session 时不视为失败
+	if errs.GetErrorCode(err) == errs.ObjectNotFound {
+		return nil
+	}
+	return err
+}
+
+// DestroySession 删除 sessionToken 对应的 session 并返回被删除的 session ，删除时会同时清除缓存，使 token 立即失效
+func DestroySession(sessionToken string, clientSDK map[string]string) (types.M, error) {
+	where := types.M{
+		"sessionToken": sessionToken,
+	}
+	response, err := Find(Master(), "_Session", where, types.M{}, clientSDK)
+	if err != nil {
+		return nil, err
+	}
+	if utils.HasResults(response) == false {
+		return nil, errs.E(errs.InvalidSessionToken, "Session token not found.")
+	}
+	results := utils.A(response["results"])
+	session := utils.M(results[0])
+	err = Delete(Master(), "_Session", utils.S(session["objectId"]))
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// StartSessionCleanup 按 SessionCleanupInterval 定期删除已过期的 session ，间隔为 0 时不启动
+func StartSessionCleanup() {
+	interval := time.Duration(config.TConfig.SessionCleanupInterval) * time.Second
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := DestroyExpiredSessions(); err != nil {
+				logger.Error("destroy expired sessions failed:", err)
+			}
+		}
+	}()
+}
+
 // GetAuthForLegacySessionToken 处理保存在 _User 中的 sessionToken。
 // 该方法处理从 parse 中迁移过来的用户数据，在 tomato 中其实不需要处理这种类型的数据，以后考虑删除
 func GetAuthForLegacySessionToken(sessionToken, installationID string) (*Auth, error) {
@@ -107,6 +244,7 @@ func GetAuthForLegacySessionToken(sessionToken, installationID string) (*Auth, e
 	if err != nil {
 		return nil, err
 	}
+	query.skipAfterFind = true
 	response, err := query.Execute()
 	if err != nil {
 		return nil, err
@@ -123,6 +261,7 @@ func GetAuthForLegacySessionToken(sessionToken, installationID string) (*Auth, e
 	if userObject == nil {
 		return nil, sessionErr
 	}
+	delete(userObject, "password")
 	userObject["className"] = "_User"
 	return &Auth{
 		IsMaster:       false,
@@ -159,11 +298,10 @@ func (a *Auth) GetUserRoles() []string {
 
 // loadRoles 从数据库加载用户角色列表
 func (a *Auth) loadRoles() []string {
-	cachedRoles := cache.Role.Get(utils.S(a.User["objectId"]))
-	if cachedRoles != nil {
+	if cachedRoles := getCachedRoles(utils.S(a.User["objectId"])); cachedRoles != nil {
 		a.FetchedRoles = true
-		a.UserRoles = cachedRoles.([]string)
-		return cachedRoles.([]string)
+		a.UserRoles = cachedRoles
+		return cachedRoles
 	}
 
 	users := types.M{
@@ -181,16 +319,17 @@ func (a *Auth) loadRoles() []string {
 		a.UserRoles = []string{}
 		a.FetchedRoles = true
 		a.RolePromise = nil
-		cache.Role.Put(utils.S(a.User["objectId"]), a.UserRoles, 0)
+		putCachedRoles(utils.S(a.User["objectId"]), a.UserRoles)
 		return a.UserRoles
 	}
+	query.skipAfterFind = true
 
 	response, err := query.Execute()
 	if err != nil || utils.HasResults(response) == false {
 		a.UserRoles = []string{}
 		a.FetchedRoles = true
 		a.RolePromise = nil
-		cache.Role.Put(utils.S(a.User["objectId"]), a.UserRoles, 0)
+		putCachedRoles(utils.S(a.User["objectId"]), a.UserRoles)
 		return a.UserRoles
 	}
 
@@ -209,19 +348,62 @@ func (a *Auth) loadRoles() []string {
 	queriedRoles := map[string]bool{} // 记录查询过的 role ，避免多次查询
 	roleNames := a.getAllRolesNamesForRoleIds(ids, names, queriedRoles)
 
+	// 同一个角色可能通过多条路径被继承，需要去重
 	a.UserRoles = []string{}
+	added := map[string]bool{}
 	for _, v := range roleNames {
+		if added[v] {
+			continue
+		}
+		added[v] = true
 		a.UserRoles = append(a.UserRoles, "role:"+v)
 	}
 	a.FetchedRoles = true
 	a.RolePromise = nil
 
-	cache.Role.Put(utils.S(a.User["objectId"]), a.UserRoles, 0)
+	putCachedRoles(utils.S(a.User["objectId"]), a.UserRoles)
 	return a.UserRoles
 }
 
+// getCachedRoles 从缓存中获取用户角色列表，未开启角色缓存时返回 nil
+func getCachedRoles(userID string) []string {
+	if config.TConfig.EnableRoleCache == false {
+		return nil
+	}
+	switch roles := cache.Role.Get(userID).(type) {
+	case []string:
+		return roles
+	case []interface{}:
+		// Redis 缓存中取出的是 JSON 解析后的数组
+		result := []string{}
+		for _, v := range roles {
+			if s, ok := v.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+// putCachedRoles 缓存用户角色列表
+func putCachedRoles(userID string, roles []string) {
+	if config.TConfig.EnableRoleCache == false {
+		return
+	}
+	cache.Role.Put(userID, roles, int64(config.TConfig.RoleCacheTTL))
+}
+
+// maxRoleDepth 角色继承的最大层数，防止角色层级过深时无限查询
+const maxRoleDepth = 20
+
 // getAllRolesNamesForRoleIds 取出角色 id 对应的父角色
 func (a *Auth) getAllRolesNamesForRoleIds(roleIDs, names []string, queriedRoles map[string]bool) []string {
+	return a.getRolesNamesForRoleIds(roleIDs, names, queriedRoles, 0)
+}
+
+// getRolesNamesForRoleIds 逐层查找父角色，depth 为当前层数
+func (a *Auth) getRolesNamesForRoleIds(roleIDs, names []string, queriedRoles map[string]bool, depth int) []string {
 	if names == nil {
 		names = []string{}
 	}
@@ -243,8 +425,8 @@ func (a *Auth) getAllRolesNamesForRoleIds(roleIDs, names []string, queriedRoles
 		ins = append(ins, object)
 	}
 
-	// 已经没有待获取父角色的 roleID，返回 names
-	if len(ins) == 0 {
+	// 已经没有待获取父角色的 roleID，或者超过最大层数时，返回 names
+	if len(ins) == 0 || depth >= maxRoleDepth {
 		return names
 	}
 
@@ -259,6 +441,7 @@ func (a *Auth) getAllRolesNamesForRoleIds(roleIDs, names []string, queriedRoles
 	if err != nil {
 		return names
 	}
+	query.skipAfterFind = true
 
 	// 未找到角色
 	response, err := query.Execute()
@@ -282,5 +465,5 @@ func (a *Auth) getAllRolesNamesForRoleIds(roleIDs, names []string, queriedRoles
 	names = append(names, pnames...)
 
 	// 继续查找最新角色的父角色
-	return a.getAllRolesNamesForRoleIds(ids, names, queriedRoles)
+	return a.getRolesNamesForRoleIds(ids, names, queriedRoles, depth+1)
 }
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/lfq7413/tomato/cache"
+	"github.com/lfq7413/tomato/config"
 	"github.com/lfq7413/tomato/errs"
 	"github.com/lfq7413/tomato/orm"
 	"github.com/lfq7413/tomato/types"
@@ -222,6 +223,245 @@ func Test_GetAuthForSessionToken(t *testing.T) {
 		t.Error("expect:", expect, "result:", result, err)
 	}
 	orm.TomatoDBController.DeleteEverything()
+	/********************************************************/
+	cache.InitCache()
+	initEnv()
+	className = "_User"
+	schema = types.M{
+		"fields": types.M{
+			"username":     types.M{"type": "String"},
+			"password":     types.M{"type": "String"},
+			"sessionToken": types.M{"type": "String"},
+		},
+	}
+	orm.Adapter.CreateClass(className, schema)
+	object = types.M{
+		"objectId":     "1001",
+		"username":     "joe",
+		"password":     "123",
+		"sessionToken": "legacy1001",
+	}
+	orm.Adapter.CreateObject(className, schema, object)
+	sessionToken = "legacy1001"
+	installationID = "111"
+	result, err = GetAuthForSessionToken(sessionToken, installationID)
+	if err != nil || result == nil || result.User["objectId"] != "1001" || result.User["password"] != nil {
+		t.Error("expect:", "1001", "result:", result, err)
+	}
+	_, err = GetAuthForSessionToken("r:"+sessionToken, installationID)
+	expectErr = errs.E(errs.InvalidSessionToken, "invalid session token")
+	if err == nil || reflect.DeepEqual(expectErr, err) == false {
+		t.Error("expect:", expectErr, "result:", err)
+	}
+	orm.TomatoDBController.DeleteEverything()
+}
+
+func Test_isSessionExpired(t *testing.T) {
+	now := time.Now().UTC()
+	var session types.M
+	var expiresAt time.Time
+	var ok bool
+	/********************************************************/
+	session = types.M{
+		"expiresAt": types.M{
+			"__type": "Date",
+			"iso":    utils.TimetoString(now.Add(-time.Second)),
+		},
+	}
+	expiresAt, ok = sessionExpiresAt(session)
+	if ok == false || isSessionExpired(expiresAt, now) == false {
+		t.Error("expect:", "expired", "result:", expiresAt, ok)
+	}
+	/********************************************************/
+	session = types.M{
+		"expiresAt": types.M{
+			"__type": "Date",
+			"iso":    utils.TimetoString(now.Add(time.Second)),
+		},
+	}
+	expiresAt, ok = sessionExpiresAt(session)
+	if ok == false || isSessionExpired(expiresAt, now) == true {
+		t.Error("expect:", "not expired", "result:", expiresAt, ok)
+	}
+	/********************************************************/
+	session = types.M{}
+	_, ok = sessionExpiresAt(session)
+	if ok == true {
+		t.Error("expect:", false, "result:", ok)
+	}
+}
+
+func Test_shouldRefreshSession(t *testing.T) {
+	now := time.Now().UTC()
+	sessionLength := config.TConfig.SessionLength
+	config.TConfig.SessionLength = 3600
+	defer func() { config.TConfig.SessionLength = sessionLength }()
+	if shouldRefreshSession(now.Add(59*time.Minute), now) == true {
+		t.Error("expect:", false, "result:", true)
+	}
+	if shouldRefreshSession(now.Add(29*time.Minute), now) == false {
+		t.Error("expect:", true, "result:", false)
+	}
+}
+
+func Test_userCacheTTL(t *testing.T) {
+	now := time.Now().UTC()
+	sessionLength := config.TConfig.SessionLength
+	expireInactiveSessions := config.TConfig.ExpireInactiveSessions
+	cacheTTL := config.TConfig.UserCacheTTL
+	defer func() {
+		config.TConfig.SessionLength = sessionLength
+		config.TConfig.ExpireInactiveSessions = expireInactiveSessions
+		config.TConfig.UserCacheTTL = cacheTTL
+	}()
+	var ttl int64
+	var ok bool
+	/********************************************************/
+	config.TConfig.SessionLength = 3600
+	config.TConfig.ExpireInactiveSessions = false
+	config.TConfig.UserCacheTTL = 0
+	ttl, ok = userCacheTTL(now.Add(time.Hour), now)
+	if ok == false || ttl != cache.DefaultTTL() {
+		t.Error("expect:", cache.DefaultTTL(), true, "result:", ttl, ok)
+	}
+	ttl, ok = userCacheTTL(now.Add(2*time.Second), now)
+	if ok == false || ttl != 2 {
+		t.Error("expect:", 2, true, "result:", ttl, ok)
+	}
+	_, ok = userCacheTTL(now.Add(500*time.Millisecond), now)
+	if ok == true {
+		t.Error("expect:", false, "result:", ok)
+	}
+	/********************************************************/
+	config.TConfig.UserCacheTTL = 60
+	ttl, ok = userCacheTTL(now.Add(time.Hour), now)
+	if ok == false || ttl != 60 {
+		t.Error("expect:", 60, true, "result:", ttl, ok)
+	}
+	ttl, ok = userCacheTTL(now.Add(30*time.Second), now)
+	if ok == false || ttl != 30 {
+		t.Error("expect:", 30, true, "result:", ttl, ok)
+	}
+	/********************************************************/
+	config.TConfig.UserCacheTTL = -1
+	ttl, ok = userCacheTTL(now.Add(time.Hour), now)
+	if ok == false || ttl != 3600 {
+		t.Error("expect:", 3600, true, "result:", ttl, ok)
+	}
+	/********************************************************/
+	config.TConfig.ExpireInactiveSessions = true
+	ttl, ok = userCacheTTL(now.Add(time.Hour), now)
+	if ok == false || ttl != 1800 {
+		t.Error("expect:", 1800, true, "result:", ttl, ok)
+	}
+	_, ok = userCacheTTL(now.Add(20*time.Minute), now)
+	if ok == true {
+		t.Error("expect:", false, "result:", ok)
+	}
+}
+
+func Test_DestroyExpiredSessions(t *testing.T) {
+	var schema, object types.M
+	var className string
+	var results []types.M
+	var err error
+	/********************************************************/
+	initEnv()
+	className = "_Session"
+	schema = types.M{
+		"fields": types.M{
+			"sessionToken": types.M{"type": "String"},
+			"expiresAt":    types.M{"type": "Date"},
+		},
+	}
+	orm.Adapter.CreateClass(className, schema)
+	object = types.M{
+		"objectId":     "2001",
+		"sessionToken": "abc2001",
+		"expiresAt":    utils.TimetoString(time.Now().UTC().Add(-time.Hour)),
+	}
+	orm.Adapter.CreateObject(className, schema, object)
+	object = types.M{
+		"objectId":     "2002",
+		"sessionToken": "abc2002",
+		"expiresAt":    utils.TimetoString(time.Now().UTC().Add(time.Hour)),
+	}
+	orm.Adapter.CreateObject(className, schema, object)
+	err = DestroyExpiredSessions()
+	if err != nil {
+		t.Error("expect:", nil, "result:", err)
+	}
+	results, err = orm.Adapter.Find(className, schema, types.M{}, types.M{})
+	if err != nil || len(results) != 1 || results[0]["objectId"] != "2002" {
+		t.Error("expect:", "2002", "result:", results, err)
+	}
+	/********************************************************/
+	err = DestroyExpiredSessions()
+	if err != nil {
+		t.Error("expect:", nil, "result:", err)
+	}
+	orm.TomatoDBController.DeleteEverything()
+	/********************************************************/
+	// 没有过期的 session
+	initEnv()
+	orm.Adapter.CreateClass(className, schema)
+	object = types.M{
+		"objectId":     "2003",
+		"sessionToken": "abc2003",
+		"expiresAt":    utils.TimetoString(time.Now().UTC().Add(time.Hour)),
+	}
+	orm.Adapter.CreateObject(className, schema, object)
+	err = DestroyExpiredSessions()
+	if err != nil {
+		t.Error("expect:", nil, "result:", err)
+	}
+	results, err = orm.Adapter.Find(className, schema, types.M{}, types.M{})
+	if err != nil || len(results) != 1 || results[0]["objectId"] != "2003" {
+		t.Error("expect:", "2003", "result:", results, err)
+	}
+	orm.TomatoDBController.DeleteEverything()
+}
+
+func Test_DestroySession(t *testing.T) {
+	var schema, object, session types.M
+	var className string
+	var results []types.M
+	var err error
+	var expect error
+	/********************************************************/
+	initEnv()
+	cache.InitCache()
+	className = "_Session"
+	schema = types.M{
+		"fields": types.M{
+			"sessionToken": types.M{"type": "String"},
+		},
+	}
+	orm.Adapter.CreateClass(className, schema)
+	object = types.M{
+		"objectId":     "2001",
+		"sessionToken": "abc2001",
+	}
+	orm.Adapter.CreateObject(className, schema, object)
+	cache.User.Put("abc2001", types.M{"objectId": "1001"}, 0)
+	session, err = DestroySession("abc2001", nil)
+	if err != nil || session == nil || session["objectId"] != "2001" {
+		t.Error("expect:", "2001", "result:", session, err)
+	}
+	results, err = orm.Adapter.Find(className, schema, types.M{}, types.M{})
+	if err != nil || len(results) != 0 {
+		t.Error("expect:", 0, "result:", results, err)
+	}
+	if cache.User.Get("abc2001") != nil {
+		t.Error("expect:", nil, "result:", cache.User.Get("abc2001"))
+	}
+	/********************************************************/
+	_, err = DestroySession("abc2001", nil)
+	expect = errs.E(errs.InvalidSessionToken, "Session token not found.")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	orm.TomatoDBController.DeleteEverything()
 }
 
 func Test_CouldUpdateUserID(t *testing.T) {
@@ -512,6 +752,17 @@ func Test_loadRoles(t *testing.T) {
 	orm.TomatoDBController.DeleteEverything()
 }
 
+func Test_getRolesNamesForRoleIds(t *testing.T) {
+	// 超过最大层数时不再查询父角色
+	names := []string{"admin"}
+	queriedRoles := map[string]bool{}
+	result := Master().getRolesNamesForRoleIds([]string{"1001"}, names, queriedRoles, maxRoleDepth)
+	expect := []string{"admin"}
+	if reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "result:", result)
+	}
+}
+
 func Test_getAllRolesNamesForRoleIds(t *testing.T) {
 	var schema types.M
 	var object types.M
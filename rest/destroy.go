@@ -33,38 +33,52 @@ func NewDestroy(
 	return destroy
 }
 
-// Execute 执行删除请求
-func (d *Destroy) Execute() error {
+// Execute 执行删除请求，删前回调返回错误时中止删除
+func (d *Destroy) Execute() (types.M, error) {
 	err := d.handleSession()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	err = d.runBeforeTrigger()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	err = d.handleUserRoles()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	err = d.runDestroy()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	err = d.runAfterTrigger()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	return types.M{}, nil
 }
 
-// handleSession 处理 _Session 表的删除操作
+// handleSession 处理 _Session 表的删除操作，清除被删除 session 对应的用户缓存
+// 没有原始数据时，按删除条件查找所有将被删除的 session
 func (d *Destroy) handleSession() error {
 	if d.className != "_Session" {
 		return nil
 	}
 	if sessionToken := utils.S(d.originalData["sessionToken"]); sessionToken != "" {
 		cache.User.Del(sessionToken)
+		return nil
+	}
+
+	sessions, err := orm.TomatoDBController.Find("_Session", d.query, types.M{})
+	if err != nil {
+		return err
+	}
+	for _, v := range sessions {
+		if session := utils.M(v); session != nil {
+			if sessionToken := utils.S(session["sessionToken"]); sessionToken != "" {
+				cache.User.Del(sessionToken)
+			}
+		}
 	}
 
 	return nil
@@ -75,14 +89,11 @@ func (d *Destroy) runBeforeTrigger() error {
 	if d.originalData == nil {
 		return nil
 	}
-	if livequery.TLiveQuery != nil {
-		livequery.TLiveQuery.OnAfterDelete(d.className, d.originalData, nil)
-	}
 
 	d.originalData["className"] = d.className
-	maybeRunTrigger(cloud.TypeBeforeDelete, d.auth, d.originalData, nil)
+	_, err := maybeRunTrigger(cloud.TypeBeforeDelete, d.auth, d.originalData, nil, nil)
 
-	return nil
+	return err
 }
 
 // handleUserRoles 获取用户角色信息
@@ -108,8 +119,18 @@ func (d *Destroy) runDestroy() error {
 	return orm.TomatoDBController.Destroy(d.className, d.query, options)
 }
 
-// runAfterTrigger 执行删后回调
+// runAfterTrigger 执行删后回调，删后回调的错误不影响删除结果
 func (d *Destroy) runAfterTrigger() error {
-	maybeRunTrigger(cloud.TypeAfterDelete, d.auth, d.originalData, nil)
+	// 删除角色后，无法直接确定受影响的用户，清除全部角色缓存
+	if d.className == "_Role" {
+		cache.Role.Clear()
+	}
+	if d.originalData == nil {
+		return nil
+	}
+	if livequery.TLiveQuery != nil {
+		livequery.TLiveQuery.OnAfterDelete(d.className, d.originalData, nil)
+	}
+	maybeRunTrigger(cloud.TypeAfterDelete, d.auth, d.originalData, nil, nil)
 	return nil
 }
@@ -38,7 +38,7 @@ func TestPostgres_Destroy(t *testing.T) {
 	query = types.M{"objectId": "1001"}
 	originalData = types.M{"username": "joe"}
 	d = NewDestroy(auth, className, query, originalData)
-	err = d.Execute()
+	_, err = d.Execute()
 	if err != nil {
 		t.Error("expect:", nil, "result:", err)
 	}
@@ -73,7 +73,7 @@ func TestPostgres_Destroy(t *testing.T) {
 	query = types.M{"objectId": "1001"}
 	originalData = types.M{"username": "joe"}
 	d = NewDestroy(auth, className, query, originalData)
-	err = d.Execute()
+	_, err = d.Execute()
 	if err != nil {
 		t.Error("expect:", nil, "result:", err)
 	}
@@ -113,7 +113,7 @@ func TestPostgres_Destroy(t *testing.T) {
 	query = types.M{"objectId": "1003"}
 	originalData = types.M{"username": "joe"}
 	d = NewDestroy(auth, className, query, originalData)
-	err = d.Execute()
+	_, err = d.Execute()
 	expectErr = errs.E(errs.ObjectNotFound, "Object not found.")
 	if err == nil || reflect.DeepEqual(expectErr, err) == false {
 		t.Error("expect:", expectErr, "result:", err)
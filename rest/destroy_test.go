@@ -3,10 +3,14 @@ package rest
 import (
 	"reflect"
 	"testing"
+	"time"
 
+	"github.com/lfq7413/tomato/cache"
+	"github.com/lfq7413/tomato/cloud"
 	"github.com/lfq7413/tomato/errs"
 	"github.com/lfq7413/tomato/orm"
 	"github.com/lfq7413/tomato/types"
+	"github.com/lfq7413/tomato/utils"
 )
 
 func Test_Destroy(t *testing.T) {
@@ -37,7 +41,7 @@ func Test_Destroy(t *testing.T) {
 	query = types.M{"objectId": "1001"}
 	originalData = types.M{"username": "joe"}
 	d = NewDestroy(auth, className, query, originalData)
-	err = d.Execute()
+	_, err = d.Execute()
 	if err != nil {
 		t.Error("expect:", nil, "result:", err)
 	}
@@ -71,7 +75,7 @@ func Test_Destroy(t *testing.T) {
 	query = types.M{"objectId": "1001"}
 	originalData = types.M{"username": "joe"}
 	d = NewDestroy(auth, className, query, originalData)
-	err = d.Execute()
+	_, err = d.Execute()
 	if err != nil {
 		t.Error("expect:", nil, "result:", err)
 	}
@@ -110,7 +114,7 @@ func Test_Destroy(t *testing.T) {
 	query = types.M{"objectId": "1003"}
 	originalData = types.M{"username": "joe"}
 	d = NewDestroy(auth, className, query, originalData)
-	err = d.Execute()
+	_, err = d.Execute()
 	expectErr = errs.E(errs.ObjectNotFound, "Object not found.")
 	if err == nil || reflect.DeepEqual(expectErr, err) == false {
 		t.Error("expect:", expectErr, "result:", err)
@@ -130,4 +134,102 @@ func Test_Destroy(t *testing.T) {
 		t.Error("expect:", expect, "result:", results)
 	}
 	orm.TomatoDBController.DeleteEverything()
+	/*****************************************************/
+	initEnv()
+	className = "user"
+	schema = types.M{
+		"fields": types.M{
+			"username": types.M{"type": "String"},
+		},
+	}
+	orm.Adapter.CreateClass(className, schema)
+	object = types.M{
+		"objectId": "1001",
+		"username": "joe",
+	}
+	orm.Adapter.CreateObject(className, schema, object)
+	cloud.BeforeDelete(className, func(request cloud.TriggerRequest, response cloud.Response) {
+		response.Error(0, "can not delete")
+	})
+	auth = Master()
+	className = "user"
+	query = types.M{"objectId": "1001"}
+	originalData = types.M{"objectId": "1001", "username": "joe"}
+	d = NewDestroy(auth, className, query, originalData)
+	_, err = d.Execute()
+	expectErr = errs.E(errs.ScriptFailed, "can not delete")
+	if reflect.DeepEqual(expectErr, err) == false {
+		t.Error("expect:", expectErr, "result:", err)
+	}
+	results, _ = orm.TomatoDBController.Find(className, types.M{}, types.M{})
+	expect = types.S{
+		types.M{
+			"objectId": "1001",
+			"username": "joe",
+		},
+	}
+	if reflect.DeepEqual(expect, results) == false {
+		t.Error("expect:", expect, "result:", results)
+	}
+	cloud.UnregisterAll()
+	orm.TomatoDBController.DeleteEverything()
+}
+
+func Test_Destroy_handleSession(t *testing.T) {
+	var schema, object types.M
+	var className string
+	var d *Destroy
+	var err, expectErr error
+	/*****************************************************/
+	cache.InitCache()
+	initEnv()
+	className = "_User"
+	schema = types.M{
+		"fields": types.M{
+			"username": types.M{"type": "String"},
+			"password": types.M{"type": "String"},
+		},
+	}
+	orm.Adapter.CreateClass(className, schema)
+	object = types.M{
+		"objectId": "1001",
+		"username": "joe",
+		"password": "123",
+	}
+	orm.Adapter.CreateObject(className, schema, object)
+	className = "_Session"
+	schema = types.M{
+		"fields": types.M{
+			"user":         types.M{"type": "Pointer", "targetClass": "_User"},
+			"sessionToken": types.M{"type": "String"},
+			"expiresAt":    types.M{"type": "Date"},
+		},
+	}
+	orm.Adapter.CreateClass(className, schema)
+	object = types.M{
+		"objectId": "2001",
+		"user": types.M{
+			"__type":    "Pointer",
+			"className": "_User",
+			"objectId":  "1001",
+		},
+		"sessionToken": "abc1001",
+		"expiresAt":    utils.TimetoString(time.Now().UTC().Add(time.Hour)),
+	}
+	orm.Adapter.CreateObject(className, schema, object)
+	_, err = GetAuthForSessionToken("abc1001", "")
+	if err != nil {
+		t.Error("expect:", nil, "result:", err)
+	}
+	d = NewDestroy(Master(), "_Session", types.M{"objectId": "2001"}, nil)
+	_, err = d.Execute()
+	if err != nil {
+		t.Error("expect:", nil, "result:", err)
+	}
+	_, err = GetAuthForSessionToken("abc1001", "")
+	expectErr = errs.E(errs.InvalidSessionToken, "invalid session token")
+	if reflect.DeepEqual(expectErr, err) == false {
+		t.Error("expect:", expectErr, "result:", err)
+	}
+	orm.TomatoDBController.DeleteEverything()
 }
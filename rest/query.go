@@ -1,6 +1,7 @@
 package rest
 
 import (
+	"fmt"
 	"sort"
 	"strings"
 
@@ -24,9 +25,14 @@ type Query struct {
 	doCount           bool
 	include           [][]string
 	keys              []string
+	excludeKeys       []string
 	redirectKey       string
 	redirectClassName string
 	clientSDK         map[string]string
+
+	subqueryReadPreference string
+	// skipAfterFind 为 true 时不执行 afterFind 回调，用于内部的系统查询
+	skipAfterFind bool
 }
 
 var alwaysSelectedKeys = []string{"objectId", "createdAt", "updatedAt"}
@@ -85,17 +91,56 @@ func NewQuery(
 	}
 
 	keys := []string{}
+	// keys 中以 - 开头的字段表示排除该字段，其余字段照常返回，objectId 总是返回
+	minusKeys := []string{}
 	if k, ok := options["keys"]; ok {
 		if s, ok := k.(string); ok {
 			keys = strings.Split(s, ",")
 			for i, key := range keys {
 				keys[i] = strings.TrimSpace(key)
 			}
+			var err error
+			keys, minusKeys, err = splitMinusKeys(keys)
+			if err != nil {
+				return nil, err
+			}
 		}
 		// 在 includePath 中 会使用 restOptions["keys"] ，所以需要设置过滤后的数据
 		options["keys"] = strings.Join(keys, ",")
 	}
 
+	// excludeKeys 参数中的字段不会返回，其中 objectId createdAt updatedAt 不允许排除
+	// excludeKeys 可以是逗号分隔的字符串，也可以是字符串数组
+	excludeKeys := minusKeys
+	if k, ok := options["excludeKeys"]; ok {
+		rawKeys := []string{}
+		if s, ok := k.(string); ok {
+			rawKeys = strings.Split(s, ",")
+		} else if a := utils.A(k); a != nil {
+			for _, v := range a {
+				s, ok := v.(string)
+				if ok == false {
+					return nil, errs.E(errs.InvalidQuery, "excludeKeys must be a string or an array of strings")
+				}
+				rawKeys = append(rawKeys, s)
+			}
+		} else {
+			return nil, errs.E(errs.InvalidQuery, "excludeKeys must be a string or an array of strings")
+		}
+		for _, key := range rawKeys {
+			key = strings.TrimSpace(key)
+			if key == "" || key == "objectId" || key == "createdAt" || key == "updatedAt" {
+				continue
+			}
+			for _, k := range keys {
+				if k == key {
+					return nil, errs.E(errs.InvalidQuery, "Cannot both select and exclude key: "+key)
+				}
+			}
+			excludeKeys = append(excludeKeys, key)
+		}
+	}
+
 	// 当 keys 包含 n 级时，在 include 中自动加入 n-1 级
 	if len(keys) > 0 {
 		includeKeys := []string{}
@@ -116,6 +161,11 @@ func NewQuery(
 		}
 	}
 
+	// 同时指定了 keys 时，只需要按 keys 选取字段
+	if len(keys) == 0 && len(excludeKeys) > 0 {
+		query.excludeKeys = excludeKeys
+	}
+
 	for k, v := range options {
 		switch k {
 		case "keys":
@@ -124,6 +174,14 @@ func NewQuery(
 			}
 		case "count":
 			query.doCount = true
+		case "distinct":
+			query.findOptions["distinct"] = v
+		case "pipeline":
+			query.findOptions["pipeline"] = v
+		case "explain":
+			if b, ok := v.(bool); ok && b {
+				query.findOptions["explain"] = true
+			}
 		case "skip":
 			query.findOptions["skip"] = v
 		case "limit":
@@ -154,6 +212,10 @@ func NewQuery(
 				pathSet := map[string]bool{}
 				for _, path := range paths {
 					parts := strings.Split(path, ".") // parts = ["user","session"]
+					// 每一层都需要一次查询，限制层数避免单个请求展开过深
+					if max := config.TConfig.MaxIncludeDepth; max > 0 && len(parts) > max {
+						return nil, errs.E(errs.InvalidQuery, fmt.Sprintf("include path %s exceeds the max include depth of %d", path, max))
+					}
 					for lenght := 1; lenght <= len(parts); lenght++ {
 						pathSet[strings.Join(parts[0:lenght], ".")] = true
 					} // pathSet = {"user":true,"user.session":true}
@@ -167,6 +229,25 @@ func NewQuery(
 					query.include = append(query.include, strings.Split(set, "."))
 				} // query.include = [["name"],["name","friend"],["user"],["user","seeeion"]]
 			}
+		case "readPreference":
+			readPreference, err := validateReadPreference(v)
+			if err != nil {
+				return nil, err
+			}
+			query.findOptions["readPreference"] = readPreference
+		case "includeReadPreference":
+			// 在 includePath 中使用
+			readPreference, err := validateReadPreference(v)
+			if err != nil {
+				return nil, err
+			}
+			options["includeReadPreference"] = readPreference
+		case "subqueryReadPreference":
+			readPreference, err := validateReadPreference(v)
+			if err != nil {
+				return nil, err
+			}
+			query.subqueryReadPreference = readPreference
 		case "redirectClassNameForKey":
 			if s, ok := v.(string); ok {
 				query.redirectKey = s
@@ -180,6 +261,24 @@ func NewQuery(
 	return query, nil
 }
 
+// readPreferences 允许使用的读偏好
+var readPreferences = map[string]bool{
+	"PRIMARY":             true,
+	"PRIMARY_PREFERRED":   true,
+	"SECONDARY":           true,
+	"SECONDARY_PREFERRED": true,
+	"NEAREST":             true,
+}
+
+// validateReadPreference 校验读偏好，不区分大小写
+func validateReadPreference(v interface{}) (string, error) {
+	readPreference := strings.ToUpper(utils.S(v))
+	if readPreferences[readPreference] == false {
+		return "", errs.E(errs.InvalidQuery, "Invalid read preference: "+utils.S(v))
+	}
+	return readPreference, nil
+}
+
 // Execute 执行查询请求，返回的数据包含 results count 两个字段
 func (q *Query) Execute(executeOptions ...types.M) (types.M, error) {
 
@@ -191,10 +290,17 @@ func (q *Query) Execute(executeOptions ...types.M) (types.M, error) {
 	if err != nil {
 		return nil, err
 	}
+	// explain 只返回查询计划
+	if q.findOptions["explain"] != nil {
+		return q.response, nil
+	}
 	err = q.runCount()
 	if err != nil {
 		return nil, err
 	}
+	if q.findOptions["distinct"] != nil || q.findOptions["pipeline"] != nil {
+		return q.response, nil
+	}
 	err = q.handleInclude()
 	if err != nil {
 		return nil, err
@@ -220,6 +326,10 @@ func (q *Query) BuildRestWhere() error {
 	if err != nil {
 		return err
 	}
+	err = q.denyProtectedFields()
+	if err != nil {
+		return err
+	}
 	err = q.replaceSelect()
 	if err != nil {
 		return err
@@ -291,6 +401,17 @@ func (q *Query) validateClientClassCreation() error {
 	return errs.E(errs.OperationForbidden, "This user is not allowed to access non-existent class: "+q.className)
 }
 
+// denyProtectedFields 非 Master 权限不能在 where 与 order 中使用 protectedFields 中的字段
+func (q *Query) denyProtectedFields() error {
+	if q.auth.IsMaster {
+		return nil
+	}
+	aclGroup, _ := q.findOptions["acl"].([]string)
+	sort, _ := q.findOptions["sort"].([]string)
+	schema := orm.TomatoDBController.LoadSchema(nil)
+	return schema.ValidateProtectedQuery(q.className, aclGroup, q.Where, sort)
+}
+
 // replaceSelect 执行 $select 中的查询语句，把结果放入 $in 中，替换掉 $select
 // 替换前的格式如下：
 // {
@@ -343,6 +464,11 @@ func (q *Query) replaceSelect() error {
 	delete(queryValue, "where")
 	delete(queryValue, "className")
 	additionalOptions := queryValue
+	if q.subqueryReadPreference != "" {
+		additionalOptions["readPreference"] = q.subqueryReadPreference
+	}
+
+	limitSubquery(additionalOptions)
 
 	query, err := NewQuery(q.auth, className, where, additionalOptions, q.clientSDK)
 	if err != nil {
@@ -363,6 +489,9 @@ func (q *Query) replaceSelect() error {
 			values = append(values, result)
 		}
 	}
+	if config.TConfig.SubqueryLimit > 0 && len(values) > config.TConfig.SubqueryLimit {
+		return errs.E(errs.InvalidQuery, fmt.Sprintf("$select subquery returned more than %d results", config.TConfig.SubqueryLimit))
+	}
 	// 替换 $select 为 $in
 	transformSelect(selectObject, key, values)
 	// 继续搜索替换
@@ -400,6 +529,11 @@ func (q *Query) replaceDontSelect() error {
 	delete(queryValue, "where")
 	delete(queryValue, "className")
 	additionalOptions := queryValue
+	if q.subqueryReadPreference != "" {
+		additionalOptions["readPreference"] = q.subqueryReadPreference
+	}
+
+	limitSubquery(additionalOptions)
 
 	query, err := NewQuery(q.auth, className, where, additionalOptions, q.clientSDK)
 	if err != nil {
@@ -420,6 +554,9 @@ func (q *Query) replaceDontSelect() error {
 			values = append(values, result)
 		}
 	}
+	if config.TConfig.SubqueryLimit > 0 && len(values) > config.TConfig.SubqueryLimit {
+		return errs.E(errs.InvalidQuery, fmt.Sprintf("$dontSelect subquery returned more than %d results", config.TConfig.SubqueryLimit))
+	}
 	// 替换 $dontSelect 为 $nin
 	transformDontSelect(dontSelectObject, key, values)
 	// 继续搜索替换
@@ -454,7 +591,7 @@ func (q *Query) replaceDontSelect() error {
 //     }
 // }
 func (q *Query) replaceInQuery() error {
-	inQueryObject := findObjectWithKey(q.Where, "$inQuery")
+	fieldName, inQueryObject := findFieldWithKey(q.Where, "$inQuery")
 	if inQueryObject == nil {
 		return nil
 	}
@@ -468,11 +605,17 @@ func (q *Query) replaceInQuery() error {
 	if where == nil || className == "" {
 		return errs.E(errs.InvalidQuery, "improper usage of $inQuery")
 	}
+	if err := q.validateSubqueryClass(fieldName, className, "$inQuery"); err != nil {
+		return err
+	}
 
 	// where 与 className 之外的字段默认为 Options
 	delete(inQueryValue, "where")
 	delete(inQueryValue, "className")
 	additionalOptions := inQueryValue
+	if q.subqueryReadPreference != "" {
+		additionalOptions["readPreference"] = q.subqueryReadPreference
+	}
 
 	query, err := NewQuery(q.auth, className, where, additionalOptions, q.clientSDK)
 	if err != nil {
@@ -502,7 +645,7 @@ func (q *Query) replaceInQuery() error {
 // replaceNotInQuery 执行 $notInQuery 中的查询语句，把结果放入 $nin 中，替换掉 $notInQuery
 // 数据格式与 replaceInQuery 类似
 func (q *Query) replaceNotInQuery() error {
-	notInQueryObject := findObjectWithKey(q.Where, "$notInQuery")
+	fieldName, notInQueryObject := findFieldWithKey(q.Where, "$notInQuery")
 	if notInQueryObject == nil {
 		return nil
 	}
@@ -516,11 +659,17 @@ func (q *Query) replaceNotInQuery() error {
 	if where == nil || className == "" {
 		return errs.E(errs.InvalidQuery, "improper usage of $notInQuery")
 	}
+	if err := q.validateSubqueryClass(fieldName, className, "$notInQuery"); err != nil {
+		return err
+	}
 
 	// where 与 className 之外的字段默认为 Options
 	delete(notInQueryValue, "where")
 	delete(notInQueryValue, "className")
 	additionalOptions := notInQueryValue
+	if q.subqueryReadPreference != "" {
+		additionalOptions["readPreference"] = q.subqueryReadPreference
+	}
 
 	query, err := NewQuery(q.auth, className, where, additionalOptions, q.clientSDK)
 	if err != nil {
@@ -553,6 +702,34 @@ func (q *Query) replaceEquality() {
 	}
 }
 
+// splitMinusKeys 把 keys 分为选取的字段与以 - 开头的排除字段，两者不能同时出现
+// 排除字段中的 objectId 会被忽略， createdAt 与 updatedAt 可以排除
+func splitMinusKeys(keys []string) ([]string, []string, error) {
+	selectKeys := []string{}
+	minusKeys := []string{}
+	hasSelectKey := false
+	for _, key := range keys {
+		if strings.HasPrefix(key, "-") {
+			key = strings.TrimSpace(key[1:])
+			if key != "" && key != "objectId" {
+				minusKeys = append(minusKeys, key)
+			}
+			continue
+		}
+		if key != "" {
+			hasSelectKey = true
+		}
+		selectKeys = append(selectKeys, key)
+	}
+	if len(minusKeys) == 0 {
+		return selectKeys, minusKeys, nil
+	}
+	if hasSelectKey {
+		return nil, nil, errs.E(errs.InvalidQuery, "Cannot mix included and excluded fields in keys")
+	}
+	return []string{}, minusKeys, nil
+}
+
 // runFind 从数据库查找数据，并处理返回结果
 func (q *Query) runFind(executeOptions ...types.M) error {
 	var options types.M
@@ -562,18 +739,17 @@ func (q *Query) runFind(executeOptions ...types.M) error {
 		options = types.M{}
 	}
 
-	if q.findOptions["limit"] != nil {
-		if l, ok := q.findOptions["limit"].(float64); ok {
-			if l == 0 {
-				q.response["results"] = types.S{}
-				return nil
-			}
-		} else if l, ok := q.findOptions["limit"].(int); ok {
-			if l == 0 {
-				q.response["results"] = types.S{}
-				return nil
-			}
+	// limit 为 0 时不查询对象，仅由 runCount 计算数量，用于只需要 count 的请求
+	// explain 时返回 count 的查询计划
+	if q.findOptions["explain"] != nil {
+		if q.doCount && isZeroLimit(q.findOptions["limit"]) {
+			q.findOptions["count"] = true
+			delete(q.findOptions, "skip")
+			delete(q.findOptions, "limit")
 		}
+	} else if isZeroLimit(q.findOptions["limit"]) {
+		q.response["results"] = types.S{}
+		return nil
 	}
 
 	findOptions := types.M{}
@@ -588,6 +764,9 @@ func (q *Query) runFind(executeOptions ...types.M) error {
 		}
 		findOptions["keys"] = keys
 	}
+	if len(q.excludeKeys) > 0 {
+		findOptions["excludeKeys"] = q.excludeKeys
+	}
 	if v, ok := options["op"].(string); ok && v != "" {
 		findOptions["op"] = v
 	}
@@ -595,6 +774,20 @@ func (q *Query) runFind(executeOptions ...types.M) error {
 	if err != nil {
 		return err
 	}
+	// 聚合查询的结果中可能包含用户对象，同样需要删除敏感字段
+	if findOptions["pipeline"] != nil && q.className == "_User" {
+		for _, v := range response {
+			if user := utils.M(v); user != nil {
+				cleanResultOfSensitiveUserInfo(user, q.auth)
+				cleanResultAuthData(user)
+			}
+		}
+	}
+	// distinct 、聚合查询与 explain 返回的不是原始对象，不需要做后续处理
+	if findOptions["distinct"] != nil || findOptions["pipeline"] != nil || findOptions["explain"] != nil {
+		q.response["results"] = response
+		return nil
+	}
 	// 从 _User 表中删除敏感字段
 	if q.className == "_User" {
 		for _, v := range response {
@@ -620,6 +813,16 @@ func (q *Query) runFind(executeOptions ...types.M) error {
 	return nil
 }
 
+// isZeroLimit 判断 limit 是否为 0
+func isZeroLimit(limit interface{}) bool {
+	if l, ok := limit.(float64); ok {
+		return l == 0
+	} else if l, ok := limit.(int); ok {
+		return l == 0
+	}
+	return false
+}
+
 // runCount 查询符合条件的结果数量
 func (q *Query) runCount() error {
 	if q.doCount == false {
@@ -646,8 +849,16 @@ func (q *Query) handleInclude() error {
 	if len(q.include) == 0 {
 		return nil
 	}
+	restOptions := q.restOptions
+	if q.skipAfterFind {
+		restOptions = types.M{}
+		for k, v := range q.restOptions {
+			restOptions[k] = v
+		}
+		restOptions["skipAfterFind"] = true
+	}
 	// includePath 中会直接更新 q.response
-	err := includePath(q.auth, q.response, q.include[0], q.restOptions)
+	err := includePath(q.auth, q.response, q.include[0], restOptions)
 	if err != nil {
 		return err
 	}
@@ -665,6 +876,9 @@ func (q *Query) runAfterFindTrigger() error {
 	if q.response == nil {
 		return nil
 	}
+	if q.skipAfterFind {
+		return nil
+	}
 	results := utils.A(q.response["results"])
 	hasAfterFindHook := cloud.TriggerExists(cloud.TypeAfterFind, q.className)
 	if hasAfterFindHook == false {
@@ -693,20 +907,17 @@ func includePath(auth *Auth, response types.M, path []string, restOptions types.
 	if len(pointers) == 0 {
 		return nil
 	}
+	// 按 className 分组，每个类只查询一次，重复的 objectId 只查询一次
 	pointersHash := map[string]types.S{}
+	pointersSeen := map[string]bool{}
 	for _, pointer := range pointers {
-		// 不再区分不同 className ，添加不为空的 className
 		className := utils.S(pointer["className"])
 		objectID := utils.S(pointer["objectId"])
-		if className != "" && objectID != "" {
-			if v, ok := pointersHash[className]; ok {
-				v = append(v, objectID)
-				pointersHash[className] = v
-			} else {
-				pointersHash[className] = types.S{objectID}
-			}
+		if className == "" || objectID == "" || pointersSeen[className+":"+objectID] {
+			continue
 		}
-
+		pointersSeen[className+":"+objectID] = true
+		pointersHash[className] = append(pointersHash[className], objectID)
 	}
 
 	// example1:
@@ -747,6 +958,10 @@ func includePath(auth *Auth, response types.M, path []string, restOptions types.
 		}
 	}
 
+	if readPreference, ok := restOptions["includeReadPreference"]; ok {
+		includeRestOptions["readPreference"] = readPreference
+	}
+
 	replace := types.M{}
 	for clsName, ids := range pointersHash {
 		// 获取所有 ids 对应的对象
@@ -760,12 +975,16 @@ func includePath(auth *Auth, response types.M, path []string, restOptions types.
 		if err != nil {
 			return err
 		}
+		if skip, ok := restOptions["skipAfterFind"].(bool); ok {
+			query.skipAfterFind = skip
+		}
 		includeResponse, err := query.Execute(types.M{"op": "get"})
 		if err != nil {
 			return err
 		}
+		// 没有查询到的对象（不存在或者没有权限）保留为 Pointer
 		if utils.HasResults(includeResponse) == false {
-			return nil
+			continue
 		}
 
 		// 组装查询到的对象
@@ -849,6 +1068,54 @@ func replacePointers(pointers []types.M, replace types.M) {
 	}
 }
 
+// findFieldWithKey 与 findObjectWithKey 类似，同时返回该对象所在的字段名
+// 查询条件的根节点即包含指定 key 时，字段名为空
+func findFieldWithKey(root interface{}, key string) (string, types.M) {
+	if root == nil {
+		return "", nil
+	}
+	if s := utils.A(root); s != nil {
+		for _, v := range s {
+			field, answer := findFieldWithKey(v, key)
+			if answer != nil {
+				return field, answer
+			}
+		}
+	}
+
+	if m := utils.M(root); m != nil {
+		if m[key] != nil {
+			return "", m
+		}
+		for k, v := range m {
+			if object := utils.M(v); object != nil && object[key] != nil {
+				return k, object
+			}
+			field, answer := findFieldWithKey(v, key)
+			if answer != nil {
+				return field, answer
+			}
+		}
+	}
+	return "", nil
+}
+
+// validateSubqueryClass 子查询的 className 必须与 Pointer 字段的 targetClass 一致
+func (q *Query) validateSubqueryClass(fieldName, className, op string) error {
+	if fieldName == "" {
+		return nil
+	}
+	schema := orm.TomatoDBController.LoadSchema(nil)
+	expectedType := schema.GetExpectedType(q.className, fieldName)
+	if expectedType == nil || utils.S(expectedType["type"]) != "Pointer" {
+		return nil
+	}
+	if targetClass := utils.S(expectedType["targetClass"]); targetClass != className {
+		return errs.E(errs.InvalidQuery, op+" className "+className+" does not match the targetClass "+targetClass+" of "+fieldName)
+	}
+	return nil
+}
+
 // findObjectWithKey 查找带有指定 key 的对象，root 可以是 Slice 或者 map
 // 查找到一个符合条件的对象之后立即返回
 func findObjectWithKey(root interface{}, key string) types.M {
@@ -881,6 +1148,20 @@ func findObjectWithKey(root interface{}, key string) types.M {
 	return nil
 }
 
+// limitSubquery 限制子查询的结果数量，未指定 limit 或者 limit 超过上限时，多取一条用于判断是否超限
+func limitSubquery(options types.M) {
+	max := config.TConfig.SubqueryLimit
+	if max <= 0 {
+		return
+	}
+	if l, ok := options["limit"].(float64); ok && l >= 0 && int(l) <= max {
+		return
+	} else if l, ok := options["limit"].(int); ok && l >= 0 && l <= max {
+		return
+	}
+	options["limit"] = max + 1
+}
+
 // transformSelect 转换对象中的 $select
 func transformSelect(selectObject types.M, key string, objects []types.M) {
 	if selectObject == nil || selectObject["$select"] == nil {
@@ -190,6 +190,91 @@ func Test_Execute(t *testing.T) {
 		t.Error("expect:", expect, "result:", result)
 	}
 	orm.TomatoDBController.DeleteEverything()
+	/**********************************************************/
+	initEnv()
+	className = "user"
+	object = types.M{
+		"fields": types.M{
+			"key": types.M{"type": "String"},
+		},
+	}
+	orm.Adapter.CreateClass(className, object)
+	object = types.M{
+		"objectId": "01",
+		"key":      "hello",
+	}
+	orm.Adapter.CreateObject(className, types.M{}, object)
+	object = types.M{
+		"objectId": "02",
+		"key":      "hello",
+	}
+	orm.Adapter.CreateObject(className, types.M{}, object)
+	object = types.M{
+		"objectId": "03",
+		"key":      "world",
+	}
+	orm.Adapter.CreateObject(className, types.M{}, object)
+	className = "user"
+	where = types.M{"key": "hello"}
+	options = types.M{"count": true, "limit": 0}
+	q, _ = NewQuery(Nobody(), className, where, options, nil)
+	result, err = q.Execute()
+	expect = types.M{
+		"results": types.S{},
+		"count":   2,
+	}
+	if err != nil || reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "result:", result)
+	}
+	orm.TomatoDBController.DeleteEverything()
+	/**********************************************************/
+	initEnv()
+	className = "user"
+	object = types.M{
+		"fields": types.M{
+			"key":  types.M{"type": "String"},
+			"blob": types.M{"type": "Object"},
+		},
+	}
+	orm.Adapter.CreateClass(className, object)
+	object = types.M{
+		"objectId": "01",
+		"key":      "b",
+		"blob":     types.M{"a": 1},
+	}
+	orm.Adapter.CreateObject(className, types.M{}, object)
+	object = types.M{
+		"objectId": "02",
+		"key":      "a",
+		"blob":     types.M{"a": 2},
+	}
+	orm.Adapter.CreateObject(className, types.M{}, object)
+	className = "user"
+	where = types.M{}
+	options = types.M{"excludeKeys": "blob,key,objectId", "order": "key"}
+	q, _ = NewQuery(Master(), className, where, options, nil)
+	result, err = q.Execute()
+	expect = types.M{
+		"results": types.S{
+			types.M{
+				"objectId": "02",
+			},
+			types.M{
+				"objectId": "01",
+			},
+		},
+	}
+	if err != nil || reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "result:", result)
+	}
+	orm.TomatoDBController.DeleteEverything()
+	/**********************************************************/
+	options = types.M{"keys": "key", "excludeKeys": "key"}
+	_, err = NewQuery(Master(), "user", types.M{}, options, nil)
+	expectErr := errs.E(errs.InvalidQuery, "Cannot both select and exclude key: key")
+	if reflect.DeepEqual(expectErr, err) == false {
+		t.Error("expect:", expectErr, "result:", err)
+	}
 }
 
 func Test_BuildRestWhere(t *testing.T) {
@@ -506,6 +591,69 @@ func Test_validateClientClassCreation(t *testing.T) {
 	orm.TomatoDBController.DeleteEverything()
 }
 
+func Test_denyProtectedFields(t *testing.T) {
+	var className string
+	var where types.M
+	var options types.M
+	var q *Query
+	var result error
+	var expect error
+	/**********************************************************/
+	initEnv()
+	className = "post"
+	orm.Adapter.CreateClass(className, types.M{
+		"fields": types.M{
+			"key":    types.M{"type": "String"},
+			"secret": types.M{"type": "String"},
+		},
+		"classLevelPermissions": types.M{
+			"protectedFields": types.M{"*": types.S{"secret"}},
+		},
+	})
+	where = types.M{"key": "hello"}
+	q, _ = NewQuery(Nobody(), className, where, nil, nil)
+	result = q.denyProtectedFields()
+	expect = nil
+	if reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "result:", result)
+	}
+	/**********************************************************/
+	where = types.M{"secret": types.M{"$regex": "^a"}}
+	q, _ = NewQuery(Nobody(), className, where, nil, nil)
+	result = q.denyProtectedFields()
+	expect = errs.E(errs.OperationForbidden, "This user is not allowed to query secret on class post")
+	if reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "result:", result)
+	}
+	/**********************************************************/
+	where = types.M{"$or": types.S{types.M{"key": "hello"}, types.M{"secret": types.M{"$exists": true}}}}
+	q, _ = NewQuery(Nobody(), className, where, nil, nil)
+	result = q.denyProtectedFields()
+	expect = errs.E(errs.OperationForbidden, "This user is not allowed to query secret on class post")
+	if reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "result:", result)
+	}
+	/**********************************************************/
+	where = types.M{}
+	options = types.M{"order": "-secret"}
+	q, _ = NewQuery(Nobody(), className, where, options, nil)
+	result = q.denyProtectedFields()
+	expect = errs.E(errs.OperationForbidden, "This user is not allowed to sort by secret on class post")
+	if reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "result:", result)
+	}
+	/**********************************************************/
+	where = types.M{"secret": "abc"}
+	options = types.M{"order": "secret"}
+	q, _ = NewQuery(Master(), className, where, options, nil)
+	result = q.denyProtectedFields()
+	expect = nil
+	if reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "result:", result)
+	}
+	orm.TomatoDBController.DeleteEverything()
+}
+
 func Test_replaceSelect(t *testing.T) {
 	var className string
 	var schema types.M
@@ -1176,6 +1324,31 @@ func Test_replaceInQuery(t *testing.T) {
 	}
 	orm.TomatoDBController.DeleteEverything()
 	/**********************************************************/
+	// 子查询的 className 与 Pointer 字段的 targetClass 不一致
+	initEnv()
+	className = "user"
+	schema = types.M{
+		"fields": types.M{
+			"post": types.M{"type": "Pointer", "targetClass": "Post"},
+		},
+	}
+	orm.Adapter.CreateClass(className, schema)
+	where = types.M{
+		"post": types.M{
+			"$inQuery": types.M{
+				"where":     types.M{},
+				"className": "Comment",
+			},
+		},
+	}
+	q, _ = NewQuery(Master(), "user", where, nil, nil)
+	err = q.replaceInQuery()
+	expectErr = errs.E(errs.InvalidQuery, "$inQuery className Comment does not match the targetClass Post of post")
+	if err == nil || reflect.DeepEqual(expectErr, err) == false {
+		t.Error("expect:", expectErr, "result:", err)
+	}
+	orm.TomatoDBController.DeleteEverything()
+	/**********************************************************/
 	initEnv()
 	className = "Post"
 	schema = types.M{
@@ -1465,6 +1638,31 @@ func Test_replaceNotInQuery(t *testing.T) {
 	}
 	orm.TomatoDBController.DeleteEverything()
 	/**********************************************************/
+	// 子查询的 className 与 Pointer 字段的 targetClass 不一致
+	initEnv()
+	className = "user"
+	schema = types.M{
+		"fields": types.M{
+			"post": types.M{"type": "Pointer", "targetClass": "Post"},
+		},
+	}
+	orm.Adapter.CreateClass(className, schema)
+	where = types.M{
+		"post": types.M{
+			"$notInQuery": types.M{
+				"where":     types.M{},
+				"className": "Comment",
+			},
+		},
+	}
+	q, _ = NewQuery(Master(), "user", where, nil, nil)
+	err = q.replaceNotInQuery()
+	expectErr = errs.E(errs.InvalidQuery, "$notInQuery className Comment does not match the targetClass Post of post")
+	if err == nil || reflect.DeepEqual(expectErr, err) == false {
+		t.Error("expect:", expectErr, "result:", err)
+	}
+	orm.TomatoDBController.DeleteEverything()
+	/**********************************************************/
 	initEnv()
 	className = "Post"
 	schema = types.M{
@@ -2850,6 +3048,160 @@ func Test_NewQuery(t *testing.T) {
 	if err != nil || reflect.DeepEqual(expect, result) == false {
 		t.Error("expect:", expect, "result:", result, err)
 	}
+	/**********************************************************/
+	auth = Master()
+	className = "user"
+	where = nil
+	options = types.M{
+		"readPreference":         "secondary",
+		"subqueryReadPreference": "nearest",
+	}
+	clientSDK = nil
+	result, err = NewQuery(auth, className, where, options, clientSDK)
+	expect = &Query{
+		auth:                   auth,
+		className:              "user",
+		Where:                  types.M{},
+		restOptions:            options,
+		findOptions:            types.M{"readPreference": "SECONDARY"},
+		response:               types.M{},
+		doCount:                false,
+		include:                [][]string{},
+		keys:                   []string{},
+		redirectKey:            "",
+		redirectClassName:      "",
+		clientSDK:              nil,
+		subqueryReadPreference: "NEAREST",
+	}
+	if err != nil || reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "result:", result, err)
+	}
+	/**********************************************************/
+	auth = Master()
+	className = "user"
+	where = nil
+	options = types.M{"explain": true, "limit": 10}
+	clientSDK = nil
+	result, err = NewQuery(auth, className, where, options, clientSDK)
+	expect = &Query{
+		auth:              auth,
+		className:         "user",
+		Where:             types.M{},
+		restOptions:       options,
+		findOptions:       types.M{"explain": true, "limit": 10},
+		response:          types.M{},
+		doCount:           false,
+		include:           [][]string{},
+		keys:              []string{},
+		redirectKey:       "",
+		redirectClassName: "",
+		clientSDK:         nil,
+	}
+	if err != nil || reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "result:", result, err)
+	}
+	/**********************************************************/
+	auth = Master()
+	className = "user"
+	where = nil
+	options = types.M{"readPreference": "fastest"}
+	clientSDK = nil
+	result, err = NewQuery(auth, className, where, options, clientSDK)
+	expectErr = errs.E(errs.InvalidQuery, "Invalid read preference: fastest")
+	if reflect.DeepEqual(expectErr, err) == false {
+		t.Error("expect:", expectErr, "result:", err)
+	}
+	/**********************************************************/
+	auth = Master()
+	className = "user"
+	where = nil
+	options = types.M{"keys": "-post, -createdAt,-objectId"}
+	clientSDK = nil
+	result, err = NewQuery(auth, className, where, options, clientSDK)
+	expect = &Query{
+		auth:              auth,
+		className:         "user",
+		Where:             types.M{},
+		restOptions:       types.M{"keys": ""},
+		findOptions:       types.M{},
+		response:          types.M{},
+		doCount:           false,
+		include:           [][]string{},
+		keys:              []string{},
+		excludeKeys:       []string{"post", "createdAt"},
+		redirectKey:       "",
+		redirectClassName: "",
+		clientSDK:         nil,
+	}
+	if err != nil || reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "result:", result, err)
+	}
+	/**********************************************************/
+	auth = Master()
+	className = "user"
+	where = nil
+	options = types.M{"keys": "-post", "excludeKeys": "user"}
+	clientSDK = nil
+	result, err = NewQuery(auth, className, where, options, clientSDK)
+	if err != nil || reflect.DeepEqual([]string{"post", "user"}, result.excludeKeys) == false {
+		t.Error("expect:", []string{"post", "user"}, "result:", result.excludeKeys, err)
+	}
+	/**********************************************************/
+	auth = Master()
+	className = "user"
+	where = nil
+	options = types.M{"excludeKeys": types.S{"post", " user ", "objectId"}}
+	clientSDK = nil
+	result, err = NewQuery(auth, className, where, options, clientSDK)
+	if err != nil || reflect.DeepEqual([]string{"post", "user"}, result.excludeKeys) == false {
+		t.Error("expect:", []string{"post", "user"}, "result:", result.excludeKeys, err)
+	}
+	/**********************************************************/
+	auth = Master()
+	className = "user"
+	where = nil
+	options = types.M{"excludeKeys": types.S{"post", 1.0}}
+	clientSDK = nil
+	_, err = NewQuery(auth, className, where, options, clientSDK)
+	if reflect.DeepEqual(errs.E(errs.InvalidQuery, "excludeKeys must be a string or an array of strings"), err) == false {
+		t.Error("expect:", errs.E(errs.InvalidQuery, "excludeKeys must be a string or an array of strings"), "result:", err)
+	}
+	/**********************************************************/
+	auth = Master()
+	className = "user"
+	where = nil
+	options = types.M{"keys": "post,-user"}
+	clientSDK = nil
+	result, err = NewQuery(auth, className, where, options, clientSDK)
+	expectErr = errs.E(errs.InvalidQuery, "Cannot mix included and excluded fields in keys")
+	if reflect.DeepEqual(expectErr, err) == false {
+		t.Error("expect:", expectErr, "result:", err)
+	}
+	/**********************************************************/
+	maxIncludeDepth := config.TConfig.MaxIncludeDepth
+	defer func() { config.TConfig.MaxIncludeDepth = maxIncludeDepth }()
+	config.TConfig.MaxIncludeDepth = 2
+	auth = Master()
+	className = "post"
+	where = nil
+	options = types.M{"include": "author.company"}
+	clientSDK = nil
+	result, err = NewQuery(auth, className, where, options, clientSDK)
+	if err != nil || reflect.DeepEqual([][]string{{"author"}, {"author", "company"}}, result.include) == false {
+		t.Error("expect:", [][]string{{"author"}, {"author", "company"}}, "result:", result.include, err)
+	}
+	options = types.M{"include": "author.company.owner"}
+	result, err = NewQuery(auth, className, where, options, clientSDK)
+	expectErr = errs.E(errs.InvalidQuery, "include path author.company.owner exceeds the max include depth of 2")
+	if reflect.DeepEqual(expectErr, err) == false {
+		t.Error("expect:", expectErr, "result:", err)
+	}
+	// keys 中的多级字段会自动加入 include
+	options = types.M{"keys": "author.company.owner.name"}
+	result, err = NewQuery(auth, className, where, options, clientSDK)
+	if reflect.DeepEqual(expectErr, err) == false {
+		t.Error("expect:", expectErr, "result:", err)
+	}
 }
 
 func Test_includePath(t *testing.T) {
@@ -3428,6 +3780,90 @@ func Test_includePath(t *testing.T) {
 		t.Error("expect:", expect, "result:", response)
 	}
 	orm.TomatoDBController.DeleteEverything()
+	/**********************************************************/
+	initEnv()
+	className = "post"
+	object = types.M{
+		"fields": types.M{
+			"key": types.M{"type": "String"},
+		},
+	}
+	orm.Adapter.CreateClass(className, object)
+	object = types.M{
+		"objectId": "2001",
+		"key":      "hello",
+	}
+	orm.Adapter.CreateObject(className, types.M{}, object)
+	object = types.M{
+		"objectId": "2002",
+		"key":      "hello",
+		"_rperm":   types.S{"someone"},
+	}
+	orm.Adapter.CreateObject(className, types.M{}, object)
+	auth = Nobody()
+	response = types.M{
+		"results": types.S{
+			types.M{
+				"objectId": "1001",
+				"post": types.M{
+					"__type":    "Pointer",
+					"className": "post",
+					"objectId":  "2002",
+				},
+			},
+			types.M{
+				"objectId": "1002",
+				"post": types.M{
+					"__type":    "Pointer",
+					"className": "post",
+					"objectId":  "2001",
+				},
+			},
+			types.M{
+				"objectId": "1003",
+				"post": types.M{
+					"__type":    "Pointer",
+					"className": "missing",
+					"objectId":  "2003",
+				},
+			},
+		},
+	}
+	path = []string{"post"}
+	err = includePath(auth, response, path, nil)
+	expect = types.M{
+		"results": types.S{
+			types.M{
+				"objectId": "1001",
+				"post": types.M{
+					"__type":    "Pointer",
+					"className": "post",
+					"objectId":  "2002",
+				},
+			},
+			types.M{
+				"objectId": "1002",
+				"post": types.M{
+					"__type":    "Object",
+					"className": "post",
+					"objectId":  "2001",
+					"key":       "hello",
+				},
+			},
+			types.M{
+				"objectId": "1003",
+				"post": types.M{
+					"__type":    "Pointer",
+					"className": "missing",
+					"objectId":  "2003",
+				},
+			},
+		},
+	}
+	if err != nil || reflect.DeepEqual(expect, response) == false {
+		t.Error("expect:", expect, "result:", response)
+	}
+	orm.TomatoDBController.DeleteEverything()
 }
 
 func Test_findPointers(t *testing.T) {
@@ -3812,6 +4248,55 @@ func Test_findObjectWithKey(t *testing.T) {
 	}
 }
 
+func Test_findFieldWithKey(t *testing.T) {
+	var root interface{}
+	var field string
+	var result types.M
+	var expectField string
+	var expect types.M
+	/**********************************************************/
+	root = nil
+	field, result = findFieldWithKey(root, "$inQuery")
+	expectField = ""
+	expect = nil
+	if field != expectField || reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expectField, expect, "result:", field, result)
+	}
+	/**********************************************************/
+	root = types.M{
+		"post": types.M{
+			"$inQuery": types.M{"className": "Post", "where": types.M{}},
+		},
+	}
+	field, result = findFieldWithKey(root, "$inQuery")
+	expectField = "post"
+	expect = types.M{
+		"$inQuery": types.M{"className": "Post", "where": types.M{}},
+	}
+	if field != expectField || reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expectField, expect, "result:", field, result)
+	}
+	/**********************************************************/
+	root = types.M{
+		"$or": types.S{
+			types.M{"key": "hello"},
+			types.M{
+				"author": types.M{
+					"$inQuery": types.M{"className": "_User", "where": types.M{}},
+				},
+			},
+		},
+	}
+	field, result = findFieldWithKey(root, "$inQuery")
+	expectField = "author"
+	expect = types.M{
+		"$inQuery": types.M{"className": "_User", "where": types.M{}},
+	}
+	if field != expectField || reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expectField, expect, "result:", field, result)
+	}
+}
+
 func Test_transformSelect(t *testing.T) {
 	var selectObject types.M
 	var key string
@@ -4058,6 +4543,45 @@ func Test_transformDontSelect(t *testing.T) {
 	}
 }
 
+func Test_limitSubquery(t *testing.T) {
+	var options types.M
+	var expect types.M
+	subqueryLimit := config.TConfig.SubqueryLimit
+	defer func() { config.TConfig.SubqueryLimit = subqueryLimit }()
+	/**********************************************************/
+	config.TConfig.SubqueryLimit = 0
+	options = types.M{}
+	limitSubquery(options)
+	expect = types.M{}
+	if reflect.DeepEqual(expect, options) == false {
+		t.Error("expect:", expect, "result:", options)
+	}
+	/**********************************************************/
+	config.TConfig.SubqueryLimit = 100
+	options = types.M{}
+	limitSubquery(options)
+	expect = types.M{"limit": 101}
+	if reflect.DeepEqual(expect, options) == false {
+		t.Error("expect:", expect, "result:", options)
+	}
+	/**********************************************************/
+	config.TConfig.SubqueryLimit = 100
+	options = types.M{"limit": 10.0}
+	limitSubquery(options)
+	expect = types.M{"limit": 10.0}
+	if reflect.DeepEqual(expect, options) == false {
+		t.Error("expect:", expect, "result:", options)
+	}
+	/**********************************************************/
+	config.TConfig.SubqueryLimit = 100
+	options = types.M{"limit": 1000}
+	limitSubquery(options)
+	expect = types.M{"limit": 101}
+	if reflect.DeepEqual(expect, options) == false {
+		t.Error("expect:", expect, "result:", options)
+	}
+}
+
 func Test_transformInQuery(t *testing.T) {
 	var inQueryObject types.M
 	var className string
@@ -86,8 +86,9 @@ func Delete(auth *Auth, className, objectID string) error {
 	}
 
 	destroy := NewDestroy(auth, className, types.M{"objectId": objectID}, inflatedObject)
+	_, err = destroy.Execute()
 
-	return destroy.Execute()
+	return err
 }
 
 // Create 创建对象
@@ -123,10 +124,12 @@ func Update(auth *Auth, className, objectID string, object types.M, clientSDK ma
 	var originalRestObject types.M
 
 	// 如果存在删前回调、或者删后回调，则需要获取到要删除的对象数据
+	// 非 Master 权限更新 _Session 时，只能查询到属于自己的 session ，以此限制只能更新自己的 session
 	var response types.M
 	hasTriggers := checkTriggers(className, []string{cloud.TypeBeforeSave, cloud.TypeAfterSave})
 	hasLiveQuery := checkLiveQuery(className)
-	if hasTriggers || hasLiveQuery {
+	isSessionUpdate := className == "_Session" && auth.IsMaster == false
+	if hasTriggers || hasLiveQuery || isSessionUpdate {
 		response, err = Find(auth, className, types.M{"objectId": objectID}, types.M{}, clientSDK)
 		if err != nil || utils.HasResults(response) == false {
 			return nil, errs.E(errs.ObjectNotFound, "Object not found for update.")
@@ -2,15 +2,68 @@ package rest
 
 import (
 	"github.com/lfq7413/tomato/cloud"
+	"github.com/lfq7413/tomato/errs"
 	"github.com/lfq7413/tomato/types"
 	"github.com/lfq7413/tomato/utils"
 )
 
-func getRequest(triggerType string, auth *Auth, parseObject, originalParseObject types.M) cloud.TriggerRequest {
+// TriggerFunc 使用 RegisterTrigger 注册的回调函数
+// object 为将要写入或者已经写入的对象，original 为更新前的对象，创建对象时为 nil
+// beforeSave 中可以直接修改 object ，返回错误时终止本次写入
+type TriggerFunc func(auth *Auth, object, original types.M) error
+
+// RegisterTrigger 注册 beforeSave afterSave beforeDelete afterDelete 回调函数
+// 回调函数返回的错误如果不包含错误码，则使用 ScriptFailed
+func RegisterTrigger(triggerType, className string, fn TriggerFunc) error {
+	handler := func(request cloud.TriggerRequest, response cloud.Response) {
+		auth := &Auth{
+			IsMaster:       request.Master,
+			User:           request.User,
+			InstallationID: request.InstallationID,
+		}
+		err := fn(auth, request.Object, request.Original)
+		if err != nil {
+			response.Error(errs.GetErrorCode(err), errs.GetErrorMessage(err))
+			return
+		}
+		response.Success(nil)
+	}
+
+	switch triggerType {
+	case cloud.TypeBeforeSave:
+		return cloud.BeforeSave(className, handler)
+	case cloud.TypeAfterSave:
+		return cloud.AfterSave(className, handler)
+	case cloud.TypeBeforeDelete:
+		return cloud.BeforeDelete(className, handler)
+	case cloud.TypeAfterDelete:
+		return cloud.AfterDelete(className, handler)
+	default:
+		return errs.E(errs.ScriptFailed, "Unsupported trigger type: "+triggerType)
+	}
+}
+
+// JobFunc 使用 RegisterJob 注册的后台任务，返回的字符串作为任务状态中的 message
+type JobFunc func(params types.M) (string, error)
+
+// RegisterJob 注册后台任务，通过 POST /jobs/:jobName 触发执行
+func RegisterJob(name string, fn JobFunc) {
+	cloud.Job(name, func(request cloud.JobRequest, response cloud.JobResponse) {
+		message, err := fn(request.Params)
+		if err != nil {
+			response.Error(errs.GetErrorMessage(err))
+			return
+		}
+		response.Success(message)
+	})
+}
+
+func getRequest(triggerType string, auth *Auth, parseObject, originalParseObject, context types.M) cloud.TriggerRequest {
 	request := cloud.TriggerRequest{
 		TriggerName: triggerType,
 		Object:      parseObject,
 		Master:      false,
+		Context:     context,
 	}
 
 	if originalParseObject != nil {
@@ -60,7 +113,8 @@ func getRequestQuery(triggerType string, auth *Auth, query types.M, count bool)
 	return request
 }
 
-func maybeRunTrigger(triggerType string, auth *Auth, parseObject, originalParseObject types.M) (types.M, error) {
+// maybeRunTrigger 执行回调，context 在同一请求的 beforeSave 与 afterSave 之间共享
+func maybeRunTrigger(triggerType string, auth *Auth, parseObject, originalParseObject, context types.M) (types.M, error) {
 	if parseObject == nil {
 		return types.M{}, nil
 	}
@@ -69,7 +123,7 @@ func maybeRunTrigger(triggerType string, auth *Auth, parseObject, originalParseO
 	if trigger == nil {
 		return types.M{}, nil
 	}
-	request := getRequest(triggerType, auth, parseObject, originalParseObject)
+	request := getRequest(triggerType, auth, parseObject, originalParseObject, context)
 	response := getResponse(request)
 	trigger(request, response)
 	return response.Response, response.Err
@@ -136,7 +190,7 @@ func maybeRunAfterFindTrigger(triggerType, className string, objects types.S, au
 	if trigger == nil {
 		return objects, nil
 	}
-	request := getRequest(triggerType, auth, nil, nil)
+	request := getRequest(triggerType, auth, nil, nil, nil)
 	response := getResponse(request)
 	request.Objects = objects
 	trigger(request, response)
@@ -144,6 +198,10 @@ func maybeRunAfterFindTrigger(triggerType, className string, objects types.S, au
 	if response.Err != nil {
 		return nil, response.Err
 	}
+	// 回调中未返回结果时，保留原有结果
+	if response.ResponseObjects == nil {
+		return objects, nil
+	}
 	return response.ResponseObjects, nil
 }
 
@@ -162,3 +220,25 @@ func inflate(data, restObject types.M) types.M {
 
 	return result
 }
+
+// RunBeforeLoginTrigger 执行登录前回调，user 为已通过密码校验的用户
+func RunBeforeLoginTrigger(auth *Auth, user types.M) error {
+	if cloud.TriggerExists(cloud.TypeBeforeLogin, "_User") == false {
+		return nil
+	}
+	object := inflate(types.M{"className": "_User"}, user)
+	delete(object, "password")
+	delete(object, "sessionToken")
+	_, err := maybeRunTrigger(cloud.TypeBeforeLogin, auth, object, nil, nil)
+	return err
+}
+
+// RunAfterLogoutTrigger 执行退出登录后回调，session 为已删除的 _Session 对象
+func RunAfterLogoutTrigger(auth *Auth, session types.M) error {
+	if cloud.TriggerExists(cloud.TypeAfterLogout, "_Session") == false {
+		return nil
+	}
+	object := inflate(types.M{"className": "_Session"}, session)
+	_, err := maybeRunTrigger(cloud.TypeAfterLogout, auth, object, nil, nil)
+	return err
+}
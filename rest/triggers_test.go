@@ -1,11 +1,13 @@
 package rest
 
 import (
+	"errors"
 	"reflect"
 	"testing"
 
 	"github.com/lfq7413/tomato/cloud"
 	"github.com/lfq7413/tomato/errs"
+	"github.com/lfq7413/tomato/orm"
 	"github.com/lfq7413/tomato/types"
 	"github.com/lfq7413/tomato/utils"
 )
@@ -25,12 +27,12 @@ func Test_maybeRunTrigger(t *testing.T) {
 			response.Error(1, "need a username")
 		}
 	})
-	_, err = maybeRunTrigger(cloud.TypeBeforeSave, Master(), types.M{"className": "user"}, nil)
+	_, err = maybeRunTrigger(cloud.TypeBeforeSave, Master(), types.M{"className": "user"}, nil, nil)
 	expectErr = errs.E(1, "need a username")
 	if reflect.DeepEqual(expectErr, err) == false {
 		t.Error("expect:", expectErr, "result:", err)
 	}
-	result, err = maybeRunTrigger(cloud.TypeBeforeSave, Master(), types.M{"className": "user", "username": "joe"}, nil)
+	result, err = maybeRunTrigger(cloud.TypeBeforeSave, Master(), types.M{"className": "user", "username": "joe"}, nil, nil)
 	expect = types.M{
 		"object": types.M{
 			"className": "user",
@@ -42,3 +44,201 @@ func Test_maybeRunTrigger(t *testing.T) {
 	}
 	cloud.UnregisterAll()
 }
+
+func Test_maybeRunAfterFindTrigger(t *testing.T) {
+	var objects types.S
+	var result types.S
+	var err error
+	var expect types.S
+	/****************************************************************************************/
+	cloud.AfterFind("user", func(request cloud.TriggerRequest, response cloud.Response) {
+	})
+	objects = types.S{types.M{"objectId": "1001"}}
+	result, err = maybeRunAfterFindTrigger(cloud.TypeAfterFind, "user", objects, Master())
+	expect = types.S{types.M{"objectId": "1001"}}
+	if err != nil || reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "result:", result, err)
+	}
+	cloud.UnregisterAll()
+	/****************************************************************************************/
+	cloud.AfterFind("user", func(request cloud.TriggerRequest, response cloud.Response) {
+		response.Success(types.S{types.M{"name": "joe"}})
+	})
+	objects = types.S{types.M{"objectId": "1001"}, types.M{"objectId": "1002"}}
+	result, err = maybeRunAfterFindTrigger(cloud.TypeAfterFind, "user", objects, Master())
+	expect = types.S{types.M{"name": "joe"}}
+	if err != nil || reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "result:", result, err)
+	}
+	cloud.UnregisterAll()
+}
+
+func Test_RegisterTrigger(t *testing.T) {
+	var object types.M
+	var result types.M
+	var err error
+	var expectErr error
+	/****************************************************************************************/
+	initEnv()
+	RegisterTrigger(cloud.TypeBeforeSave, "post", func(auth *Auth, object, original types.M) error {
+		if utils.S(object["title"]) == "" {
+			return errors.New("title is required")
+		}
+		return nil
+	})
+	object = types.M{"content": "hello"}
+	result, err = Create(Master(), "post", object, nil)
+	expectErr = errs.E(errs.ScriptFailed, "title is required")
+	if reflect.DeepEqual(expectErr, err) == false {
+		t.Error("expect:", expectErr, "result:", result, err)
+	}
+	cloud.UnregisterAll()
+	orm.TomatoDBController.DeleteEverything()
+	/****************************************************************************************/
+	initEnv()
+	var saved types.M
+	RegisterTrigger(cloud.TypeBeforeSave, "post", func(auth *Auth, object, original types.M) error {
+		object["title"] = "tomato"
+		return nil
+	})
+	RegisterTrigger(cloud.TypeAfterSave, "post", func(auth *Auth, object, original types.M) error {
+		saved = object
+		return nil
+	})
+	object = types.M{"content": "hello"}
+	result, err = Create(Master(), "post", object, nil)
+	if err != nil {
+		t.Error("expect:", nil, "result:", err)
+	}
+	if saved == nil || saved["title"] != "tomato" || saved["content"] != "hello" {
+		t.Error("expect:", "tomato", "result:", saved)
+	}
+	cloud.UnregisterAll()
+	orm.TomatoDBController.DeleteEverything()
+	/****************************************************************************************/
+	err = RegisterTrigger(cloud.TypeBeforeFind, "post", func(auth *Auth, object, original types.M) error {
+		return nil
+	})
+	expectErr = errs.E(errs.ScriptFailed, "Unsupported trigger type: beforeFind")
+	if reflect.DeepEqual(expectErr, err) == false {
+		t.Error("expect:", expectErr, "result:", err)
+	}
+}
+
+type testJobStatus struct {
+	status  string
+	message string
+}
+
+func (j *testJobStatus) SetSucceeded(message string) {
+	j.status = "succeeded"
+	j.message = message
+}
+
+func (j *testJobStatus) SetFailed(message string) {
+	j.status = "failed"
+	j.message = message
+}
+
+func (j *testJobStatus) SetMessage(message string) {
+	j.message = message
+}
+
+func Test_RegisterJob(t *testing.T) {
+	var status *testJobStatus
+	/****************************************************************************************/
+	RegisterJob("cleanup", func(params types.M) (string, error) {
+		if params["fail"] != nil {
+			return "", errs.E(errs.ScriptFailed, "cleanup failed")
+		}
+		return "done", nil
+	})
+	job := cloud.GetJob("cleanup")
+	if job == nil {
+		t.Fatal("expect:", "job", "result:", nil)
+	}
+	status = &testJobStatus{}
+	job(cloud.JobRequest{Params: types.M{}}, cloud.JobResponse{JobStatus: status})
+	if status.status != "succeeded" || status.message != "done" {
+		t.Error("expect:", "succeeded done", "result:", status.status, status.message)
+	}
+	status = &testJobStatus{}
+	job(cloud.JobRequest{Params: types.M{"fail": true}}, cloud.JobResponse{JobStatus: status})
+	if status.status != "failed" || status.message != "cleanup failed" {
+		t.Error("expect:", "failed cleanup failed", "result:", status.status, status.message)
+	}
+	cloud.UnregisterAll()
+}
+
+func Test_RunBeforeLoginTrigger(t *testing.T) {
+	var user types.M
+	var err error
+	var expect error
+	/*************************************************/
+	user = types.M{"objectId": "1001", "username": "joe", "banned": true}
+	err = RunBeforeLoginTrigger(Nobody(), user)
+	if err != nil {
+		t.Error("expect:", nil, "result:", err)
+	}
+	/*************************************************/
+	var object types.M
+	cloud.BeforeLogin(func(request cloud.TriggerRequest, response cloud.Response) {
+		object = request.Object
+		if request.Object["banned"] == true {
+			response.Error(0, "user is banned")
+			return
+		}
+		response.Success(nil)
+	})
+	user = types.M{"objectId": "1001", "username": "joe", "password": "123", "banned": true}
+	err = RunBeforeLoginTrigger(Nobody(), user)
+	expect = errs.E(errs.ScriptFailed, "user is banned")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	if _, ok := object["password"]; ok || object["className"] != "_User" {
+		t.Error("expect:", "object without password", "result:", object)
+	}
+	/*************************************************/
+	user = types.M{"objectId": "1002", "username": "jack"}
+	err = RunBeforeLoginTrigger(Nobody(), user)
+	if err != nil {
+		t.Error("expect:", nil, "result:", err)
+	}
+	cloud.UnregisterAll()
+}
+
+func Test_RunAfterLogoutTrigger(t *testing.T) {
+	var session types.M
+	var err error
+	/*************************************************/
+	session = types.M{"objectId": "2001", "sessionToken": "r:abc"}
+	err = RunAfterLogoutTrigger(Nobody(), session)
+	if err != nil {
+		t.Error("expect:", nil, "result:", err)
+	}
+	/*************************************************/
+	var request cloud.TriggerRequest
+	called := false
+	cloud.AfterLogout(func(r cloud.TriggerRequest, response cloud.Response) {
+		called = true
+		request = r
+		response.Success(nil)
+	})
+	session = types.M{
+		"objectId":     "2001",
+		"sessionToken": "r:abc",
+		"user":         types.M{"__type": "Pointer", "className": "_User", "objectId": "1001"},
+	}
+	err = RunAfterLogoutTrigger(Nobody(), session)
+	if err != nil {
+		t.Error("expect:", nil, "result:", err)
+	}
+	if called == false {
+		t.Error("expect:", "afterLogout called", "result:", called)
+	}
+	if request.TriggerName != cloud.TypeAfterLogout || request.Object["className"] != "_Session" || request.Object["objectId"] != "2001" {
+		t.Error("expect:", "_Session 2001", "result:", request.TriggerName, request.Object)
+	}
+	cloud.UnregisterAll()
+}
@@ -6,24 +6,37 @@ import (
 	"time"
 
 	"strings"
+	"sync"
 
 	"github.com/lfq7413/tomato/config"
 	"github.com/lfq7413/tomato/errs"
+	"github.com/lfq7413/tomato/logger"
 	"github.com/lfq7413/tomato/mail"
 	"github.com/lfq7413/tomato/orm"
 	"github.com/lfq7413/tomato/types"
 	"github.com/lfq7413/tomato/utils"
 )
 
+// adapter 邮件发送模块，为 nil 时表示未配置邮件发送模块
 var adapter mail.Adapter
 
 func init() {
-	a := config.TConfig.MailAdapter
-	if a == "smtp" {
-		adapter = mail.NewSMTPAdapter()
-	} else {
-		adapter = mail.NewSMTPAdapter()
+	adapter = newMailAdapter()
+}
+
+// newMailAdapter 根据配置选择邮件发送模块，缺少必要参数时返回 nil
+func newMailAdapter() mail.Adapter {
+	switch config.TConfig.MailAdapter {
+	case "", "smtp":
+		if config.TConfig.SMTPServer != "" {
+			return mail.NewSMTPAdapter()
+		}
+	case "mailgun":
+		if config.TConfig.MailgunAPIKey != "" && config.TConfig.MailgunDomain != "" {
+			return mail.NewMailgunAdapter()
+		}
 	}
+	return nil
 }
 
 // shouldVerifyEmails 根据配置参数确定是否需要验证邮箱
@@ -46,25 +59,28 @@ func SetEmailVerifyToken(user types.M) {
 	}
 }
 
-// SendVerificationEmail 发送验证邮件
-func SendVerificationEmail(user types.M) {
+// SendVerificationEmail 发送验证邮件，未发送成功时返回错误
+func SendVerificationEmail(user types.M) error {
 	if shouldVerifyEmails() == false {
-		return
+		return nil
 	}
 	token := url.QueryEscape(utils.S(user["_email_verify_token"]))
 	user = getUserIfNeeded(user)
 	if user == nil {
-		return
+		return errors.New("no user")
 	}
 	user["className"] = "_User"
 	username := url.QueryEscape(utils.S(user["username"]))
 	link := buildEmailLink(config.VerifyEmailURL(), username, token)
-	options := types.M{
-		"appName": config.TConfig.AppName,
-		"link":    link,
-		"user":    user,
+	if adapter == nil {
+		logger.Warn("no mail adapter configured, verification email not sent to", user["email"])
+		return errors.New("no mail adapter configured")
+	}
+	err := adapter.SendVerificationEmail(utils.S(user["email"]), link, user)
+	if err != nil {
+		logger.Error("failed to send verification email:", err)
 	}
-	adapter.SendMail(defaultVerificationEmail(options))
+	return err
 }
 
 // ResendVerificationEmail 重新发送验证邮件
@@ -73,18 +89,84 @@ func ResendVerificationEmail(username string) error {
 	if aUser == nil {
 		return errors.New("no user")
 	}
+	return resendVerificationEmail(aUser)
+}
+
+// ResendVerificationEmailByEmail 根据 email 重新生成 token 并发送验证邮件
+func ResendVerificationEmailByEmail(email string) error {
+	aUser := getUserIfNeeded(types.M{"email": email})
+	if aUser == nil {
+		return errs.E(errs.EmailNotFound, "No user found with email "+email)
+	}
+	return resendVerificationEmail(aUser)
+}
+
+// resendVerificationEmail 已验证的用户返回错误，同一个用户在时间间隔内只允许发送一次
+// 未开启邮箱验证时不做任何处理
+func resendVerificationEmail(aUser types.M) error {
+	if shouldVerifyEmails() == false {
+		return nil
+	}
 	if emailVerified, ok := aUser["emailVerified"].(bool); ok && emailVerified {
-		return errors.New("emailVerified")
+		return errs.E(errs.OtherCause, "Email "+utils.S(aUser["email"])+" is already verified.")
+	}
+	userID := utils.S(aUser["objectId"])
+	if reserveVerificationEmailRequest(userID, time.Now()) == false {
+		return errs.E(errs.RequestLimitExceeded, "Verification email was sent recently, please try again later.")
 	}
 	SetEmailVerifyToken(aUser)
-	_, err := orm.TomatoDBController.Update("_User", types.M{"username": username}, aUser, types.M{}, false)
+	update := types.M{
+		"_email_verify_token": aUser["_email_verify_token"],
+		"emailVerified":       aUser["emailVerified"],
+	}
+	if aUser["_email_verify_token_expires_at"] != nil {
+		update["_email_verify_token_expires_at"] = aUser["_email_verify_token_expires_at"]
+	}
+	_, err := orm.TomatoDBController.Update("_User", types.M{"objectId": aUser["objectId"]}, update, types.M{}, false)
 	if err != nil {
+		releaseVerificationEmailRequest(userID)
 		return err
 	}
-	SendVerificationEmail(aUser)
+	err = SendVerificationEmail(aUser)
+	if err != nil {
+		// 发送失败时释放记录，允许立即重试
+		releaseVerificationEmailRequest(userID)
+		return errs.E(errs.InternalServerError, "Failed to send verification email, please try again later.")
+	}
 	return nil
 }
 
+var verificationEmailRequests = map[string]time.Time{}
+var verificationEmailRequestsMutex sync.Mutex
+
+// reserveVerificationEmailRequest 检测用户最近一次发送验证邮件是否已超过时间间隔，防止恶意频繁发送邮件
+// 允许发送时同时记录本次发送时间，检测与记录在同一个临界区中完成，并发请求只有一个能够发送
+func reserveVerificationEmailRequest(userID string, now time.Time) bool {
+	interval := time.Duration(config.TConfig.VerificationEmailRequestInterval) * time.Second
+	if interval <= 0 {
+		return true
+	}
+	verificationEmailRequestsMutex.Lock()
+	defer verificationEmailRequestsMutex.Unlock()
+	for id, t := range verificationEmailRequests {
+		if now.Sub(t) >= interval {
+			delete(verificationEmailRequests, id)
+		}
+	}
+	if _, ok := verificationEmailRequests[userID]; ok {
+		return false
+	}
+	verificationEmailRequests[userID] = now
+	return true
+}
+
+// releaseVerificationEmailRequest 删除用户的发送记录，用于发送失败的情况
+func releaseVerificationEmailRequest(userID string) {
+	verificationEmailRequestsMutex.Lock()
+	defer verificationEmailRequestsMutex.Unlock()
+	delete(verificationEmailRequests, userID)
+}
+
 // getUserIfNeeded 把 user 填充完整，如果无法完成则返回 nil
 func getUserIfNeeded(user types.M) types.M {
 	if user == nil {
@@ -105,6 +187,7 @@ func getUserIfNeeded(user types.M) types.M {
 	if err != nil {
 		return nil
 	}
+	query.skipAfterFind = true
 	response, err := query.Execute()
 	if err != nil {
 		return nil
@@ -120,43 +203,28 @@ func getUserIfNeeded(user types.M) types.M {
 	return utils.M(results[0])
 }
 
-func defaultVerificationEmail(options types.M) types.M {
-	if options == nil {
-		return nil
-	}
-	user := utils.M(options["user"])
-	if user == nil {
-		return nil
-	}
-	text := "Hi,\n\n"
-	text += "You are being asked to confirm the e-mail address " + utils.S(user["email"])
-	text += " with " + utils.S(options["appName"]) + "\n\n"
-	text += "Click here to confirm it:\n" + utils.S(options["link"])
-	to := utils.S(user["email"])
-	subject := "Please verify your e-mail for " + utils.S(options["appName"])
-	return types.M{
-		"text":    text,
-		"to":      to,
-		"subject": subject,
-	}
-}
-
-// SendPasswordResetEmail 发送密码重置邮件
+// SendPasswordResetEmail 发送密码重置邮件，未找到对应用户时返回 ObjectNotFound
 func SendPasswordResetEmail(email string) error {
 	user := setPasswordResetToken(email)
 	if user == nil || len(user) == 0 {
-		return errs.E(errs.EmailMissing, "you must provide an email")
+		return errs.E(errs.ObjectNotFound, "No user found with email "+email)
 	}
 	user["className"] = "_User"
 	token := url.QueryEscape(utils.S(user["_perishable_token"]))
 	username := url.QueryEscape(utils.S(user["username"]))
 	link := buildEmailLink(config.RequestResetPasswordURL(), username, token)
-	options := types.M{
-		"appName": config.TConfig.AppName,
-		"link":    link,
-		"user":    user,
+	if adapter == nil {
+		logger.Warn("no mail adapter configured, password reset email not sent to", email)
+		return nil
+	}
+	to := utils.S(user["email"])
+	if to == "" {
+		to = utils.S(user["username"])
+	}
+	err := adapter.SendPasswordResetEmail(to, link, user)
+	if err != nil {
+		logger.Error("failed to send password reset email:", err)
 	}
-	adapter.SendMail(defaultResetPasswordEmail(options))
 	return nil
 }
 
@@ -177,12 +245,33 @@ func setPasswordResetToken(email string) types.M {
 			},
 		},
 	}
+	// 已有的 token 未过期时继续使用，使用户点击之前的邮件链接也可以重置密码
+	if config.TConfig.ResetTokenReuseIfValid && config.TConfig.ResetTokenValidityDuration > 0 {
+		reuseWhere := types.M{
+			"$and": types.S{
+				where,
+				types.M{
+					"_perishable_token": types.M{"$exists": true},
+					"_perishable_token_expires_at": types.M{
+						"$gt": utils.TimetoString(time.Now().UTC()),
+					},
+				},
+			},
+		}
+		results, err := db.Find("_User", reuseWhere, types.M{"limit": 1})
+		if err == nil && len(results) == 1 {
+			return utils.M(results[0])
+		}
+	}
+	// 新的 token 会覆盖之前的 token
 	update := types.M{
 		"_perishable_token": token,
 	}
-	// 增加 token 过期时间
-	if config.TConfig.PasswordPolicy && config.TConfig.ResetTokenValidityDuration > 0 {
+	// 增加 token 过期时间，未设置有效期时清除之前的过期时间
+	if config.TConfig.ResetTokenValidityDuration > 0 {
 		update["_perishable_token_expires_at"] = utils.TimetoString(config.GeneratePasswordResetTokenExpiresAt())
+	} else {
+		update["_perishable_token_expires_at"] = types.M{"__op": "Delete"}
 	}
 	r, err := db.Update("_User", where, update, types.M{}, true)
 	if err != nil {
@@ -191,31 +280,6 @@ func setPasswordResetToken(email string) types.M {
 	return r
 }
 
-func defaultResetPasswordEmail(options types.M) types.M {
-	if options == nil {
-		return nil
-	}
-	user := utils.M(options["user"])
-	if user == nil {
-		return nil
-	}
-	text := "Hi,\n\n"
-	text += "You requested to reset your password for " + utils.S(options["appName"]) + "\n\n"
-	text += "Click here to reset it:\n" + utils.S(options["link"])
-	var to string
-	if utils.S(user["email"]) != "" {
-		to = utils.S(user["email"])
-	} else {
-		to = utils.S(user["username"])
-	}
-	subject := "Password Reset for " + utils.S(options["appName"])
-	return types.M{
-		"text":    text,
-		"to":      to,
-		"subject": subject,
-	}
-}
-
 // VerifyEmail 更新邮箱验证标志
 func VerifyEmail(username, token string) bool {
 	if shouldVerifyEmails() == false {
@@ -248,6 +312,7 @@ func VerifyEmail(username, token string) bool {
 	if err != nil {
 		return false
 	}
+	checkIfAlreadyVerified.skipAfterFind = true
 	result, err := checkIfAlreadyVerified.Execute()
 	if err != nil {
 		return false
@@ -275,7 +340,7 @@ func CheckResetTokenValidity(username, token string) types.M {
 		"username":          username,
 		"_perishable_token": token,
 	}
-	if config.TConfig.PasswordPolicy && config.TConfig.ResetTokenValidityDuration > 0 {
+	if config.TConfig.ResetTokenValidityDuration > 0 {
 		where["_perishable_token_expires_at"] = types.M{
 			"$gt": utils.TimetoString(time.Now().UTC()),
 		}
@@ -312,12 +377,22 @@ func UpdatePassword(username, token, newPassword string) error {
 		"_perishable_token_expires_at": types.M{"__op": "Delete"},
 	}
 	_, err = db.Update("_User", selector, update, types.M{}, false)
+	if err != nil {
+		return err
+	}
 
-	return err
+	// 使用新密码可立即登录，无需等待锁定结束
+	// 此时密码已经修改成功，解锁失败只记录日志，账户仍会在锁定时间结束后自动解锁
+	if err := NewAccountLockout(username).UnlockAccount(); err != nil {
+		logger.Error("failed to unlock account after password reset:", err)
+	}
+	return nil
 }
 
 func updateUserPassword(userID, password string) error {
-	_, err := Update(Master(), "_User", userID, types.M{"password": password}, nil)
+	auth := Master()
+	auth.isPasswordReset = true
+	_, err := Update(auth, "_User", userID, types.M{"password": password}, nil)
 	if err != nil {
 		return err
 	}
@@ -333,3 +408,44 @@ func buildEmailLink(destination, username, token string) string {
 	}
 	return destination + `?` + usernameAndToken
 }
+
+// CheckPasswordExpired 检测用户密码是否已超过 MaxPasswordAge
+// 启用该功能之前创建的用户没有 _password_changed_at ，以当前时间作为修改时间写入，避免这些用户全部无法登录
+func CheckPasswordExpired(user types.M) error {
+	if config.TConfig.PasswordPolicy == false || config.TConfig.MaxPasswordAge <= 0 || user == nil {
+		return nil
+	}
+	changedAt, ok := passwordChangedAt(user["_password_changed_at"])
+	if ok == false {
+		query := types.M{"objectId": user["objectId"]}
+		update := types.M{"_password_changed_at": utils.TimetoString(time.Now().UTC())}
+		orm.TomatoDBController.Update("_User", query, update, types.M{}, false)
+		return nil
+	}
+	if isPasswordExpired(changedAt, time.Now()) {
+		return errs.E(errs.PasswordExpired, "Your password has expired. Please reset your password.")
+	}
+	return nil
+}
+
+// passwordChangedAt 解析 _password_changed_at ，不同的数据库返回的格式不同
+func passwordChangedAt(v interface{}) (time.Time, bool) {
+	switch value := v.(type) {
+	case time.Time:
+		return value, true
+	case string:
+		t, err := utils.StringtoTime(value)
+		return t, err == nil
+	}
+	if value := utils.M(v); value != nil && utils.S(value["__type"]) == "Date" {
+		t, err := utils.StringtoTime(utils.S(value["iso"]))
+		return t, err == nil
+	}
+	return time.Time{}, false
+}
+
+// isPasswordExpired 密码修改时间加上 MaxPasswordAge 早于 now 时，密码过期
+func isPasswordExpired(changedAt, now time.Time) bool {
+	expiresAt := changedAt.Add(time.Duration(config.TConfig.MaxPasswordAge) * 24 * time.Hour)
+	return expiresAt.Before(now)
+}
@@ -7,7 +7,6 @@ import (
 
 	"github.com/lfq7413/tomato/config"
 	"github.com/lfq7413/tomato/errs"
-	"github.com/lfq7413/tomato/mail"
 	"github.com/lfq7413/tomato/orm"
 	"github.com/lfq7413/tomato/types"
 	"github.com/lfq7413/tomato/utils"
@@ -152,7 +151,7 @@ func TestPostgres_getUserIfNeeded(t *testing.T) {
 }
 
 func TestPostgres_SendPasswordResetEmail(t *testing.T) {
-	adapter = mail.NewSMTPAdapter()
+	adapter = &testMailAdapter{}
 	var schema types.M
 	var object types.M
 	var email string
@@ -176,7 +175,7 @@ func TestPostgres_SendPasswordResetEmail(t *testing.T) {
 	orm.Adapter.CreateObject("_User", schema, object)
 	email = "aa@g.cn"
 	result = SendPasswordResetEmail(email)
-	expect = errs.E(errs.EmailMissing, "you must provide an email")
+	expect = errs.E(errs.ObjectNotFound, "No user found with email aa@g.cn")
 	if reflect.DeepEqual(expect, result) == false {
 		t.Error("expect:", expect, "result:", result)
 	}
@@ -2,6 +2,7 @@ package rest
 
 import (
 	"reflect"
+	"sync"
 	"testing"
 	"time"
 
@@ -90,13 +91,112 @@ func Test_SendVerificationEmail(t *testing.T) {
 		VerifyUserEmails: true,
 		ServerURL:        "http://www.g.cn/",
 	}
-	adapter = mail.NewSMTPAdapter()
+	adapter = &testMailAdapter{}
 	user = types.M{
 		"_email_verify_token": "abc",
 		"username":            "joe",
 		"mail":                "abc@g.cn",
 	}
 	SendVerificationEmail(user)
+	/*********************************************************/
+	config.TConfig = &config.Config{
+		AppName:          "tomato",
+		VerifyUserEmails: true,
+		ServerURL:        "http://www.g.cn/",
+		AppID:            "1001",
+	}
+	a := &testMailAdapter{}
+	adapter = a
+	user = types.M{
+		"_email_verify_token": "abc",
+		"username":            "joe",
+		"email":               "abc@g.cn",
+	}
+	err := SendVerificationEmail(user)
+	if err != nil || len(a.verifications) != 1 || a.verifications[0]["to"] != "abc@g.cn" {
+		t.Error("expect:", "abc@g.cn", "result:", a.verifications, err)
+	}
+	/*********************************************************/
+	adapter = nil
+	err = SendVerificationEmail(user)
+	if err == nil {
+		t.Error("expect:", "error", "result:", nil)
+	}
+}
+
+// testMailAdapter 记录发送的邮件，不实际发送
+type testMailAdapter struct {
+	verifications  []types.M
+	passwordResets []types.M
+	messages       []mail.MailMessage
+}
+
+func (a *testMailAdapter) SendVerificationEmail(to, link string, user types.M) error {
+	a.verifications = append(a.verifications, types.M{"to": to, "link": link, "user": user})
+	return nil
+}
+
+func (a *testMailAdapter) SendPasswordResetEmail(to, link string, user types.M) error {
+	a.passwordResets = append(a.passwordResets, types.M{"to": to, "link": link, "user": user})
+	return nil
+}
+
+func (a *testMailAdapter) SendMail(message mail.MailMessage) error {
+	a.messages = append(a.messages, message)
+	return nil
+}
+
+func Test_reserveVerificationEmailRequest(t *testing.T) {
+	interval := config.TConfig.VerificationEmailRequestInterval
+	defer func() { config.TConfig.VerificationEmailRequestInterval = interval }()
+	now := time.Now()
+	/*****************************************************************/
+	config.TConfig.VerificationEmailRequestInterval = 300
+	if reserveVerificationEmailRequest("1001", now) == false {
+		t.Error("expect:", true, "result:", false)
+	}
+	if reserveVerificationEmailRequest("1001", now.Add(time.Minute)) == true {
+		t.Error("expect:", false, "result:", true)
+	}
+	if reserveVerificationEmailRequest("1002", now.Add(time.Minute)) == false {
+		t.Error("expect:", true, "result:", false)
+	}
+	if reserveVerificationEmailRequest("1001", now.Add(5*time.Minute)) == false {
+		t.Error("expect:", true, "result:", false)
+	}
+	// 发送失败时释放记录，允许立即重试
+	releaseVerificationEmailRequest("1001")
+	if reserveVerificationEmailRequest("1001", now.Add(5*time.Minute)) == false {
+		t.Error("expect:", true, "result:", false)
+	}
+	/*****************************************************************/
+	// 并发请求只有一个能够发送
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	reserved := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if reserveVerificationEmailRequest("1003", now) {
+				mutex.Lock()
+				reserved++
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if reserved != 1 {
+		t.Error("expect:", 1, "result:", reserved)
+	}
+	/*****************************************************************/
+	config.TConfig.VerificationEmailRequestInterval = 0
+	if reserveVerificationEmailRequest("1004", now) == false {
+		t.Error("expect:", true, "result:", false)
+	}
+	if reserveVerificationEmailRequest("1004", now) == false {
+		t.Error("expect:", true, "result:", false)
+	}
 }
 
 func Test_getUserIfNeeded(t *testing.T) {
@@ -233,50 +333,8 @@ func Test_getUserIfNeeded(t *testing.T) {
 	orm.TomatoDBController.DeleteEverything()
 }
 
-func Test_defaultVerificationEmail(t *testing.T) {
-	var options types.M
-	var result types.M
-	var expect types.M
-	var text string
-	/*********************************************************/
-	options = nil
-	result = defaultVerificationEmail(options)
-	expect = nil
-	if reflect.DeepEqual(expect, result) == false {
-		t.Error("expect:", expect, "result:", result)
-	}
-	/*********************************************************/
-	options = types.M{}
-	result = defaultVerificationEmail(options)
-	expect = nil
-	if reflect.DeepEqual(expect, result) == false {
-		t.Error("expect:", expect, "result:", result)
-	}
-	/*********************************************************/
-	options = types.M{
-		"user": types.M{
-			"email": "123@g.com",
-		},
-		"appName": "tomato",
-		"link":    "http://www.g.com",
-	}
-	result = defaultVerificationEmail(options)
-	text = "Hi,\n\n"
-	text += "You are being asked to confirm the e-mail address 123@g.com"
-	text += " with tomato\n\n"
-	text += "Click here to confirm it:\nhttp://www.g.com"
-	expect = types.M{
-		"text":    text,
-		"to":      "123@g.com",
-		"subject": "Please verify your e-mail for tomato",
-	}
-	if reflect.DeepEqual(expect, result) == false {
-		t.Error("expect:", expect, "result:", result)
-	}
-}
-
 func Test_SendPasswordResetEmail(t *testing.T) {
-	adapter = mail.NewSMTPAdapter()
+	adapter = &testMailAdapter{}
 	var schema types.M
 	var object types.M
 	var email string
@@ -299,7 +357,7 @@ func Test_SendPasswordResetEmail(t *testing.T) {
 	orm.Adapter.CreateObject("_User", schema, object)
 	email = "aa@g.cn"
 	result = SendPasswordResetEmail(email)
-	expect = errs.E(errs.EmailMissing, "you must provide an email")
+	expect = errs.E(errs.ObjectNotFound, "No user found with email aa@g.cn")
 	if reflect.DeepEqual(expect, result) == false {
 		t.Error("expect:", expect, "result:", result)
 	}
@@ -386,47 +444,33 @@ func Test_setPasswordResetToken(t *testing.T) {
 		t.Error("expect:", expect, "result:", result)
 	}
 	orm.TomatoDBController.DeleteEverything()
-}
-
-func Test_defaultResetPasswordEmail(t *testing.T) {
-	var options types.M
-	var result types.M
-	var expect types.M
-	var text string
-	/*********************************************************/
-	options = nil
-	result = defaultResetPasswordEmail(options)
-	expect = nil
-	if reflect.DeepEqual(expect, result) == false {
-		t.Error("expect:", expect, "result:", result)
-	}
-	/*********************************************************/
-	options = types.M{}
-	result = defaultResetPasswordEmail(options)
-	expect = nil
-	if reflect.DeepEqual(expect, result) == false {
-		t.Error("expect:", expect, "result:", result)
-	}
 	/*********************************************************/
-	options = types.M{
-		"user": types.M{
-			"email": "123@g.com",
+	initEnv()
+	config.TConfig.ResetTokenValidityDuration = 3600
+	config.TConfig.ResetTokenReuseIfValid = true
+	schema = types.M{
+		"fields": types.M{
+			"username": types.M{"type": "String"},
+			"email":    types.M{"type": "String"},
 		},
-		"appName": "tomato",
-		"link":    "http://www.g.com",
 	}
-	result = defaultResetPasswordEmail(options)
-	text = "Hi,\n\n"
-	text += "You requested to reset your password for tomato\n\n"
-	text += "Click here to reset it:\nhttp://www.g.com"
-	expect = types.M{
-		"text":    text,
-		"to":      "123@g.com",
-		"subject": "Password Reset for tomato",
+	orm.Adapter.CreateClass("_User", schema)
+	object = types.M{
+		"objectId":                     "1001",
+		"username":                     "joe",
+		"email":                        "abc@g.cn",
+		"_perishable_token":            "abc",
+		"_perishable_token_expires_at": utils.TimetoString(time.Now().UTC().Add(time.Hour)),
 	}
-	if reflect.DeepEqual(expect, result) == false {
-		t.Error("expect:", expect, "result:", result)
+	orm.Adapter.CreateObject("_User", schema, object)
+	email = "abc@g.cn"
+	result = setPasswordResetToken(email)
+	if result == nil || result["_perishable_token"] != "abc" {
+		t.Error("expect:", "abc", "result:", result)
 	}
+	config.TConfig.ResetTokenValidityDuration = 0
+	config.TConfig.ResetTokenReuseIfValid = false
+	orm.TomatoDBController.DeleteEverything()
 }
 
 func Test_VerifyEmail(t *testing.T) {
@@ -621,3 +665,98 @@ func Test_UpdatePassword(t *testing.T) {
 func Test_updateUserPassword(t *testing.T) {
 	// TODO
 }
+
+func Test_passwordChangedAt(t *testing.T) {
+	var v interface{}
+	var result time.Time
+	var ok bool
+	expect, _ := utils.StringtoTime("2017-03-01T09:10:10.000Z")
+	/*********************************************************/
+	v = nil
+	_, ok = passwordChangedAt(v)
+	if ok {
+		t.Error("expect:", false, "result:", ok)
+	}
+	/*********************************************************/
+	v = expect
+	result, ok = passwordChangedAt(v)
+	if ok == false || result.Equal(expect) == false {
+		t.Error("expect:", expect, "result:", result, ok)
+	}
+	/*********************************************************/
+	v = "2017-03-01T09:10:10.000Z"
+	result, ok = passwordChangedAt(v)
+	if ok == false || result.Equal(expect) == false {
+		t.Error("expect:", expect, "result:", result, ok)
+	}
+	/*********************************************************/
+	v = types.M{"__type": "Date", "iso": "2017-03-01T09:10:10.000Z"}
+	result, ok = passwordChangedAt(v)
+	if ok == false || result.Equal(expect) == false {
+		t.Error("expect:", expect, "result:", result, ok)
+	}
+	/*********************************************************/
+	v = types.M{"__type": "Date", "iso": ""}
+	_, ok = passwordChangedAt(v)
+	if ok {
+		t.Error("expect:", false, "result:", ok)
+	}
+}
+
+func Test_isPasswordExpired(t *testing.T) {
+	maxPasswordAge := config.TConfig.MaxPasswordAge
+	defer func() { config.TConfig.MaxPasswordAge = maxPasswordAge }()
+	config.TConfig.MaxPasswordAge = 30
+	now := time.Now()
+	/*********************************************************/
+	if isPasswordExpired(now.Add(-29*24*time.Hour), now) {
+		t.Error("expect:", false, "result:", true)
+	}
+	/*********************************************************/
+	if isPasswordExpired(now.Add(-31*24*time.Hour), now) == false {
+		t.Error("expect:", true, "result:", false)
+	}
+}
+
+func Test_CheckPasswordExpired(t *testing.T) {
+	passwordPolicy := config.TConfig.PasswordPolicy
+	maxPasswordAge := config.TConfig.MaxPasswordAge
+	defer func() {
+		config.TConfig.PasswordPolicy = passwordPolicy
+		config.TConfig.MaxPasswordAge = maxPasswordAge
+	}()
+	config.TConfig.PasswordPolicy = true
+	config.TConfig.MaxPasswordAge = 30
+	var user types.M
+	var err error
+	var expect error
+	/*********************************************************/
+	user = types.M{
+		"objectId":             "1001",
+		"_password_changed_at": time.Now().Add(-31 * 24 * time.Hour),
+	}
+	err = CheckPasswordExpired(user)
+	expect = errs.E(errs.PasswordExpired, "Your password has expired. Please reset your password.")
+	if reflect.DeepEqual(expect, err) == false {
+		t.Error("expect:", expect, "result:", err)
+	}
+	/*********************************************************/
+	user = types.M{
+		"objectId":             "1001",
+		"_password_changed_at": time.Now().Add(-29 * 24 * time.Hour),
+	}
+	err = CheckPasswordExpired(user)
+	if err != nil {
+		t.Error("expect:", nil, "result:", err)
+	}
+	/*********************************************************/
+	config.TConfig.MaxPasswordAge = 0
+	user = types.M{
+		"objectId":             "1001",
+		"_password_changed_at": time.Now().Add(-31 * 24 * time.Hour),
+	}
+	err = CheckPasswordExpired(user)
+	if err != nil {
+		t.Error("expect:", nil, "result:", err)
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"regexp"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"strconv"
 
@@ -16,6 +18,7 @@ import (
 	"github.com/lfq7413/tomato/errs"
 	"github.com/lfq7413/tomato/files"
 	"github.com/lfq7413/tomato/livequery"
+	"github.com/lfq7413/tomato/logger"
 	"github.com/lfq7413/tomato/orm"
 	"github.com/lfq7413/tomato/types"
 	"github.com/lfq7413/tomato/utils"
@@ -34,12 +37,14 @@ type Write struct {
 	updatedAt                  string
 	responseShouldHaveUsername bool
 	clientSDK                  map[string]string
+	context                    types.M
 }
 
 // NewWrite 可用于 create 和 update ， create 时 	query 为 nil
 // query 查询条件，当 update 请求时不为空
 // data 写入数据
 // originalData 原始对象数据，当 update 请求时不为空
+// data 中的 _context 不会写入数据库，会传递给 beforeSave 与 afterSave
 func NewWrite(
 	auth *Auth,
 	className string,
@@ -78,7 +83,12 @@ func NewWrite(
 		updatedAt:                  utils.TimetoString(time.Now().UTC()),
 		responseShouldHaveUsername: false,
 		clientSDK:                  clientSDK,
+		context:                    types.M{},
 	}
+	if context := utils.M(write.data["_context"]); context != nil {
+		write.context = context
+	}
+	delete(write.data, "_context")
 	return write, nil
 }
 
@@ -100,6 +110,10 @@ func (w *Write) Execute() (types.M, error) {
 	if err != nil {
 		return nil, err
 	}
+	err = w.handleRole()
+	if err != nil {
+		return nil, err
+	}
 	err = w.validateAuthData()
 	if err != nil {
 		return nil, err
@@ -259,6 +273,11 @@ func (w *Write) handleInstallation() error {
 				installationIDMatch = result
 			}
 			if w.data["deviceToken"] != nil && utils.S(result["deviceToken"]) == utils.S(w.data["deviceToken"]) {
+				// 不同应用中的相同 deviceToken 属于不同的设备
+				if w.data["appIdentifier"] != nil && result["appIdentifier"] != nil &&
+					utils.S(w.data["appIdentifier"]) != utils.S(result["appIdentifier"]) {
+					continue
+				}
 				deviceTokenMatches = append(deviceTokenMatches, result)
 			}
 		}
@@ -415,6 +434,47 @@ func (w *Write) handleInstallation() error {
 	return nil
 }
 
+var roleNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_\-]+$`)
+
+// handleRole 校验 _Role 的 name 字段，以及 users roles 两个 Relation 字段指向的类
+func (w *Write) handleRole() error {
+	if w.response != nil || w.className != "_Role" {
+		return nil
+	}
+
+	if name, ok := w.data["name"]; ok {
+		// 角色名称只能在创建时设置
+		if w.query != nil {
+			return errs.E(errs.InvalidRoleName, "A role's name can only be set before it has been saved.")
+		}
+		n, ok := name.(string)
+		if ok == false || roleNameRegexp.MatchString(n) == false {
+			return errs.E(errs.InvalidRoleName, "A role's name can only contain alphanumeric characters, _ and -.")
+		}
+	}
+
+	targetClasses := map[string]string{
+		"users": "_User",
+		"roles": "_Role",
+	}
+	for key, targetClass := range targetClasses {
+		op := utils.M(w.data[key])
+		if op == nil {
+			continue
+		}
+		if name := utils.S(op["__op"]); name != "AddRelation" && name != "RemoveRelation" {
+			continue
+		}
+		for _, v := range utils.A(op["objects"]) {
+			if object := utils.M(v); object != nil && utils.S(object["className"]) != targetClass {
+				return errs.E(errs.InvalidJSON, "objects in "+key+" must be pointers to "+targetClass)
+			}
+		}
+	}
+
+	return nil
+}
+
 // handleSession 处理 _Session 表的操作
 func (w *Write) handleSession() error {
 	if w.response != nil || w.className != "_Session" {
@@ -429,6 +489,16 @@ func (w *Write) handleSession() error {
 		return errs.E(errs.InvalidKeyName, "Cannot set ACL on a Session.")
 	}
 
+	// 非 Master 权限不允许把 session 转给其他用户，也不允许修改 sessionToken
+	if w.auth.IsMaster == false {
+		if w.data["sessionToken"] != nil {
+			return errs.E(errs.InvalidKeyName, "Invalid field name: sessionToken.")
+		}
+		if user := utils.M(w.data["user"]); user != nil && utils.S(user["objectId"]) != utils.S(w.auth.User["objectId"]) {
+			return errs.E(errs.InvalidKeyName, "Invalid field name: user.")
+		}
+	}
+
 	// 当前为 create 请求，并且不是 Master 权限时
 	if w.query == nil && w.auth.IsMaster == false {
 		// 生成 token ，过期时间为 1 年
@@ -533,9 +603,12 @@ func (w *Write) handleAuthData(authData types.M) error {
 		return errs.E(errs.AccountAlreadyLinked, "this auth is already used")
 	}
 
-	// 保存登录方式
+	// 保存登录方式，值为 null 的表示解除关联，不计入登录方式
 	keys := []string{}
-	for k := range authData {
+	for k, v := range authData {
+		if v == nil {
+			continue
+		}
 		keys = append(keys, k)
 	}
 	w.storage["authProvider"] = strings.Join(keys, ",")
@@ -603,10 +676,81 @@ func (w *Write) handleAuthData(authData types.M) error {
 		}
 	}
 
-	// 当前第三方数据未关联任何用户或者是 update 请求时，会来到这里
+	if w.query != nil && w.query["objectId"] != nil {
+		// update 请求时，传入的 authData 会合并到已有的 authData 中，仅校验新增或者修改的部分
+		mutatedAuthData, err := w.mutatedAuthData(authData)
+		if err != nil {
+			return err
+		}
+		return w.handleAuthDataValidation(mutatedAuthData)
+	}
+
+	// 当前第三方数据未关联任何用户时，会来到这里
 	return w.handleAuthDataValidation(authData)
 }
 
+// mutatedAuthData 对比用户已有的 authData ，返回新增或者修改的第三方登录数据
+func (w *Write) mutatedAuthData(authData types.M) (types.M, error) {
+	results, err := orm.TomatoDBController.Find(w.className, types.M{"objectId": w.query["objectId"]}, types.M{})
+	if err != nil {
+		return nil, err
+	}
+	var userAuthData types.M
+	if len(results) > 0 {
+		if user := utils.M(results[0]); user != nil {
+			userAuthData = utils.M(user["authData"])
+		}
+	}
+
+	mutatedAuthData := types.M{}
+	for provider, providerData := range authData {
+		if providerData == nil {
+			continue
+		}
+		if userAuthData != nil && reflect.DeepEqual(providerData, userAuthData[provider]) {
+			continue
+		}
+		mutatedAuthData[provider] = providerData
+	}
+	return mutatedAuthData, nil
+}
+
+// upgradeAnonymousUser 匿名用户设置了用户名或密码时，解除 anonymous 关联
+func (w *Write) upgradeAnonymousUser() error {
+	if w.query == nil {
+		return nil
+	}
+	if utils.S(w.data["username"]) == "" && utils.S(w.data["password"]) == "" {
+		return nil
+	}
+	authData := utils.M(w.data["authData"])
+	if authData != nil {
+		if _, ok := authData["anonymous"]; ok {
+			return nil
+		}
+	}
+
+	results, err := orm.TomatoDBController.Find(w.className, types.M{"objectId": w.objectID()}, types.M{})
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		return nil
+	}
+	user := utils.M(results[0])
+	userAuthData := utils.M(user["authData"])
+	if userAuthData == nil || userAuthData["anonymous"] == nil {
+		return nil
+	}
+
+	if authData == nil {
+		authData = types.M{}
+	}
+	authData["anonymous"] = nil
+	w.data["authData"] = authData
+	return nil
+}
+
 // handleAuthDataValidation 校验第三方登录数据
 func (w *Write) handleAuthDataValidation(authData types.M) error {
 	for k, v := range authData {
@@ -682,26 +826,26 @@ func (w *Write) runBeforeTrigger() error {
 		updatedObject[k] = v
 	}
 
-	response, err := maybeRunTrigger(cloud.TypeBeforeSave, w.auth, updatedObject, originalObject)
+	response, err := maybeRunTrigger(cloud.TypeBeforeSave, w.auth, updatedObject, originalObject, w.context)
 	if err != nil {
 		return err
 	}
 	if response != nil && utils.M(response["object"]) != nil {
 		object := utils.M(response["object"])
-		// 删除额外添加的字段
-		delete(object, "className")
-		if w.query != nil && w.query["objectId"] != nil {
-			delete(object, "objectId")
-		}
+		// 仅合并回调中修改过的字段，{"__op":"Delete"} 会在写入时删除对应字段
 		fields := []string{}
 		for k, v := range object {
+			switch k {
+			case "className", "objectId", "createdAt", "updatedAt":
+				continue
+			}
 			if reflect.DeepEqual(w.data[k], v) == false {
 				fields = append(fields, k)
+				w.data[k] = v
 			}
 		}
 		if len(fields) > 0 {
 			w.storage["fieldsChangedByTrigger"] = fields
-			w.data = object
 		}
 	}
 
@@ -738,6 +882,12 @@ func (w *Write) transformUser() error {
 		}
 	}
 
+	// 匿名用户设置用户名或密码后，转为普通用户
+	err := w.upgradeAnonymousUser()
+	if err != nil {
+		return err
+	}
+
 	// 如果是正在更新 _User ，则清除相应用户的 session 缓存
 	if w.query != nil {
 		where := types.M{
@@ -751,6 +901,7 @@ func (w *Write) transformUser() error {
 		if err != nil {
 			return err
 		}
+		query.skipAfterFind = true
 		response, err := query.Execute()
 		if err != nil {
 			return err
@@ -786,7 +937,7 @@ func (w *Write) transformUser() error {
 	}
 
 	// 处理用户名，检测用户名是否唯一
-	err := w.validateUserName()
+	err = w.validateUserName()
 	if err != nil {
 		return err
 	}
@@ -875,6 +1026,9 @@ func (w *Write) validatePasswordPolicy() error {
 	if config.TConfig.PasswordPolicy == false {
 		return nil
 	}
+	if w.auth.IsMaster && w.auth.isPasswordReset == false && config.TConfig.PasswordPolicyExemptMaster {
+		return nil
+	}
 	err := w.validatePasswordRequirements()
 	if err != nil {
 		return err
@@ -885,7 +1039,17 @@ func (w *Write) validatePasswordPolicy() error {
 // validatePasswordRequirements 检测密码是否符合设定的密码规则。 go 中的 regexp 不支持 backtracking ，无法使用 (?= 表达式
 func (w *Write) validatePasswordRequirements() error {
 	policyError := "Password does not meet the Password Policy requirements."
+	if config.TConfig.ValidationError != "" {
+		policyError = config.TConfig.ValidationError
+	}
 	password := utils.S(w.data["password"])
+	// 检测长度、大小写、数字与符号规则
+	if msg := unmetPasswordRule(password); msg != "" {
+		if config.TConfig.ValidationError != "" {
+			msg = config.TConfig.ValidationError
+		}
+		return errs.E(errs.ValidationError, msg)
+	}
 	// 检测密码是否符合设定的正则表达式
 	if config.TConfig.ValidatorPattern != "" {
 		b, _ := regexp.MatchString(config.TConfig.ValidatorPattern, password)
@@ -893,13 +1057,14 @@ func (w *Write) validatePasswordRequirements() error {
 			return errs.E(errs.ValidationError, policyError)
 		}
 	}
-	// 检测密码是否包含用户名
+	// 使用回调函数检测密码
+	if config.TConfig.ValidatorCallback != nil && config.TConfig.ValidatorCallback(password) == false {
+		return errs.E(errs.ValidationError, policyError)
+	}
+	// 检测密码是否包含用户名，不区分大小写
 	if config.TConfig.DoNotAllowUsername {
-		if username := utils.S(w.data["username"]); username != "" {
-			if strings.Index(password, username) >= 0 {
-				return errs.E(errs.ValidationError, policyError)
-			}
-		} else {
+		username := utils.S(w.data["username"])
+		if username == "" {
 			// username 不存在时，从数据库中取出再去检测
 			query := types.M{"objectId": w.objectID()}
 			results, err := orm.TomatoDBController.Find("_User", query, types.M{})
@@ -910,14 +1075,56 @@ func (w *Write) validatePasswordRequirements() error {
 				return errs.E(errs.ValidationError, policyError)
 			}
 			result := utils.M(results[0])
-			if result == nil || strings.Index(password, utils.S(result["username"])) >= 0 {
+			if result == nil {
 				return errs.E(errs.ValidationError, policyError)
 			}
+			username = utils.S(result["username"])
+		}
+		if passwordContainsUsername(password, username) {
+			return errs.E(errs.ValidationError, policyError)
 		}
 	}
 	return nil
 }
 
+// unmetPasswordRule 返回密码未满足的规则描述，全部满足时返回空字符串
+func unmetPasswordRule(password string) string {
+	if utf8.RuneCountInString(password) < config.TConfig.PasswordMinLength {
+		return "Password must be at least " + strconv.Itoa(config.TConfig.PasswordMinLength) + " characters long."
+	}
+	var hasUpper, hasLower, hasNumber, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasNumber = true
+		case unicode.IsLetter(r) == false && unicode.IsSpace(r) == false:
+			hasSymbol = true
+		}
+	}
+	if config.TConfig.PasswordRequireMixedCase && (hasUpper == false || hasLower == false) {
+		return "Password must contain both uppercase and lowercase letters."
+	}
+	if config.TConfig.PasswordRequireNumber && hasNumber == false {
+		return "Password must contain at least one number."
+	}
+	if config.TConfig.PasswordRequireSymbol && hasSymbol == false {
+		return "Password must contain at least one symbol."
+	}
+	return ""
+}
+
+// passwordContainsUsername 密码中是否包含用户名，不区分大小写
+func passwordContainsUsername(password, username string) bool {
+	if username == "" {
+		return false
+	}
+	return strings.Contains(strings.ToLower(password), strings.ToLower(username))
+}
+
 // validatePasswordHistory 校验密码历史
 func (w *Write) validatePasswordHistory() error {
 	if w.query == nil || config.TConfig.MaxPasswordHistory == 0 {
@@ -927,7 +1134,8 @@ func (w *Write) validatePasswordHistory() error {
 		"objectId": w.objectID(),
 	}
 	options := types.M{
-		"keys": []string{"_password_history", "_hashed_password"},
+		"keys":                   []string{"_password_history", "_hashed_password"},
+		"includePasswordHistory": true,
 	}
 	results, err := orm.TomatoDBController.Find("_User", query, options)
 	if err != nil {
@@ -973,10 +1181,6 @@ func (w *Write) runDatabaseOperation() error {
 		return nil
 	}
 
-	if w.className == "_Role" {
-		cache.Role.Clear()
-	}
-
 	if w.className == "_User" && w.query != nil &&
 		w.auth.CouldUpdateUserID(utils.S(w.query["objectId"])) == false {
 		// 不能更新该用户，Master 可以更新任意用户，普通用户仅可更新自身
@@ -1017,7 +1221,8 @@ func (w *Write) runDatabaseOperation() error {
 				"objectId": w.objectID(),
 			}
 			options := types.M{
-				"keys": []string{"_password_history", "_hashed_password"},
+				"keys":                   []string{"_password_history", "_hashed_password"},
+				"includePasswordHistory": true,
 			}
 			results, err := orm.TomatoDBController.Find("_User", query, options)
 			if err != nil {
@@ -1234,6 +1439,8 @@ func (w *Write) runAfterTrigger() error {
 		return nil
 	}
 
+	w.invalidateRoleCache()
+
 	hasAfterSaveHook := cloud.TriggerExists(cloud.TypeAfterSave, w.className)
 	hasLiveQuery := false
 	if livequery.TLiveQuery != nil {
@@ -1266,12 +1473,72 @@ func (w *Write) runAfterTrigger() error {
 
 	if hasAfterSaveHook {
 		// TODO 不等待回调返回
-		maybeRunTrigger(cloud.TypeAfterSave, w.auth, updatedObject, originalObject)
+		// afterSave 出错时不影响本次请求的结果，仅记录日志
+		_, err := maybeRunTrigger(cloud.TypeAfterSave, w.auth, updatedObject, originalObject, w.context)
+		if err != nil {
+			logger.Error("afterSave failed for", w.className, err)
+		}
 	}
 
 	return nil
 }
 
+// invalidateRoleCache _Role 保存成功后，清除成员关系发生变化的用户的角色缓存
+func (w *Write) invalidateRoleCache() {
+	if w.className != "_Role" {
+		return
+	}
+	userIDs, clearAll := roleCacheInvalidation(w.data, w.query != nil)
+	if clearAll {
+		cache.Role.Clear()
+		return
+	}
+	for _, id := range userIDs {
+		cache.Role.Del(id)
+	}
+}
+
+// roleCacheInvalidation 根据 _Role 的写入数据计算需要清除角色缓存的用户
+// 修改角色继承关系或者角色名时，无法直接确定受影响的用户，需要清除全部角色缓存
+func roleCacheInvalidation(data types.M, isUpdate bool) ([]string, bool) {
+	userIDs := []string{}
+	if _, ok := data["roles"]; ok {
+		return userIDs, true
+	}
+	if _, ok := data["name"]; ok && isUpdate {
+		return userIDs, true
+	}
+	users, ok := data["users"]
+	if ok == false {
+		return userIDs, false
+	}
+	op := utils.M(users)
+	if op == nil {
+		return userIDs, true
+	}
+	ops := types.S{op}
+	if utils.S(op["__op"]) == "Batch" {
+		ops = utils.A(op["ops"])
+	}
+	for _, v := range ops {
+		o := utils.M(v)
+		if o == nil {
+			return userIDs, true
+		}
+		switch utils.S(o["__op"]) {
+		case "AddRelation", "RemoveRelation":
+			for _, object := range utils.A(o["objects"]) {
+				if pointer := utils.M(object); pointer != nil && utils.S(pointer["objectId"]) != "" {
+					userIDs = append(userIDs, utils.S(pointer["objectId"]))
+				}
+			}
+		default:
+			return userIDs, true
+		}
+	}
+	return userIDs, false
+}
+
 // location 获取对象路径
 func (w *Write) location() string {
 	var middle string
@@ -996,7 +996,7 @@ func TestPostgres_validateAuthData(t *testing.T) {
 	data = types.M{
 		"authData": types.M{
 			"anonymous": types.M{
-				"id": "1001",
+				"id": "00000000-0000-4000-8000-000000001001",
 			},
 		},
 	}
@@ -2189,7 +2189,7 @@ func TestPostgres_handleAuthData(t *testing.T) {
 		"objectId": "101",
 		"authData": types.M{
 			"anonymous": types.M{
-				"id": "1001",
+				"id": "00000000-0000-4000-8000-000000001001",
 			},
 		},
 	}
@@ -2198,7 +2198,7 @@ func TestPostgres_handleAuthData(t *testing.T) {
 		"objectId": "102",
 		"authData": types.M{
 			"anonymous": types.M{
-				"id": "1001",
+				"id": "00000000-0000-4000-8000-000000001001",
 			},
 		},
 	}
@@ -2208,7 +2208,7 @@ func TestPostgres_handleAuthData(t *testing.T) {
 	data = types.M{
 		"authData": types.M{
 			"anonymous": types.M{
-				"id": "1001",
+				"id": "00000000-0000-4000-8000-000000001001",
 			},
 		},
 	}
@@ -2235,7 +2235,7 @@ func TestPostgres_handleAuthData(t *testing.T) {
 		"objectId": "101",
 		"authData": types.M{
 			"anonymous": types.M{
-				"id": "1001",
+				"id": "00000000-0000-4000-8000-000000001001",
 			},
 		},
 	}
@@ -2245,7 +2245,7 @@ func TestPostgres_handleAuthData(t *testing.T) {
 	data = types.M{
 		"authData": types.M{
 			"anonymous": types.M{
-				"id": "1002",
+				"id": "00000000-0000-4000-8000-000000001002",
 			},
 		},
 	}
@@ -2278,7 +2278,7 @@ func TestPostgres_handleAuthData(t *testing.T) {
 		"objectId": "101",
 		"authData": types.M{
 			"anonymous": types.M{
-				"id": "1001",
+				"id": "00000000-0000-4000-8000-000000001001",
 			},
 		},
 	}
@@ -2288,7 +2288,7 @@ func TestPostgres_handleAuthData(t *testing.T) {
 	data = types.M{
 		"authData": types.M{
 			"anonymous": types.M{
-				"id": "1001",
+				"id": "00000000-0000-4000-8000-000000001001",
 			},
 		},
 	}
@@ -2303,7 +2303,7 @@ func TestPostgres_handleAuthData(t *testing.T) {
 		"objectId": "101",
 		"authData": map[string]interface{}{
 			"anonymous": types.M{
-				"id": "1001",
+				"id": "00000000-0000-4000-8000-000000001001",
 			},
 		},
 	}
@@ -2333,7 +2333,7 @@ func TestPostgres_handleAuthData(t *testing.T) {
 		"objectId": "101",
 		"authData": types.M{
 			"anonymous": types.M{
-				"id":    "1001",
+				"id":    "00000000-0000-4000-8000-000000001001",
 				"token": "aaa",
 			},
 		},
@@ -2344,7 +2344,7 @@ func TestPostgres_handleAuthData(t *testing.T) {
 	data = types.M{
 		"authData": types.M{
 			"anonymous": types.M{
-				"id":    "1001",
+				"id":    "00000000-0000-4000-8000-000000001001",
 				"token": "abc",
 			},
 		},
@@ -2360,7 +2360,7 @@ func TestPostgres_handleAuthData(t *testing.T) {
 		"objectId": "101",
 		"authData": map[string]interface{}{
 			"anonymous": types.M{
-				"id":    "1001",
+				"id":    "00000000-0000-4000-8000-000000001001",
 				"token": "abc",
 			},
 		},
@@ -2377,7 +2377,7 @@ func TestPostgres_handleAuthData(t *testing.T) {
 		"objectId": "101",
 		"authData": types.M{
 			"anonymous": map[string]interface{}{
-				"id":    "1001",
+				"id":    "00000000-0000-4000-8000-000000001001",
 				"token": "abc",
 			},
 		},
@@ -2404,7 +2404,7 @@ func TestPostgres_handleAuthData(t *testing.T) {
 		"objectId": "101",
 		"authData": types.M{
 			"anonymous": types.M{
-				"id":    "1001",
+				"id":    "00000000-0000-4000-8000-000000001001",
 				"token": "aaa",
 			},
 		},
@@ -2415,7 +2415,7 @@ func TestPostgres_handleAuthData(t *testing.T) {
 	data = types.M{
 		"authData": types.M{
 			"anonymous": types.M{
-				"id":    "1001",
+				"id":    "00000000-0000-4000-8000-000000001001",
 				"token": "aaa",
 			},
 		},
@@ -2446,7 +2446,7 @@ func TestPostgres_handleAuthData(t *testing.T) {
 		"objectId": "101",
 		"authData": types.M{
 			"anonymous": types.M{
-				"id":    "1001",
+				"id":    "00000000-0000-4000-8000-000000001001",
 				"token": "aaa",
 			},
 		},
@@ -2457,7 +2457,7 @@ func TestPostgres_handleAuthData(t *testing.T) {
 	data = types.M{
 		"authData": types.M{
 			"anonymous": types.M{
-				"id":    "1001",
+				"id":    "00000000-0000-4000-8000-000000001001",
 				"token": "aaa",
 			},
 		},
@@ -2488,7 +2488,7 @@ func TestPostgres_handleAuthDataValidation(t *testing.T) {
 	w, _ = NewWrite(Master(), "user", query, data, originalData, nil)
 	authData = types.M{
 		"anonymous": types.M{
-			"id": "1001",
+			"id": "00000000-0000-4000-8000-000000001001",
 		},
 	}
 	result = w.handleAuthDataValidation(authData)
@@ -2,6 +2,7 @@ package rest
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -838,6 +839,48 @@ func Test_handleInstallation(t *testing.T) {
 		t.Error("expect:", expect, "result:", results, err)
 	}
 	orm.TomatoDBController.DeleteEverything()
+	/***************************************************************/
+	initEnv()
+	schema = types.M{
+		"fields": types.M{
+			"installationId": types.M{"type": "String"},
+			"deviceToken":    types.M{"type": "String"},
+			"deviceType":     types.M{"type": "String"},
+			"appIdentifier":  types.M{"type": "String"},
+		},
+	}
+	orm.Adapter.CreateClass("_Installation", schema)
+	object = types.M{
+		"objectId":      "1001",
+		"deviceToken":   "aaa",
+		"deviceType":    "ios",
+		"appIdentifier": "com.g.app1",
+	}
+	orm.Adapter.CreateObject("_Installation", schema, object)
+	query = nil
+	data = types.M{"deviceToken": "aaa", "deviceType": "ios", "appIdentifier": "com.g.app2"}
+	originalData = nil
+	w, _ = NewWrite(Master(), "_Installation", query, data, originalData, nil)
+	err = w.handleInstallation()
+	expectErr = nil
+	if reflect.DeepEqual(expectErr, err) == false {
+		t.Error("expect:", expectErr, "result:", err)
+	}
+	if w.query != nil {
+		t.Error("expect:", nil, "result:", w.query)
+	}
+	/***************************************************************/
+	data = types.M{"deviceToken": "aaa", "deviceType": "ios", "appIdentifier": "com.g.app1"}
+	w, _ = NewWrite(Master(), "_Installation", query, data, originalData, nil)
+	err = w.handleInstallation()
+	if reflect.DeepEqual(expectErr, err) == false {
+		t.Error("expect:", expectErr, "result:", err)
+	}
+	expectQuery = types.M{"objectId": "1001"}
+	if reflect.DeepEqual(expectQuery, w.query) == false {
+		t.Error("expect:", expectQuery, "result:", w.query)
+	}
+	orm.TomatoDBController.DeleteEverything()
 }
 
 func Test_handleSession(t *testing.T) {
@@ -885,6 +928,34 @@ func Test_handleSession(t *testing.T) {
 		t.Error("expect:", expectErr, "result:", err)
 	}
 	/***************************************************************/
+	auth = &Auth{
+		IsMaster: false,
+		User:     types.M{"objectId": "1001"},
+	}
+	query = types.M{"objectId": "2001"}
+	data = types.M{"sessionToken": "r:abc"}
+	originalData = nil
+	w, _ = NewWrite(auth, "_Session", query, data, originalData, nil)
+	err = w.handleSession()
+	expectErr = errs.E(errs.InvalidKeyName, "Invalid field name: sessionToken.")
+	if reflect.DeepEqual(expectErr, err) == false {
+		t.Error("expect:", expectErr, "result:", err)
+	}
+	/***************************************************************/
+	auth = &Auth{
+		IsMaster: false,
+		User:     types.M{"objectId": "1001"},
+	}
+	query = types.M{"objectId": "2001"}
+	data = types.M{"user": types.M{"__type": "Pointer", "className": "_User", "objectId": "1002"}}
+	originalData = nil
+	w, _ = NewWrite(auth, "_Session", query, data, originalData, nil)
+	err = w.handleSession()
+	expectErr = errs.E(errs.InvalidKeyName, "Invalid field name: user.")
+	if reflect.DeepEqual(expectErr, err) == false {
+		t.Error("expect:", expectErr, "result:", err)
+	}
+	/***************************************************************/
 	initEnv()
 	auth = &Auth{
 		IsMaster: false,
@@ -908,6 +979,72 @@ func Test_handleSession(t *testing.T) {
 	orm.TomatoDBController.DeleteEverything()
 }
 
+func Test_handleRole(t *testing.T) {
+	var w *Write
+	var query types.M
+	var data types.M
+	var err, expectErr error
+	/***************************************************************/
+	query = nil
+	data = types.M{"name": "Admin_1-a"}
+	w, _ = NewWrite(Master(), "_Role", query, data, nil, nil)
+	err = w.handleRole()
+	expectErr = nil
+	if reflect.DeepEqual(expectErr, err) == false {
+		t.Error("expect:", expectErr, "result:", err)
+	}
+	/***************************************************************/
+	query = nil
+	data = types.M{"name": "Admin Role"}
+	w, _ = NewWrite(Master(), "_Role", query, data, nil, nil)
+	err = w.handleRole()
+	expectErr = errs.E(errs.InvalidRoleName, "A role's name can only contain alphanumeric characters, _ and -.")
+	if reflect.DeepEqual(expectErr, err) == false {
+		t.Error("expect:", expectErr, "result:", err)
+	}
+	/***************************************************************/
+	query = types.M{"objectId": "1001"}
+	data = types.M{"name": "Admin"}
+	w, _ = NewWrite(Master(), "_Role", query, data, nil, nil)
+	err = w.handleRole()
+	expectErr = errs.E(errs.InvalidRoleName, "A role's name can only be set before it has been saved.")
+	if reflect.DeepEqual(expectErr, err) == false {
+		t.Error("expect:", expectErr, "result:", err)
+	}
+	/***************************************************************/
+	query = types.M{"objectId": "1001"}
+	data = types.M{
+		"users": types.M{
+			"__op": "AddRelation",
+			"objects": types.S{
+				types.M{"__type": "Pointer", "className": "_Role", "objectId": "2001"},
+			},
+		},
+	}
+	w, _ = NewWrite(Master(), "_Role", query, data, nil, nil)
+	err = w.handleRole()
+	expectErr = errs.E(errs.InvalidJSON, "objects in users must be pointers to _User")
+	if reflect.DeepEqual(expectErr, err) == false {
+		t.Error("expect:", expectErr, "result:", err)
+	}
+	/***************************************************************/
+	query = types.M{"objectId": "1001"}
+	data = types.M{
+		"roles": types.M{
+			"__op": "RemoveRelation",
+			"objects": types.S{
+				types.M{"__type": "Pointer", "className": "_Role", "objectId": "2001"},
+			},
+		},
+	}
+	w, _ = NewWrite(Master(), "_Role", query, data, nil, nil)
+	err = w.handleRole()
+	expectErr = nil
+	if reflect.DeepEqual(expectErr, err) == false {
+		t.Error("expect:", expectErr, "result:", err)
+	}
+}
+
 func Test_validateAuthData(t *testing.T) {
 	var className string
 	var w *Write
@@ -983,7 +1120,7 @@ func Test_validateAuthData(t *testing.T) {
 	data = types.M{
 		"authData": types.M{
 			"anonymous": types.M{
-				"id": "1001",
+				"id": "00000000-0000-4000-8000-000000001001",
 			},
 		},
 	}
@@ -1208,6 +1345,66 @@ func Test_runBeforeTrigger(t *testing.T) {
 		t.Error("expect:", nil, "result:", w.storage["fieldsChangedByTrigger"])
 	}
 	cloud.UnregisterAll()
+	/***************************************************************/
+	cloud.BeforeSave("user", func(request cloud.TriggerRequest, response cloud.Response) {
+		response.Success(types.M{
+			"objectId": "2001",
+			"status":   "approved",
+			"key":      types.M{"__op": "Delete"},
+		})
+	})
+	query = types.M{"objectId": "1001"}
+	data = types.M{
+		"username": "joe",
+		"key":      "hello",
+	}
+	originalData = nil
+	w, _ = NewWrite(Master(), "user", query, data, originalData, nil)
+	result = w.runBeforeTrigger()
+	expect = nil
+	if reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "result:", result)
+	}
+	expectData = types.M{
+		"username": "joe",
+		"status":   "approved",
+		"key":      types.M{"__op": "Delete"},
+	}
+	if reflect.DeepEqual(expectData, w.data) == false {
+		t.Error("expect:", expectData, "result:", w.data)
+	}
+	cloud.UnregisterAll()
+	/***************************************************************/
+	cloud.BeforeSave("user", func(request cloud.TriggerRequest, response cloud.Response) {
+		if request.Context["source"] != "app" {
+			response.Error(1, "context is missing")
+			return
+		}
+		request.Context["checked"] = true
+		response.Success(nil)
+	})
+	query = nil
+	data = types.M{
+		"username": "joe",
+		"_context": types.M{"source": "app"},
+	}
+	originalData = nil
+	w, _ = NewWrite(Master(), "user", query, data, originalData, nil)
+	result = w.runBeforeTrigger()
+	expect = nil
+	if reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "result:", result)
+	}
+	expectData = types.M{
+		"username": "joe",
+	}
+	if reflect.DeepEqual(expectData, w.data) == false {
+		t.Error("expect:", expectData, "result:", w.data)
+	}
+	if reflect.DeepEqual(types.M{"source": "app", "checked": true}, w.context) == false {
+		t.Error("expect:", types.M{"source": "app", "checked": true}, "result:", w.context)
+	}
+	cloud.UnregisterAll()
 }
 
 func Test_setRequiredFieldsIfNeeded(t *testing.T) {
@@ -1376,6 +1573,50 @@ func Test_transformUser(t *testing.T) {
 	/***************************************************************/
 	initEnv()
 	config.TConfig.PasswordPolicy = true
+	config.TConfig.DoNotAllowUsername = true
+	query = nil
+	data = types.M{
+		"username": "Joe",
+		"password": "jOE123456",
+	}
+	originalData = nil
+	w, _ = NewWrite(Master(), "_User", query, data, originalData, nil)
+	w.data["objectId"] = "1001"
+	err = w.transformUser()
+	expectErr = errs.E(errs.ValidationError, policyError)
+	if reflect.DeepEqual(expectErr, err) == false {
+		t.Error("expect:", expectErr, "result:", err)
+	}
+	config.TConfig.DoNotAllowUsername = false
+	config.TConfig.PasswordPolicy = false
+	orm.TomatoDBController.DeleteEverything()
+	/***************************************************************/
+	initEnv()
+	config.TConfig.PasswordPolicy = true
+	config.TConfig.ValidationError = "Password must contain a digit."
+	config.TConfig.ValidatorCallback = func(password string) bool {
+		return strings.ContainsAny(password, "0123456789")
+	}
+	query = nil
+	data = types.M{
+		"username": "joe",
+		"password": "abcdef",
+	}
+	originalData = nil
+	w, _ = NewWrite(Master(), "_User", query, data, originalData, nil)
+	w.data["objectId"] = "1001"
+	err = w.transformUser()
+	expectErr = errs.E(errs.ValidationError, "Password must contain a digit.")
+	if reflect.DeepEqual(expectErr, err) == false {
+		t.Error("expect:", expectErr, "result:", err)
+	}
+	config.TConfig.ValidatorCallback = nil
+	config.TConfig.ValidationError = ""
+	config.TConfig.PasswordPolicy = false
+	orm.TomatoDBController.DeleteEverything()
+	/***************************************************************/
+	initEnv()
+	config.TConfig.PasswordPolicy = true
 	config.TConfig.MaxPasswordHistory = 3
 	schema = types.M{
 		"fields": types.M{
@@ -2055,6 +2296,279 @@ func Test_runAfterTrigger(t *testing.T) {
 	cloud.UnregisterAll()
 }
 
+func Test_validatePasswordPolicy(t *testing.T) {
+	var w *Write
+	var auth *Auth
+	var err, expectErr error
+	passwordPolicy := config.TConfig.PasswordPolicy
+	minLength := config.TConfig.PasswordMinLength
+	exemptMaster := config.TConfig.PasswordPolicyExemptMaster
+	defer func() {
+		config.TConfig.PasswordPolicy = passwordPolicy
+		config.TConfig.PasswordMinLength = minLength
+		config.TConfig.PasswordPolicyExemptMaster = exemptMaster
+	}()
+	config.TConfig.PasswordPolicy = true
+	config.TConfig.PasswordMinLength = 8
+	expectErr = errs.E(errs.ValidationError, "Password must be at least 8 characters long.")
+	/***************************************************************/
+	config.TConfig.PasswordPolicyExemptMaster = false
+	w, _ = NewWrite(Master(), "_User", nil, types.M{"password": "123"}, nil, nil)
+	err = w.validatePasswordPolicy()
+	if reflect.DeepEqual(expectErr, err) == false {
+		t.Error("expect:", expectErr, "result:", err)
+	}
+	/***************************************************************/
+	config.TConfig.PasswordPolicyExemptMaster = true
+	w, _ = NewWrite(Master(), "_User", nil, types.M{"password": "123"}, nil, nil)
+	err = w.validatePasswordPolicy()
+	if err != nil {
+		t.Error("expect:", nil, "result:", err)
+	}
+	w, _ = NewWrite(Nobody(), "_User", nil, types.M{"password": "123"}, nil, nil)
+	err = w.validatePasswordPolicy()
+	if reflect.DeepEqual(expectErr, err) == false {
+		t.Error("expect:", expectErr, "result:", err)
+	}
+	// 重置密码流程不跳过校验
+	auth = Master()
+	auth.isPasswordReset = true
+	w, _ = NewWrite(auth, "_User", nil, types.M{"password": "123"}, nil, nil)
+	err = w.validatePasswordPolicy()
+	if reflect.DeepEqual(expectErr, err) == false {
+		t.Error("expect:", expectErr, "result:", err)
+	}
+}
+
+func Test_unmetPasswordRule(t *testing.T) {
+	minLength := config.TConfig.PasswordMinLength
+	mixedCase := config.TConfig.PasswordRequireMixedCase
+	number := config.TConfig.PasswordRequireNumber
+	symbol := config.TConfig.PasswordRequireSymbol
+	defer func() {
+		config.TConfig.PasswordMinLength = minLength
+		config.TConfig.PasswordRequireMixedCase = mixedCase
+		config.TConfig.PasswordRequireNumber = number
+		config.TConfig.PasswordRequireSymbol = symbol
+	}()
+	config.TConfig.PasswordMinLength = 8
+	config.TConfig.PasswordRequireMixedCase = true
+	config.TConfig.PasswordRequireNumber = true
+	config.TConfig.PasswordRequireSymbol = true
+	tests := []struct {
+		password string
+		expect   string
+	}{
+		{"Ab1!", "Password must be at least 8 characters long."},
+		{"密码密码密码密码", "Password must contain both uppercase and lowercase letters."},
+		{"abcdefgh1!", "Password must contain both uppercase and lowercase letters."},
+		{"ABCDEFGH1!", "Password must contain both uppercase and lowercase letters."},
+		{"Abcdefgh!", "Password must contain at least one number."},
+		{"Abcdefgh1", "Password must contain at least one symbol."},
+		{"Abcdefg 1", "Password must contain at least one symbol."},
+		{"Abcdefgh1!", ""},
+	}
+	for _, tt := range tests {
+		if result := unmetPasswordRule(tt.password); result != tt.expect {
+			t.Error("password:", tt.password, "expect:", tt.expect, "result:", result)
+		}
+	}
+	/***************************************************************/
+	config.TConfig.PasswordMinLength = 0
+	config.TConfig.PasswordRequireMixedCase = false
+	config.TConfig.PasswordRequireNumber = false
+	config.TConfig.PasswordRequireSymbol = false
+	if result := unmetPasswordRule(""); result != "" {
+		t.Error("expect:", "", "result:", result)
+	}
+}
+
+func Test_passwordContainsUsername(t *testing.T) {
+	var password, username string
+	var result, expect bool
+	/***************************************************************/
+	password = "123456"
+	username = ""
+	result = passwordContainsUsername(password, username)
+	expect = false
+	if result != expect {
+		t.Error("expect:", expect, "result:", result)
+	}
+	/***************************************************************/
+	password = "123456"
+	username = "joe"
+	result = passwordContainsUsername(password, username)
+	expect = false
+	if result != expect {
+		t.Error("expect:", expect, "result:", result)
+	}
+	/***************************************************************/
+	password = "123JoE456"
+	username = "jOe"
+	result = passwordContainsUsername(password, username)
+	expect = true
+	if result != expect {
+		t.Error("expect:", expect, "result:", result)
+	}
+}
+
+func Test_roleCacheInvalidation(t *testing.T) {
+	var data types.M
+	var isUpdate bool
+	var userIDs []string
+	var clearAll bool
+	var expect []string
+	/***************************************************************/
+	data = types.M{"ACL": types.M{"*": types.M{"read": true}}}
+	isUpdate = true
+	userIDs, clearAll = roleCacheInvalidation(data, isUpdate)
+	expect = []string{}
+	if reflect.DeepEqual(expect, userIDs) == false || clearAll {
+		t.Error("expect:", expect, false, "result:", userIDs, clearAll)
+	}
+	/***************************************************************/
+	data = types.M{"name": "admin"}
+	isUpdate = false
+	userIDs, clearAll = roleCacheInvalidation(data, isUpdate)
+	if clearAll {
+		t.Error("expect:", false, "result:", clearAll)
+	}
+	/***************************************************************/
+	data = types.M{"name": "admin"}
+	isUpdate = true
+	userIDs, clearAll = roleCacheInvalidation(data, isUpdate)
+	if clearAll == false {
+		t.Error("expect:", true, "result:", clearAll)
+	}
+	/***************************************************************/
+	data = types.M{
+		"roles": types.M{
+			"__op":    "AddRelation",
+			"objects": types.S{types.M{"__type": "Pointer", "className": "_Role", "objectId": "1001"}},
+		},
+	}
+	isUpdate = true
+	userIDs, clearAll = roleCacheInvalidation(data, isUpdate)
+	if clearAll == false {
+		t.Error("expect:", true, "result:", clearAll)
+	}
+	/***************************************************************/
+	data = types.M{
+		"users": types.M{
+			"__op": "RemoveRelation",
+			"objects": types.S{
+				types.M{"__type": "Pointer", "className": "_User", "objectId": "1001"},
+				types.M{"__type": "Pointer", "className": "_User", "objectId": "1002"},
+			},
+		},
+	}
+	isUpdate = true
+	userIDs, clearAll = roleCacheInvalidation(data, isUpdate)
+	expect = []string{"1001", "1002"}
+	if reflect.DeepEqual(expect, userIDs) == false || clearAll {
+		t.Error("expect:", expect, false, "result:", userIDs, clearAll)
+	}
+	/***************************************************************/
+	data = types.M{
+		"users": types.M{
+			"__op": "Batch",
+			"ops": types.S{
+				types.M{
+					"__op":    "AddRelation",
+					"objects": types.S{types.M{"__type": "Pointer", "className": "_User", "objectId": "1001"}},
+				},
+				types.M{
+					"__op":    "RemoveRelation",
+					"objects": types.S{types.M{"__type": "Pointer", "className": "_User", "objectId": "1002"}},
+				},
+			},
+		},
+	}
+	isUpdate = true
+	userIDs, clearAll = roleCacheInvalidation(data, isUpdate)
+	expect = []string{"1001", "1002"}
+	if reflect.DeepEqual(expect, userIDs) == false || clearAll {
+		t.Error("expect:", expect, false, "result:", userIDs, clearAll)
+	}
+	/***************************************************************/
+	data = types.M{
+		"users": types.M{"__op": "Delete"},
+	}
+	isUpdate = true
+	userIDs, clearAll = roleCacheInvalidation(data, isUpdate)
+	if clearAll == false {
+		t.Error("expect:", true, "result:", clearAll)
+	}
+}
+
+func Test_invalidateRoleCache(t *testing.T) {
+	var schema types.M
+	var object types.M
+	var auth *Auth
+	var w *Write
+	var result []string
+	var expect []string
+	/***************************************************************/
+	cache.InitCache()
+	initEnv()
+	enableRoleCache := config.TConfig.EnableRoleCache
+	config.TConfig.EnableRoleCache = true
+	defer func() { config.TConfig.EnableRoleCache = enableRoleCache }()
+	schema = types.M{
+		"fields": types.M{
+			"name":  types.M{"type": "String"},
+			"users": types.M{"type": "Relation", "targetClass": "_User"},
+			"roles": types.M{"type": "Relation", "targetClass": "_Role"},
+		},
+	}
+	orm.Adapter.CreateClass("_Role", schema)
+	object = types.M{
+		"objectId": "1001",
+		"name":     "role1001",
+	}
+	orm.Adapter.CreateObject("_Role", schema, object)
+	schema = types.M{
+		"fields": types.M{
+			"relatedId": types.M{"type": "String"},
+			"owningId":  types.M{"type": "String"},
+		},
+	}
+	orm.Adapter.CreateClass("_Join:users:_Role", schema)
+	object = types.M{
+		"objectId":  "5001",
+		"owningId":  "1001",
+		"relatedId": "9001",
+	}
+	orm.Adapter.CreateObject("_Join:users:_Role", schema, object)
+	auth = &Auth{IsMaster: false, User: types.M{"objectId": "9001"}}
+	result = auth.GetUserRoles()
+	expect = []string{"role:role1001"}
+	if reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "result:", result)
+	}
+	w, _ = NewWrite(
+		Master(),
+		"_Role",
+		types.M{"objectId": "1001"},
+		types.M{
+			"users": types.M{
+				"__op":    "RemoveRelation",
+				"objects": types.S{types.M{"__type": "Pointer", "className": "_User", "objectId": "9001"}},
+			},
+		},
+		types.M{"objectId": "1001", "name": "role1001"},
+		nil,
+	)
+	w.Execute()
+	auth = &Auth{IsMaster: false, User: types.M{"objectId": "9001"}}
+	result = auth.GetUserRoles()
+	expect = []string{}
+	if reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "result:", result)
+	}
+	orm.TomatoDBController.DeleteEverything()
+}
+
 func Test_cleanUserAuthData(t *testing.T) {
 	var w *Write
 	var expect types.M
@@ -2105,6 +2619,90 @@ func Test_cleanUserAuthData(t *testing.T) {
 
 /////////////////////////////////////////////////////////////
 
+func Test_upgradeAnonymousUser(t *testing.T) {
+	var className string
+	var schema, object types.M
+	var w *Write
+	var query, data types.M
+	var expect types.M
+	var err error
+	/***************************************************************/
+	initEnv()
+	className = "_User"
+	schema = types.M{
+		"fields": types.M{},
+	}
+	orm.Adapter.CreateClass(className, schema)
+	object = types.M{
+		"objectId": "101",
+		"authData": types.M{
+			"anonymous": types.M{
+				"id": "00000000-0000-4000-8000-000000001001",
+			},
+		},
+	}
+	orm.TomatoDBController.Create(className, object, nil)
+	query = types.M{"objectId": "101"}
+	data = types.M{
+		"username": "joe",
+		"password": "123456",
+	}
+	w, _ = NewWrite(Master(), className, query, data, nil, nil)
+	err = w.upgradeAnonymousUser()
+	if err != nil {
+		t.Error("expect:", nil, "result:", err)
+	}
+	expect = types.M{
+		"username": "joe",
+		"password": "123456",
+		"authData": types.M{
+			"anonymous": nil,
+		},
+	}
+	if reflect.DeepEqual(expect, w.data) == false {
+		t.Error("expect:", expect, "result:", w.data)
+	}
+	/***************************************************************/
+	query = types.M{"objectId": "101"}
+	data = types.M{
+		"nickname": "joe",
+	}
+	w, _ = NewWrite(Master(), className, query, data, nil, nil)
+	err = w.upgradeAnonymousUser()
+	expect = types.M{
+		"nickname": "joe",
+	}
+	if err != nil || reflect.DeepEqual(expect, w.data) == false {
+		t.Error("expect:", expect, "result:", w.data, err)
+	}
+	orm.TomatoDBController.DeleteEverything()
+	/***************************************************************/
+	initEnv()
+	className = "_User"
+	schema = types.M{
+		"fields": types.M{},
+	}
+	orm.Adapter.CreateClass(className, schema)
+	object = types.M{
+		"objectId": "101",
+		"username": "joe",
+	}
+	orm.TomatoDBController.Create(className, object, nil)
+	query = types.M{"objectId": "101"}
+	data = types.M{
+		"password": "123456",
+	}
+	w, _ = NewWrite(Master(), className, query, data, nil, nil)
+	err = w.upgradeAnonymousUser()
+	expect = types.M{
+		"password": "123456",
+	}
+	if err != nil || reflect.DeepEqual(expect, w.data) == false {
+		t.Error("expect:", expect, "result:", w.data, err)
+	}
+	orm.TomatoDBController.DeleteEverything()
+}
+
 func Test_handleAuthData(t *testing.T) {
 	var className string
 	var schema types.M
@@ -2146,7 +2744,7 @@ func Test_handleAuthData(t *testing.T) {
 		"objectId": "101",
 		"authData": types.M{
 			"anonymous": types.M{
-				"id": "1001",
+				"id": "00000000-0000-4000-8000-000000001001",
 			},
 		},
 	}
@@ -2155,7 +2753,7 @@ func Test_handleAuthData(t *testing.T) {
 		"objectId": "102",
 		"authData": types.M{
 			"anonymous": types.M{
-				"id": "1001",
+				"id": "00000000-0000-4000-8000-000000001001",
 			},
 		},
 	}
@@ -2165,7 +2763,7 @@ func Test_handleAuthData(t *testing.T) {
 	data = types.M{
 		"authData": types.M{
 			"anonymous": types.M{
-				"id": "1001",
+				"id": "00000000-0000-4000-8000-000000001001",
 			},
 		},
 	}
@@ -2189,7 +2787,7 @@ func Test_handleAuthData(t *testing.T) {
 		"objectId": "101",
 		"authData": types.M{
 			"anonymous": types.M{
-				"id": "1001",
+				"id": "00000000-0000-4000-8000-000000001001",
 			},
 		},
 	}
@@ -2199,7 +2797,7 @@ func Test_handleAuthData(t *testing.T) {
 	data = types.M{
 		"authData": types.M{
 			"anonymous": types.M{
-				"id": "1002",
+				"id": "00000000-0000-4000-8000-000000001002",
 			},
 		},
 	}
@@ -2229,7 +2827,7 @@ func Test_handleAuthData(t *testing.T) {
 		"objectId": "101",
 		"authData": types.M{
 			"anonymous": types.M{
-				"id": "1001",
+				"id": "00000000-0000-4000-8000-000000001001",
 			},
 		},
 	}
@@ -2239,7 +2837,7 @@ func Test_handleAuthData(t *testing.T) {
 	data = types.M{
 		"authData": types.M{
 			"anonymous": types.M{
-				"id": "1001",
+				"id": "00000000-0000-4000-8000-000000001001",
 			},
 		},
 	}
@@ -2254,7 +2852,7 @@ func Test_handleAuthData(t *testing.T) {
 		"objectId": "101",
 		"authData": types.M{
 			"anonymous": types.M{
-				"id": "1001",
+				"id": "00000000-0000-4000-8000-000000001001",
 			},
 		},
 	}
@@ -2281,7 +2879,7 @@ func Test_handleAuthData(t *testing.T) {
 		"objectId": "101",
 		"authData": types.M{
 			"anonymous": types.M{
-				"id":    "1001",
+				"id":    "00000000-0000-4000-8000-000000001001",
 				"token": "aaa",
 			},
 		},
@@ -2292,7 +2890,7 @@ func Test_handleAuthData(t *testing.T) {
 	data = types.M{
 		"authData": types.M{
 			"anonymous": types.M{
-				"id":    "1001",
+				"id":    "00000000-0000-4000-8000-000000001001",
 				"token": "abc",
 			},
 		},
@@ -2308,7 +2906,7 @@ func Test_handleAuthData(t *testing.T) {
 		"objectId": "101",
 		"authData": map[string]interface{}{
 			"anonymous": types.M{
-				"id":    "1001",
+				"id":    "00000000-0000-4000-8000-000000001001",
 				"token": "abc",
 			},
 		},
@@ -2325,7 +2923,7 @@ func Test_handleAuthData(t *testing.T) {
 		"objectId": "101",
 		"authData": types.M{
 			"anonymous": types.M{
-				"id":    "1001",
+				"id":    "00000000-0000-4000-8000-000000001001",
 				"token": "abc",
 			},
 		},
@@ -2349,7 +2947,7 @@ func Test_handleAuthData(t *testing.T) {
 		"objectId": "101",
 		"authData": types.M{
 			"anonymous": types.M{
-				"id":    "1001",
+				"id":    "00000000-0000-4000-8000-000000001001",
 				"token": "aaa",
 			},
 		},
@@ -2360,7 +2958,7 @@ func Test_handleAuthData(t *testing.T) {
 	data = types.M{
 		"authData": types.M{
 			"anonymous": types.M{
-				"id":    "1001",
+				"id":    "00000000-0000-4000-8000-000000001001",
 				"token": "aaa",
 			},
 		},
@@ -2388,7 +2986,7 @@ func Test_handleAuthData(t *testing.T) {
 		"objectId": "101",
 		"authData": types.M{
 			"anonymous": types.M{
-				"id":    "1001",
+				"id":    "00000000-0000-4000-8000-000000001001",
 				"token": "aaa",
 			},
 		},
@@ -2399,7 +2997,7 @@ func Test_handleAuthData(t *testing.T) {
 	data = types.M{
 		"authData": types.M{
 			"anonymous": types.M{
-				"id":    "1001",
+				"id":    "00000000-0000-4000-8000-000000001001",
 				"token": "aaa",
 			},
 		},
@@ -2412,6 +3010,47 @@ func Test_handleAuthData(t *testing.T) {
 		t.Error("expect:", expect, "result:", result)
 	}
 	orm.TomatoDBController.DeleteEverything()
+	/***************************************************************/
+	config.TConfig = &config.Config{
+		ServerURL: "http://www.g.cn",
+	}
+	config.TConfig.EnableAnonymousUsers = true
+	initEnv()
+	className = "_User"
+	schema = types.M{
+		"fields": types.M{},
+	}
+	orm.Adapter.CreateClass(className, schema)
+	object = types.M{
+		"objectId": "101",
+		"authData": types.M{
+			"other": types.M{
+				"id": "2001",
+			},
+		},
+	}
+	orm.TomatoDBController.Create(className, object, nil)
+	className = "_User"
+	query = types.M{"objectId": "101"}
+	data = types.M{
+		"authData": types.M{
+			"other": types.M{
+				"id": "2001",
+			},
+			"anonymous": types.M{
+				"id":    "00000000-0000-4000-8000-000000001001",
+				"token": "aaa",
+			},
+		},
+	}
+	originalData = nil
+	w, _ = NewWrite(Master(), className, query, data, originalData, nil)
+	result = w.handleAuthData(utils.M(w.data["authData"]))
+	expect = nil
+	if reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "result:", result)
+	}
+	orm.TomatoDBController.DeleteEverything()
 }
 
 func Test_handleAuthDataValidation(t *testing.T) {
@@ -2430,7 +3069,7 @@ func Test_handleAuthDataValidation(t *testing.T) {
 	w, _ = NewWrite(Master(), "user", query, data, originalData, nil)
 	authData = types.M{
 		"anonymous": types.M{
-			"id": "1001",
+			"id": "00000000-0000-4000-8000-000000001001",
 		},
 	}
 	result = w.handleAuthDataValidation(authData)
@@ -12,6 +12,16 @@ func init() {
 				&controllers.ClassesController{},
 			),
 		),
+		beego.NSNamespace("/aggregate",
+			beego.NSInclude(
+				&controllers.AggregateController{},
+			),
+		),
+		beego.NSNamespace("/distinct",
+			beego.NSInclude(
+				&controllers.DistinctController{},
+			),
+		),
 		beego.NSNamespace("/users",
 			beego.NSInclude(
 				&controllers.UsersController{},
@@ -132,11 +142,21 @@ func init() {
 				&controllers.UpgradeSessionController{},
 			),
 		),
+		beego.NSNamespace("/unlockAccount",
+			beego.NSInclude(
+				&controllers.UnlockAccountController{},
+			),
+		),
 		beego.NSNamespace("/health",
 			beego.NSInclude(
 				&controllers.HealthController{},
 			),
 		),
+		beego.NSNamespace("/health/cache",
+			beego.NSInclude(
+				&controllers.CacheStatsController{},
+			),
+		),
 	)
 	beego.AddNamespace(ns)
 }
@@ -17,10 +17,13 @@ type Adapter interface {
 	DeleteObjectsByQuery(className string, schema, query types.M) error
 	Find(className string, schema, query, options types.M) ([]types.M, error)
 	Count(className string, schema, query types.M) (int, error)
+	Distinct(className string, schema, query types.M, fieldName string) (types.S, error)
+	Aggregate(className string, schema types.M, pipeline types.S) ([]types.M, error)
 	UpdateObjectsByQuery(className string, schema, query, update types.M) error
 	FindOneAndUpdate(className string, schema, query, update types.M) (types.M, error)
 	UpsertOneObject(className string, schema, query, update types.M) error
 	EnsureUniqueness(className string, schema types.M, fieldNames []string) error
+	CreateIndex(className string, schema types.M, indexName string, fields types.M) error
 	PerformInitialization(options types.M) error
 	HandleShutdown()
 }
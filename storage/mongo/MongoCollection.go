@@ -8,6 +8,7 @@ import (
 	"github.com/lfq7413/tomato/errs"
 	"github.com/lfq7413/tomato/types"
 	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
 )
 
 // MongoCollection mongo 表操作对象
@@ -26,6 +27,14 @@ func (m *MongoCollection) find(query interface{}, options types.M) ([]types.M, e
 	result, err := m.rawFind(query, options)
 	if err != nil {
 		msg := err.Error()
+		// 检测是否为无效的正则表达式
+		if isInvalidRegexError(err) {
+			return nil, errs.E(errs.InvalidQuery, "Bad $regex value for query: "+msg)
+		}
+		// 检测是否为 no text index 错误
+		if strings.Contains(msg, "text index required") {
+			return nil, errs.E(errs.InvalidQuery, "text index required for $text query")
+		}
 		// 检测是否为 no geoindex 错误
 		if strings.Index(msg, "unable to find index") < 0 || strings.Index(msg, "geoNear") < 0 {
 			return nil, err
@@ -43,11 +52,7 @@ func (m *MongoCollection) find(query interface{}, options types.M) ([]types.M, e
 		}
 		key := msg[:end]
 		// 添加索引
-		index := mgo.Index{
-			Key:  []string{"$2dsphere:" + key},
-			Bits: 26,
-		}
-		m.collection.EnsureIndex(index)
+		m.ensure2dsphereIndex(key)
 		// 再次尝试查询
 		result, err = m.rawFind(query, options)
 		if err != nil {
@@ -65,7 +70,22 @@ func (m *MongoCollection) find(query interface{}, options types.M) ([]types.M, e
 	return result, nil
 }
 
-// rawFind 执行原始查找操作，查找选项包括 sort、skip、limit、keys、maxTimeMS
+// isInvalidRegexError 检测是否为无效正则表达式的错误
+// 旧版本返回 BadValue(2) ，新版本返回 51091
+func isInvalidRegexError(err error) bool {
+	if e, ok := err.(*mgo.QueryError); ok {
+		if e.Code == 51091 {
+			return true
+		}
+		if e.Code == 2 && strings.Contains(e.Message, "Regular expression is invalid") {
+			return true
+		}
+	}
+	return false
+}
+
+// rawFind 执行原始查找操作，查找选项包括 sort、skip、limit、keys、maxTimeMS、explain
+// explain 为 true 时返回查询计划
 func (m *MongoCollection) rawFind(query interface{}, options types.M) ([]types.M, error) {
 	if options == nil {
 		options = types.M{}
@@ -100,11 +120,35 @@ func (m *MongoCollection) rawFind(query interface{}, options types.M) ([]types.M
 			q = q.SetMaxTime(time.Duration(limit) * time.Millisecond)
 		}
 	}
+	if options["explain"] != nil {
+		var plan types.M
+		err := q.Explain(&plan)
+		if err != nil {
+			return nil, err
+		}
+		return []types.M{plan}, nil
+	}
 	var result []types.M
 	err := q.All(&result)
 	return result, err
 }
 
+// explainCount 返回 count 命令的查询计划
+func (m *MongoCollection) explainCount(query interface{}) (types.M, error) {
+	var plan types.M
+	cmd := bson.D{
+		{Name: "explain", Value: bson.D{
+			{Name: "count", Value: m.collection.Name},
+			{Name: "query", Value: query},
+		}},
+	}
+	err := m.collection.Database.Run(cmd, &plan)
+	if err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
 // count 执行 count 操作，查找选项包括 sort、skip、limit、maxTimeMS
 func (m *MongoCollection) count(query interface{}, options types.M) int {
 	if options == nil {
@@ -144,8 +188,39 @@ func (m *MongoCollection) count(query interface{}, options types.M) int {
 	return n
 }
 
+// distinct 查找指定字段的不重复值，查找选项包括 maxTimeMS
+func (m *MongoCollection) distinct(fieldName string, query interface{}, options types.M) ([]interface{}, error) {
+	if options == nil {
+		options = types.M{}
+	}
+	q := m.collection.Find(query)
+	if options["maxTimeMS"] != nil {
+		if limit, ok := options["maxTimeMS"].(float64); ok {
+			q = q.SetMaxTime(time.Duration(limit) * time.Millisecond)
+		} else if limit, ok := options["maxTimeMS"].(int); ok {
+			q = q.SetMaxTime(time.Duration(limit) * time.Millisecond)
+		}
+	}
+	var result []interface{}
+	err := q.Distinct(fieldName, &result)
+	return result, err
+}
+
+// aggregate 执行聚合操作
+func (m *MongoCollection) aggregate(pipeline interface{}) ([]types.M, error) {
+	var result []types.M
+	err := m.collection.Pipe(pipeline).All(&result)
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return []types.M{}, nil
+	}
+	return result, nil
+}
+
 // findOneAndUpdate 查找并更新一个对象，返回更新后的对象
-func (m *MongoCollection) findOneAndUpdate(selector interface{}, update interface{}) types.M {
+func (m *MongoCollection) findOneAndUpdate(selector interface{}, update interface{}) (types.M, error) {
 
 	var result types.M
 	change := mgo.Change{
@@ -153,11 +228,32 @@ func (m *MongoCollection) findOneAndUpdate(selector interface{}, update interfac
 		ReturnNew: true,
 	}
 	info, err := m.collection.Find(selector).Apply(change, &result)
-	if err != nil || info.Updated == 0 {
-		return types.M{}
+	if err == mgo.ErrNotFound {
+		return types.M{}, nil
 	}
+	if err != nil {
+		return nil, transformUpdateError(err)
+	}
+	if info == nil || info.Updated == 0 {
+		return types.M{}, nil
+	}
+
+	return result, nil
+}
 
-	return result
+// transformUpdateError 转换更新操作符作用于类型不符的字段时数据库返回的错误
+func transformUpdateError(err error) error {
+	message := err.Error()
+	// 对非数字类型的字段执行 $inc
+	if strings.Contains(message, "non-numeric type") {
+		return errs.E(errs.InvalidJSON, "Cannot increment a field of non-numeric type")
+	}
+	// 对非数组类型的字段执行 $push $addToSet $pullAll
+	if strings.Contains(message, "must be an array") ||
+		strings.Contains(message, "non-array") {
+		return errs.E(errs.InvalidJSON, "Cannot apply array operations to a field of non-array type")
+	}
+	return err
 }
 
 // insertOne 插入一个对象
@@ -187,7 +283,10 @@ func (m *MongoCollection) updateOne(selector interface{}, update interface{}) er
 // updateMany 更新多个对象
 func (m *MongoCollection) updateMany(selector interface{}, update interface{}) error {
 	_, err := m.collection.UpdateAll(selector, update)
-	return err
+	if err != nil {
+		return transformUpdateError(err)
+	}
+	return nil
 }
 
 // deleteOne 删除一个对象
@@ -220,3 +319,22 @@ func (m *MongoCollection) ensureSparseUniqueIndexInBackground(indexRequest []str
 	}
 	return m.collection.EnsureIndex(index)
 }
+
+// ensureIndex 后台创建指定名称的索引
+func (m *MongoCollection) ensureIndex(name string, keys []string) error {
+	index := mgo.Index{
+		Key:        keys,
+		Name:       name,
+		Background: true,
+	}
+	return m.collection.EnsureIndex(index)
+}
+
+// ensure2dsphereIndex 为 GeoPoint 字段创建 2dsphere 索引
+func (m *MongoCollection) ensure2dsphereIndex(key string) error {
+	index := mgo.Index{
+		Key:  []string{"$2dsphere:" + key},
+		Bits: 26,
+	}
+	return m.collection.EnsureIndex(index)
+}
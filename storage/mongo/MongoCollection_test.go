@@ -552,10 +552,10 @@ func Test_findOneAndUpdate(t *testing.T) {
 	mc.insertOne(docs)
 	selector = types.M{"name": "joe"}
 	update = types.M{"$set": types.M{"age": 35}}
-	obj = mc.findOneAndUpdate(selector, update)
+	obj, err = mc.findOneAndUpdate(selector, update)
 	expect = types.M{"_id": "001", "name": "joe", "age": 35}
-	if reflect.DeepEqual(obj, expect) == false {
-		t.Error("expect:", expect, "get result:", obj)
+	if err != nil || reflect.DeepEqual(obj, expect) == false {
+		t.Error("expect:", expect, "get result:", obj, err)
 	}
 	result, err = mc.rawFind(selector, nil)
 	expect = []types.M{
@@ -575,10 +575,10 @@ func Test_findOneAndUpdate(t *testing.T) {
 	mc.insertOne(docs)
 	selector = types.M{"name": "tom"}
 	update = types.M{"$set": types.M{"age": 35}}
-	obj = mc.findOneAndUpdate(selector, update)
+	obj, err = mc.findOneAndUpdate(selector, update)
 	expect = types.M{}
-	if reflect.DeepEqual(obj, expect) == false {
-		t.Error("expect:", expect, "get result:", obj)
+	if err != nil || reflect.DeepEqual(obj, expect) == false {
+		t.Error("expect:", expect, "get result:", obj, err)
 	}
 	result, err = mc.rawFind(nil, nil)
 	expect = []types.M{
@@ -590,6 +590,50 @@ func Test_findOneAndUpdate(t *testing.T) {
 		t.Error("expect:", expect, "get result:", result, err)
 	}
 	mc.drop()
+	/********************************************************/
+	docs = types.M{"_id": "001", "name": "joe", "age": 25}
+	mc.insertOne(docs)
+	selector = types.M{"_id": "001"}
+	update = types.M{"$inc": types.M{"age": 5}}
+	obj, err = mc.findOneAndUpdate(selector, update)
+	expect = types.M{"_id": "001", "name": "joe", "age": 30}
+	if err != nil || reflect.DeepEqual(obj, expect) == false {
+		t.Error("expect:", expect, "get result:", obj, err)
+	}
+	mc.drop()
+	/********************************************************/
+	docs = types.M{"_id": "001", "name": "joe", "age": "old"}
+	mc.insertOne(docs)
+	selector = types.M{"_id": "001"}
+	update = types.M{"$inc": types.M{"age": 5}}
+	_, err = mc.findOneAndUpdate(selector, update)
+	expect = errs.E(errs.InvalidJSON, "Cannot increment a field of non-numeric type")
+	if reflect.DeepEqual(err, expect) == false {
+		t.Error("expect:", expect, "get result:", err)
+	}
+	mc.drop()
+	/********************************************************/
+	docs = types.M{"_id": "001", "name": "joe", "tags": types.S{"a"}}
+	mc.insertOne(docs)
+	selector = types.M{"_id": "001"}
+	update = types.M{"$addToSet": types.M{"tags": types.M{"$each": types.S{"a", "b"}}}}
+	obj, err = mc.findOneAndUpdate(selector, update)
+	expect = types.M{"_id": "001", "name": "joe", "tags": []interface{}{"a", "b"}}
+	if err != nil || reflect.DeepEqual(obj, expect) == false {
+		t.Error("expect:", expect, "get result:", obj, err)
+	}
+	mc.drop()
+	/********************************************************/
+	docs = types.M{"_id": "001", "name": "joe", "tags": "a"}
+	mc.insertOne(docs)
+	selector = types.M{"_id": "001"}
+	update = types.M{"$push": types.M{"tags": types.M{"$each": types.S{"b"}}}}
+	_, err = mc.findOneAndUpdate(selector, update)
+	expect = errs.E(errs.InvalidJSON, "Cannot apply array operations to a field of non-array type")
+	if reflect.DeepEqual(err, expect) == false {
+		t.Error("expect:", expect, "get result:", err)
+	}
+	mc.drop()
 }
 
 func Test_insertOne(t *testing.T) {
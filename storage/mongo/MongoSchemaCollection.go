@@ -199,6 +199,10 @@ func mongoFieldToParseSchemaField(t string) types.M {
 		return types.M{
 			"type": "GeoPoint",
 		}
+	case "polygon":
+		return types.M{
+			"type": "Polygon",
+		}
 	case "file":
 		return types.M{
 			"type": "File",
@@ -291,11 +295,18 @@ func mongoSchemaToParseSchema(schema types.M) types.M {
 		}
 	}
 
-	return types.M{
+	result := types.M{
 		"className":             schema["_id"],
 		"fields":                mongoSchemaFieldsToParseSchemaFields(schema),
 		"classLevelPermissions": clps,
 	}
+	// 复制 schema["_metadata"]["indexes"] 到 indexes 中
+	if metadata := utils.M(schema["_metadata"]); metadata != nil {
+		if utils.M(metadata["indexes"]) != nil {
+			result["indexes"] = metadata["indexes"]
+		}
+	}
+	return result
 }
 
 // parseFieldTypeToMongoFieldType 返回数据库中存储的字段类型
@@ -327,6 +338,8 @@ func parseFieldTypeToMongoFieldType(t types.M) string {
 		return "array"
 	case "GeoPoint":
 		return "geopoint"
+	case "Polygon":
+		return "polygon"
 	case "File":
 		return "file"
 	default:
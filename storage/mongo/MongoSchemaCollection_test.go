@@ -1078,6 +1078,39 @@ func Test_mongoSchemaToParseSchema(t *testing.T) {
 		t.Error("expect:", expect, "result:", result)
 	}
 	/*****************************************************/
+	schema = types.M{
+		"_id": "user",
+		"_metadata": types.M{
+			"indexes": types.M{
+				"name_1": types.M{"name": 1},
+			},
+		},
+	}
+	result = mongoSchemaToParseSchema(schema)
+	expect = types.M{
+		"className": "user",
+		"fields": types.M{
+			"ACL":       types.M{"type": "ACL"},
+			"createdAt": types.M{"type": "Date"},
+			"updatedAt": types.M{"type": "Date"},
+			"objectId":  types.M{"type": "String"},
+		},
+		"classLevelPermissions": types.M{
+			"find":     types.M{"*": true},
+			"get":      types.M{"*": true},
+			"create":   types.M{"*": true},
+			"update":   types.M{"*": true},
+			"delete":   types.M{"*": true},
+			"addField": types.M{"*": true},
+		},
+		"indexes": types.M{
+			"name_1": types.M{"name": 1},
+		},
+	}
+	if reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "result:", result)
+	}
+	/*****************************************************/
 	schema = types.M{
 		"_id":  "user",
 		"key1": "*user",
@@ -2,7 +2,9 @@ package mongo
 
 import (
 	"regexp"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/lfq7413/tomato/errs"
 	"github.com/lfq7413/tomato/types"
@@ -76,9 +78,7 @@ func (m *MongoAdapter) SetClassLevelPermissions(className string, CLPs types.M)
 	schemaCollection := m.schemaCollection()
 	update := types.M{
 		"$set": types.M{
-			"_metadata": types.M{
-				"class_permissions": CLPs,
-			},
+			"_metadata.class_permissions": CLPs,
 		},
 	}
 	return schemaCollection.updateSchema(className, update)
@@ -104,13 +104,32 @@ func (m *MongoAdapter) CreateClass(className string, schema types.M) (types.M, e
 		return nil, err
 	}
 
+	// 为 GeoPoint 与 Polygon 字段创建 2dsphere 索引
+	if fields := utils.M(schema["fields"]); fields != nil {
+		for fieldName, v := range fields {
+			if fieldType := utils.M(v); fieldType != nil && (utils.S(fieldType["type"]) == "GeoPoint" || utils.S(fieldType["type"]) == "Polygon") {
+				err = m.adaptiveCollection(className).ensure2dsphereIndex(fieldName)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
 	return mongoSchemaToParseSchema(mongoObject), nil
 }
 
-// AddFieldIfNotExists 添加字段定义
+// AddFieldIfNotExists 添加字段定义，GeoPoint 与 Polygon 字段会同时创建 2dsphere 索引
 func (m *MongoAdapter) AddFieldIfNotExists(className, fieldName string, fieldType types.M) error {
 	schemaCollection := m.schemaCollection()
-	return schemaCollection.addFieldIfNotExists(className, fieldName, fieldType)
+	err := schemaCollection.addFieldIfNotExists(className, fieldName, fieldType)
+	if err != nil {
+		return err
+	}
+	if fieldType != nil && (utils.S(fieldType["type"]) == "GeoPoint" || utils.S(fieldType["type"]) == "Polygon") {
+		return m.adaptiveCollection(className).ensure2dsphereIndex(fieldName)
+	}
+	return nil
 }
 
 // DeleteClass 删除指定表
@@ -274,7 +293,10 @@ func (m *MongoAdapter) FindOneAndUpdate(className string, schema, query, update
 		return nil, err
 	}
 	coll := m.adaptiveCollection(className)
-	object := coll.findOneAndUpdate(mongoWhere, mongoUpdate)
+	object, err := coll.findOneAndUpdate(mongoWhere, mongoUpdate)
+	if err != nil {
+		return nil, err
+	}
 	result, err := m.transform.mongoObjectToParseObject(className, object, schema)
 	if err != nil {
 		return nil, err
@@ -307,6 +329,13 @@ func (m *MongoAdapter) Find(className string, schema, query, options types.M) ([
 	if err != nil {
 		return nil, err
 	}
+	// 全文搜索时，未指定排序方式则按相关度排序
+	if _, ok := mongoWhere["$text"]; ok {
+		if keys, ok := options["sort"].([]string); ok == false || len(keys) == 0 {
+			options["sort"] = []string{"$score"}
+		}
+	}
+	var sortByScore bool
 	if _, ok := options["sort"]; ok {
 		if keys, ok := options["sort"].([]string); ok {
 			mongoSort := []string{}
@@ -319,6 +348,13 @@ func (m *MongoAdapter) Find(className string, schema, query, options types.M) ([
 					key = key[1:]
 				}
 
+				// 按全文搜索的相关度排序，相关度总是按降序排列
+				if key == "$score" {
+					sortByScore = true
+					mongoSort = append(mongoSort, "$textScore:score")
+					continue
+				}
+
 				mongoKey = prefix + m.transform.transformKey(className, key, schema)
 				mongoSort = append(mongoSort, mongoKey)
 			}
@@ -339,11 +375,55 @@ func (m *MongoAdapter) Find(className string, schema, query, options types.M) ([
 			delete(options, "keys")
 		}
 	}
+	// 未指定 keys 时，excludeKeys 转换为排除字段的投影
+	if excludeKeys, ok := options["excludeKeys"].([]string); ok {
+		if options["keys"] == nil && len(excludeKeys) > 0 {
+			mongoKeys := types.M{}
+			for _, key := range excludeKeys {
+				mongoKey := m.transform.transformKey(className, key, schema)
+				mongoKeys[mongoKey] = 0
+			}
+			options["keys"] = mongoKeys
+		}
+		delete(options, "excludeKeys")
+	}
+	// 按相关度排序时，需要把相关度以 score 字段返回
+	if sortByScore {
+		mongoKeys := utils.M(options["keys"])
+		if mongoKeys == nil {
+			mongoKeys = types.M{}
+		}
+		mongoKeys["score"] = types.M{"$meta": "textScore"}
+		options["keys"] = mongoKeys
+	}
 	if m.maxTimeMS != 0 {
 		options["maxTimeMS"] = m.maxTimeMS
 	}
 
 	coll := m.adaptiveCollection(className)
+	// 指定读偏好时，使用复制的 session 进行查询
+	if readPreference, ok := options["readPreference"].(string); ok {
+		delete(options, "readPreference")
+		session := m.db.Session.Copy()
+		defer session.Close()
+		session.SetMode(parseReadPreference(readPreference), true)
+		coll = newMongoCollection(m.db.With(session).C(m.collectionPrefix + className))
+	}
+	// 返回原始的查询计划，需要 count 时返回 count 命令的查询计划
+	if options["explain"] != nil {
+		if options["count"] != nil {
+			countWhere, err := nearSphereToGeoWithin(mongoWhere)
+			if err != nil {
+				return nil, err
+			}
+			plan, err := coll.explainCount(countWhere)
+			if err != nil {
+				return nil, err
+			}
+			return []types.M{plan}, nil
+		}
+		return coll.find(mongoWhere, options)
+	}
 	results, err := coll.find(mongoWhere, options)
 	if err != nil {
 		return nil, err
@@ -359,6 +439,22 @@ func (m *MongoAdapter) Find(className string, schema, query, options types.M) ([
 	return objects, nil
 }
 
+// parseReadPreference 转换读偏好，无法识别时使用 Primary
+func parseReadPreference(readPreference string) mgo.Mode {
+	switch readPreference {
+	case "PRIMARY_PREFERRED":
+		return mgo.PrimaryPreferred
+	case "SECONDARY":
+		return mgo.Secondary
+	case "SECONDARY_PREFERRED":
+		return mgo.SecondaryPreferred
+	case "NEAREST":
+		return mgo.Nearest
+	default:
+		return mgo.Primary
+	}
+}
+
 // rawFind 仅用于测试
 func (m *MongoAdapter) rawFind(className string, query types.M) ([]types.M, error) {
 	coll := m.adaptiveCollection(className)
@@ -377,6 +473,10 @@ func (m *MongoAdapter) Count(className string, schema, query types.M) (int, erro
 	if err != nil {
 		return 0, err
 	}
+	mongoWhere, err = nearSphereToGeoWithin(mongoWhere)
+	if err != nil {
+		return 0, err
+	}
 	options := types.M{}
 	if m.maxTimeMS != 0 {
 		options["maxTimeMS"] = m.maxTimeMS
@@ -385,6 +485,139 @@ func (m *MongoAdapter) Count(className string, schema, query types.M) (int, erro
 	return c, nil
 }
 
+// nearSphereToGeoWithin count 命令不支持 $nearSphere ，转换为不需要排序的 $geoWithin $centerSphere
+// $centerSphere 的半径单位为弧度
+func nearSphereToGeoWithin(mongoWhere types.M) (types.M, error) {
+	for key, v := range mongoWhere {
+		if key == "$or" || key == "$and" || key == "$nor" {
+			if subQuerys, ok := v.(types.S); ok {
+				for i, subQuery := range subQuerys {
+					if sub := utils.M(subQuery); sub != nil {
+						converted, err := nearSphereToGeoWithin(sub)
+						if err != nil {
+							return nil, err
+						}
+						subQuerys[i] = converted
+					}
+				}
+			}
+			continue
+		}
+		constraint := utils.M(v)
+		if constraint == nil {
+			continue
+		}
+		nearSphere := utils.M(constraint["$nearSphere"])
+		if nearSphere == nil {
+			continue
+		}
+		delete(constraint, "$nearSphere")
+		geometry := utils.M(nearSphere["$geometry"])
+		maxDistance, ok := nearSphere["$maxDistance"]
+		if geometry == nil || ok == false {
+			// 未限制距离时，只要求字段存在
+			constraint["$exists"] = true
+			continue
+		}
+		var distance float64
+		switch d := maxDistance.(type) {
+		case float64:
+			distance = d
+		case float32:
+			distance = float64(d)
+		case int:
+			distance = float64(d)
+		case int32:
+			distance = float64(d)
+		case int64:
+			distance = float64(d)
+		default:
+			return nil, errs.E(errs.InvalidQuery, "bad $maxDistance value")
+		}
+		constraint["$geoWithin"] = types.M{
+			"$centerSphere": types.S{geometry["coordinates"], distance / (6371 * 1000)},
+		}
+	}
+	return mongoWhere, nil
+}
+
+// Distinct 查找指定字段的不重复值，使用数据库自带的 distinct 命令
+func (m *MongoAdapter) Distinct(className string, schema, query types.M, fieldName string) (types.S, error) {
+	schema = convertParseSchemaToMongoSchema(schema)
+	isPointerField := false
+	if fields := utils.M(schema["fields"]); fields != nil {
+		if tp := utils.M(fields[fieldName]); tp != nil && utils.S(tp["type"]) == "Pointer" {
+			isPointerField = true
+		}
+	}
+	mongoFieldName := m.transform.transformKey(className, fieldName, schema)
+	mongoWhere, err := m.transform.transformWhere(className, query, schema)
+	if err != nil {
+		return nil, err
+	}
+	options := types.M{}
+	if m.maxTimeMS != 0 {
+		options["maxTimeMS"] = m.maxTimeMS
+	}
+	coll := m.adaptiveCollection(className)
+	values, err := coll.distinct(mongoFieldName, mongoWhere, options)
+	if err != nil {
+		return nil, err
+	}
+	results := types.S{}
+	for _, value := range values {
+		if value == nil {
+			continue
+		}
+		// 指针类型的字段在数据库中保存为 className$objectId
+		if isPointerField {
+			objData := strings.Split(utils.S(value), "$")
+			if len(objData) != 2 {
+				continue
+			}
+			results = append(results, types.M{
+				"__type":    "Pointer",
+				"className": objData[0],
+				"objectId":  objData[1],
+			})
+			continue
+		}
+		result, err := m.transform.nestedMongoObjectToNestedParseObject(value)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// Aggregate 执行聚合管道，返回的 _id 字段转换为 objectId ，其余字段按 Find 的方式转换为 REST 格式
+func (m *MongoAdapter) Aggregate(className string, schema types.M, pipeline types.S) ([]types.M, error) {
+	schema = convertParseSchemaToMongoSchema(schema)
+	mongoPipeline, err := m.transform.transformPipeline(className, pipeline, schema)
+	if err != nil {
+		return nil, err
+	}
+	coll := m.adaptiveCollection(className)
+	results, err := coll.aggregate(mongoPipeline)
+	if err != nil {
+		return nil, err
+	}
+	objects := []types.M{}
+	for _, result := range results {
+		// 按日期分组时， _id 转换为 ISO8601 格式的字符串
+		if id, ok := result["_id"].(time.Time); ok {
+			result["_id"] = utils.TimetoString(id)
+		}
+		r, err := m.transform.mongoObjectToParseObject(className, result, schema)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, utils.M(r))
+	}
+	return objects, nil
+}
+
 // EnsureUniqueness 创建索引
 func (m *MongoAdapter) EnsureUniqueness(className string, schema types.M, fieldNames []string) error {
 	schema = convertParseSchemaToMongoSchema(schema)
@@ -401,6 +634,47 @@ func (m *MongoAdapter) EnsureUniqueness(className string, schema types.M, fieldN
 	return err
 }
 
+// CreateIndex 创建索引，fields 中字段的值为 1 、 -1 或者 "text" ，"text" 表示全文索引
+func (m *MongoAdapter) CreateIndex(className string, schema types.M, indexName string, fields types.M) error {
+	schema = convertParseSchemaToMongoSchema(schema)
+	fieldNames := []string{}
+	for fieldName := range fields {
+		fieldNames = append(fieldNames, fieldName)
+	}
+	sort.Strings(fieldNames)
+
+	mongoKeys := []string{}
+	for _, fieldName := range fieldNames {
+		k := m.transform.transformKey(className, fieldName, schema)
+		switch v := fields[fieldName].(type) {
+		case string:
+			mongoKeys = append(mongoKeys, "$"+v+":"+k)
+		case float64:
+			if v < 0 {
+				k = "-" + k
+			}
+			mongoKeys = append(mongoKeys, k)
+		case int:
+			if v < 0 {
+				k = "-" + k
+			}
+			mongoKeys = append(mongoKeys, k)
+		}
+	}
+	coll := m.adaptiveCollection(className)
+	err := coll.ensureIndex(indexName, mongoKeys)
+	if err != nil {
+		return err
+	}
+	// 在 schema 中记录索引
+	update := types.M{
+		"$set": types.M{
+			"_metadata.indexes." + indexName: fields,
+		},
+	}
+	return m.schemaCollection().updateSchema(className, update)
+}
+
 // PerformInitialization 性能优化初始化
 func (m *MongoAdapter) PerformInitialization(options types.M) error {
 	return nil
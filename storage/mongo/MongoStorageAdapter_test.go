@@ -1378,6 +1378,79 @@ func Test_Count(t *testing.T) {
 	adapter.DeleteAllClasses()
 }
 
+func Test_Distinct(t *testing.T) {
+	adapter := getAdapter()
+	var className string
+	var schema types.M
+	var query types.M
+	var results types.S
+	var err error
+	var object types.M
+	var expect types.S
+	tmpTimeStr := utils.TimetoString(time.Now().UTC())
+	/*****************************************************/
+	className = "user"
+	schema = types.M{
+		"fields": types.M{
+			"post": types.M{"type": "Pointer", "targetClass": "Post"},
+		},
+	}
+	object = types.M{
+		"objectId":  "01",
+		"updatedAt": tmpTimeStr,
+		"createdAt": tmpTimeStr,
+		"key":       "hello",
+		"post":      types.M{"__type": "Pointer", "className": "Post", "objectId": "p01"},
+	}
+	adapter.CreateObject(className, schema, object)
+	object = types.M{
+		"objectId":  "02",
+		"updatedAt": tmpTimeStr,
+		"createdAt": tmpTimeStr,
+		"key":       "hello",
+		"post":      types.M{"__type": "Pointer", "className": "Post", "objectId": "p01"},
+	}
+	adapter.CreateObject(className, schema, object)
+	object = types.M{
+		"objectId":  "03",
+		"updatedAt": tmpTimeStr,
+		"createdAt": tmpTimeStr,
+		"key":       "world",
+	}
+	adapter.CreateObject(className, schema, object)
+	/*****************************************************/
+	query = types.M{"objectId": types.M{"$in": types.S{"01", "02"}}}
+	results, err = adapter.Distinct(className, schema, query, "key")
+	expect = types.S{"hello"}
+	if err != nil || reflect.DeepEqual(expect, results) == false {
+		t.Error("expect:", expect, "result:", results, err)
+	}
+	/*****************************************************/
+	query = types.M{}
+	results, err = adapter.Distinct(className, schema, query, "key")
+	if err != nil || len(results) != 2 {
+		t.Error("expect:", 2, "result:", results, err)
+	}
+	/*****************************************************/
+	query = types.M{}
+	results, err = adapter.Distinct(className, schema, query, "post")
+	expect = types.S{
+		types.M{"__type": "Pointer", "className": "Post", "objectId": "p01"},
+	}
+	if err != nil || reflect.DeepEqual(expect, results) == false {
+		t.Error("expect:", expect, "result:", results, err)
+	}
+	/*****************************************************/
+	query = types.M{}
+	results, err = adapter.Distinct("user1", schema, query, "key")
+	expect = types.S{}
+	if err != nil || reflect.DeepEqual(expect, results) == false {
+		t.Error("expect:", expect, "result:", results, err)
+	}
+
+	adapter.DeleteAllClasses()
+}
+
 func Test_EnsureUniqueness(t *testing.T) {
 	adapter := getAdapter()
 	var className string
@@ -1621,6 +1694,128 @@ func Test_mongoSchemaFromFieldsAndClassNameAndCLP(t *testing.T) {
 	}
 }
 
+func Test_nearSphereToGeoWithin(t *testing.T) {
+	var where types.M
+	var result types.M
+	var expect types.M
+	var err error
+	var expectErr error
+	/*************************************************/
+	where = types.M{
+		"location": types.M{
+			"$nearSphere": types.M{
+				"$geometry": types.M{
+					"type":        "Point",
+					"coordinates": types.S{20.0, 10.0},
+				},
+				"$maxDistance": 6371000.0,
+			},
+		},
+		"name": "joe",
+	}
+	result, err = nearSphereToGeoWithin(where)
+	expect = types.M{
+		"location": types.M{
+			"$geoWithin": types.M{
+				"$centerSphere": types.S{types.S{20.0, 10.0}, 1.0},
+			},
+		},
+		"name": "joe",
+	}
+	if err != nil || reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "result:", result, err)
+	}
+	/*************************************************/
+	where = types.M{
+		"$or": types.S{
+			types.M{
+				"location": types.M{
+					"$nearSphere": types.M{
+						"$geometry": types.M{
+							"type":        "Point",
+							"coordinates": types.S{20.0, 10.0},
+						},
+					},
+				},
+			},
+		},
+	}
+	result, err = nearSphereToGeoWithin(where)
+	expect = types.M{
+		"$or": types.S{
+			types.M{
+				"location": types.M{"$exists": true},
+			},
+		},
+	}
+	if err != nil || reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "result:", result, err)
+	}
+	/*************************************************/
+	where = types.M{
+		"location": types.M{
+			"$nearSphere": types.M{
+				"$geometry": types.M{
+					"type":        "Point",
+					"coordinates": types.S{0, 0},
+				},
+				"$maxDistance": 0,
+			},
+		},
+	}
+	result, err = nearSphereToGeoWithin(where)
+	expect = types.M{
+		"location": types.M{
+			"$geoWithin": types.M{
+				"$centerSphere": types.S{types.S{0, 0}, 0.0},
+			},
+		},
+	}
+	if err != nil || reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "result:", result, err)
+	}
+	/*************************************************/
+	where = types.M{
+		"location": types.M{
+			"$nearSphere": types.M{
+				"$geometry": types.M{
+					"type":        "Point",
+					"coordinates": types.S{20.0, 10.0},
+				},
+				"$maxDistance": int64(6371000),
+			},
+		},
+	}
+	result, err = nearSphereToGeoWithin(where)
+	expect = types.M{
+		"location": types.M{
+			"$geoWithin": types.M{
+				"$centerSphere": types.S{types.S{20.0, 10.0}, 1.0},
+			},
+		},
+	}
+	if err != nil || reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "result:", result, err)
+	}
+	/*************************************************/
+	where = types.M{
+		"location": types.M{
+			"$nearSphere": types.M{
+				"$geometry": types.M{
+					"type":        "Point",
+					"coordinates": types.S{20.0, 10.0},
+				},
+				"$maxDistance": "far",
+			},
+		},
+	}
+	result, err = nearSphereToGeoWithin(where)
+	expectErr = errs.E(errs.InvalidQuery, "bad $maxDistance value")
+	if reflect.DeepEqual(expectErr, err) == false {
+		t.Error("expect:", expectErr, "result:", err)
+	}
+}
+
 func getAdapter() *MongoAdapter {
 	return NewMongoAdapter("tomato", openDB())
 }
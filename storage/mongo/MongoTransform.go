@@ -11,6 +11,7 @@ import (
 	"github.com/lfq7413/tomato/errs"
 	"github.com/lfq7413/tomato/types"
 	"github.com/lfq7413/tomato/utils"
+	"gopkg.in/mgo.v2/bson"
 )
 
 // Transform ...
@@ -39,6 +40,12 @@ func (t *Transform) transformKey(className, fieldName string, schema types.M) st
 
 	}
 
+	// authData.facebook.id ==> _auth_data_facebook.id
+	re := regexp.MustCompile(`^authData\.([a-zA-Z0-9_]+)\.id$`)
+	if authDataMatch := re.FindStringSubmatch(fieldName); authDataMatch != nil {
+		return "_auth_data_" + authDataMatch[1] + ".id"
+	}
+
 	if schema == nil {
 		return fieldName
 	}
@@ -255,35 +262,14 @@ func (t *Transform) transformQueryKeyValue(className, key string, value interfac
 	case "_rperm", "_wperm", "_perishable_token", "_email_verify_token":
 		return key, value, nil
 
-	case "$or":
-		if value == nil {
-			return "$or", nil, nil
-		}
-		array := utils.A(value)
-		if array == nil {
-			return "$or", nil, nil
-		}
-		querys := types.S{}
-		for _, subQuery := range array {
-			sub := utils.M(subQuery)
-			if sub == nil {
-				continue
-			}
-			r, err := t.transformWhere(className, sub, schema)
-			if err != nil {
-				return "", nil, err
-			}
-			querys = append(querys, r)
-		}
-		return "$or", querys, nil
-
-	case "$and":
+	// 对 $or $and $nor 的每个分支分别进行转换
+	case "$or", "$and", "$nor":
 		if value == nil {
-			return "$and", nil, nil
+			return key, nil, nil
 		}
 		array := utils.A(value)
 		if array == nil {
-			return "$and", nil, nil
+			return key, nil, nil
 		}
 		querys := types.S{}
 		for _, subQuery := range array {
@@ -297,7 +283,7 @@ func (t *Transform) transformQueryKeyValue(className, key string, value interfac
 			}
 			querys = append(querys, r)
 		}
-		return "$and", querys, nil
+		return key, querys, nil
 
 	default:
 		re := regexp.MustCompile(`^authData\.([a-zA-Z0-9_]+)\.id$`)
@@ -323,7 +309,7 @@ func (t *Transform) transformQueryKeyValue(className, key string, value interfac
 		key = "_p_" + key
 	} else if fieldType == nil {
 		if v := utils.M(value); v != nil {
-			if utils.S(v["__type"]) == "Pointer" {
+			if utils.S(v["__type"]) == "Pointer" || isPointerInQuery(v) {
 				key = "_p_" + key
 			}
 		}
@@ -334,6 +320,10 @@ func (t *Transform) transformQueryKeyValue(className, key string, value interfac
 		return "", nil, err
 	}
 	if cValue != cannotTransform() {
+		// $text 只能出现在查询的顶层
+		if c := utils.M(cValue); c != nil && c["$text"] != nil {
+			return "$text", c["$text"], nil
+		}
 		return key, cValue, nil
 	}
 
@@ -358,6 +348,18 @@ func (t *Transform) transformQueryKeyValue(className, key string, value interfac
 	return "", nil, errs.E(errs.InvalidJSON, "You cannot use this value as a query parameter.")
 }
 
+// isPointerInQuery 判断 $in $nin 中是否包含 Pointer ，没有 schema 时据此确定字段为 Pointer 类型
+func isPointerInQuery(constraint types.M) bool {
+	for _, op := range []string{"$in", "$nin"} {
+		for _, value := range utils.A(constraint[op]) {
+			if v := utils.M(value); v != nil && utils.S(v["__type"]) == "Pointer" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // transformConstraint 转换查询限制条件，处理的操作符类似 "$lt", "$gt" 等
 // inArray 表示该字段是否为数组类型
 func (t *Transform) transformConstraint(constraint interface{}, inArray bool) (interface{}, error) {
@@ -373,6 +375,10 @@ func (t *Transform) transformConstraint(constraint interface{}, inArray bool) (i
 		transformFunction = t.transformTopLevelAtom
 	}
 	var transformer = func(atom interface{}) (interface{}, error) {
+		// null 用于匹配字段不存在的对象，如 {"$in":[ptr, null]}
+		if atom == nil {
+			return nil, nil
+		}
 		result, err := transformFunction(atom)
 		if err != nil {
 			return nil, err
@@ -441,6 +447,15 @@ func (t *Transform) transformConstraint(constraint interface{}, inArray bool) (i
 			}
 			answerArr := types.S{}
 			for _, v := range arr {
+				// 数组元素为正则表达式时，如 containsAllStartingWith 生成的 {"$regex":"^\Qabc\E"}
+				if regex := utils.M(v); regex != nil && regex["$regex"] != nil {
+					s := utils.S(regex["$regex"])
+					if s == "" {
+						return nil, errs.E(errs.InvalidJSON, "bad regex")
+					}
+					answerArr = append(answerArr, bson.RegEx{Pattern: transformRegexPattern(s), Options: utils.S(regex["$options"])})
+					continue
+				}
 				obj, err := t.transformInteriorAtom(v)
 				if err != nil {
 					return nil, err
@@ -456,7 +471,7 @@ func (t *Transform) transformConstraint(constraint interface{}, inArray bool) (i
 				// 必须为字符串
 				return nil, errs.E(errs.InvalidJSON, "bad regex")
 			}
-			answer[key] = s
+			answer[key] = transformRegexPattern(s)
 
 		// 转换 $options 操作符
 		case "$options":
@@ -571,10 +586,36 @@ func (t *Transform) transformConstraint(constraint interface{}, inArray bool) (i
 			if geoWithin == nil {
 				return nil, errs.E(errs.InvalidJSON, "bad $geoWithin value")
 			}
+			// 矩形区域，格式为 {"$box": [southwest, northeast]}
+			if v, ok := geoWithin["$box"]; ok {
+				box := utils.A(v)
+				if len(box) != 2 {
+					return nil, errs.E(errs.InvalidJSON, "bad $geoWithin value; $box should contain exactly 2 GeoPoints")
+				}
+				g := geoPointCoder{}
+				corners := types.S{}
+				for _, point := range box {
+					if g.isValidJSON(utils.M(point)) == false {
+						return nil, errs.E(errs.InvalidJSON, "bad $geoWithin value; $box should contain exactly 2 GeoPoints")
+					}
+					p, err := g.jsonToDatabase(utils.M(point))
+					if err != nil {
+						return nil, err
+					}
+					corners = append(corners, p)
+				}
+				answer["$geoWithin"] = types.M{
+					"$box": corners,
+				}
+				break
+			}
 			polygon := utils.A(geoWithin["$polygon"])
 			if polygon == nil {
 				return nil, errs.E(errs.InvalidJSON, "bad $geoWithin value")
 			}
+			if len(polygon) < 3 {
+				return nil, errs.E(errs.InvalidJSON, "bad $geoWithin value; $polygon should contain at least 3 GeoPoints")
+			}
 			points := types.S{}
 			for _, point := range polygon {
 				g := geoPointCoder{}
@@ -592,6 +633,63 @@ func (t *Transform) transformConstraint(constraint interface{}, inArray bool) (i
 				"$polygon": points,
 			}
 
+		case "$geoIntersects":
+			// 查找包含指定点的 Polygon ，格式为 {"$geoIntersects": {"$point": {"__type": "GeoPoint", ...}}}
+			geoIntersects := utils.M(object[key])
+			point := utils.M(geoIntersects["$point"])
+			g := geoPointCoder{}
+			if g.isValidJSON(point) == false {
+				return nil, errs.E(errs.InvalidJSON, "bad $geoIntersect value; $point should be GeoPoint")
+			}
+			p, err := g.jsonToDatabase(point)
+			if err != nil {
+				return nil, err
+			}
+			answer["$geoIntersects"] = types.M{
+				"$geometry": types.M{
+					"type":        "Point",
+					"coordinates": p,
+				},
+			}
+
+		case "$text":
+			// 全文搜索，格式为 {"$text": {"$search": {"$term": "coffee", "$language": "en"}}}
+			text := utils.M(object[key])
+			if text == nil {
+				return nil, errs.E(errs.InvalidQuery, "bad $text: $search, should be object")
+			}
+			search := utils.M(text["$search"])
+			if search == nil {
+				return nil, errs.E(errs.InvalidQuery, "bad $text: $search, should be object")
+			}
+			term, ok := search["$term"].(string)
+			if ok == false {
+				return nil, errs.E(errs.InvalidQuery, "bad $text: $term, should be string")
+			}
+			textQuery := types.M{"$search": term}
+			if v, ok := search["$language"]; ok {
+				if language, ok := v.(string); ok {
+					textQuery["$language"] = language
+				} else {
+					return nil, errs.E(errs.InvalidQuery, "bad $text: $language, should be string")
+				}
+			}
+			if v, ok := search["$caseSensitive"]; ok {
+				if caseSensitive, ok := v.(bool); ok {
+					textQuery["$caseSensitive"] = caseSensitive
+				} else {
+					return nil, errs.E(errs.InvalidQuery, "bad $text: $caseSensitive, should be boolean")
+				}
+			}
+			if v, ok := search["$diacriticSensitive"]; ok {
+				if diacriticSensitive, ok := v.(bool); ok {
+					textQuery["$diacriticSensitive"] = diacriticSensitive
+				} else {
+					return nil, errs.E(errs.InvalidQuery, "bad $text: $diacriticSensitive, should be boolean")
+				}
+			}
+			answer["$text"] = textQuery
+
 		default:
 			b, _ := regexp.MatchString(`^\$+`, key)
 			if b {
@@ -685,6 +783,17 @@ func (t *Transform) transformTopLevelAtom(atom interface{}) (interface{}, error)
 			return g.jsonToDatabase(object)
 		}
 
+		// Polygon 类型
+		// {
+		// 	"__type": "Polygon",
+		// 	"coordinates": [[40.0, -30.0], [40.0, -20.0], [50.0, -20.0]]
+		// }
+		// ==> {"type": "Polygon", "coordinates": [[[-30.0, 40.0], [-20.0, 40.0], [-20.0, 50.0], [-30.0, 40.0]]]}
+		p := polygonCoder{}
+		if p.isValidJSON(object) {
+			return p.jsonToDatabase(object)
+		}
+
 		// File 类型
 		// {
 		// 	"__type": "File",
@@ -1439,6 +1548,16 @@ func (t *Transform) mongoObjectToParseObject(className string, mongoObject inter
 						restObject[key] = g.databaseToJSON(value)
 						break
 					}
+					// polygon 类型
+					// {
+					// 	"__type":      "Polygon",
+					// 	"coordinates": [[40, 30], [40, 20], [50, 20], [40, 30]]
+					// }
+					p := polygonCoder{}
+					if expectedType != nil && utils.S(expectedType["type"]) == "Polygon" && p.isValidDatabaseObject(value) {
+						restObject[key] = p.databaseToJSON(value)
+						break
+					}
 					// bytesCoder 类型
 					// {
 					// 	"__type": "Bytes",
@@ -1486,6 +1605,83 @@ func (t *Transform) mongoObjectToParseObject(className string, mongoObject inter
 	return nil, errs.E(errs.InternalServerError, "unknown object type")
 }
 
+// transformPipeline 转换聚合管道，把各阶段中引用的字段名转换为数据库中的格式
+// 如 "$createdAt" 转换为 "$_created_at" ，指针字段 "$post" 转换为 "$_p_post"
+func (t *Transform) transformPipeline(className string, pipeline types.S, schema types.M) (types.S, error) {
+	result := types.S{}
+	for _, s := range pipeline {
+		stage := utils.M(s)
+		if stage == nil {
+			return nil, errs.E(errs.InvalidQuery, "Bad pipeline stage")
+		}
+		mongoStage := types.M{}
+		for name, value := range stage {
+			switch name {
+			case "$match":
+				match := utils.M(value)
+				if match == nil {
+					return nil, errs.E(errs.InvalidQuery, "Bad $match value")
+				}
+				mongoMatch, err := t.transformWhere(className, match, schema)
+				if err != nil {
+					return nil, err
+				}
+				mongoStage[name] = mongoMatch
+			case "$project", "$sort":
+				object := utils.M(value)
+				if object == nil {
+					return nil, errs.E(errs.InvalidQuery, "Bad "+name+" value")
+				}
+				mongoObject := types.M{}
+				for k, v := range object {
+					mongoObject[t.transformKey(className, k, schema)] = t.transformPipelineValue(className, v, schema)
+				}
+				mongoStage[name] = mongoObject
+			default:
+				mongoStage[name] = t.transformPipelineValue(className, value, schema)
+			}
+		}
+		result = append(result, mongoStage)
+	}
+	return result, nil
+}
+
+// transformPipelineValue 转换聚合表达式中以 $ 开头的字段引用
+func (t *Transform) transformPipelineValue(className string, value interface{}, schema types.M) interface{} {
+	if s, ok := value.(string); ok {
+		if strings.HasPrefix(s, "$") && strings.HasPrefix(s, "$$") == false {
+			return "$" + t.transformKey(className, s[1:], schema)
+		}
+		return s
+	}
+	if arr := utils.A(value); arr != nil {
+		result := types.S{}
+		for _, v := range arr {
+			result = append(result, t.transformPipelineValue(className, v, schema))
+		}
+		return result
+	}
+	if object := utils.M(value); object != nil {
+		result := types.M{}
+		for k, v := range object {
+			result[k] = t.transformPipelineValue(className, v, schema)
+		}
+		return result
+	}
+	return value
+}
+
+// transformRegexPattern 把 startsWith 生成的 ^\Qabc\E 转换为 ^abc 的形式，以便数据库使用索引
+func transformRegexPattern(pattern string) string {
+	if strings.HasPrefix(pattern, `^\Q`) && strings.HasSuffix(pattern, `\E`) {
+		literal := pattern[3 : len(pattern)-2]
+		if strings.Contains(literal, `\E`) == false {
+			return "^" + regexp.QuoteMeta(literal)
+		}
+	}
+	return pattern
+}
+
 func cannotTransform() interface{} {
 	return nil
 }
@@ -1660,6 +1856,64 @@ func (g geoPointCoder) isValidJSON(value types.M) bool {
 	return value != nil && utils.S(value["__type"]) == "GeoPoint" && value["longitude"] != nil && value["latitude"] != nil
 }
 
+// polygonCoder Polygon 类型处理，数据库中以 GeoJSON 格式保存，顶点格式为 [longitude, latitude]
+// API 格式中顶点格式为 [latitude, longitude]
+type polygonCoder struct{}
+
+func (p polygonCoder) databaseToJSON(object interface{}) types.M {
+	coords := types.S{}
+	rings := utils.A(utils.M(object)["coordinates"])
+	if len(rings) > 0 {
+		for _, c := range utils.A(rings[0]) {
+			if point := utils.A(c); len(point) == 2 {
+				coords = append(coords, types.S{point[1], point[0]})
+			}
+		}
+	}
+	return types.M{
+		"__type":      "Polygon",
+		"coordinates": coords,
+	}
+}
+
+func (p polygonCoder) isValidDatabaseObject(object interface{}) bool {
+	polygon := utils.M(object)
+	if polygon == nil || utils.S(polygon["type"]) != "Polygon" {
+		return false
+	}
+	rings := utils.A(polygon["coordinates"])
+	return len(rings) > 0 && utils.A(rings[0]) != nil
+}
+
+func (p polygonCoder) jsonToDatabase(json types.M) (interface{}, error) {
+	coords := utils.A(json["coordinates"])
+	if len(coords) < 3 {
+		return nil, errs.E(errs.InvalidJSON, "Polygon must have at least 3 values")
+	}
+	ring := types.S{}
+	for _, c := range coords {
+		point := utils.A(c)
+		if len(point) != 2 {
+			return nil, errs.E(errs.InvalidJSON, "bad Polygon coordinates")
+		}
+		ring = append(ring, types.S{point[1], point[0]})
+	}
+	// GeoJSON 中的 Polygon 需要首尾顶点相同
+	first := utils.A(ring[0])
+	last := utils.A(ring[len(ring)-1])
+	if first[0] != last[0] || first[1] != last[1] {
+		ring = append(ring, types.S{first[0], first[1]})
+	}
+	return types.M{
+		"type":        "Polygon",
+		"coordinates": types.S{ring},
+	}, nil
+}
+
+func (p polygonCoder) isValidJSON(value types.M) bool {
+	return value != nil && utils.S(value["__type"]) == "Polygon" && utils.A(value["coordinates"]) != nil
+}
+
 // fileCoder File 类型处理
 type fileCoder struct{}
 
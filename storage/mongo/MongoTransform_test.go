@@ -8,6 +8,7 @@ import (
 	"github.com/lfq7413/tomato/errs"
 	"github.com/lfq7413/tomato/types"
 	"github.com/lfq7413/tomato/utils"
+	"gopkg.in/mgo.v2/bson"
 )
 
 func Test_transformKey(t *testing.T) {
@@ -105,6 +106,13 @@ func Test_transformKey(t *testing.T) {
 	if result != "_p_user" {
 		t.Error("transform:", fieldName, "error!", "result:", result)
 	}
+	/*************************************************/
+	schema = nil
+	fieldName = "authData.anonymous.id"
+	result = tf.transformKey("", fieldName, schema)
+	if result != "_auth_data_anonymous.id" {
+		t.Error("transform:", fieldName, "error!", "result:", result)
+	}
 }
 
 func Test_transformKeyValueForUpdate(t *testing.T) {
@@ -612,6 +620,59 @@ func Test_transformQueryKeyValue(t *testing.T) {
 		t.Error("expect:", expectKey, expectValue, "get result:", resultKey, resultValue, err)
 	}
 	/*************************************************/
+	key = "user"
+	value = types.M{
+		"$in": types.S{
+			types.M{"__type": "Pointer", "className": "_User", "objectId": "1024"},
+			types.M{"__type": "Pointer", "className": "_User", "objectId": "2048"},
+		},
+	}
+	schema = types.M{}
+	resultKey, resultValue, err = tf.transformQueryKeyValue("", key, value, schema)
+	expectKey = "_p_user"
+	expectValue = types.M{"$in": types.S{"_User$1024", "_User$2048"}}
+	if err != nil || resultKey != expectKey || reflect.DeepEqual(resultValue, expectValue) == false {
+		t.Error("expect:", expectKey, expectValue, "get result:", resultKey, resultValue, err)
+	}
+	/*************************************************/
+	key = "user"
+	value = types.M{
+		"$nin": types.S{
+			types.M{"__type": "Pointer", "className": "_User", "objectId": "1024"},
+			"_User$2048",
+			nil,
+		},
+	}
+	schema = types.M{
+		"fields": types.M{
+			"user": types.M{
+				"type": "Pointer",
+			},
+		},
+	}
+	resultKey, resultValue, err = tf.transformQueryKeyValue("", key, value, schema)
+	expectKey = "_p_user"
+	expectValue = types.M{"$nin": types.S{"_User$1024", "_User$2048", nil}}
+	if err != nil || resultKey != expectKey || reflect.DeepEqual(resultValue, expectValue) == false {
+		t.Error("expect:", expectKey, expectValue, "get result:", resultKey, resultValue, err)
+	}
+	/*************************************************/
+	key = "user"
+	value = types.M{"$in": types.S{}}
+	schema = types.M{
+		"fields": types.M{
+			"user": types.M{
+				"type": "Pointer",
+			},
+		},
+	}
+	resultKey, resultValue, err = tf.transformQueryKeyValue("", key, value, schema)
+	expectKey = "_p_user"
+	expectValue = types.M{"$in": types.S{}}
+	if err != nil || resultKey != expectKey || reflect.DeepEqual(resultValue, expectValue) == false {
+		t.Error("expect:", expectKey, expectValue, "get result:", resultKey, resultValue, err)
+	}
+	/*************************************************/
 	key = "age"
 	value = types.M{
 		"$lt": 25,
@@ -674,6 +735,16 @@ func Test_transformQueryKeyValue(t *testing.T) {
 	if err != nil || resultKey != expectKey || reflect.DeepEqual(resultValue, expectValue) == false {
 		t.Error("expect:", expectKey, expectValue, "get result:", resultKey, resultValue, err)
 	}
+	/*************************************************/
+	key = "subject"
+	value = types.M{"$text": types.M{"$search": types.M{"$term": "coffee"}}}
+	schema = types.M{}
+	resultKey, resultValue, err = tf.transformQueryKeyValue("", key, value, schema)
+	expectKey = "$text"
+	expectValue = types.M{"$search": "coffee"}
+	if err != nil || resultKey != expectKey || reflect.DeepEqual(resultValue, expectValue) == false {
+		t.Error("expect:", expectKey, expectValue, "get result:", resultKey, resultValue, err)
+	}
 }
 
 func Test_transformConstraint(t *testing.T) {
@@ -1134,6 +1205,57 @@ func Test_transformConstraint(t *testing.T) {
 		t.Error("expect:", expect, "get result:", result, err)
 	}
 	/*************************************************/
+	constraint = types.M{
+		"$geoWithin": types.M{
+			"$box": types.S{
+				types.M{"__type": "GeoPoint", "longitude": 20.0, "latitude": 20.0},
+				types.M{"__type": "GeoPoint", "longitude": 30.0, "latitude": 30.0},
+			},
+		},
+	}
+	inArray = false
+	result, err = tf.transformConstraint(constraint, inArray)
+	expect = types.M{
+		"$geoWithin": types.M{
+			"$box": types.S{
+				types.S{20.0, 20.0},
+				types.S{30.0, 30.0},
+			},
+		},
+	}
+	if err != nil || reflect.DeepEqual(result, expect) == false {
+		t.Error("expect:", expect, "get result:", result, err)
+	}
+	/*************************************************/
+	constraint = types.M{
+		"$geoWithin": types.M{
+			"$box": types.S{
+				types.M{"__type": "GeoPoint", "longitude": 20.0, "latitude": 20.0},
+			},
+		},
+	}
+	inArray = false
+	result, err = tf.transformConstraint(constraint, inArray)
+	expect = errs.E(errs.InvalidJSON, "bad $geoWithin value; $box should contain exactly 2 GeoPoints")
+	if reflect.DeepEqual(err, expect) == false {
+		t.Error("expect:", expect, "get result:", err)
+	}
+	/*************************************************/
+	constraint = types.M{
+		"$geoWithin": types.M{
+			"$polygon": types.S{
+				types.M{"__type": "GeoPoint", "longitude": 20.0, "latitude": 20.0},
+				types.M{"__type": "GeoPoint", "longitude": 30.0, "latitude": 30.0},
+			},
+		},
+	}
+	inArray = false
+	result, err = tf.transformConstraint(constraint, inArray)
+	expect = errs.E(errs.InvalidJSON, "bad $geoWithin value; $polygon should contain at least 3 GeoPoints")
+	if reflect.DeepEqual(err, expect) == false {
+		t.Error("expect:", expect, "get result:", err)
+	}
+	/*************************************************/
 	constraint = types.M{"$other": "hello"}
 	inArray = true
 	result, err = tf.transformConstraint(constraint, inArray)
@@ -1157,6 +1279,84 @@ func Test_transformConstraint(t *testing.T) {
 	if err != nil || reflect.DeepEqual(result, expect) == false {
 		t.Error("expect:", expect, "get result:", result)
 	}
+	/*************************************************/
+	constraint = types.M{"$regex": `^\Qa.b\E`}
+	inArray = false
+	result, err = tf.transformConstraint(constraint, inArray)
+	expect = types.M{"$regex": `^a\.b`}
+	if err != nil || reflect.DeepEqual(result, expect) == false {
+		t.Error("expect:", expect, "get result:", result)
+	}
+	/*************************************************/
+	constraint = types.M{"$all": types.S{
+		types.M{"$regex": `^\Qabc\E`},
+		types.M{"$regex": `efg`, "$options": "i"},
+	}}
+	inArray = false
+	result, err = tf.transformConstraint(constraint, inArray)
+	expect = types.M{"$all": types.S{
+		bson.RegEx{Pattern: `^abc`},
+		bson.RegEx{Pattern: `efg`, Options: "i"},
+	}}
+	if err != nil || reflect.DeepEqual(result, expect) == false {
+		t.Error("expect:", expect, "get result:", result)
+	}
+	/*************************************************/
+	constraint = types.M{"$text": types.M{"$search": types.M{"$term": "coffee", "$language": "en", "$caseSensitive": true}}}
+	inArray = false
+	result, err = tf.transformConstraint(constraint, inArray)
+	expect = types.M{"$text": types.M{"$search": "coffee", "$language": "en", "$caseSensitive": true}}
+	if err != nil || reflect.DeepEqual(result, expect) == false {
+		t.Error("expect:", expect, "get result:", result)
+	}
+	/*************************************************/
+	constraint = types.M{"$text": types.M{"$search": types.M{"$term": "café", "$diacriticSensitive": false}}}
+	inArray = false
+	result, err = tf.transformConstraint(constraint, inArray)
+	expect = types.M{"$text": types.M{"$search": "café", "$diacriticSensitive": false}}
+	if err != nil || reflect.DeepEqual(result, expect) == false {
+		t.Error("expect:", expect, "get result:", result)
+	}
+	/*************************************************/
+	constraint = types.M{"$text": types.M{"$search": types.M{"$term": "coffee", "$diacriticSensitive": "no"}}}
+	inArray = false
+	result, err = tf.transformConstraint(constraint, inArray)
+	expect = errs.E(errs.InvalidQuery, "bad $text: $diacriticSensitive, should be boolean")
+	if reflect.DeepEqual(err, expect) == false {
+		t.Error("expect:", expect, "get result:", err)
+	}
+	/*************************************************/
+	constraint = types.M{"$geoIntersects": types.M{"$point": types.M{"__type": "GeoPoint", "latitude": 40.0, "longitude": -30.0}}}
+	inArray = false
+	result, err = tf.transformConstraint(constraint, inArray)
+	expect = types.M{"$geoIntersects": types.M{"$geometry": types.M{"type": "Point", "coordinates": types.S{-30.0, 40.0}}}}
+	if err != nil || reflect.DeepEqual(result, expect) == false {
+		t.Error("expect:", expect, "get result:", result)
+	}
+	/*************************************************/
+	constraint = types.M{"$geoIntersects": types.M{"$point": types.S{40.0, -30.0}}}
+	inArray = false
+	result, err = tf.transformConstraint(constraint, inArray)
+	expect = errs.E(errs.InvalidJSON, "bad $geoIntersect value; $point should be GeoPoint")
+	if reflect.DeepEqual(err, expect) == false {
+		t.Error("expect:", expect, "get result:", err)
+	}
+	/*************************************************/
+	constraint = types.M{"$text": types.M{"$term": "coffee"}}
+	inArray = false
+	result, err = tf.transformConstraint(constraint, inArray)
+	expect = errs.E(errs.InvalidQuery, "bad $text: $search, should be object")
+	if reflect.DeepEqual(err, expect) == false {
+		t.Error("expect:", expect, "get result:", err)
+	}
+	/*************************************************/
+	constraint = types.M{"$text": types.M{"$search": types.M{"$term": 1024}}}
+	inArray = false
+	result, err = tf.transformConstraint(constraint, inArray)
+	expect = errs.E(errs.InvalidQuery, "bad $text: $term, should be string")
+	if reflect.DeepEqual(err, expect) == false {
+		t.Error("expect:", expect, "get result:", err)
+	}
 }
 
 func Test_transformTopLevelAtom(t *testing.T) {
@@ -1291,6 +1491,21 @@ func Test_transformTopLevelAtom(t *testing.T) {
 	if err != nil || reflect.DeepEqual(result, expect) == false {
 		t.Error("expect:", expect, "get result:", result)
 	}
+	/*************************************************/
+	atom = types.M{
+		"__type":      "Polygon",
+		"coordinates": types.S{types.S{40.0, -30.0}, types.S{40.0, -20.0}, types.S{50.0, -20.0}},
+	}
+	result, err = tf.transformTopLevelAtom(atom)
+	expect = types.M{
+		"type": "Polygon",
+		"coordinates": types.S{types.S{
+			types.S{-30.0, 40.0}, types.S{-20.0, 40.0}, types.S{-20.0, 50.0}, types.S{-30.0, 40.0},
+		}},
+	}
+	if err != nil || reflect.DeepEqual(result, expect) == false {
+		t.Error("expect:", expect, "get result:", result)
+	}
 }
 
 func Test_transformUpdateOperator(t *testing.T) {
@@ -2128,6 +2343,98 @@ func Test_transformWhere(t *testing.T) {
 	if err != nil || reflect.DeepEqual(expect, result) == false {
 		t.Error("expect:", expect, "get result:", result)
 	}
+	/*************************************************/
+	where = types.M{
+		"$and": types.S{
+			types.M{
+				"$or": types.S{
+					types.M{"user": types.M{"__type": "Pointer", "className": "_User", "objectId": "1024"}},
+					types.M{"createdAt": types.M{"$lt": types.M{"__type": "Date", "iso": tmpTimeStr}}},
+				},
+			},
+			types.M{"_rperm": types.M{"$in": types.S{nil, "*"}}},
+		},
+		"$nor": types.S{
+			types.M{"user": types.M{"__type": "Pointer", "className": "_User", "objectId": "2048"}},
+		},
+	}
+	schema = types.M{
+		"fields": types.M{
+			"user": types.M{
+				"type":        "Pointer",
+				"targetClass": "_User",
+			},
+		},
+	}
+	result, err = tf.transformWhere("", where, schema)
+	expect = types.M{
+		"$and": types.S{
+			types.M{
+				"$or": types.S{
+					types.M{"_p_user": "_User$1024"},
+					types.M{"_created_at": types.M{"$lt": tmpTime}},
+				},
+			},
+			types.M{"_rperm": types.M{"$in": types.S{nil, "*"}}},
+		},
+		"$nor": types.S{
+			types.M{"_p_user": "_User$2048"},
+		},
+	}
+	if err != nil || reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "get result:", result)
+	}
+}
+
+func Test_transformPipeline(t *testing.T) {
+	tf := NewTransform()
+	var pipeline types.S
+	var schema types.M
+	var result types.S
+	var err error
+	var expect types.S
+	/*************************************************/
+	pipeline = types.S{"$match"}
+	schema = types.M{}
+	result, err = tf.transformPipeline("", pipeline, schema)
+	expectErr := errs.E(errs.InvalidQuery, "Bad pipeline stage")
+	if reflect.DeepEqual(expectErr, err) == false {
+		t.Error("expect:", expectErr, "get result:", err)
+	}
+	/*************************************************/
+	pipeline = types.S{
+		types.M{"$match": types.M{"user": "jack", "score": types.M{"$gt": 10}}},
+		types.M{"$group": types.M{
+			"_id":   "$user",
+			"total": types.M{"$sum": "$score"},
+			"first": types.M{"$min": "$createdAt"},
+		}},
+		types.M{"$project": types.M{"updatedAt": 1, "user": 1}},
+		types.M{"$sort": types.M{"createdAt": -1}},
+		types.M{"$limit": 10},
+	}
+	schema = types.M{
+		"fields": types.M{
+			"user": types.M{
+				"type": "Pointer",
+			},
+		},
+	}
+	result, err = tf.transformPipeline("", pipeline, schema)
+	expect = types.S{
+		types.M{"$match": types.M{"_p_user": "jack", "score": types.M{"$gt": 10}}},
+		types.M{"$group": types.M{
+			"_id":   "$_p_user",
+			"total": types.M{"$sum": "$score"},
+			"first": types.M{"$min": "$_created_at"},
+		}},
+		types.M{"$project": types.M{"_updated_at": 1, "_p_user": 1}},
+		types.M{"$sort": types.M{"_created_at": -1}},
+		types.M{"$limit": 10},
+	}
+	if err != nil || reflect.DeepEqual(expect, result) == false {
+		t.Error("expect:", expect, "get result:", result)
+	}
 }
 
 func Test_transformUpdate(t *testing.T) {
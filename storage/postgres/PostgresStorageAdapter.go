@@ -25,6 +25,8 @@ const postgresDuplicateColumnError = "42701"
 const postgresDuplicateObjectError = "42710"
 const postgresUniqueIndexViolationError = "23505"
 const postgresTransactionAbortedError = "25P02"
+const postgresMissingColumnError = "42703"
+const postgresInvalidRegexError = "2201B"
 
 // PostgresAdapter postgres 数据库适配器
 type PostgresAdapter struct {
@@ -558,6 +560,12 @@ func (p *PostgresAdapter) CreateObject(className string, schema, object types.M)
 			} else {
 				valuesArray = append(valuesArray, "")
 			}
+		case "Polygon":
+			polygon, err := convertPolygonToSQL(utils.A(utils.M(object[fieldName])["coordinates"]))
+			if err != nil {
+				return err
+			}
+			valuesArray = append(valuesArray, polygon)
 		case "GeoPoint":
 			geoPoints[fieldName] = object[fieldName]
 			columnsArray = columnsArray[:len(columnsArray)-1]
@@ -770,6 +778,14 @@ func (p *PostgresAdapter) Find(className string, schema, query, options types.M)
 			postgresSort := []string{}
 			for _, key := range keys {
 				var postgresKey string
+				// 按全文搜索的相关度排序，相关度总是按降序排列
+				if key == "$score" || key == "-$score" {
+					if len(where.scores) == 0 {
+						return nil, errs.E(errs.InvalidQuery, "$score sort requires a $text query")
+					}
+					postgresSort = append(postgresSort, fmt.Sprintf(`(%s) DESC`, strings.Join(where.scores, " + ")))
+					continue
+				}
 				if strings.HasPrefix(key, "-") {
 					key = key[1:]
 					postgresKey = fmt.Sprintf(`"%s" DESC`, key)
@@ -804,6 +820,13 @@ func (p *PostgresAdapter) Find(className string, schema, query, options types.M)
 	}
 
 	qs := fmt.Sprintf(`SELECT %s FROM "%s" %s %s %s %s`, columns, className, wherePattern, sortPattern, limitPattern, skipPattern)
+	// 返回查询计划，需要 count 时返回 count 语句的查询计划
+	if options["explain"] != nil {
+		if options["count"] != nil {
+			qs = fmt.Sprintf(`SELECT count(*) FROM "%s" %s`, className, wherePattern)
+		}
+		return p.explain(qs, values)
+	}
 	rows, err := p.db.Query(qs, values...)
 	if err != nil {
 		if e, ok := err.(*pq.Error); ok {
@@ -812,7 +835,7 @@ func (p *PostgresAdapter) Find(className string, schema, query, options types.M)
 				return []types.M{}, nil
 			}
 		}
-		return nil, err
+		return nil, transformRegexError(err)
 	}
 	defer rows.Close()
 
@@ -850,13 +873,53 @@ func (p *PostgresAdapter) Find(className string, schema, query, options types.M)
 		if err != nil {
 			return nil, err
 		}
+		// 删除 excludeKeys 中指定的字段
+		if _, ok := options["keys"]; ok == false {
+			if excludeKeys, ok := options["excludeKeys"].([]string); ok {
+				for _, key := range excludeKeys {
+					delete(object, key)
+				}
+			}
+		}
 
 		results = append(results, object)
 	}
+	if err = rows.Err(); err != nil {
+		return nil, transformRegexError(err)
+	}
 
 	return results, nil
 }
 
+// explain 执行 EXPLAIN 语句，返回 JSON 格式的查询计划
+func (p *PostgresAdapter) explain(qs string, values types.S) ([]types.M, error) {
+	rows, err := p.db.Query(`EXPLAIN (FORMAT JSON) `+qs, values...)
+	if err != nil {
+		if e, ok := err.(*pq.Error); ok {
+			if e.Code == postgresRelationDoesNotExistError {
+				return []types.M{}, nil
+			}
+		}
+		return nil, err
+	}
+	defer rows.Close()
+	results := []types.M{}
+	for rows.Next() {
+		var v []byte
+		err = rows.Scan(&v)
+		if err != nil {
+			return nil, err
+		}
+		var plans []types.M
+		err = json.Unmarshal(v, &plans)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, plans...)
+	}
+	return results, nil
+}
+
 // Count ...
 func (p *PostgresAdapter) Count(className string, schema, query types.M) (int, error) {
 	where, err := buildWhereClause(schema, query, 1)
@@ -877,7 +940,7 @@ func (p *PostgresAdapter) Count(className string, schema, query types.M) (int, e
 				return 0, nil
 			}
 		}
-		return 0, err
+		return 0, transformRegexError(err)
 	}
 	defer rows.Close()
 	var count int
@@ -887,10 +950,83 @@ func (p *PostgresAdapter) Count(className string, schema, query types.M) (int, e
 			return 0, nil
 		}
 	}
+	if err = rows.Err(); err != nil {
+		return 0, transformRegexError(err)
+	}
 
 	return count, nil
 }
 
+// Distinct 查找指定字段的不重复值
+func (p *PostgresAdapter) Distinct(className string, schema, query types.M, fieldName string) (types.S, error) {
+	if schema == nil {
+		schema = types.M{}
+	}
+	where, err := buildWhereClause(schema, query, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	wherePattern := ""
+	if len(where.pattern) > 0 {
+		wherePattern = `WHERE ` + where.pattern
+	}
+
+	qs := fmt.Sprintf(`SELECT DISTINCT "%s" FROM "%s" %s`, fieldName, className, wherePattern)
+	rows, err := p.db.Query(qs, where.values...)
+	if err != nil {
+		if e, ok := err.(*pq.Error); ok {
+			if e.Code == postgresRelationDoesNotExistError || e.Code == postgresMissingColumnError {
+				return types.S{}, nil
+			}
+		}
+		return nil, transformRegexError(err)
+	}
+	defer rows.Close()
+
+	fields := utils.M(schema["fields"])
+	if fields == nil {
+		fields = types.M{}
+	}
+
+	results := types.S{}
+	for rows.Next() {
+		var v interface{}
+		err = rows.Scan(&v)
+		if err != nil {
+			return nil, err
+		}
+		if v == nil {
+			continue
+		}
+		object, err := postgresObjectToParseObject(types.M{fieldName: v}, fields)
+		if err != nil {
+			return nil, err
+		}
+		if object[fieldName] != nil {
+			results = append(results, object[fieldName])
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, transformRegexError(err)
+	}
+
+	return results, nil
+}
+
+// transformRegexError 把无效正则表达式的错误转换为 InvalidQuery
+func transformRegexError(err error) error {
+	if e, ok := err.(*pq.Error); ok && e.Code == postgresInvalidRegexError {
+		return errs.E(errs.InvalidQuery, "Bad $regex value for query: "+e.Message)
+	}
+	return err
+}
+
+// Aggregate 暂不支持聚合管道
+func (p *PostgresAdapter) Aggregate(className string, schema types.M, pipeline types.S) ([]types.M, error) {
+	return nil, errs.E(errs.CommandUnavailable, "Aggregate is not supported by PostgreSQL adapter.")
+}
+
 // UpdateObjectsByQuery ...
 func (p *PostgresAdapter) UpdateObjectsByQuery(className string, schema, query, update types.M) error {
 	_, err := p.FindOneAndUpdate(className, schema, query, update)
@@ -1043,6 +1179,15 @@ func (p *PostgresAdapter) FindOneAndUpdate(className string, schema, query, upda
 				values = append(values, object["longitude"], object["latitude"])
 				index = index + 2
 				continue
+			case "Polygon":
+				polygon, err := convertPolygonToSQL(utils.A(object["coordinates"]))
+				if err != nil {
+					return nil, err
+				}
+				updatePatterns = append(updatePatterns, fmt.Sprintf(`"%s" = $%d::polygon`, fieldName, index))
+				values = append(values, polygon)
+				index = index + 1
+				continue
 			case "Relation":
 				continue
 			}
@@ -1219,13 +1364,35 @@ func (p *PostgresAdapter) UpsertOneObject(className string, schema, query, updat
 // EnsureUniqueness 创建索引
 func (p *PostgresAdapter) EnsureUniqueness(className string, schema types.M, fieldNames []string) error {
 	sort.Sort(sort.StringSlice(fieldNames))
-	constraintName := `unique_` + strings.Join(fieldNames, "_")
+	constraintName := `unique_` + strings.Replace(strings.Join(fieldNames, "_"), ".", "_", -1)
 	constraintPatterns := []string{}
+	hasNestedField := false
 	for _, fieldName := range fieldNames {
-		constraintPatterns = append(constraintPatterns, `"`+fieldName+`"`)
+		if strings.Contains(fieldName, ".") {
+			// 嵌套字段（如 authData.anonymous.id ）保存在 jsonb 列中，使用表达式 ("authData"->'anonymous'->>'id')
+			hasNestedField = true
+			components := strings.Split(fieldName, ".")
+			pattern := `"` + components[0] + `"`
+			for i, cmpt := range components[1:] {
+				if i == len(components)-2 {
+					pattern += `->>'` + cmpt + `'`
+				} else {
+					pattern += `->'` + cmpt + `'`
+				}
+			}
+			constraintPatterns = append(constraintPatterns, "("+pattern+")")
+		} else {
+			constraintPatterns = append(constraintPatterns, `"`+fieldName+`"`)
+		}
 	}
 
-	qs := fmt.Sprintf(`ALTER TABLE "%s" ADD CONSTRAINT "%s" UNIQUE (%s)`, className, constraintName, strings.Join(constraintPatterns, ","))
+	var qs string
+	if hasNestedField {
+		// 唯一约束不支持表达式，使用唯一索引，值为 NULL 的记录不受约束
+		qs = fmt.Sprintf(`CREATE UNIQUE INDEX IF NOT EXISTS "%s" ON "%s" (%s)`, constraintName, className, strings.Join(constraintPatterns, ","))
+	} else {
+		qs = fmt.Sprintf(`ALTER TABLE "%s" ADD CONSTRAINT "%s" UNIQUE (%s)`, className, constraintName, strings.Join(constraintPatterns, ","))
+	}
 	_, err := p.db.Exec(qs)
 	if err != nil {
 		if e, ok := err.(*pq.Error); ok {
@@ -1241,6 +1408,59 @@ func (p *PostgresAdapter) EnsureUniqueness(className string, schema types.M, fie
 	return nil
 }
 
+// CreateIndex 创建索引，fields 中字段的值为 1 、 -1 或者 "text" ，"text" 表示全文索引
+func (p *PostgresAdapter) CreateIndex(className string, schema types.M, indexName string, fields types.M) error {
+	fieldNames := []string{}
+	for fieldName := range fields {
+		fieldNames = append(fieldNames, fieldName)
+	}
+	sort.Strings(fieldNames)
+
+	// 全文索引与普通索引的类型不同，不能混合在同一个索引中
+	textCount := 0
+	for _, fieldName := range fieldNames {
+		if fields[fieldName] == "text" {
+			textCount++
+		}
+	}
+	if textCount > 0 && textCount < len(fieldNames) {
+		return errs.E(errs.InvalidQuery, "Index "+indexName+" cannot mix text and non-text fields")
+	}
+
+	var qs string
+	if textCount > 0 {
+		// 全文索引使用 GIN 索引，与查询时的 to_tsvector 表达式保持一致
+		textPatterns := []string{}
+		for _, fieldName := range fieldNames {
+			textPatterns = append(textPatterns, fmt.Sprintf(`to_tsvector('english', "%s")`, fieldName))
+		}
+		qs = fmt.Sprintf(`CREATE INDEX IF NOT EXISTS "%s" ON "%s" USING GIN ((%s))`, indexName, className, strings.Join(textPatterns, " || "))
+	} else {
+		indexPatterns := []string{}
+		for _, fieldName := range fieldNames {
+			if v, ok := fields[fieldName].(float64); ok && v < 0 {
+				indexPatterns = append(indexPatterns, fmt.Sprintf(`"%s" DESC`, fieldName))
+			} else {
+				indexPatterns = append(indexPatterns, fmt.Sprintf(`"%s"`, fieldName))
+			}
+		}
+		qs = fmt.Sprintf(`CREATE INDEX IF NOT EXISTS "%s" ON "%s" (%s)`, indexName, className, strings.Join(indexPatterns, ", "))
+	}
+	_, err := p.db.Exec(qs)
+	if err != nil {
+		return err
+	}
+
+	// 在 schema 中记录索引
+	b, err := json.Marshal(types.M{indexName: fields})
+	if err != nil {
+		return err
+	}
+	qs = `UPDATE "_SCHEMA" SET "schema" = json_object_set_key("schema", 'indexes', COALESCE("schema"->'indexes', '{}'::jsonb) || $1::jsonb) WHERE "className"=$2`
+	_, err = p.db.Exec(qs, string(b), className)
+	return err
+}
+
 // PerformInitialization ...
 func (p *PostgresAdapter) PerformInitialization(options types.M) error {
 	if options == nil {
@@ -1371,6 +1591,38 @@ func postgresObjectToParseObject(object, fields types.M) (types.M, error) {
 				"longitude": longitude,
 				"latitude":  latitude,
 			}
+		} else if objectType == "Polygon" && object[fieldName] != nil {
+			// object[fieldName] = ((10,20),(30,40),(50,60)) (longitude, latitude)
+			resString := ""
+			if v, ok := object[fieldName].([]byte); ok {
+				resString = string(v)
+			} else if v, ok := object[fieldName].(string); ok {
+				resString = v
+			}
+			if len(resString) < 5 {
+				object[fieldName] = nil
+				continue
+			}
+			coords := types.S{}
+			for _, p := range strings.Split(resString[2:len(resString)-2], "),(") {
+				pointString := strings.Split(p, ",")
+				if len(pointString) != 2 {
+					continue
+				}
+				longitude, err := strconv.ParseFloat(pointString[0], 64)
+				if err != nil {
+					return nil, err
+				}
+				latitude, err := strconv.ParseFloat(pointString[1], 64)
+				if err != nil {
+					return nil, err
+				}
+				coords = append(coords, types.S{latitude, longitude})
+			}
+			object[fieldName] = types.M{
+				"__type":      "Polygon",
+				"coordinates": coords,
+			}
 		} else if objectType == "File" && object[fieldName] != nil {
 			if v, ok := object[fieldName].([]byte); ok {
 				object[fieldName] = types.M{
@@ -1534,6 +1786,23 @@ var parseToPosgresComparator = map[string]string{
 	"$lte": "<=",
 }
 
+// convertPolygonToSQL 把 Polygon 的顶点转换为 postgres 中的 polygon 格式
+// [[lat, lng], ...] ==> ((lng, lat), ...)
+func convertPolygonToSQL(coords types.S) (string, error) {
+	if len(coords) < 3 {
+		return "", errs.E(errs.InvalidJSON, "Polygon must have at least 3 values")
+	}
+	points := []string{}
+	for _, c := range coords {
+		point := utils.A(c)
+		if len(point) != 2 {
+			return "", errs.E(errs.InvalidJSON, "bad Polygon coordinates")
+		}
+		points = append(points, fmt.Sprintf("(%v, %v)", point[1], point[0]))
+	}
+	return "(" + strings.Join(points, ", ") + ")", nil
+}
+
 func parseTypeToPostgresType(t types.M) (string, error) {
 	if t == nil {
 		return "", nil
@@ -1556,6 +1825,8 @@ func parseTypeToPostgresType(t types.M) (string, error) {
 		return "double precision", nil
 	case "GeoPoint":
 		return "point", nil
+	case "Polygon":
+		return "polygon", nil
 	case "Array":
 		if contents := utils.M(t["contents"]); contents != nil {
 			if utils.S(contents["type"]) == "String" {
@@ -1640,11 +1911,15 @@ func toParseSchema(schema types.M) types.M {
 		}
 	}
 
-	return types.M{
+	result := types.M{
 		"className":             schema["className"],
 		"fields":                fields,
 		"classLevelPermissions": clps,
 	}
+	if utils.M(schema["indexes"]) != nil {
+		result["indexes"] = schema["indexes"]
+	}
+	return result
 }
 
 func toPostgresSchema(schema types.M) types.M {
@@ -1748,12 +2023,14 @@ type whereClause struct {
 	pattern string
 	values  types.S
 	sorts   []string
+	scores  []string // $text 条件的相关度表达式，用于按 $score 排序
 }
 
 func buildWhereClause(schema, query types.M, index int) (*whereClause, error) {
 	patterns := []string{}
 	values := types.S{}
 	sorts := []string{}
+	var scores []string
 
 	schema = toPostgresSchema(schema)
 	if schema == nil {
@@ -1813,7 +2090,7 @@ func buildWhereClause(schema, query types.M, index int) (*whereClause, error) {
 			patterns = append(patterns, fmt.Sprintf(`"%s" = $%d`, fieldName, index))
 			values = append(values, fieldValue)
 			index = index + 1
-		} else if fieldName == "$or" || fieldName == "$and" {
+		} else if fieldName == "$or" || fieldName == "$and" || fieldName == "$nor" {
 			clauses := []string{}
 			clauseValues := types.S{}
 			if array := utils.A(fieldValue); array != nil {
@@ -1824,20 +2101,32 @@ func buildWhereClause(schema, query types.M, index int) (*whereClause, error) {
 							return nil, err
 						}
 						if len(clause.pattern) > 0 {
+							if fieldName == "$nor" {
+								// 字段为 NULL 时比较结果为 NULL ， NOT NULL 仍为 NULL ，需要视为不满足
+								clause.pattern = fmt.Sprintf(`COALESCE((%s), false)`, clause.pattern)
+							}
 							clauses = append(clauses, clause.pattern)
 							clauseValues = append(clauseValues, clause.values...)
 							index = index + len(clause.values)
+							if fieldName != "$nor" {
+								scores = append(scores, clause.scores...)
+							}
 						}
 					}
 				}
 			}
 			var orOrAnd string
-			if fieldName == "$or" {
-				orOrAnd = " OR "
-			} else {
+			var not string
+			if fieldName == "$and" {
 				orOrAnd = " AND "
+			} else {
+				orOrAnd = " OR "
+			}
+			// $nor 表示所有分支均不满足
+			if fieldName == "$nor" {
+				not = "NOT "
 			}
-			patterns = append(patterns, fmt.Sprintf(`(%s)`, strings.Join(clauses, orOrAnd)))
+			patterns = append(patterns, fmt.Sprintf(`%s(%s)`, not, strings.Join(clauses, orOrAnd)))
 			values = append(values, clauseValues...)
 		}
 
@@ -1922,14 +2211,18 @@ func buildWhereClause(schema, query types.M, index int) (*whereClause, error) {
 						} else {
 							inPatterns := []string{}
 							for listIndex, listElem := range baseArray {
-								values = append(values, listElem)
+								values = append(values, transformValue(listElem))
 								inPatterns = append(inPatterns, fmt.Sprintf("$%d", index+listIndex))
 							}
 							patterns = append(patterns, fmt.Sprintf(`"%s" %s IN (%s)`, fieldName, not, strings.Join(inPatterns, ",")))
 							index = index + len(inPatterns)
 						}
-					} else if !notIn {
-						patterns = append(patterns, fmt.Sprintf(`"%s" IS NULL`, fieldName))
+					} else if notIn {
+						// 空的 $nin 不排除任何对象
+						patterns = append(patterns, "TRUE")
+					} else {
+						// 空的 $in 不匹配任何对象
+						patterns = append(patterns, "FALSE")
 					}
 				}
 				if inArray != nil {
@@ -1942,10 +2235,24 @@ func buildWhereClause(schema, query types.M, index int) (*whereClause, error) {
 
 			allArray := utils.A(value["$all"])
 			if allArray != nil && isArrayField {
-				patterns = append(patterns, fmt.Sprintf(`array_contains_all("%s", $%d::jsonb)`, fieldName, index))
-				j, _ := json.Marshal(allArray)
-				values = append(values, string(j))
-				index = index + 1
+				if isAllValuesRegex(allArray) {
+					// 数组中每个正则表达式都至少匹配一个元素
+					for _, v := range allArray {
+						regex := utils.M(v)
+						operator := "~"
+						if strings.Contains(utils.S(regex["$options"]), "i") {
+							operator = "~*"
+						}
+						patterns = append(patterns, fmt.Sprintf(`EXISTS (SELECT 1 FROM jsonb_array_elements_text("%s") AS e WHERE e %s $%d)`, fieldName, operator, index))
+						values = append(values, processRegexPattern(utils.S(regex["$regex"])))
+						index = index + 1
+					}
+				} else {
+					patterns = append(patterns, fmt.Sprintf(`array_contains_all("%s", $%d::jsonb)`, fieldName, index))
+					j, _ := json.Marshal(allArray)
+					values = append(values, string(j))
+					index = index + 1
+				}
 			}
 
 			if b, ok := value["$exists"].(bool); ok {
@@ -1985,8 +2292,24 @@ func buildWhereClause(schema, query types.M, index int) (*whereClause, error) {
 				}
 			}
 
-			if geoWithin := utils.M(value["$geoWithin"]); geoWithin != nil {
+			if geoWithin := utils.M(value["$geoWithin"]); geoWithin != nil && geoWithin["$box"] != nil {
+				box := utils.A(geoWithin["$box"])
+				if len(box) != 2 {
+					return nil, errs.E(errs.InvalidJSON, "bad $geoWithin value; $box should contain exactly 2 GeoPoints")
+				}
+				box1 := utils.M(box[0])
+				box2 := utils.M(box[1])
+				if utils.S(box1["__type"]) != "GeoPoint" || utils.S(box2["__type"]) != "GeoPoint" {
+					return nil, errs.E(errs.InvalidJSON, "bad $geoWithin value; $box should contain exactly 2 GeoPoints")
+				}
+				patterns = append(patterns, fmt.Sprintf(`"%s"::point <@ $%d::box`, fieldName, index))
+				values = append(values, fmt.Sprintf("((%v, %v), (%v, %v))", box1["longitude"], box1["latitude"], box2["longitude"], box2["latitude"]))
+				index = index + 1
+			} else if geoWithin := utils.M(value["$geoWithin"]); geoWithin != nil {
 				if polygon := utils.A(geoWithin["$polygon"]); polygon != nil {
+					if len(polygon) < 3 {
+						return nil, errs.E(errs.InvalidJSON, "bad $geoWithin value; $polygon should contain at least 3 GeoPoints")
+					}
 					points := []string{}
 					for _, p := range polygon {
 						if point := utils.M(p); point != nil && utils.S(point["__type"]) == "GeoPoint" {
@@ -2006,7 +2329,59 @@ func buildWhereClause(schema, query types.M, index int) (*whereClause, error) {
 				}
 			}
 
-			if regex := utils.S(value["$regex"]); regex != "" {
+			if geoIntersects := utils.M(value["$geoIntersects"]); geoIntersects != nil {
+				point := utils.M(geoIntersects["$point"])
+				if point == nil || utils.S(point["__type"]) != "GeoPoint" {
+					return nil, errs.E(errs.InvalidJSON, "bad $geoIntersect value; $point should be GeoPoint")
+				}
+				patterns = append(patterns, fmt.Sprintf(`"%s"::polygon @> $%d::point`, fieldName, index))
+				values = append(values, fmt.Sprintf("(%v, %v)", point["longitude"], point["latitude"]))
+				index = index + 1
+			}
+
+			if text := utils.M(value["$text"]); text != nil {
+				search := utils.M(text["$search"])
+				if search == nil {
+					return nil, errs.E(errs.InvalidQuery, "bad $text: $search, should be object")
+				}
+				term, ok := search["$term"].(string)
+				if ok == false {
+					return nil, errs.E(errs.InvalidQuery, "bad $text: $term, should be string")
+				}
+				if v, ok := search["$caseSensitive"]; ok {
+					if b, ok := v.(bool); ok == false || b {
+						return nil, errs.E(errs.InvalidQuery, "bad $text: $caseSensitive not supported, please use $regex or create a separate lower case column.")
+					}
+				}
+				if v, ok := search["$diacriticSensitive"]; ok {
+					if b, ok := v.(bool); ok == false || b {
+						return nil, errs.E(errs.InvalidQuery, "bad $text: $diacriticSensitive not supported.")
+					}
+				}
+				if v, ok := search["$language"]; ok {
+					language, ok := v.(string)
+					if ok == false {
+						return nil, errs.E(errs.InvalidQuery, "bad $text: $language, should be string")
+					}
+					patterns = append(patterns, fmt.Sprintf(`to_tsvector($%d::regconfig, "%s") @@ plainto_tsquery($%d::regconfig, $%d)`, index, fieldName, index, index+1))
+					scores = append(scores, fmt.Sprintf(`ts_rank(to_tsvector($%d::regconfig, "%s"), plainto_tsquery($%d::regconfig, $%d))`, index, fieldName, index, index+1))
+					values = append(values, language, term)
+					index = index + 2
+				} else {
+					// 未指定语言时使用 english ，与 CreateIndex 中创建的索引保持一致
+					patterns = append(patterns, fmt.Sprintf(`to_tsvector('english', "%s") @@ plainto_tsquery('english', $%d)`, fieldName, index))
+					scores = append(scores, fmt.Sprintf(`ts_rank(to_tsvector('english', "%s"), plainto_tsquery('english', $%d))`, fieldName, index))
+					values = append(values, term)
+					index = index + 1
+				}
+			}
+
+			if regex := utils.S(value["$regex"]); regex != "" && strings.Trim(utils.S(value["$options"]), "s") == "" && regexPrefix(regex) != "" {
+				// 简单的前缀匹配使用 LIKE ，以便使用索引
+				patterns = append(patterns, fmt.Sprintf(`"%s" LIKE $%d`, fieldName, index))
+				values = append(values, escapeLikePattern(regexPrefix(regex))+"%")
+				index = index + 1
+			} else if regex != "" {
 				operator := "~"
 				opts := utils.S(value["$options"])
 				if opts != "" {
@@ -2019,8 +2394,14 @@ func buildWhereClause(schema, query types.M, index int) (*whereClause, error) {
 				}
 
 				regex = processRegexPattern(regex)
+				// 多行模式下 ^ $ 匹配每一行的开头与结尾，对应 postgres 中的 n 选项
+				if strings.Contains(opts, "m") {
+					regex = "(?n)" + regex
+				}
 
-				patterns = append(patterns, fmt.Sprintf(`"%s" %s '%s'`, fieldName, operator, regex))
+				patterns = append(patterns, fmt.Sprintf(`"%s" %s $%d`, fieldName, operator, index))
+				values = append(values, regex)
+				index = index + 1
 			}
 
 			if utils.S(value["__type"]) == "Pointer" {
@@ -2063,7 +2444,7 @@ func buildWhereClause(schema, query types.M, index int) (*whereClause, error) {
 	for i, v := range values {
 		values[i] = transformValue(v)
 	}
-	return &whereClause{strings.Join(patterns, " AND "), values, sorts}, nil
+	return &whereClause{strings.Join(patterns, " AND "), values, sorts, scores}, nil
 }
 
 func removeWhiteSpace(s string) string {
@@ -2084,6 +2465,47 @@ func removeWhiteSpace(s string) string {
 	return s
 }
 
+// regexPrefix 当正则表达式仅为 ^abc 或 ^\Qabc\E 形式的前缀匹配时，返回前缀 abc
+func regexPrefix(s string) string {
+	if strings.HasPrefix(s, "^") == false {
+		return ""
+	}
+	s = s[1:]
+	if strings.HasPrefix(s, `\Q`) && strings.HasSuffix(s, `\E`) {
+		literal := s[2 : len(s)-2]
+		if strings.Contains(literal, `\E`) {
+			return ""
+		}
+		return literal
+	}
+	if strings.ContainsAny(s, `\^$.|?*+()[]{}`) {
+		return ""
+	}
+	return s
+}
+
+// escapeLikePattern 转义 LIKE 中的特殊字符
+func escapeLikePattern(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `%`, `\%`, -1)
+	s = strings.Replace(s, `_`, `\_`, -1)
+	return s
+}
+
+// isAllValuesRegex 检测数组中的元素是否均为正则表达式
+func isAllValuesRegex(values types.S) bool {
+	if len(values) == 0 {
+		return false
+	}
+	for _, v := range values {
+		regex := utils.M(v)
+		if regex == nil || utils.S(regex["$regex"]) == "" {
+			return false
+		}
+	}
+	return true
+}
+
 func processRegexPattern(s string) string {
 	if strings.HasPrefix(s, "^") {
 		return "^" + literalizeRegexPart(s[1:])
@@ -2097,11 +2519,7 @@ func createLiteralRegex(s string) string {
 	chars := strings.Split(s, "")
 	for i, c := range chars {
 		if m, _ := regexp.MatchString(`[0-9a-zA-Z]`, c); m == false {
-			if c == `'` {
-				chars[i] = `''`
-			} else {
-				chars[i] = `\` + c
-			}
+			chars[i] = `\` + c
 		}
 	}
 	return strings.Join(chars, "")
@@ -2139,10 +2557,6 @@ func literalizeRegexPart(s string) string {
 	s = re.ReplaceAllString(s, "")
 	re = regexp.MustCompile(`^\\Q`)
 	s = re.ReplaceAllString(s, "")
-	re = regexp.MustCompile(`([^'])'`)
-	s = re.ReplaceAllString(s, "$1''")
-	re = regexp.MustCompile(`^'([^'])`)
-	s = re.ReplaceAllString(s, "''$1")
 	return s
 }
 
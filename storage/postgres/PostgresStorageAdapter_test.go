@@ -907,6 +907,43 @@ func Test_buildWhereClause(t *testing.T) {
 			},
 			wantErr: nil,
 		},
+		{
+			name: "11.1",
+			args: args{
+				schema: types.M{},
+				query: types.M{
+					"$nor": types.S{
+						types.M{"key": 10},
+						types.M{"key": 20},
+					},
+				},
+				index: 1,
+			},
+			want: &whereClause{
+				pattern: `NOT (COALESCE(("key" = $1), false) OR COALESCE(("key" = $2), false))`,
+				values:  types.S{10, 20},
+				sorts:   []string{},
+			},
+			wantErr: nil,
+		},
+		{
+			name: "11.2",
+			args: args{
+				schema: types.M{},
+				query: types.M{
+					"$nor": types.S{
+						types.M{"key": types.M{"$gt": 10}},
+					},
+				},
+				index: 1,
+			},
+			want: &whereClause{
+				pattern: `NOT (COALESCE(("key" > $1), false))`,
+				values:  types.S{10},
+				sorts:   []string{},
+			},
+			wantErr: nil,
+		},
 		{
 			name: "12",
 			args: args{
@@ -1125,6 +1162,34 @@ func Test_buildWhereClause(t *testing.T) {
 			},
 			wantErr: nil,
 		},
+		{
+			name: "19.1",
+			args: args{
+				schema: types.M{
+					"fields": types.M{
+						"key": types.M{
+							"type":        "Pointer",
+							"targetClass": "Post",
+						},
+					},
+				},
+				query: types.M{
+					"key": types.M{
+						"$in": types.S{
+							types.M{"__type": "Pointer", "className": "Post", "objectId": "1001"},
+							types.M{"__type": "Pointer", "className": "Post", "objectId": "1002"},
+						},
+					},
+				},
+				index: 1,
+			},
+			want: &whereClause{
+				pattern: `"key"  IN ($1,$2)`,
+				values:  types.S{"1001", "1002"},
+				sorts:   []string{},
+			},
+			wantErr: nil,
+		},
 		{
 			name: "20",
 			args: args{
@@ -1143,7 +1208,55 @@ func Test_buildWhereClause(t *testing.T) {
 				index: 1,
 			},
 			want: &whereClause{
-				pattern: `"key" IS NULL`,
+				pattern: `FALSE`,
+				values:  types.S{},
+				sorts:   []string{},
+			},
+			wantErr: nil,
+		},
+		{
+			name: "20.1",
+			args: args{
+				schema: types.M{
+					"fields": types.M{
+						"key": types.M{
+							"type": "String",
+						},
+					},
+				},
+				query: types.M{
+					"key": types.M{
+						"$nin": types.S{},
+					},
+				},
+				index: 1,
+			},
+			want: &whereClause{
+				pattern: `TRUE`,
+				values:  types.S{},
+				sorts:   []string{},
+			},
+			wantErr: nil,
+		},
+		{
+			name: "20.2",
+			args: args{
+				schema: types.M{
+					"fields": types.M{
+						"key": types.M{
+							"type": "Array",
+						},
+					},
+				},
+				query: types.M{
+					"key": types.M{
+						"$in": types.S{},
+					},
+				},
+				index: 1,
+			},
+			want: &whereClause{
+				pattern: `FALSE`,
 				values:  types.S{},
 				sorts:   []string{},
 			},
@@ -1372,8 +1485,8 @@ func Test_buildWhereClause(t *testing.T) {
 				index: 1,
 			},
 			want: &whereClause{
-				pattern: `"key" ~ 'abc'`,
-				values:  types.S{},
+				pattern: `"key" ~ $1`,
+				values:  types.S{"abc"},
 				sorts:   []string{},
 			},
 			wantErr: nil,
@@ -1393,8 +1506,8 @@ func Test_buildWhereClause(t *testing.T) {
 				index: 1,
 			},
 			want: &whereClause{
-				pattern: `"key" ~* 'abc'`,
-				values:  types.S{},
+				pattern: `"key" ~* $1`,
+				values:  types.S{"abc"},
 				sorts:   []string{},
 			},
 			wantErr: nil,
@@ -1414,8 +1527,260 @@ func Test_buildWhereClause(t *testing.T) {
 				index: 1,
 			},
 			want: &whereClause{
-				pattern: `"key" ~ 'abcefg'`,
-				values:  types.S{},
+				pattern: `"key" ~ $1`,
+				values:  types.S{"abcefg"},
+				sorts:   []string{},
+			},
+			wantErr: nil,
+		},
+		{
+			name: "30.1",
+			args: args{
+				schema: types.M{
+					"fields": types.M{},
+				},
+				query: types.M{
+					"key": types.M{
+						"$regex":   `^abc`,
+						"$options": "im",
+					},
+				},
+				index: 1,
+			},
+			want: &whereClause{
+				pattern: `"key" ~* $1`,
+				values:  types.S{"(?n)^abc"},
+				sorts:   []string{},
+			},
+			wantErr: nil,
+		},
+		{
+			name: "30.1.1",
+			args: args{
+				schema: types.M{
+					"fields": types.M{},
+				},
+				query: types.M{
+					"key": types.M{
+						"$regex": `a' OR '1'='1`,
+					},
+				},
+				index: 1,
+			},
+			want: &whereClause{
+				pattern: `"key" ~ $1`,
+				values:  types.S{`a' OR '1'='1`},
+				sorts:   []string{},
+			},
+			wantErr: nil,
+		},
+		{
+			name: "30.2",
+			args: args{
+				schema: types.M{
+					"fields": types.M{},
+				},
+				query: types.M{
+					"key": types.M{
+						"$regex": `^\Qab_c\E`,
+					},
+				},
+				index: 1,
+			},
+			want: &whereClause{
+				pattern: `"key" LIKE $1`,
+				values:  types.S{`ab\_c%`},
+				sorts:   []string{},
+			},
+			wantErr: nil,
+		},
+		{
+			name: "30.3",
+			args: args{
+				schema: types.M{
+					"fields": types.M{
+						"key": types.M{"type": "Array"},
+					},
+				},
+				query: types.M{
+					"key": types.M{
+						"$all": types.S{
+							types.M{"$regex": `^\Qabc\E`},
+							types.M{"$regex": `^efg`, "$options": "i"},
+						},
+					},
+				},
+				index: 1,
+			},
+			want: &whereClause{
+				pattern: `EXISTS (SELECT 1 FROM jsonb_array_elements_text("key") AS e WHERE e ~ $1) AND EXISTS (SELECT 1 FROM jsonb_array_elements_text("key") AS e WHERE e ~* $2)`,
+				values:  types.S{"^abc", "^efg"},
+				sorts:   []string{},
+			},
+			wantErr: nil,
+		},
+		{
+			name: "30.3.1",
+			args: args{
+				schema: types.M{
+					"fields": types.M{
+						"key": types.M{"type": "Array"},
+					},
+				},
+				query: types.M{
+					"key": types.M{
+						"$all": types.S{
+							types.M{"$regex": `''') OR true --`},
+						},
+					},
+				},
+				index: 1,
+			},
+			want: &whereClause{
+				pattern: `EXISTS (SELECT 1 FROM jsonb_array_elements_text("key") AS e WHERE e ~ $1)`,
+				values:  types.S{`''') OR true --`},
+				sorts:   []string{},
+			},
+			wantErr: nil,
+		},
+		{
+			name: "30.4",
+			args: args{
+				schema: types.M{
+					"fields": types.M{
+						"subject": types.M{"type": "String"},
+					},
+				},
+				query: types.M{
+					"subject": types.M{
+						"$text": types.M{"$search": types.M{"$term": "coffee"}},
+					},
+				},
+				index: 1,
+			},
+			want: &whereClause{
+				pattern: `to_tsvector('english', "subject") @@ plainto_tsquery('english', $1)`,
+				values:  types.S{"coffee"},
+				sorts:   []string{},
+				scores:  []string{`ts_rank(to_tsvector('english', "subject"), plainto_tsquery('english', $1))`},
+			},
+			wantErr: nil,
+		},
+		{
+			name: "30.5",
+			args: args{
+				schema: types.M{
+					"fields": types.M{
+						"subject": types.M{"type": "String"},
+					},
+				},
+				query: types.M{
+					"subject": types.M{
+						"$text": types.M{"$search": types.M{"$term": "coffee", "$language": "simple"}},
+					},
+				},
+				index: 1,
+			},
+			want: &whereClause{
+				pattern: `to_tsvector($1::regconfig, "subject") @@ plainto_tsquery($1::regconfig, $2)`,
+				values:  types.S{"simple", "coffee"},
+				sorts:   []string{},
+				scores:  []string{`ts_rank(to_tsvector($1::regconfig, "subject"), plainto_tsquery($1::regconfig, $2))`},
+			},
+			wantErr: nil,
+		},
+		{
+			name: "30.5.1",
+			args: args{
+				schema: types.M{
+					"fields": types.M{
+						"subject": types.M{"type": "String"},
+					},
+				},
+				query: types.M{
+					"$or": types.S{
+						types.M{"key": "hello"},
+						types.M{
+							"subject": types.M{
+								"$text": types.M{"$search": types.M{"$term": "coffee"}},
+							},
+						},
+					},
+				},
+				index: 1,
+			},
+			want: &whereClause{
+				pattern: `("key" = $1 OR to_tsvector('english', "subject") @@ plainto_tsquery('english', $2))`,
+				values:  types.S{"hello", "coffee"},
+				sorts:   []string{},
+				scores:  []string{`ts_rank(to_tsvector('english', "subject"), plainto_tsquery('english', $2))`},
+			},
+			wantErr: nil,
+		},
+		{
+			name: "30.6",
+			args: args{
+				schema: types.M{
+					"fields": types.M{
+						"subject": types.M{"type": "String"},
+					},
+				},
+				query: types.M{
+					"subject": types.M{
+						"$text": types.M{"$search": types.M{"$term": "coffee", "$caseSensitive": true}},
+					},
+				},
+				index: 1,
+			},
+			want:    nil,
+			wantErr: errs.E(errs.InvalidQuery, "bad $text: $caseSensitive not supported, please use $regex or create a separate lower case column."),
+		},
+		{
+			name: "30.7",
+			args: args{
+				schema: types.M{
+					"fields": types.M{
+						"zone": types.M{"type": "Polygon"},
+					},
+				},
+				query: types.M{
+					"zone": types.M{
+						"$geoIntersects": types.M{"$point": types.M{"__type": "GeoPoint", "latitude": 40.0, "longitude": -30.0}},
+					},
+				},
+				index: 1,
+			},
+			want: &whereClause{
+				pattern: `"zone"::polygon @> $1::point`,
+				values:  types.S{"(-30, 40)"},
+				sorts:   []string{},
+			},
+			wantErr: nil,
+		},
+		{
+			name: "30.8",
+			args: args{
+				schema: types.M{
+					"fields": types.M{
+						"location": types.M{"type": "GeoPoint"},
+						"name":     types.M{"type": "String"},
+					},
+				},
+				query: types.M{
+					"location": types.M{
+						"$geoWithin": types.M{
+							"$box": types.S{
+								types.M{"__type": "GeoPoint", "longitude": 20, "latitude": 20},
+								types.M{"__type": "GeoPoint", "longitude": 30, "latitude": 30},
+							},
+						},
+					},
+				},
+				index: 1,
+			},
+			want: &whereClause{
+				pattern: `"location"::point <@ $1::box`,
+				values:  types.S{"((20, 20), (30, 30))"},
 				sorts:   []string{},
 			},
 			wantErr: nil,
@@ -1723,7 +2088,7 @@ func Test_createLiteralRegex(t *testing.T) {
 		{
 			name: "4",
 			args: args{s: "abc'edf'"},
-			want: "abc''edf''",
+			want: `abc\'edf\'`,
 		},
 		{
 			name: "5",
@@ -1815,7 +2180,7 @@ func Test_literalizeRegexPart(t *testing.T) {
 		{
 			name: "14",
 			args: args{s: `'abc'`},
-			want: "''abc''",
+			want: "'abc'",
 		},
 		{
 			name: "15",
@@ -1825,7 +2190,7 @@ func Test_literalizeRegexPart(t *testing.T) {
 		{
 			name: "16",
 			args: args{s: `\Q'abc'\E`},
-			want: "''abc''",
+			want: `\'abc\'`,
 		},
 		{
 			name: "17",
@@ -3205,6 +3570,51 @@ func TestPostgresAdapter_Find(t *testing.T) {
 			initialize: initialize,
 			clean:      clean,
 		},
+		{
+			name: "8.1-sort-score",
+			args: args{
+				className: "post",
+				schema: types.M{
+					"className": "post",
+					"fields":    types.M{"key": types.M{"type": "String"}},
+				},
+				query: types.M{
+					"key": types.M{"$text": types.M{"$search": types.M{"$term": "coffee"}}},
+				},
+				options: types.M{"sort": []string{"$score"}, "limit": 10},
+				dataObjects: []types.M{
+					types.M{"key": "coffee and tea"},
+					types.M{"key": "coffee coffee coffee"},
+					types.M{"key": "green tea"},
+				},
+			},
+			want: []types.M{
+				types.M{"key": "coffee coffee coffee"},
+				types.M{"key": "coffee and tea"},
+			},
+			wantErr:    nil,
+			initialize: initialize,
+			clean:      clean,
+		},
+		{
+			name: "8.2-sort-score-without-text",
+			args: args{
+				className: "post",
+				schema: types.M{
+					"className": "post",
+					"fields":    types.M{"key": types.M{"type": "String"}},
+				},
+				query:   types.M{},
+				options: types.M{"sort": []string{"$score"}},
+				dataObjects: []types.M{
+					types.M{"key": "hello"},
+				},
+			},
+			want:       nil,
+			wantErr:    errs.E(errs.InvalidQuery, "$score sort requires a $text query"),
+			initialize: initialize,
+			clean:      clean,
+		},
 		{
 			name: "9-keys",
 			args: args{
@@ -4970,6 +5380,25 @@ func TestPostgresAdapter_Find(t *testing.T) {
 			initialize: initialize,
 			clean:      clean,
 		},
+		{
+			name: "62-invalid-regex",
+			args: args{
+				className: "post",
+				schema: types.M{
+					"className": "post",
+					"fields":    types.M{"key": types.M{"type": "String"}},
+				},
+				query:   types.M{"key": types.M{"$regex": "joe("}},
+				options: types.M{},
+				dataObjects: []types.M{
+					types.M{"key": "hello"},
+				},
+			},
+			want:       nil,
+			wantErr:    errs.E(errs.InvalidQuery, "Bad $regex value for query: invalid regular expression: parentheses () not balanced"),
+			initialize: initialize,
+			clean:      clean,
+		},
 	}
 	for _, tt := range tests {
 		tt.initialize(tt.args.className, tt.args.schema, tt.args.dataObjects)
@@ -6053,6 +6482,42 @@ func TestPostgresAdapter_EnsureUniqueness(t *testing.T) {
 			},
 			clean: clean,
 		},
+		{
+			name: "4",
+			args: args{
+				className: "_User",
+				schema: types.M{
+					"className": "_User",
+					"fields": types.M{
+						"authData": types.M{"type": "Object"},
+					},
+				},
+				fieldNames: []string{"authData.anonymous.id"},
+			},
+			wantErr:    nil,
+			initialize: initialize,
+			clean:      clean,
+		},
+		{
+			name: "5",
+			args: args{
+				className: "_User",
+				schema: types.M{
+					"className": "_User",
+					"fields": types.M{
+						"authData": types.M{"type": "Object"},
+					},
+				},
+				fieldNames: []string{"authData.anonymous.id"},
+			},
+			wantErr: errs.E(errs.DuplicateValue, "A duplicate value for a field with unique values was provided"),
+			initialize: func(className string, schema types.M) {
+				p.CreateClass(className, schema)
+				p.CreateObject(className, schema, types.M{"objectId": "01", "authData": types.M{"anonymous": types.M{"id": "1001"}}})
+				p.CreateObject(className, schema, types.M{"objectId": "02", "authData": types.M{"anonymous": types.M{"id": "1001"}}})
+			},
+			clean: clean,
+		},
 	}
 	for _, tt := range tests {
 		tt.initialize(tt.args.className, tt.args.schema)
@@ -6063,3 +6528,82 @@ func TestPostgresAdapter_EnsureUniqueness(t *testing.T) {
 		}
 	}
 }
+
+func TestPostgresAdapter_CreateIndex(t *testing.T) {
+	db := openDB()
+	p := NewPostgresAdapter("", db)
+	initialize := func(className string, schema types.M) {
+		p.CreateClass(className, schema)
+	}
+	clean := func(className string) {
+		db.Exec(`DROP TABLE "` + className + `"`)
+		db.Exec(`DROP TABLE "_SCHEMA"`)
+	}
+	schema := types.M{
+		"className": "post",
+		"fields": types.M{
+			"key":  types.M{"type": "String"},
+			"key2": types.M{"type": "String"},
+		},
+	}
+	type args struct {
+		className string
+		schema    types.M
+		indexName string
+		fields    types.M
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr error
+	}{
+		{
+			name: "1",
+			args: args{
+				className: "post",
+				schema:    schema,
+				indexName: "key_1_key2_-1",
+				fields:    types.M{"key": 1.0, "key2": -1.0},
+			},
+			wantErr: nil,
+		},
+		{
+			name: "2",
+			args: args{
+				className: "post",
+				schema:    schema,
+				indexName: "key_text_key2_text",
+				fields:    types.M{"key": "text", "key2": "text"},
+			},
+			wantErr: nil,
+		},
+		{
+			name: "3",
+			args: args{
+				className: "post",
+				schema:    schema,
+				indexName: "key_text_key2_1",
+				fields:    types.M{"key": "text", "key2": 1.0},
+			},
+			wantErr: errs.E(errs.InvalidQuery, "Index key_text_key2_1 cannot mix text and non-text fields"),
+		},
+		{
+			name: "4",
+			args: args{
+				className: "post",
+				schema:    schema,
+				indexName: "key_1_key2_text",
+				fields:    types.M{"key": 1.0, "key2": "text"},
+			},
+			wantErr: errs.E(errs.InvalidQuery, "Index key_1_key2_text cannot mix text and non-text fields"),
+		},
+	}
+	for _, tt := range tests {
+		initialize(tt.args.className, tt.args.schema)
+		err := p.CreateIndex(tt.args.className, tt.args.schema, tt.args.indexName, tt.args.fields)
+		clean(tt.args.className)
+		if reflect.DeepEqual(err, tt.wantErr) == false {
+			t.Errorf("%q. PostgresAdapter.CreateIndex() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
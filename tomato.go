@@ -12,6 +12,8 @@ import (
 	"github.com/lfq7413/tomato/controllers"
 	"github.com/lfq7413/tomato/livequery"
 	"github.com/lfq7413/tomato/orm"
+	"github.com/lfq7413/tomato/push"
+	"github.com/lfq7413/tomato/rest"
 )
 
 // Run ...
@@ -22,6 +24,12 @@ func Run() {
 	// 创建必要的索引
 	orm.TomatoDBController.PerformInitialization()
 
+	// 定期清理已过期的 Session
+	rest.StartSessionCleanup()
+
+	// 加载服务重启前未发送的定时推送
+	push.StartScheduledPush()
+
 	if beego.BConfig.RunMode == "dev" {
 		beego.BConfig.WebConfig.DirectoryIndex = true
 		beego.BConfig.WebConfig.StaticDir["/swagger"] = "swagger"
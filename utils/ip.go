@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"net"
+	"strings"
+)
+
+// ClientIP 获取客户端 IP
+// 只有 remoteAddr 属于 trustedProxies 时才使用 X-Forwarded-For ，从右向左跳过可信代理，返回第一个不可信的地址
+// trustedProxies 中可以是 IP 或者 CIDR
+func ClientIP(remoteAddr, forwardedFor string, trustedProxies []string) string {
+	ip := remoteAddr
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		ip = host
+	}
+	if forwardedFor == "" || isTrustedProxy(ip, trustedProxies) == false {
+		return ip
+	}
+	hops := strings.Split(forwardedFor, ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			// 无法解析的地址不可信，停止向前查找
+			return ip
+		}
+		ip = hop
+		if isTrustedProxy(hop, trustedProxies) == false {
+			return hop
+		}
+	}
+	return ip
+}
+
+// isTrustedProxy 判断 ip 是否属于 trustedProxies
+func isTrustedProxy(ip string, trustedProxies []string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, proxy := range trustedProxies {
+		if strings.Contains(proxy, "/") {
+			if _, network, err := net.ParseCIDR(proxy); err == nil && network.Contains(parsed) {
+				return true
+			}
+		} else if p := net.ParseIP(proxy); p != nil && p.Equal(parsed) {
+			return true
+		}
+	}
+	return false
+}
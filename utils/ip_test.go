@@ -0,0 +1,44 @@
+package utils
+
+import "testing"
+
+func Test_ClientIP(t *testing.T) {
+	var result string
+	proxies := []string{"10.0.0.1", "192.168.0.0/16"}
+	/*****************************************************************/
+	// 不经过可信代理时忽略 X-Forwarded-For
+	result = ClientIP("1.2.3.4:5000", "5.6.7.8", proxies)
+	if result != "1.2.3.4" {
+		t.Error("expect:", "1.2.3.4", "result:", result)
+	}
+	result = ClientIP("1.2.3.4:5000", "5.6.7.8", nil)
+	if result != "1.2.3.4" {
+		t.Error("expect:", "1.2.3.4", "result:", result)
+	}
+	/*****************************************************************/
+	result = ClientIP("10.0.0.1:5000", "5.6.7.8", proxies)
+	if result != "5.6.7.8" {
+		t.Error("expect:", "5.6.7.8", "result:", result)
+	}
+	/*****************************************************************/
+	// 客户端伪造的地址位于最左侧，不会被采用
+	result = ClientIP("10.0.0.1:5000", "9.9.9.9, 5.6.7.8, 192.168.1.2", proxies)
+	if result != "5.6.7.8" {
+		t.Error("expect:", "5.6.7.8", "result:", result)
+	}
+	/*****************************************************************/
+	result = ClientIP("10.0.0.1:5000", "192.168.1.2", proxies)
+	if result != "192.168.1.2" {
+		t.Error("expect:", "192.168.1.2", "result:", result)
+	}
+	/*****************************************************************/
+	result = ClientIP("10.0.0.1:5000", "unknown", proxies)
+	if result != "10.0.0.1" {
+		t.Error("expect:", "10.0.0.1", "result:", result)
+	}
+	/*****************************************************************/
+	result = ClientIP("10.0.0.1:5000", "", proxies)
+	if result != "10.0.0.1" {
+		t.Error("expect:", "10.0.0.1", "result:", result)
+	}
+}